@@ -6,17 +6,23 @@ import (
 	"strconv"
 
 	"tg-robot-sim/pkg/telegram"
+	"tg-robot-sim/server/middleware"
 	"tg-robot-sim/services"
 )
 
 // MiniAppApiService Mini App API 处理器
 type MiniAppApiService struct {
-	productService       services.ProductService
-	walletService        services.WalletService
-	orderService         services.OrderService
-	walletHistoryService services.WalletHistoryService
-	rechargeService      services.RechargeService
-	esimCardService      services.EsimCardService
+	productService         services.ProductService
+	walletService          services.WalletService
+	orderService           services.OrderService
+	walletHistoryService   services.WalletHistoryService
+	rechargeService        services.RechargeService
+	esimCardService        services.EsimCardService
+	withdrawalService      services.WithdrawalService
+	referralService        services.ReferralService
+	starsGateway           services.PaymentGateway
+	eventHub               services.EventHub
+	providerWebhookService services.ProviderWebhookService
 }
 
 // NewMiniAppApiService 创建 Mini App 处理器实例
@@ -27,14 +33,24 @@ func NewMiniAppApiService(
 	walletHistoryService services.WalletHistoryService,
 	rechargeService services.RechargeService,
 	esimCardService services.EsimCardService,
+	withdrawalService services.WithdrawalService,
+	referralService services.ReferralService,
+	starsGateway services.PaymentGateway,
+	eventHub services.EventHub,
+	providerWebhookService services.ProviderWebhookService,
 ) *MiniAppApiService {
 	return &MiniAppApiService{
-		productService:       productService,
-		walletService:        walletService,
-		orderService:         orderService,
-		walletHistoryService: walletHistoryService,
-		rechargeService:      rechargeService,
-		esimCardService:      esimCardService,
+		productService:         productService,
+		walletService:          walletService,
+		orderService:           orderService,
+		walletHistoryService:   walletHistoryService,
+		rechargeService:        rechargeService,
+		esimCardService:        esimCardService,
+		withdrawalService:      withdrawalService,
+		referralService:        referralService,
+		starsGateway:           starsGateway,
+		eventHub:               eventHub,
+		providerWebhookService: providerWebhookService,
 	}
 }
 
@@ -65,7 +81,13 @@ const (
 	ErrCodeProductNotFound     = 40007 // 产品不存在
 	ErrCodeProductUnavailable  = 40008 // 产品暂不可用
 	ErrCodeUnauthorized        = 40100 // 未授权访问
-	ErrCodeInsufficientBalance = 40009 // 余额不足（用于订单创建）
+	ErrCodeInsufficientBalance = 40009 // 余额不足（用于订单创建、转账）
+	ErrCodeInvalidTransfer     = 40010 // 转账收款方无效（不存在或为自己）
+	ErrCodeInvalidAddress      = 40011 // 提现地址无效
+	ErrCodeWithdrawalLimit     = 40012 // 超出每日提现限额
+	ErrCodeInvalidCoupon       = 40013 // 优惠码不可用
+	ErrCodeAssetUnavailable    = 40014 // 充值资产不存在、已停用或未设置汇率
+	ErrCodeGatewayDisabled     = 40015 // 支付渠道未启用
 	ErrCodeNotFound            = 40400 // 资源未找到
 
 	// 服务器错误 (50xxx)
@@ -143,6 +165,12 @@ func (h *MiniAppApiService) getUserIDFromContext(r *http.Request) (int64, error)
 	return 0, nil
 }
 
+// getVerifiedUserID 获取通过 initData 签名校验的用户 ID
+// 不接受 user_id 查询参数，用于转账、提现等必须确认用户身份的接口
+func (h *MiniAppApiService) getVerifiedUserID(r *http.Request) (int64, bool) {
+	return middleware.TelegramUserID(r.Context())
+}
+
 // parseIntParam 解析整数参数
 func (h *MiniAppApiService) parseIntParam(r *http.Request, key string, defaultValue int) int {
 	valueStr := r.URL.Query().Get(key)
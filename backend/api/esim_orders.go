@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -68,7 +69,9 @@ func (h *MiniAppApiService) handleCreateEsimOrder(w http.ResponseWriter, r *http
 	if err != nil {
 		// 根据错误类型返回不同的错误码
 		errMsg := err.Error()
-		if strings.Contains(errMsg, "余额不足") {
+		if errors.Is(err, services.ErrInvalidCoupon) {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidCoupon, errMsg, "")
+		} else if strings.Contains(errMsg, "余额不足") {
 			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInsufficientBalance, errMsg, "")
 		} else if strings.Contains(errMsg, "产品不存在") {
 			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeProductNotFound, errMsg, "")
@@ -86,16 +89,72 @@ func (h *MiniAppApiService) handleCreateEsimOrder(w http.ResponseWriter, r *http
 
 	// 返回订单信息
 	response := map[string]interface{}{
-		"order_id":     order.OrderID,
-		"order_no":     order.OrderNo,
-		"status":       order.Status,
-		"total_amount": order.TotalAmount,
-		"created_at":   order.CreatedAt,
+		"order_id":        order.OrderID,
+		"order_no":        order.OrderNo,
+		"status":          order.Status,
+		"total_amount":    order.TotalAmount,
+		"discount_amount": order.DiscountAmount,
+		"coupon_code":     order.CouponCode,
+		"created_at":      order.CreatedAt,
 	}
 
 	h.sendSuccess(w, response)
 }
 
+// handleEsimOrderQuote 处理 eSIM 订单报价请求（计算优惠后的实付金额）
+func (h *MiniAppApiService) handleEsimOrderQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	ctx := r.Context()
+
+	// 获取用户 ID
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil || userID == 0 {
+		h.sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid user ID")
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		ProductID  int    `json:"product_id"`
+		Quantity   int    `json:"quantity"`
+		CouponCode string `json:"coupon_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	if req.ProductID == 0 {
+		h.sendError(w, http.StatusBadRequest, "Product ID is required", "")
+		return
+	}
+	if req.Quantity <= 0 {
+		h.sendError(w, http.StatusBadRequest, "Quantity must be greater than 0", "")
+		return
+	}
+
+	quote, err := h.orderService.QuoteEsimOrder(ctx, userID, req.ProductID, req.Quantity, req.CouponCode)
+	if err != nil {
+		errMsg := err.Error()
+		if errors.Is(err, services.ErrInvalidCoupon) {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidCoupon, errMsg, "")
+		} else if strings.Contains(errMsg, "产品不存在") {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeProductNotFound, errMsg, "")
+		} else if strings.Contains(errMsg, "产品暂不可用") {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeProductUnavailable, errMsg, "")
+		} else {
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "计算订单金额失败", errMsg)
+		}
+		return
+	}
+
+	h.sendSuccess(w, quote)
+}
+
 // handleGetEsimOrders 处理获取用户 eSIM 订单列表请求
 func (h *MiniAppApiService) handleGetEsimOrders(w http.ResponseWriter, r *http.Request, userID int64) {
 	ctx := r.Context()
@@ -143,6 +202,8 @@ func (h *MiniAppApiService) handleGetEsimOrders(w http.ResponseWriter, r *http.R
 			"quantity":          order.Quantity,
 			"unit_price":        order.UnitPrice,
 			"total_amount":      order.Amount,
+			"discount_amount":   order.DiscountAmount,
+			"coupon_code":       order.CouponCode,
 			"status":            order.Status,
 			"provider_order_id": order.ProviderOrderID,
 			"provider_order_no": order.ProviderOrderNo,
@@ -217,6 +278,8 @@ func (h *MiniAppApiService) handleEsimOrderDetail(w http.ResponseWriter, r *http
 		"quantity":          orderDetail.Quantity,
 		"unit_price":        orderDetail.UnitPrice,
 		"total_amount":      orderDetail.Amount,
+		"discount_amount":   orderDetail.DiscountAmount,
+		"coupon_code":       orderDetail.CouponCode,
 		"status":            orderDetail.Status,
 		"provider_order_id": orderDetail.ProviderOrderID,
 		"provider_order_no": orderDetail.ProviderOrderNo,
@@ -225,6 +288,24 @@ func (h *MiniAppApiService) handleEsimOrderDetail(w http.ResponseWriter, r *http
 		"completed_at":      orderDetail.CompletedAt,
 	}
 
+	// 订单状态时间线，只返回面向用户的字段（不含操作人和第三方原始数据）
+	events, err := h.orderService.GetOrderEvents(ctx, orderDetail.ID)
+	if err != nil {
+		h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "获取订单详情失败", err.Error())
+		return
+	}
+	timeline := make([]map[string]interface{}, 0, len(events))
+	for _, event := range events {
+		timeline = append(timeline, map[string]interface{}{
+			"from_status": event.FromStatus,
+			"to_status":   event.ToStatus,
+			"actor":       event.Actor,
+			"reason":      event.Reason,
+			"created_at":  event.CreatedAt,
+		})
+	}
+	response["events"] = timeline
+
 	h.sendSuccess(w, response)
 }
 
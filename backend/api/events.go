@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// eventStreamHeartbeat 心跳间隔，保持连接不被代理或客户端判定为空闲
+	eventStreamHeartbeat = 15 * time.Second
+	// eventStreamWriteGrace 每次写入后允许的最长阻塞时间（在心跳间隔之外）
+	eventStreamWriteGrace = 10 * time.Second
+	// eventStreamRetry 建议客户端断线后的重连间隔
+	eventStreamRetry = 3 * time.Second
+)
+
+// handleEvents 处理实时事件流请求（Server-Sent Events）
+// 浏览器 EventSource 无法设置请求头，initData 通过 init_data 查询参数传递，由 Telegram 中间件校验。
+// 重连时根据 Last-Event-ID（或 last_event_id 查询参数）补发断线期间的事件；无法完整补发时先发送 resync 事件，客户端应重新拉取状态。
+func (h *MiniAppApiService) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if h.eventHub == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Event stream unavailable", "")
+		return
+	}
+
+	// 用户 ID 只取自校验通过的 initData，事件流不接受 user_id 查询参数
+	userID, ok := h.getVerifiedUserID(r)
+	if !ok {
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized", "Valid Telegram init data required")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, err := h.eventHub.Subscribe(userID, lastEventID)
+	if err != nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Event stream unavailable", err.Error())
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 关闭 Nginx 缓冲
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+	if err := stream.write(fmt.Sprintf("retry: %d\n\n", eventStreamRetry.Milliseconds())); err != nil {
+		return
+	}
+	if sub.Resync {
+		if err := stream.event("", "resync", "{}"); err != nil {
+			return
+		}
+	}
+	for _, event := range sub.Replay {
+		if err := stream.event(event.ID, event.Type, string(event.Data)); err != nil {
+			return
+		}
+	}
+	// ready 事件携带当前游标，之后断线重连不会遗漏订阅期间的事件
+	if err := stream.event(sub.Cursor, "ready", "{}"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// 订阅被断开（消费过慢或服务关闭），客户端重连后补发
+				return
+			}
+			if err := stream.event(event.ID, event.Type, string(event.Data)); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := stream.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventStream SSE 输出
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// event 写入一条事件，data 必须是单行内容（紧凑 JSON）
+func (s *eventStream) event(id, eventType, data string) error {
+	message := ""
+	if id != "" {
+		message += "id: " + id + "\n"
+	}
+	message += "event: " + eventType + "\ndata: " + data + "\n\n"
+	return s.write(message)
+}
+
+// write 写入并立即刷新
+// 每次写入前顺延写超时：http.Server 的 WriteTimeout 从读完请求开始计时，不顺延会按时切断长连接
+func (s *eventStream) write(message string) error {
+	if err := s.rc.SetWriteDeadline(time.Now().Add(eventStreamHeartbeat + eventStreamWriteGrace)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := fmt.Fprint(s.w, message); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"tg-robot-sim/pkg/sdk/esim"
+	"tg-robot-sim/services"
+)
+
+// providerWebhookMaxBody Webhook 请求体大小上限
+const providerWebhookMaxBody = 1 << 20
+
+// handleProviderWebhook 处理 eSIM 第三方 Webhook 推送（订单完成、订单失败、eSIM 使用情况）
+// 处理失败时返回 5xx，第三方可使用新的 nonce 重试；漏推的订单事件由定时同步兜底
+func (h *MiniAppApiService) handleProviderWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if h.providerWebhookService == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Provider webhook not configured", "")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, providerWebhookMaxBody))
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	err = h.providerWebhookService.HandleWebhook(r.Context(), &services.ProviderWebhookRequest{
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Body:      body,
+		Timestamp: r.Header.Get(esim.HeaderTimestamp),
+		Nonce:     r.Header.Get(esim.HeaderNonce),
+		Signature: r.Header.Get(esim.HeaderSignature),
+	})
+	switch {
+	case err == nil:
+		h.sendSuccess(w, nil)
+	case errors.Is(err, services.ErrProviderWebhookUnauthorized):
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid signature", "")
+	case errors.Is(err, services.ErrProviderWebhookReplayed):
+		h.sendError(w, http.StatusConflict, "Replayed request", "")
+	case errors.Is(err, services.ErrProviderWebhookBusy):
+		w.Header().Set("Retry-After", "5")
+		h.sendError(w, http.StatusServiceUnavailable, "Order is being synced, retry later", "")
+	case errors.Is(err, services.ErrProviderWebhookInvalid):
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid event", err.Error())
+	default:
+		h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeInternalError, "Failed to process event", err.Error())
+	}
+}
@@ -1,11 +1,50 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+
+	"tg-robot-sim/pkg/tron"
+	"tg-robot-sim/services"
+	"tg-robot-sim/storage/models"
 )
 
+// rechargeQRScale 充值二维码每个模块的像素数
+const rechargeQRScale = 6
+
+// handleRechargeAssets 处理可充值资产列表请求
+func (h *MiniAppApiService) handleRechargeAssets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	assets, err := h.rechargeService.ListRechargeAssets(r.Context())
+	if err != nil {
+		h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "获取充值资产失败", err.Error())
+		return
+	}
+
+	assetList := make([]map[string]interface{}, 0, len(assets))
+	for _, asset := range assets {
+		assetList = append(assetList, map[string]interface{}{
+			"code":     asset.Code,
+			"symbol":   asset.Symbol,
+			"chain":    asset.Chain,
+			"decimals": asset.Decimals,
+			"usd_rate": asset.UsdRate,
+		})
+	}
+
+	h.sendSuccess(w, map[string]interface{}{
+		"assets": assetList,
+	})
+}
+
 // handleCreateRecharge 处理创建充值订单请求
 func (h *MiniAppApiService) handleCreateRecharge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -25,6 +64,7 @@ func (h *MiniAppApiService) handleCreateRecharge(w http.ResponseWriter, r *http.
 	// 解析请求体
 	var req struct {
 		Amount string `json:"amount"`
+		Asset  string `json:"asset"` // 支付资产代码，为空时使用 USDT-TRC20
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
@@ -38,11 +78,13 @@ func (h *MiniAppApiService) handleCreateRecharge(w http.ResponseWriter, r *http.
 	}
 
 	// 创建充值订单
-	order, err := h.rechargeService.CreateRechargeOrder(ctx, userID, req.Amount)
+	order, err := h.rechargeService.CreateRechargeOrder(ctx, userID, req.Amount, req.Asset)
 	if err != nil {
 		// 根据错误类型返回不同的错误码
 		errMsg := err.Error()
-		if errMsg == "充值金额格式错误" {
+		if errors.Is(err, services.ErrAssetNotFound) || errors.Is(err, services.ErrAssetNotSupported) || errors.Is(err, services.ErrAssetRateUnavailable) {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeAssetUnavailable, errMsg, "")
+		} else if errMsg == "充值金额格式错误" {
 			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidFormat, errMsg, "")
 		} else if strings.Contains(errMsg, "充值金额不能低于") || strings.Contains(errMsg, "充值金额不能超过") {
 			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidAmount, errMsg, "")
@@ -58,16 +100,44 @@ func (h *MiniAppApiService) handleCreateRecharge(w http.ResponseWriter, r *http.
 	response := map[string]interface{}{
 		"order_no":       order.OrderNo,
 		"amount":         order.Amount,
+		"asset":          order.Asset,
+		"rate":           order.Rate,
 		"exact_amount":   order.ExactAmount,
 		"wallet_address": order.WalletAddress,
+		"match_mode":     order.MatchMode,
 		"status":         order.Status,
 		"expires_at":     order.ExpiresAt,
 		"created_at":     order.CreatedAt,
 	}
+	h.addRechargeQRCode(ctx, response, order, r.URL.Query().Get("qr_format"))
 
 	h.sendSuccess(w, response)
 }
 
+// addRechargeQRCode 在响应中加入收款 URI 和本地生成的二维码（data URI），qrFormat 为 svg 时返回 SVG，否则返回 PNG
+// 二维码只是辅助展示，生成失败时不影响订单信息的返回
+func (h *MiniAppApiService) addRechargeQRCode(ctx context.Context, response map[string]interface{}, order *models.RechargeOrder, qrFormat string) {
+	paymentURI, err := h.rechargeService.GetPaymentURI(ctx, order)
+	if err != nil {
+		return
+	}
+	qr, err := tron.EncodeQRCode(paymentURI)
+	if err != nil {
+		return
+	}
+
+	response["payment_uri"] = paymentURI
+	if qrFormat == "svg" {
+		response["qr_code"] = "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(qr.SVG(rechargeQRScale)))
+		return
+	}
+	image, err := qr.PNG(rechargeQRScale)
+	if err != nil {
+		return
+	}
+	response["qr_code"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)
+}
+
 // handleRechargeDetail 处理充值订单详情和状态检查请求
 func (h *MiniAppApiService) handleRechargeDetail(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -125,16 +195,25 @@ func (h *MiniAppApiService) handleRechargeDetail(w http.ResponseWriter, r *http.
 
 		// 返回订单详情
 		response := map[string]interface{}{
-			"order_no":       order.OrderNo,
-			"amount":         order.Amount,
-			"exact_amount":   order.ExactAmount,
-			"wallet_address": order.WalletAddress,
-			"status":         order.Status,
-			"tx_hash":        order.TxHash,
-			"confirmations":  order.Confirmations,
-			"expires_at":     order.ExpiresAt,
-			"confirmed_at":   order.ConfirmedAt,
-			"created_at":     order.CreatedAt,
+			"order_no":        order.OrderNo,
+			"amount":          order.Amount,
+			"asset":           order.Asset,
+			"rate":            order.Rate,
+			"exact_amount":    order.ExactAmount,
+			"wallet_address":  order.WalletAddress,
+			"match_mode":      order.MatchMode,
+			"status":          order.Status,
+			"tx_hash":         order.TxHash,
+			"payment_type":    order.PaymentType,
+			"paid_amount":     order.PaidAmount,
+			"credited_amount": order.CreditedAmount,
+			"confirmations":   order.Confirmations,
+			"expires_at":      order.ExpiresAt,
+			"confirmed_at":    order.ConfirmedAt,
+			"created_at":      order.CreatedAt,
+		}
+		if order.Status == models.RechargeStatusPending {
+			h.addRechargeQRCode(ctx, response, order, r.URL.Query().Get("qr_format"))
 		}
 
 		h.sendSuccess(w, response)
@@ -211,12 +290,14 @@ func (h *MiniAppApiService) handleRechargeHistory(w http.ResponseWriter, r *http
 	var orderList []map[string]interface{}
 	for _, order := range orders {
 		orderData := map[string]interface{}{
-			"order_no":     order.OrderNo,
-			"amount":       order.Amount,
-			"status":       order.Status,
-			"tx_hash":      order.TxHash,
-			"created_at":   order.CreatedAt,
-			"confirmed_at": order.ConfirmedAt,
+			"order_no":        order.OrderNo,
+			"amount":          order.Amount,
+			"credited_amount": order.CreditedAmount,
+			"asset":           order.Asset,
+			"status":          order.Status,
+			"tx_hash":         order.TxHash,
+			"created_at":      order.CreatedAt,
+			"confirmed_at":    order.ConfirmedAt,
 		}
 		orderList = append(orderList, orderData)
 	}
@@ -229,3 +310,59 @@ func (h *MiniAppApiService) handleRechargeHistory(w http.ResponseWriter, r *http
 		"offset": offset,
 	})
 }
+
+// handleCreateStarsRecharge 处理 Telegram Stars 充值请求，返回发票链接供 Mini App 调用 openInvoice 打开
+func (h *MiniAppApiService) handleCreateStarsRecharge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if h.starsGateway == nil {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeGatewayDisabled, "Stars 充值未启用", "")
+		return
+	}
+
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil || userID == 0 {
+		h.sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		Amount string `json:"amount"` // 充值金额（USD）
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if req.Amount == "" {
+		h.sendError(w, http.StatusBadRequest, "Amount is required", "")
+		return
+	}
+
+	invoice, err := h.starsGateway.CreateInvoiceLink(r.Context(), userID, req.Amount)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "充值金额格式错误" {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidFormat, errMsg, "")
+		} else if strings.Contains(errMsg, "充值金额不能低于") || strings.Contains(errMsg, "充值金额不能超过") {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidAmount, errMsg, "")
+		} else {
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeInternalError, "创建 Stars 发票失败", errMsg)
+		}
+		return
+	}
+
+	payment := invoice.Payment
+	h.sendSuccess(w, map[string]interface{}{
+		"payment_no":   payment.PaymentNo,
+		"invoice_link": invoice.InvoiceLink,
+		"currency":     payment.Currency,
+		"stars":        payment.TotalAmount,
+		"amount":       payment.Amount,
+		"rate":         payment.Rate,
+		"status":       payment.Status,
+		"expires_at":   payment.ExpiresAt,
+		"created_at":   payment.CreatedAt,
+	})
+}
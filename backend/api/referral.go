@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+)
+
+// handleReferralInfo 处理邀请信息请求：邀请链接、邀请人数和累计奖励
+func (h *MiniAppApiService) handleReferralInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	ctx := r.Context()
+
+	// 获取用户 ID
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil || userID == 0 {
+		h.sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid user ID")
+		return
+	}
+
+	info, err := h.referralService.GetReferralInfo(ctx, userID)
+	if err != nil {
+		h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "获取邀请信息失败", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, info)
+}
@@ -10,21 +10,39 @@ func (h *MiniAppApiService) RegisterRoutes(mux *http.ServeMux) {
 
 	// 钱包相关
 	mux.HandleFunc("/api/miniapp/wallet/balance", h.handleWalletBalance)
+	mux.HandleFunc("/api/miniapp/wallet/transfer", h.handleWalletTransfer)
+	mux.HandleFunc("/api/miniapp/wallet/statement", h.handleWalletStatement)
 
 	// 充值相关
 	mux.HandleFunc("/api/miniapp/wallet/recharge", h.handleCreateRecharge)
 	mux.HandleFunc("/api/miniapp/wallet/recharge/", h.handleRechargeDetail)
 	mux.HandleFunc("/api/miniapp/wallet/recharge/history", h.handleRechargeHistory)
+	mux.HandleFunc("/api/miniapp/wallet/recharge/assets", h.handleRechargeAssets)
+	mux.HandleFunc("/api/miniapp/wallet/recharge/stars", h.handleCreateStarsRecharge)
+
+	// 提现相关
+	mux.HandleFunc("/api/miniapp/wallet/withdrawals", h.handleWithdrawals)
+	mux.HandleFunc("/api/miniapp/wallet/withdrawals/", h.handleWithdrawalDetail)
+
+	// 邀请相关
+	mux.HandleFunc("/api/miniapp/referral", h.handleReferralInfo)
 
 	// eSIM 订单相关
 	mux.HandleFunc("/api/miniapp/esim/orders", h.handleEsimOrders)
 	mux.HandleFunc("/api/miniapp/esim/orders/", h.handleEsimOrderDetail)
+	mux.HandleFunc("/api/miniapp/esim/quote", h.handleEsimOrderQuote)
 
 	// eSIM 卡相关
 	mux.HandleFunc("/api/miniapp/esim/cards", h.handleEsimCards)
 
+	// 实时事件推送（SSE）
+	mux.HandleFunc("/api/miniapp/events", h.handleEvents)
+
 	// 钱包历史相关
 	mux.HandleFunc("/api/miniapp/wallet/history", h.handleWalletHistory)
 	mux.HandleFunc("/api/miniapp/wallet/history/stats", h.handleWalletHistoryStats)
 	mux.HandleFunc("/api/miniapp/wallet/history/", h.handleHistoryRecord)
+
+	// 第三方 Webhook（签名校验，不需要 Telegram 身份）
+	mux.HandleFunc("/api/provider/webhook", h.handleProviderWebhook)
 }
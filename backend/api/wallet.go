@@ -1,10 +1,13 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"tg-robot-sim/services"
 	"tg-robot-sim/storage/models"
@@ -49,6 +52,77 @@ func (h *MiniAppApiService) handleWalletBalance(w http.ResponseWriter, r *http.R
 	h.sendSuccess(w, response)
 }
 
+// handleWalletTransfer 处理用户间转账请求
+func (h *MiniAppApiService) handleWalletTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	ctx := r.Context()
+
+	// 转账只接受经过签名校验的用户身份
+	userID, ok := h.getVerifiedUserID(r)
+	if !ok {
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized", "Valid Telegram init data required")
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		ToUserID int64  `json:"to_user_id"`
+		Amount   string `json:"amount"`
+		Memo     string `json:"memo"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	if req.ToUserID == 0 {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "收款方不能为空", "")
+		return
+	}
+	if req.Amount == "" {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "转账金额不能为空", "")
+		return
+	}
+
+	// 执行转账
+	result, err := h.walletService.Transfer(ctx, userID, req.ToUserID, req.Amount, req.Memo)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInsufficientBalance):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInsufficientBalance, "余额不足", "")
+		case errors.Is(err, services.ErrInvalidTransferAmount):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidFormat, "转账金额必须大于 0 且最多两位小数", "")
+		case errors.Is(err, services.ErrTransferToSelf):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidTransfer, "不能给自己转账", "")
+		case errors.Is(err, services.ErrTransferRecipientNotFound):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidTransfer, "收款方不存在", "")
+		case errors.Is(err, services.ErrTransferMemoTooLong):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "转账备注过长", err.Error())
+		default:
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeBalanceUpdate, "转账失败", err.Error())
+		}
+		return
+	}
+
+	// 返回转账结果
+	response := map[string]interface{}{
+		"transferNo": result.TransferNo,
+		"toUserId":   fmt.Sprintf("%d", result.ToUserID),
+		"toName":     result.ToName,
+		"amount":     parseFloat(result.Amount),
+		"memo":       result.Memo,
+		"balance":    parseFloat(result.FromBalance),
+		"currency":   "USDT",
+		"createdAt":  result.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+
+	h.sendSuccess(w, response)
+}
+
 // handleWalletHistory 处理钱包历史记录请求
 func (h *MiniAppApiService) handleWalletHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -94,6 +168,62 @@ func (h *MiniAppApiService) handleWalletHistory(w http.ResponseWriter, r *http.R
 	h.sendSuccess(w, response)
 }
 
+// handleWalletStatement 处理钱包对账单导出请求
+// GET /api/miniapp/wallet/statement?from=YYYY-MM-DD&to=YYYY-MM-DD&format=csv|pdf
+func (h *MiniAppApiService) handleWalletStatement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	ctx := r.Context()
+
+	// 获取用户 ID
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil || userID == 0 {
+		h.sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid user ID")
+		return
+	}
+
+	query := r.URL.Query()
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = services.StatementFormatPDF
+	}
+	if format != services.StatementFormatCSV && format != services.StatementFormatPDF {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "format 只支持 csv 或 pdf", "")
+		return
+	}
+
+	from, to, err := services.ParseStatementPeriod(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), "")
+		return
+	}
+
+	statement, err := h.walletHistoryService.GetWalletStatement(ctx, userID, from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatementPeriod) {
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), "")
+		} else {
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "生成对账单失败", err.Error())
+		}
+		return
+	}
+
+	content, contentType, err := services.RenderWalletStatement(statement, format)
+	if err != nil {
+		h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeInternalError, "生成对账单失败", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", services.StatementFileName(statement, format)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
 // handleWalletHistoryStats 处理钱包历史统计请求
 func (h *MiniAppApiService) handleWalletHistoryStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
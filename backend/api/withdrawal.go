@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"tg-robot-sim/services"
+	"tg-robot-sim/storage/models"
+)
+
+// handleWithdrawals 处理提现申请列表和创建提现申请请求
+func (h *MiniAppApiService) handleWithdrawals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleWithdrawalHistory(w, r)
+	case http.MethodPost:
+		h.handleCreateWithdrawal(w, r)
+	default:
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+	}
+}
+
+// handleCreateWithdrawal 处理创建提现申请请求
+func (h *MiniAppApiService) handleCreateWithdrawal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 提现只接受经过签名校验的用户身份
+	userID, ok := h.getVerifiedUserID(r)
+	if !ok {
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized", "Valid Telegram init data required")
+		return
+	}
+
+	// 解析请求体
+	var req struct {
+		Amount    string `json:"amount"`
+		ToAddress string `json:"to_address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	if req.Amount == "" {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "提现金额不能为空", "")
+		return
+	}
+	if req.ToAddress == "" {
+		h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "提现地址不能为空", "")
+		return
+	}
+
+	// 创建提现申请
+	withdrawal, err := h.withdrawalService.CreateWithdrawal(ctx, userID, req.Amount, req.ToAddress)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInsufficientBalance):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInsufficientBalance, "余额不足", "")
+		case errors.Is(err, services.ErrInvalidWithdrawalAmount):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidAmount, "提现金额无效", err.Error())
+		case errors.Is(err, services.ErrInvalidWithdrawalAddress):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeInvalidAddress, "提现地址无效", "")
+		case errors.Is(err, services.ErrWithdrawalDailyLimitExceeded):
+			h.sendErrorWithCode(w, http.StatusBadRequest, ErrCodeWithdrawalLimit, "超出每日提现限额", "")
+		default:
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "创建提现申请失败", err.Error())
+		}
+		return
+	}
+
+	h.sendSuccess(w, withdrawalResponse(withdrawal))
+}
+
+// handleWithdrawalHistory 处理提现申请列表请求
+func (h *MiniAppApiService) handleWithdrawalHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 提现只接受经过签名校验的用户身份
+	userID, ok := h.getVerifiedUserID(r)
+	if !ok {
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized", "Valid Telegram init data required")
+		return
+	}
+
+	// 获取查询参数
+	limit := h.parseIntParam(r, "limit", 20)
+	offset := h.parseIntParam(r, "offset", 0)
+
+	withdrawals, total, err := h.withdrawalService.GetUserWithdrawals(ctx, userID, limit, offset)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to get withdrawals", err.Error())
+		return
+	}
+
+	usage, err := h.withdrawalService.GetDailyUsage(ctx, userID)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to get withdrawal limit", err.Error())
+		return
+	}
+
+	withdrawalList := make([]map[string]interface{}, 0, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		withdrawalList = append(withdrawalList, withdrawalResponse(withdrawal))
+	}
+
+	// 返回响应
+	h.sendSuccess(w, map[string]interface{}{
+		"withdrawals":     withdrawalList,
+		"total":           total,
+		"limit":           limit,
+		"offset":          offset,
+		"daily_limit":     usage.Limit,
+		"daily_used":      usage.Used,
+		"daily_remaining": usage.Remaining,
+	})
+}
+
+// handleWithdrawalDetail 处理提现申请详情请求
+func (h *MiniAppApiService) handleWithdrawalDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	ctx := r.Context()
+
+	// 提现只接受经过签名校验的用户身份
+	userID, ok := h.getVerifiedUserID(r)
+	if !ok {
+		h.sendErrorWithCode(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized", "Valid Telegram init data required")
+		return
+	}
+
+	// 从 URL 路径提取提现单号：/api/miniapp/wallet/withdrawals/WDR17308000001234
+	withdrawalNo := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/miniapp/wallet/withdrawals/"), "/")
+	if withdrawalNo == "" {
+		h.sendError(w, http.StatusBadRequest, "Withdrawal number is required", "")
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.GetWithdrawal(ctx, userID, withdrawalNo)
+	if err != nil {
+		if errors.Is(err, services.ErrWithdrawalNotFound) {
+			h.sendErrorWithCode(w, http.StatusNotFound, ErrCodeNotFound, "提现申请不存在", "")
+		} else {
+			h.sendErrorWithCode(w, http.StatusInternalServerError, ErrCodeDatabaseError, "获取提现申请失败", err.Error())
+		}
+		return
+	}
+
+	h.sendSuccess(w, withdrawalResponse(withdrawal))
+}
+
+// withdrawalResponse 转换提现申请数据格式
+func withdrawalResponse(withdrawal *models.WithdrawalRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"withdrawal_no": withdrawal.WithdrawalNo,
+		"amount":        withdrawal.Amount,
+		"to_address":    withdrawal.ToAddress,
+		"status":        withdrawal.Status,
+		"tx_hash":       withdrawal.TxHash,
+		"reject_reason": withdrawal.RejectReason,
+		"reviewed_at":   withdrawal.ReviewedAt,
+		"created_at":    withdrawal.CreatedAt,
+	}
+}
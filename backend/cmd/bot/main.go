@@ -91,7 +91,7 @@ func main() {
 	// appLogger.Info("TRON client initialized")
 
 	// 初始化区块链服务
-	// blockchainService := services.NewBlockchainService(tronClient, &cfg.Blockchain, appLogger)
+	// blockchainService := services.NewBlockchainService(tronClient, &cfg.Blockchain, tronAssets, appLogger)
 	// appLogger.Info("Blockchain service initialized")
 
 	// 初始化菜单服务
@@ -124,8 +124,39 @@ func main() {
 	}
 
 	// 初始化通知服务
-	// notificationService := services.NewNotificationService(telegramBot.GetAPI(), appLogger)
-	// appLogger.Info("Notification service initialized")
+	notificationService := services.NewNotificationService(telegramBot.GetAPI(), appLogger, cfg.Telegram.AdminUserIDs)
+	appLogger.Info("Notification service initialized")
+
+	// 初始化钱包服务（用户间转账）
+	ledgerService := services.NewLedgerService(
+		db.GetDB(),
+		db.GetLedgerRepository(),
+		db.GetWalletRepository(),
+	)
+	walletHistoryService := services.NewWalletHistoryService(db.GetWalletHistoryRepository())
+	walletService := services.NewWalletService(
+		db.GetWalletRepository(),
+		db.GetRechargeOrderRepository(),
+		nil,
+		walletHistoryService,
+		ledgerService,
+		db.GetUserRepository(),
+		notificationService,
+	)
+	appLogger.Info("Wallet service initialized")
+
+	// 初始化邀请服务
+	referralService := services.NewReferralService(
+		db.GetUserRepository(),
+		db.GetOrderRepository(),
+		db.GetWalletRepository(),
+		db.GetWalletHistoryRepository(),
+		ledgerService,
+		notificationService,
+		&cfg.Referral,
+		telegramBot.GetAPI().Self.UserName,
+	)
+	appLogger.Info("Referral service initialized")
 
 	// 注册中间件
 	registry := telegramBot.GetRegistry()
@@ -178,7 +209,7 @@ func main() {
 	}
 
 	// 注册命令处理器
-	startHandler := botHandlers.NewStartHandler(telegramBot.GetAPI(), db.GetUserRepository(), dialogService, productsHandler, cfg)
+	startHandler := botHandlers.NewStartHandler(telegramBot.GetAPI(), db.GetUserRepository(), dialogService, productsHandler, cfg, referralService)
 	if err := registry.RegisterCommandHandler(startHandler); err != nil {
 		appLogger.Error("Failed to register start handler: %v", err)
 		log.Fatalf("Failed to register start handler: %v", err)
@@ -196,6 +227,56 @@ func main() {
 		log.Fatalf("Failed to register menu handler: %v", err)
 	}
 
+	transferHandler := botHandlers.NewTransferHandler(telegramBot.GetAPI(), walletService, db.GetUserRepository(), appLogger)
+	if err := registry.RegisterCommandHandler(transferHandler); err != nil {
+		appLogger.Error("Failed to register transfer command handler: %v", err)
+		log.Fatalf("Failed to register transfer command handler: %v", err)
+	}
+	if err := registry.RegisterCallbackHandler(transferHandler); err != nil {
+		appLogger.Error("Failed to register transfer callback handler: %v", err)
+		log.Fatalf("Failed to register transfer callback handler: %v", err)
+	}
+
+	// 邀请处理器需在通用回调处理器之前注册
+	referralHandler := botHandlers.NewReferralHandler(telegramBot.GetAPI(), referralService, appLogger)
+	if err := registry.RegisterCommandHandler(referralHandler); err != nil {
+		appLogger.Error("Failed to register referral command handler: %v", err)
+		log.Fatalf("Failed to register referral command handler: %v", err)
+	}
+	if err := registry.RegisterCallbackHandler(referralHandler); err != nil {
+		appLogger.Error("Failed to register referral callback handler: %v", err)
+		log.Fatalf("Failed to register referral callback handler: %v", err)
+	}
+
+	// 注册对账单处理器
+	statementHandler := botHandlers.NewStatementHandler(telegramBot.GetAPI(), walletHistoryService, appLogger)
+	if err := registry.RegisterCommandHandler(statementHandler); err != nil {
+		appLogger.Error("Failed to register statement command handler: %v", err)
+		log.Fatalf("Failed to register statement command handler: %v", err)
+	}
+
+	// 注册 Telegram Stars 充值处理器（命令 + 预结账/支付成功回调）
+	if cfg.Stars.Enabled {
+		starsGateway := services.NewStarsGateway(
+			db.GetGatewayPaymentRepository(),
+			ledgerService,
+			notificationService,
+			services.NewDBEventPublisher(db.GetUserEventRepository()),
+			telegramBot.GetAPI(),
+			&cfg.Stars,
+			db.GetDB(),
+		)
+		starsHandler := botHandlers.NewStarsHandler(telegramBot.GetAPI(), starsGateway, appLogger)
+		if err := registry.RegisterCommandHandler(starsHandler); err != nil {
+			appLogger.Error("Failed to register stars command handler: %v", err)
+			log.Fatalf("Failed to register stars command handler: %v", err)
+		}
+		if err := registry.RegisterPaymentHandler(starsHandler); err != nil {
+			appLogger.Error("Failed to register stars payment handler: %v", err)
+			log.Fatalf("Failed to register stars payment handler: %v", err)
+		}
+	}
+
 	// 注册消息处理器
 	messageHandler := handlers.NewGeneralMessageHandler(telegramBot.GetAPI(), dialogService)
 	if err := registry.RegisterMessageHandler(messageHandler); err != nil {
@@ -11,8 +11,12 @@ import (
 	"strings"
 	"time"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
 	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/logger"
 	"tg-robot-sim/pkg/sdk/esim"
+	"tg-robot-sim/services"
 	"tg-robot-sim/storage/data"
 	"tg-robot-sim/storage/models"
 	"tg-robot-sim/storage/repository"
@@ -23,12 +27,25 @@ const (
 	cmdSyncProductDetails = "sync-product-details"
 	cmdListProducts       = "list-products"
 	cmdAddBalance         = "add-balance"
+	cmdReconcileWallets   = "reconcile-wallets"
+	cmdListWithdrawals    = "list-withdrawals"
+	cmdApproveWithdrawal  = "approve-withdrawal"
+	cmdRejectWithdrawal   = "reject-withdrawal"
+	cmdCreateCoupon       = "create-coupon"
+	cmdListCoupons        = "list-coupons"
+	cmdDisableCoupon      = "disable-coupon"
+	cmdListAssets         = "list-assets"
+	cmdSetAssetRate       = "set-asset-rate"
+	cmdListOrphanDeposits = "list-orphan-deposits"
+	cmdAssignOrphan       = "assign-orphan-deposit"
+	cmdRefundStars        = "refund-stars"
+	cmdOrderEvents        = "order-events"
 	cmdHelp               = "help"
 )
 
 func main() {
 	// 定义命令行参数
-	command := flag.String("cmd", "", "命令: sync-products, list-products, sync-product-details, add-balance, help")
+	command := flag.String("cmd", "", "命令: sync-products, list-products, sync-product-details, add-balance, reconcile-wallets, list-withdrawals, approve-withdrawal, reject-withdrawal, create-coupon, list-coupons, disable-coupon, list-assets, set-asset-rate, list-orphan-deposits, assign-orphan-deposit, refund-stars, order-events, help")
 	configPath := flag.String("config", "config/config.json", "配置文件路径")
 	productType := flag.String("type", "", "产品类型: local, regional, global (可选)")
 	limit := flag.Int("limit", 0, "限制数量 (0 表示全部)")
@@ -38,6 +55,34 @@ func main() {
 	amount := flag.String("amount", "", "金额 (例如: 100.00)")
 	reason := flag.String("reason", "管理员手动充值", "充值原因")
 
+	// 对账相关参数
+	fix := flag.Bool("fix", false, "写入调整分录修正对账差异 (用于 reconcile-wallets)")
+
+	// 提现审核相关参数
+	withdrawalNo := flag.String("no", "", "提现单号 (用于 approve-withdrawal, reject-withdrawal)；Stars 支付单号 (用于 refund-stars)；订单号 (用于 order-events)")
+	txHash := flag.String("tx-hash", "", "打款交易哈希 (用于 approve-withdrawal)")
+	status := flag.String("status", string(models.WithdrawalStatusPending), "提现状态: pending, approved, rejected, all (用于 list-withdrawals)")
+
+	// 优惠券相关参数
+	couponCode := flag.String("code", "", "优惠码 (用于 create-coupon, disable-coupon)")
+	couponName := flag.String("name", "", "优惠券名称 (用于 create-coupon，可选)")
+	discountType := flag.String("discount-type", string(models.CouponDiscountPercentage), "折扣类型: percentage, fixed (用于 create-coupon)")
+	discountValue := flag.String("value", "", "折扣值：百分比或立减金额 (用于 create-coupon)")
+	maxDiscount := flag.String("max-discount", "0", "最高优惠金额，仅按比例折扣 (用于 create-coupon，0 表示不限)")
+	minSpend := flag.String("min-spend", "0", "最低消费金额 (用于 create-coupon，0 表示不限)")
+	countries := flag.String("countries", "", "适用国家代码，逗号分隔 (用于 create-coupon，为空表示不限)")
+	usageLimit := flag.Int("usage-limit", 0, "总使用次数上限 (用于 create-coupon，0 表示不限)")
+	perUserLimit := flag.Int("per-user-limit", 1, "每个用户使用次数上限 (用于 create-coupon，0 表示不限)")
+	startsAt := flag.String("starts", "", "生效日期 YYYY-MM-DD (用于 create-coupon，可选)")
+	expiresAt := flag.String("expires", "", "过期日期 YYYY-MM-DD，当天结束后失效 (用于 create-coupon，可选)")
+
+	// 资产相关参数
+	assetCode := flag.String("asset", "", "资产代码，如 TRX, USDT-TRC20 (用于 set-asset-rate)")
+	rate := flag.String("rate", "", "1 单位资产折合的美元金额 (用于 set-asset-rate)")
+
+	// 孤儿充值相关参数
+	orphanID := flag.Uint("id", 0, "孤儿充值 ID (用于 assign-orphan-deposit)")
+
 	flag.Parse()
 
 	if *command == "" || *command == cmdHelp {
@@ -77,6 +122,104 @@ func main() {
 		if err := addBalance(ctx, db, *userID, *amount, *reason); err != nil {
 			log.Fatalf("增加余额失败: %v", err)
 		}
+	case cmdReconcileWallets:
+		fixReason := "钱包对账修正"
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "reason" {
+				fixReason = *reason
+			}
+		})
+		if err := reconcileWallets(ctx, db, *userID, *fix, fixReason); err != nil {
+			log.Fatalf("钱包对账失败: %v", err)
+		}
+	case cmdListWithdrawals:
+		if err := listWithdrawals(ctx, db, *status, *limit); err != nil {
+			log.Fatalf("列出提现申请失败: %v", err)
+		}
+	case cmdApproveWithdrawal:
+		if err := approveWithdrawal(ctx, cfg, db, *withdrawalNo, *txHash); err != nil {
+			log.Fatalf("审核提现申请失败: %v", err)
+		}
+	case cmdRejectWithdrawal:
+		// -reason 默认值用于充值，拒绝提现必须显式给出原因
+		rejectReason := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "reason" {
+				rejectReason = *reason
+			}
+		})
+		if err := rejectWithdrawal(ctx, cfg, db, *withdrawalNo, rejectReason); err != nil {
+			log.Fatalf("拒绝提现申请失败: %v", err)
+		}
+	case cmdCreateCoupon:
+		coupon := &models.Coupon{
+			Code:          *couponCode,
+			Name:          *couponName,
+			DiscountType:  models.CouponDiscountType(*discountType),
+			DiscountValue: *discountValue,
+			MaxDiscount:   *maxDiscount,
+			MinSpend:      *minSpend,
+			ProductTypes:  *productType,
+			Countries:     *countries,
+			UsageLimit:    *usageLimit,
+			PerUserLimit:  *perUserLimit,
+		}
+		if err := createCoupon(ctx, db, coupon, *startsAt, *expiresAt); err != nil {
+			log.Fatalf("创建优惠券失败: %v", err)
+		}
+	case cmdListCoupons:
+		// -status 默认值用于提现，只有显式指定时才按优惠券状态过滤
+		couponStatus := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "status" {
+				couponStatus = *status
+			}
+		})
+		if err := listCoupons(ctx, db, couponStatus, *limit); err != nil {
+			log.Fatalf("列出优惠券失败: %v", err)
+		}
+	case cmdDisableCoupon:
+		if err := disableCoupon(ctx, db, *couponCode); err != nil {
+			log.Fatalf("停用优惠券失败: %v", err)
+		}
+	case cmdListAssets:
+		if err := listAssets(ctx, db); err != nil {
+			log.Fatalf("列出资产失败: %v", err)
+		}
+	case cmdSetAssetRate:
+		if err := setAssetRate(ctx, db, *assetCode, *rate); err != nil {
+			log.Fatalf("设置资产汇率失败: %v", err)
+		}
+	case cmdListOrphanDeposits:
+		if err := listOrphanDeposits(ctx, db, *status, *limit); err != nil {
+			log.Fatalf("列出孤儿充值失败: %v", err)
+		}
+	case cmdAssignOrphan:
+		// -reason 默认值用于充值，分配孤儿充值必须显式说明核实依据
+		assignNote := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "reason" {
+				assignNote = *reason
+			}
+		})
+		if err := assignOrphanDeposit(ctx, db, *orphanID, *userID, assignNote); err != nil {
+			log.Fatalf("分配孤儿充值失败: %v", err)
+		}
+	case cmdRefundStars:
+		// -reason 默认值用于充值，退款必须显式给出原因
+		refundReason := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "reason" {
+				refundReason = *reason
+			}
+		})
+		if err := refundStars(ctx, cfg, db, *withdrawalNo, refundReason); err != nil {
+			log.Fatalf("Stars 退款失败: %v", err)
+		}
+	case cmdOrderEvents:
+		if err := showOrderEvents(ctx, db, *withdrawalNo); err != nil {
+			log.Fatalf("查询订单事件失败: %v", err)
+		}
 	default:
 		fmt.Printf("未知命令: %s\n", *command)
 		printHelp()
@@ -451,19 +594,24 @@ func addBalance(ctx context.Context, db *data.Database, userID int64, amount str
 	}
 	fmt.Printf("✓ 当前余额: %s USDT\n", wallet.Balance)
 
-	// 3. 计算新余额
-	balanceBefore := wallet.Balance
-	newBalance, err := addDecimal(balanceBefore, amount)
+	// 3. 通过账本入账（借 充值清算，贷 用户可用余额），钱包余额随分录刷新
+	relatedID := fmt.Sprintf("admin-recharge-%d", time.Now().Unix())
+	ledgerService := services.NewLedgerService(db.GetDB(), db.GetLedgerRepository(), walletRepo)
+	result, err := ledgerService.Post(ctx, services.NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeAdjustment,
+		models.LedgerAccountDepositClearing,
+		models.LedgerAccountUserAvailable,
+		amount,
+		relatedID,
+		reason,
+	))
 	if err != nil {
-		return fmt.Errorf("计算余额失败: %w", err)
-	}
-
-	// 4. 更新钱包余额
-	wallet.Balance = newBalance
-	if err := walletRepo.Update(ctx, wallet); err != nil {
 		return fmt.Errorf("更新钱包失败: %w", err)
 	}
-	fmt.Printf("✓ 更新余额: %s USDT → %s USDT\n", balanceBefore, newBalance)
+	balanceBefore := result.WalletBefore.Balance
+	newBalance := result.WalletAfter.Balance
+	fmt.Printf("✓ 更新余额: %s USDT → %s USDT (分录 ID: %d)\n", balanceBefore, newBalance, result.Entry.ID)
 
 	// 5. 创建钱包历史记录
 	history := &models.WalletHistory{
@@ -473,7 +621,7 @@ func addBalance(ctx context.Context, db *data.Database, userID int64, amount str
 		BalanceBefore: balanceBefore,
 		BalanceAfter:  newBalance,
 		Status:        models.WalletHistoryStatusCompleted,
-		RelatedID:     fmt.Sprintf("admin-recharge-%d", time.Now().Unix()),
+		RelatedID:     relatedID,
 		TxHash:        "",
 		Description:   reason,
 	}
@@ -495,20 +643,511 @@ func addBalance(ctx context.Context, db *data.Database, userID int64, amount str
 	return nil
 }
 
-// addDecimal 将两个十进制字符串相加
-func addDecimal(a, b string) (string, error) {
-	// 简单实现：转换为 float64 计算
-	// 注意：在生产环境中应该使用 decimal 库以避免精度问题
-	var aFloat, bFloat float64
-	if _, err := fmt.Sscanf(a, "%f", &aFloat); err != nil {
-		return "", fmt.Errorf("解析金额 %s 失败: %w", a, err)
+// reconcileWallets 钱包对账，可选写入调整分录修正差异
+func reconcileWallets(ctx context.Context, db *data.Database, userID int64, fix bool, reason string) error {
+	ledgerService := services.NewLedgerService(db.GetDB(), db.GetLedgerRepository(), db.GetWalletRepository())
+	reconciliationService := services.NewReconciliationService(
+		db.GetWalletRepository(),
+		db.GetWalletHistoryRepository(),
+		db.GetRechargeOrderRepository(),
+		db.GetOrderRepository(),
+		db.GetWithdrawalRepository(),
+		db.GetLedgerRepository(),
+		ledgerService,
+	)
+
+	var discrepancies []*services.WalletReconciliation
+	if userID != 0 {
+		fmt.Printf("开始对账用户 %d 的钱包...\n\n", userID)
+		result, err := reconciliationService.ReconcileUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if result.HasDrift() {
+			discrepancies = append(discrepancies, result)
+		} else {
+			fmt.Printf("✓ 用户 %d 钱包无差异 (可用: %s, 冻结: %s)\n", userID, result.WalletBalance, result.WalletFrozen)
+		}
+	} else {
+		fmt.Println("开始对账所有钱包...")
+		report, err := reconciliationService.ReconcileAll(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ 已检查 %d 个钱包，发现 %d 个差异\n\n", report.WalletsCount, len(report.Discrepancies))
+		discrepancies = report.Discrepancies
+	}
+
+	if len(discrepancies) == 0 {
+		return nil
+	}
+
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	fmt.Printf("%-14s %-10s %-16s %-16s %-16s %-16s\n", "用户ID", "科目", "期望", "账本", "钱包", "差额")
+	for _, d := range discrepancies {
+		fmt.Printf("%-14d %-10s %-16s %-16s %-16s %-16s\n", d.UserID, "可用", d.ExpectedBalance, d.LedgerBalance, d.WalletBalance, d.BalanceDiff)
+		fmt.Printf("%-14s %-10s %-16s %-16s %-16s %-16s\n", "", "冻结", d.ExpectedFrozen, d.LedgerFrozen, d.WalletFrozen, d.FrozenDiff)
+		fmt.Printf("%-14s 回放: %d 条历史, %d 笔充值, %d 笔订单, %d 笔提现\n", "", d.HistoryRows, d.RechargeOrders, d.Orders, d.Withdrawals)
+	}
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+
+	if !fix {
+		fmt.Println("\n使用 -fix 写入调整分录修正以上差异")
+		return nil
+	}
+
+	operator := gmOperator()
+
+	failed := 0
+	for _, d := range discrepancies {
+		entry, err := reconciliationService.FixDiscrepancy(ctx, d, operator, reason)
+		if err != nil {
+			fmt.Printf("✗ 修正用户 %d 失败: %v\n", d.UserID, err)
+			failed++
+			continue
+		}
+		if entry != nil {
+			fmt.Printf("✓ 修正用户 %d (分录 ID: %d)\n", d.UserID, entry.ID)
+		} else {
+			fmt.Printf("✓ 修正用户 %d (按账本刷新钱包缓存)\n", d.UserID)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d 个钱包修正失败", failed)
+	}
+	return nil
+}
+
+// newWithdrawalService 创建提现审核用的服务，配置了 Bot Token 时会通知用户审核结果
+func newWithdrawalService(cfg *config.Config, db *data.Database) services.WithdrawalService {
+	var notificationService services.NotificationService
+	if cfg.Telegram.BotToken != "" {
+		api, err := tgbotapi.NewBotAPI(cfg.Telegram.BotToken)
+		if err != nil {
+			fmt.Printf("⚠ 初始化 Telegram Bot 失败，将不会通知用户: %v\n", err)
+		} else if appLogger, err := logger.NewLogger(&cfg.Logging); err != nil {
+			fmt.Printf("⚠ 初始化日志失败，将不会通知用户: %v\n", err)
+		} else {
+			notificationService = services.NewNotificationService(api, appLogger, cfg.Telegram.AdminUserIDs)
+		}
+	}
+
+	ledgerService := services.NewLedgerService(db.GetDB(), db.GetLedgerRepository(), db.GetWalletRepository())
+	walletService := services.NewWalletService(
+		db.GetWalletRepository(),
+		db.GetRechargeOrderRepository(),
+		nil,
+		services.NewWalletHistoryService(db.GetWalletHistoryRepository()),
+		ledgerService,
+		db.GetUserRepository(),
+		nil,
+	)
+
+	return services.NewWithdrawalService(
+		db.GetWithdrawalRepository(),
+		walletService,
+		ledgerService,
+		notificationService,
+		&cfg.Withdrawal,
+	)
+}
+
+// gmOperator 当前操作员，用于审计
+func gmOperator() string {
+	if operator := os.Getenv("USER"); operator != "" {
+		return operator
+	}
+	return "gm"
+}
+
+// listWithdrawals 列出提现申请
+func listWithdrawals(ctx context.Context, db *data.Database, status string, limit int) error {
+	withdrawalStatus := models.WithdrawalStatus(status)
+	switch withdrawalStatus {
+	case models.WithdrawalStatusPending, models.WithdrawalStatusApproved, models.WithdrawalStatusRejected:
+	case "all", "":
+		withdrawalStatus = ""
+	default:
+		return fmt.Errorf("未知的提现状态: %s", status)
+	}
+
+	withdrawals, err := db.GetWithdrawalRepository().GetByStatus(ctx, withdrawalStatus, limit, 0)
+	if err != nil {
+		return fmt.Errorf("查询提现申请失败: %w", err)
+	}
+
+	if len(withdrawals) == 0 {
+		fmt.Println("没有找到提现申请")
+		return nil
+	}
+
+	fmt.Printf("找到 %d 条提现申请:\n\n", len(withdrawals))
+	fmt.Printf("%-22s %-14s %-16s %-10s %-36s %s\n", "单号", "用户ID", "金额", "状态", "地址", "申请时间")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	for _, w := range withdrawals {
+		fmt.Printf("%-22s %-14d %-16s %-10s %-36s %s\n",
+			w.WithdrawalNo, w.UserID, w.Amount, w.Status, w.ToAddress, w.CreatedAt.Format("2006-01-02 15:04:05"))
+		if w.TxHash != "" {
+			fmt.Printf("%-22s 交易哈希: %s\n", "", w.TxHash)
+		}
+		if w.RejectReason != "" {
+			fmt.Printf("%-22s 拒绝原因: %s\n", "", w.RejectReason)
+		}
+	}
+
+	return nil
+}
+
+// approveWithdrawal 审核通过提现申请
+func approveWithdrawal(ctx context.Context, cfg *config.Config, db *data.Database, withdrawalNo, txHash string) error {
+	if withdrawalNo == "" {
+		return fmt.Errorf("提现单号不能为空，请使用 -no 参数指定")
+	}
+	if txHash == "" {
+		return fmt.Errorf("打款交易哈希不能为空，请使用 -tx-hash 参数指定")
+	}
+
+	withdrawal, err := newWithdrawalService(cfg, db).ApproveWithdrawal(ctx, withdrawalNo, txHash, gmOperator())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 提现申请 %s 已通过\n", withdrawal.WithdrawalNo)
+	fmt.Printf("用户ID: %d\n", withdrawal.UserID)
+	fmt.Printf("金额: %s USDT\n", withdrawal.Amount)
+	fmt.Printf("地址: %s\n", withdrawal.ToAddress)
+	fmt.Printf("交易哈希: %s\n", withdrawal.TxHash)
+	return nil
+}
+
+// rejectWithdrawal 拒绝提现申请
+func rejectWithdrawal(ctx context.Context, cfg *config.Config, db *data.Database, withdrawalNo, reason string) error {
+	if withdrawalNo == "" {
+		return fmt.Errorf("提现单号不能为空，请使用 -no 参数指定")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("拒绝原因不能为空，请使用 -reason 参数指定")
+	}
+
+	withdrawal, err := newWithdrawalService(cfg, db).RejectWithdrawal(ctx, withdrawalNo, reason, gmOperator())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 提现申请 %s 已拒绝，%s USDT 已退还到用户 %d 的可用余额\n", withdrawal.WithdrawalNo, withdrawal.Amount, withdrawal.UserID)
+	return nil
+}
+
+// createCoupon 创建优惠码
+func createCoupon(ctx context.Context, db *data.Database, coupon *models.Coupon, startsAt, expiresAt string) error {
+	if startsAt != "" {
+		t, err := time.ParseInLocation("2006-01-02", startsAt, time.Local)
+		if err != nil {
+			return fmt.Errorf("生效日期格式错误: %w", err)
+		}
+		coupon.StartsAt = &t
+	}
+	if expiresAt != "" {
+		t, err := time.ParseInLocation("2006-01-02", expiresAt, time.Local)
+		if err != nil {
+			return fmt.Errorf("过期日期格式错误: %w", err)
+		}
+		// 过期日期当天仍可使用
+		t = t.AddDate(0, 0, 1)
+		coupon.ExpiresAt = &t
+	}
+
+	couponService := services.NewCouponService(db.GetDB(), db.GetCouponRepository())
+	if err := couponService.CreateCoupon(ctx, coupon); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 优惠码 %s 已创建 (ID: %d)\n", coupon.Code, coupon.ID)
+	fmt.Printf("折扣: %s\n", couponDiscountText(coupon))
+	return nil
+}
+
+// listCoupons 列出优惠码
+func listCoupons(ctx context.Context, db *data.Database, status string, limit int) error {
+	couponStatus := models.CouponStatus(status)
+	switch couponStatus {
+	case models.CouponStatusActive, models.CouponStatusInactive:
+	case "all", "":
+		couponStatus = ""
+	default:
+		return fmt.Errorf("未知的优惠码状态: %s", status)
+	}
+
+	couponService := services.NewCouponService(db.GetDB(), db.GetCouponRepository())
+	coupons, err := couponService.ListCoupons(ctx, couponStatus, limit, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(coupons) == 0 {
+		fmt.Println("没有找到优惠码")
+		return nil
+	}
+
+	now := time.Now()
+	fmt.Printf("找到 %d 个优惠码:\n\n", len(coupons))
+	fmt.Printf("%-16s %-28s %-12s %-10s %-12s %s\n", "优惠码", "折扣", "已用/上限", "每人上限", "状态", "有效期至")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	for _, c := range coupons {
+		usage := fmt.Sprintf("%d/", c.UsedCount)
+		if c.UsageLimit > 0 {
+			usage += strconv.Itoa(c.UsageLimit)
+		} else {
+			usage += "不限"
+		}
+		perUser := "不限"
+		if c.PerUserLimit > 0 {
+			perUser = strconv.Itoa(c.PerUserLimit)
+		}
+		state := string(c.Status)
+		if c.Status == models.CouponStatusActive && !c.IsActive(now) {
+			state = "不在有效期"
+		}
+		expires := "永久"
+		if c.ExpiresAt != nil {
+			expires = c.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-16s %-28s %-12s %-10s %-12s %s\n", c.Code, couponDiscountText(c), usage, perUser, state, expires)
+		if c.ProductTypes != "" || c.Countries != "" || isPositiveAmount(c.MinSpend) {
+			fmt.Printf("%-16s 限制: 类型=%s 国家=%s 最低消费=%s\n", "", c.ProductTypes, c.Countries, c.MinSpend)
+		}
+	}
+
+	return nil
+}
+
+// disableCoupon 停用优惠码
+func disableCoupon(ctx context.Context, db *data.Database, code string) error {
+	if code == "" {
+		return fmt.Errorf("优惠码不能为空，请使用 -code 参数指定")
+	}
+
+	couponService := services.NewCouponService(db.GetDB(), db.GetCouponRepository())
+	if err := couponService.DisableCoupon(ctx, code); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 优惠码 %s 已停用\n", models.NormalizeCouponCode(code))
+	return nil
+}
+
+// listAssets 列出资产登记表
+func listAssets(ctx context.Context, db *data.Database) error {
+	assetService := services.NewAssetService(db.GetAssetRepository())
+	assets, err := assetService.ListAssets(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	if len(assets) == 0 {
+		fmt.Println("没有找到资产")
+		return nil
+	}
+
+	fmt.Printf("找到 %d 个资产:\n\n", len(assets))
+	fmt.Printf("%-12s %-8s %-10s %-6s %-14s %-10s %s\n", "资产", "符号", "链", "精度", "汇率(USD)", "状态", "合约地址")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	for _, a := range assets {
+		fmt.Printf("%-12s %-8s %-10s %-6d %-14s %-10s %s\n", a.Code, a.Symbol, a.Chain, a.Decimals, a.UsdRate, a.Status, a.ContractAddress)
+	}
+
+	return nil
+}
+
+// setAssetRate 设置资产折合美元的汇率
+func setAssetRate(ctx context.Context, db *data.Database, code, rate string) error {
+	if code == "" {
+		return fmt.Errorf("资产代码不能为空，请使用 -asset 参数指定")
+	}
+	if rate == "" {
+		return fmt.Errorf("汇率不能为空，请使用 -rate 参数指定")
+	}
+
+	assetService := services.NewAssetService(db.GetAssetRepository())
+	if err := assetService.UpdateRate(ctx, code, rate); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 资产 %s 汇率已更新为 %s USD\n", models.NormalizeAssetCode(code), rate)
+	return nil
+}
+
+// newOrphanDepositService 创建孤儿充值服务
+func newOrphanDepositService(db *data.Database) services.OrphanDepositService {
+	return services.NewOrphanDepositService(
+		db.GetOrphanDepositRepository(),
+		db.GetRechargeOrderRepository(),
+		services.NewAssetService(db.GetAssetRepository()),
+		services.NewLedgerService(db.GetDB(), db.GetLedgerRepository(), db.GetWalletRepository()),
+		db.GetDB(),
+	)
+}
+
+// listOrphanDeposits 列出孤儿充值
+func listOrphanDeposits(ctx context.Context, db *data.Database, status string, limit int) error {
+	switch status {
+	case models.OrphanStatusPending, models.OrphanStatusAssigned:
+	case "all", "":
+		status = ""
+	default:
+		return fmt.Errorf("未知的孤儿充值状态: %s", status)
+	}
+
+	deposits, err := newOrphanDepositService(db).ListOrphanDeposits(ctx, status, limit, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(deposits) == 0 {
+		fmt.Println("没有找到孤儿充值")
+		return nil
+	}
+
+	fmt.Printf("找到 %d 条孤儿充值:\n\n", len(deposits))
+	fmt.Printf("%-6s %-12s %-18s %-10s %-10s %-36s %s\n", "ID", "资产", "数量", "原因", "状态", "收款地址", "记录时间")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	for _, d := range deposits {
+		fmt.Printf("%-6d %-12s %-18s %-10s %-10s %-36s %s\n",
+			d.ID, d.Asset, d.Amount, d.Reason, d.Status, d.Address, d.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("%-6s 交易哈希: %s，付款地址: %s\n", "", d.TxHash, d.FromAddress)
+		if d.RechargeNo != "" {
+			fmt.Printf("%-6s 关联订单: %s\n", "", d.RechargeNo)
+		}
+		if d.Status == models.OrphanStatusAssigned {
+			fmt.Printf("%-6s 已分配给用户 %d，入账 %s USD，操作人: %s，备注: %s\n", "", d.AssignedUserID, d.CreditedAmount, d.Operator, d.Note)
+		}
+	}
+
+	return nil
+}
+
+// assignOrphanDeposit 将孤儿充值分配给用户并入账
+func assignOrphanDeposit(ctx context.Context, db *data.Database, id uint, userID int64, note string) error {
+	if id == 0 {
+		return fmt.Errorf("孤儿充值 ID 不能为空，请使用 -id 参数指定")
+	}
+	if userID <= 0 {
+		return fmt.Errorf("用户 ID 不能为空，请使用 -user-id 参数指定")
+	}
+	if strings.TrimSpace(note) == "" {
+		return fmt.Errorf("分配依据不能为空，请使用 -reason 参数指定")
+	}
+
+	deposit, err := newOrphanDepositService(db).AssignOrphanDeposit(ctx, id, userID, gmOperator(), note)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 孤儿充值 %d 已分配给用户 %d\n", deposit.ID, deposit.AssignedUserID)
+	fmt.Printf("实收: %s %s\n", deposit.Amount, deposit.Asset)
+	fmt.Printf("入账: %s USD\n", deposit.CreditedAmount)
+	fmt.Printf("交易哈希: %s\n", deposit.TxHash)
+	return nil
+}
+
+// refundStars 退还 Telegram Stars 充值并从用户钱包扣回入账金额
+func refundStars(ctx context.Context, cfg *config.Config, db *data.Database, paymentNo, reason string) error {
+	if paymentNo == "" {
+		return fmt.Errorf("支付单号不能为空，请使用 -no 参数指定")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("退款原因不能为空，请使用 -reason 参数指定")
+	}
+	if cfg.Telegram.BotToken == "" {
+		return fmt.Errorf("未配置 Telegram Bot Token，无法调用 Stars 退款接口")
+	}
+
+	api, err := tgbotapi.NewBotAPI(cfg.Telegram.BotToken)
+	if err != nil {
+		return fmt.Errorf("初始化 Telegram Bot 失败: %w", err)
 	}
-	if _, err := fmt.Sscanf(b, "%f", &bFloat); err != nil {
-		return "", fmt.Errorf("解析金额 %s 失败: %w", b, err)
+	var notificationService services.NotificationService
+	if appLogger, err := logger.NewLogger(&cfg.Logging); err != nil {
+		fmt.Printf("⚠ 初始化日志失败，将不会通知用户: %v\n", err)
+	} else {
+		notificationService = services.NewNotificationService(api, appLogger, cfg.Telegram.AdminUserIDs)
 	}
 
-	result := aFloat + bFloat
-	return fmt.Sprintf("%.4f", result), nil
+	gateway := services.NewStarsGateway(
+		db.GetGatewayPaymentRepository(),
+		services.NewLedgerService(db.GetDB(), db.GetLedgerRepository(), db.GetWalletRepository()),
+		notificationService,
+		nil,
+		api,
+		&cfg.Stars,
+		db.GetDB(),
+	)
+	payment, err := gateway.Refund(ctx, paymentNo, gmOperator(), reason)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Stars 支付 %s 已退款\n", payment.PaymentNo)
+	fmt.Printf("用户: %d\n", payment.UserID)
+	fmt.Printf("退回: %d Stars\n", payment.TotalAmount)
+	fmt.Printf("扣回: %s USD\n", payment.Amount)
+	return nil
+}
+
+// showOrderEvents 显示订单状态变更时间线
+func showOrderEvents(ctx context.Context, db *data.Database, orderNo string) error {
+	if orderNo == "" {
+		return fmt.Errorf("订单号不能为空，请使用 -no 参数指定")
+	}
+
+	order, err := db.GetOrderRepository().GetByOrderNo(ctx, orderNo)
+	if err != nil {
+		return fmt.Errorf("查询订单失败: %w", err)
+	}
+	events, err := db.GetOrderEventRepository().GetByOrderID(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("查询订单事件失败: %w", err)
+	}
+
+	fmt.Printf("订单 %s（用户 %d，%s，金额 %s）当前状态: %s\n\n", order.OrderNo, order.UserID, order.ProductName, order.Amount, order.Status)
+	if len(events) == 0 {
+		fmt.Println("没有状态变更记录")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-24s %-8s %-14s %s\n", "时间", "状态", "发起方", "操作人", "原因")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	for _, e := range events {
+		from := string(e.FromStatus)
+		if from == "" {
+			from = "-"
+		}
+		fmt.Printf("%-20s %-24s %-8s %-14s %s\n",
+			e.CreatedAt.Format("2006-01-02 15:04:05"), from+" -> "+string(e.ToStatus), e.Actor, e.Operator, e.Reason)
+		if e.Payload != "" {
+			fmt.Printf("%-20s 数据: %s\n", "", e.Payload)
+		}
+	}
+	return nil
+}
+
+// isPositiveAmount 金额字段是否大于 0
+func isPositiveAmount(value string) bool {
+	amount, err := strconv.ParseFloat(value, 64)
+	return err == nil && amount > 0
+}
+
+// couponDiscountText 折扣描述
+func couponDiscountText(c *models.Coupon) string {
+	if c.DiscountType == models.CouponDiscountFixed {
+		return fmt.Sprintf("立减 %s USDT", c.DiscountValue)
+	}
+	text := fmt.Sprintf("减 %s%%", c.DiscountValue)
+	if isPositiveAmount(c.MaxDiscount) {
+		text += fmt.Sprintf("，最多 %s USDT", c.MaxDiscount)
+	}
+	return text
 }
 
 // printHelp 打印帮助信息
@@ -523,6 +1162,19 @@ func printHelp() {
 	fmt.Println("  sync-product-details  从 API 同步产品详情到详情表")
 	fmt.Println("  list-products         列出本地数据库中的产品")
 	fmt.Println("  add-balance           增加用户钱包余额")
+	fmt.Println("  reconcile-wallets     钱包对账，报告余额差异")
+	fmt.Println("  list-withdrawals      列出提现申请")
+	fmt.Println("  approve-withdrawal    审核通过提现申请（需先在链上完成打款）")
+	fmt.Println("  reject-withdrawal     拒绝提现申请并退还冻结金额")
+	fmt.Println("  create-coupon         创建优惠码")
+	fmt.Println("  list-coupons          列出优惠码")
+	fmt.Println("  disable-coupon        停用优惠码")
+	fmt.Println("  list-assets           列出可充值资产及汇率")
+	fmt.Println("  set-asset-rate        设置资产折合美元的汇率")
+	fmt.Println("  list-orphan-deposits  列出无法自动入账的孤儿充值")
+	fmt.Println("  assign-orphan-deposit 将孤儿充值分配给用户并入账")
+	fmt.Println("  refund-stars          退还 Telegram Stars 充值并扣回入账金额")
+	fmt.Println("  order-events          查看订单状态变更时间线")
 	fmt.Println("  help                  显示帮助信息")
 	fmt.Println()
 	fmt.Println("选项:")
@@ -532,6 +1184,29 @@ func printHelp() {
 	fmt.Println("  -user-id <id>      用户 Telegram ID (用于 add-balance)")
 	fmt.Println("  -amount <amount>   充值金额 (用于 add-balance)")
 	fmt.Println("  -reason <text>     充值原因 (用于 add-balance，可选)")
+	fmt.Println("                     分配依据 (用于 assign-orphan-deposit，必填)")
+	fmt.Println("                     退款原因 (用于 refund-stars，必填)")
+	fmt.Println("  -fix               写入调整分录修正差异 (用于 reconcile-wallets)")
+	fmt.Println("  -status <status>   提现状态: pending, approved, rejected, all (用于 list-withdrawals，默认 pending)")
+	fmt.Println("                     孤儿充值状态: pending, assigned, all (用于 list-orphan-deposits，默认 pending)")
+	fmt.Println("  -no <no>           提现单号 (用于 approve-withdrawal, reject-withdrawal)")
+	fmt.Println("                     Stars 支付单号 (用于 refund-stars)")
+	fmt.Println("                     订单号 (用于 order-events)")
+	fmt.Println("  -tx-hash <hash>    打款交易哈希 (用于 approve-withdrawal)")
+	fmt.Println("  -code <code>       优惠码 (用于 create-coupon, disable-coupon)")
+	fmt.Println("  -discount-type <t> 折扣类型: percentage, fixed (用于 create-coupon，默认 percentage)")
+	fmt.Println("  -value <value>     折扣值：百分比或立减金额 (用于 create-coupon)")
+	fmt.Println("  -max-discount <n>  最高优惠金额，仅按比例折扣 (用于 create-coupon)")
+	fmt.Println("  -min-spend <n>     最低消费金额 (用于 create-coupon)")
+	fmt.Println("  -type <types>      适用产品类型，逗号分隔 (用于 create-coupon)")
+	fmt.Println("  -countries <codes> 适用国家代码，逗号分隔 (用于 create-coupon)")
+	fmt.Println("  -usage-limit <n>   总使用次数上限 (用于 create-coupon，0 表示不限)")
+	fmt.Println("  -per-user-limit <n> 每个用户使用次数上限 (用于 create-coupon，默认 1)")
+	fmt.Println("  -starts <date>     生效日期 YYYY-MM-DD (用于 create-coupon)")
+	fmt.Println("  -expires <date>    过期日期 YYYY-MM-DD (用于 create-coupon)")
+	fmt.Println("  -asset <code>      资产代码 (用于 set-asset-rate)")
+	fmt.Println("  -rate <rate>       1 单位资产折合的美元金额 (用于 set-asset-rate)")
+	fmt.Println("  -id <id>           孤儿充值 ID (用于 assign-orphan-deposit)")
 	fmt.Println()
 	fmt.Println("示例:")
 	fmt.Println("  # 同步所有产品")
@@ -554,4 +1229,43 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("  # 给用户增加余额并指定原因")
 	fmt.Println("  gm -cmd add-balance -user-id 123456789 -amount 50.00 -reason \"活动奖励\"")
+	fmt.Println()
+	fmt.Println("  # 对账所有钱包")
+	fmt.Println("  gm -cmd reconcile-wallets")
+	fmt.Println()
+	fmt.Println("  # 对账指定用户并修正差异")
+	fmt.Println("  gm -cmd reconcile-wallets -user-id 123456789 -fix -reason \"修正历史漏记\"")
+	fmt.Println()
+	fmt.Println("  # 列出待审核的提现申请")
+	fmt.Println("  gm -cmd list-withdrawals")
+	fmt.Println()
+	fmt.Println("  # 审核通过提现申请")
+	fmt.Println("  gm -cmd approve-withdrawal -no WDR17308000001234 -tx-hash <64位交易哈希>")
+	fmt.Println()
+	fmt.Println("  # 拒绝提现申请")
+	fmt.Println("  gm -cmd reject-withdrawal -no WDR17308000001234 -reason \"地址疑似交易所充值地址\"")
+	fmt.Println()
+	fmt.Println("  # 创建 8 折优惠码，最多减 5 USDT，限 100 次，每人 1 次")
+	fmt.Println("  gm -cmd create-coupon -code SPRING20 -value 20 -max-discount 5 -usage-limit 100 -expires 2026-12-31")
+	fmt.Println()
+	fmt.Println("  # 创建仅限日本本地套餐、满 10 减 2 的优惠码")
+	fmt.Println("  gm -cmd create-coupon -code JP2 -discount-type fixed -value 2 -min-spend 10 -type local -countries JP")
+	fmt.Println()
+	fmt.Println("  # 停用优惠码")
+	fmt.Println("  gm -cmd disable-coupon -code SPRING20")
+	fmt.Println()
+	fmt.Println("  # 设置 TRX 汇率（1 TRX = 0.12 USD）")
+	fmt.Println("  gm -cmd set-asset-rate -asset TRX -rate 0.12")
+	fmt.Println()
+	fmt.Println("  # 列出待处理的孤儿充值")
+	fmt.Println("  gm -cmd list-orphan-deposits")
+	fmt.Println()
+	fmt.Println("  # 核实付款人后将孤儿充值分配给用户")
+	fmt.Println("  gm -cmd assign-orphan-deposit -id 12 -user-id 123456789 -reason \"用户提供转账截图，工单 #88\"")
+	fmt.Println()
+	fmt.Println("  # 退还 Telegram Stars 充值")
+	fmt.Println("  gm -cmd refund-stars -no PAY1730800000123456789 -reason \"用户误充，工单 #90\"")
+	fmt.Println()
+	fmt.Println("  # 查看订单状态变更时间线")
+	fmt.Println("  gm -cmd order-events -no ORD17308000001234")
 }
@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"tg-robot-sim/config"
 	"tg-robot-sim/pkg/bot"
+	"tg-robot-sim/pkg/evm"
 	"tg-robot-sim/pkg/logger"
 	"tg-robot-sim/pkg/sdk/esim"
 	"tg-robot-sim/pkg/tron"
@@ -18,6 +20,7 @@ import (
 	"tg-robot-sim/services"
 	service_common "tg-robot-sim/services/common"
 	"tg-robot-sim/storage/data"
+	"tg-robot-sim/storage/models"
 )
 
 const (
@@ -65,17 +68,39 @@ func main() {
 	// 初始化 TRON 客户端
 	tronClient := tron.NewClient(cfg.Blockchain.TronEndpoint, cfg.Blockchain.TronAPIKey, appLogger)
 
-	// 初始化区块链服务
-	blockchainService := services.NewBlockchainService(tronClient, &cfg.Blockchain, appLogger)
+	// 初始化区块链服务（只识别资产表中登记的 TRON 资产）
+	tronAssets, err := db.GetAssetRepository().ListByChain(context.Background(), models.ChainTron)
+	if err != nil {
+		log.Fatalf("Failed to load TRON assets: %v", err)
+	}
+	blockchainService := services.NewBlockchainService(tronClient, &cfg.Blockchain, tronAssets, appLogger)
 
 	walletHistoryService := services.NewWalletHistoryService(db.GetWalletHistoryRepository())
 
+	// 复式记账服务（钱包余额由账本驱动）
+	ledgerService := services.NewLedgerService(
+		db.GetDB(),
+		db.GetLedgerRepository(),
+		db.GetWalletRepository(),
+	)
+
+	// 初始化 Telegram Bot
+	telegramBot, err := bot.NewBot(&cfg.Telegram, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to initialize bot: %v", err)
+		log.Fatalf("Failed to initialize bot: %v", err)
+	}
+	notificationService := services.NewNotificationService(telegramBot.GetAPI(), appLogger, cfg.Telegram.AdminUserIDs)
+
 	// 创建服务
 	walletService := services.NewWalletService(
 		db.GetWalletRepository(),
 		db.GetRechargeOrderRepository(),
 		blockchainService,
 		walletHistoryService,
+		ledgerService,
+		db.GetUserRepository(),
+		notificationService,
 	)
 	// 初始化 eSIM 服务
 	var esimService service_common.EsimClientService
@@ -88,7 +113,7 @@ func main() {
 		)
 		appLogger.Info("eSIM service initialized")
 	} else {
-		appLogger.Warn("eSIM service not configured, orders will be created without provider integration")
+		appLogger.Warn("eSIM service not configured, provider orders will stay queued until it is configured")
 	}
 
 	productService := services.NewProductService(db.GetProductRepository())
@@ -98,16 +123,63 @@ func main() {
 		esimService,
 	)
 
+	couponService := services.NewCouponService(db.GetDB(), db.GetCouponRepository())
+
+	// 创建邀请服务（邀请链接使用机器人用户名）
+	referralService := services.NewReferralService(
+		db.GetUserRepository(),
+		db.GetOrderRepository(),
+		db.GetWalletRepository(),
+		db.GetWalletHistoryRepository(),
+		ledgerService,
+		notificationService,
+		&cfg.Referral,
+		telegramBot.GetAPI().Self.UserName,
+	)
+
+	// 创建实时事件中心（充值到账、订单完成/失败推送到 Mini App）
+	// 业务服务写入事件表，由事件投递任务转发到本进程的事件中心，Bot 和其他副本发布的事件同样能推送到这里的连接
+	eventHub := services.NewEventHub(0, 0)
+	eventPublisher := services.NewDBEventPublisher(db.GetUserEventRepository())
+	eventRelay, err := services.NewEventRelay(context.Background(), db.GetUserEventRepository(), eventHub)
+	if err != nil {
+		appLogger.Error("Failed to create event relay: %v", err)
+		log.Fatalf("Failed to create event relay: %v", err)
+	}
+
+	// 初始化订单状态机（所有订单状态变更写入 order_events）
+	orderStateMachine := services.NewOrderStateMachine(db.GetDB(), db.GetOrderRepository(), db.GetOrderEventRepository())
+
 	orderService := services.NewOrderService(
+		db.GetDB(),
 		db.GetOrderRepository(),
+		orderStateMachine,
+		db.GetOrderOutboxRepository(),
 		db.GetProductRepository(),
 		walletService,
 		esimService,
 		esimCardService,
+		couponService,
+		referralService,
+		eventPublisher,
 	)
 
+	// 初始化第三方下单后台任务（执行下单事务写入的发件箱任务）
+	var providerOrderWorker services.ProviderOrderWorker
+	if esimService != nil {
+		providerOrderWorker = services.NewProviderOrderWorker(
+			db.GetDB(),
+			db.GetOrderRepository(),
+			db.GetOrderOutboxRepository(),
+			orderService,
+			esimService,
+			notificationService,
+		)
+	}
+
 	// 初始化订单同步服务
 	var orderSyncService services.OrderSyncService
+	var providerWebhookService services.ProviderWebhookService
 	if cfg.EsimSDK.APIKey != "" && cfg.EsimSDK.APIKey != "${ESIM_API_KEY}" {
 		// 创建 eSIM Client 用于订单同步
 		esimClient := esim.NewClient(esim.Config{
@@ -120,32 +192,108 @@ func main() {
 		// 创建订单同步服务
 		orderSyncService = services.NewOrderSyncService(
 			db.GetOrderRepository(),
+			db.GetOrderSyncErrorRepository(),
 			orderService,
 			esimClient,
+			notificationService,
+			&cfg.Order,
 		)
 		appLogger.Info("OrderSyncService initialized successfully")
+
+		// 第三方 Webhook 与订单同步共用签名配置和处理流程
+		providerWebhookService = services.NewProviderWebhookService(
+			esimClient,
+			db.GetProviderWebhookNonceRepository(),
+			orderSyncService,
+			esimCardService,
+		)
 	} else {
 		appLogger.Warn("eSIM SDK not configured, OrderSyncService will not be initialized")
 	}
 
-	// 初始化 Telegram Bot
-	telegramBot, err := bot.NewBot(&cfg.Telegram, appLogger)
-	if err != nil {
-		appLogger.Error("Failed to initialize bot: %v", err)
-		log.Fatalf("Failed to initialize bot: %v", err)
+	// 充值收款链：TRON 默认启用，EVM 链按配置启用
+	assetService := services.NewAssetService(db.GetAssetRepository())
+	depositChains := map[string]*services.DepositChain{
+		models.ChainTron: {
+			Service:        blockchainService,
+			DepositAddress: cfg.Recharge.DepositAddress,
+			Confirmations:  services.NewConfirmationPolicy(cfg.Recharge.RequiredConfirmations, cfg.Recharge.ConfirmationTiers),
+		},
+	}
+	if cfg.Blockchain.DepositAddressMode == config.DepositAddressModeHD {
+		addressService, err := services.NewHDDepositAddressService(db.GetDB(), db.GetDepositAddressRepository(), cfg.Blockchain.DepositXPub)
+		if err != nil {
+			log.Fatalf("Failed to initialize HD deposit addresses: %v", err)
+		}
+		depositChains[models.ChainTron].Addresses = addressService
+		appLogger.Info("TRON deposits use per-user HD addresses")
+	}
+	if cfg.EVM.Enabled {
+		evmAssets, err := db.GetAssetRepository().ListByChain(context.Background(), cfg.EVM.Chain)
+		if err != nil {
+			log.Fatalf("Failed to load %s assets: %v", cfg.EVM.Chain, err)
+		}
+		depositChains[cfg.EVM.Chain] = &services.DepositChain{
+			Service:        services.NewEVMBlockchainService(evm.NewClient(cfg.EVM.RPCEndpoint), &cfg.EVM, evmAssets, appLogger),
+			DepositAddress: strings.ToLower(cfg.EVM.DepositAddress),
+			Confirmations:  services.NewConfirmationPolicy(cfg.EVM.RequiredConfirmations, cfg.EVM.ConfirmationTiers),
+		}
+		appLogger.Info("EVM deposits enabled on %s with %d assets", cfg.EVM.Chain, len(evmAssets))
 	}
-	notificationService := services.NewNotificationService(telegramBot.GetAPI(), appLogger)
 
 	// 创建充值服务
 	rechargeService := services.NewRechargeService(
 		db.GetRechargeOrderRepository(),
+		db.GetTransactionRepository(),
+		db.GetDepositCursorRepository(),
+		db.GetOrphanDepositRepository(),
+		assetService,
 		walletService,
-		blockchainService,
+		db.GetWalletRepository(),
+		depositChains,
 		notificationService,
+		eventPublisher,
+		ledgerService,
 		db.GetDB(),
-		cfg.Recharge.DepositAddress,
 		cfg.Recharge.MinAmount,
 		cfg.Recharge.MaxAmount,
+		cfg.Recharge.UnderpaymentPolicy,
+		cfg.Recharge.ReverifyBlocks,
+	)
+
+	// 创建 Telegram Stars 支付渠道（未启用时 Mini App 的 Stars 充值接口返回未启用）
+	var starsGateway services.PaymentGateway
+	if cfg.Stars.Enabled {
+		starsGateway = services.NewStarsGateway(
+			db.GetGatewayPaymentRepository(),
+			ledgerService,
+			notificationService,
+			eventPublisher,
+			telegramBot.GetAPI(),
+			&cfg.Stars,
+			db.GetDB(),
+		)
+		appLogger.Info("Telegram Stars recharge enabled at %.4f USD per star", cfg.Stars.USDPerStar)
+	}
+
+	// 创建提现服务
+	withdrawalService := services.NewWithdrawalService(
+		db.GetWithdrawalRepository(),
+		walletService,
+		ledgerService,
+		notificationService,
+		&cfg.Withdrawal,
+	)
+
+	// 创建钱包对账服务
+	reconciliationService := services.NewReconciliationService(
+		db.GetWalletRepository(),
+		db.GetWalletHistoryRepository(),
+		db.GetRechargeOrderRepository(),
+		db.GetOrderRepository(),
+		db.GetWithdrawalRepository(),
+		db.GetLedgerRepository(),
+		ledgerService,
 	)
 
 	// 创建 HTTP 服务器
@@ -157,6 +305,11 @@ func main() {
 		walletHistoryService,
 		rechargeService,
 		esimCardService,
+		withdrawalService,
+		referralService,
+		starsGateway,
+		eventHub,
+		providerWebhookService,
 	)
 
 	// 启动区块链监控定时任务
@@ -171,14 +324,42 @@ func main() {
 		startExpireOldOrdersMonitoring(rechargeService)
 	}()
 
+	// 启动第三方下单定时任务
+	if providerOrderWorker != nil {
+		go func() {
+			log.Println("Starting provider order outbox task...")
+			startProviderOrderOutboxTask(providerOrderWorker, appLogger)
+		}()
+	}
+
 	// 启动订单同步定时任务
 	if orderSyncService != nil {
 		go func() {
 			log.Println("Starting order sync task...")
-			startOrderSyncTask(orderSyncService, appLogger)
+			startOrderSyncTask(orderSyncService, cfg.Order.SyncInterval.ToDuration(), appLogger)
+		}()
+	}
+
+	// 启动 Webhook nonce 清理定时任务
+	if providerWebhookService != nil {
+		go func() {
+			log.Println("Starting provider webhook nonce cleanup task...")
+			startProviderWebhookNonceCleanupTask(providerWebhookService, appLogger)
 		}()
 	}
 
+	// 启动实时事件投递任务
+	go func() {
+		log.Println("Starting event relay task...")
+		startEventRelayTask(eventRelay, appLogger)
+	}()
+
+	// 启动钱包对账定时任务
+	go func() {
+		log.Println("Starting wallet reconciliation task...")
+		startWalletReconciliationTask(reconciliationService, appLogger)
+	}()
+
 	// 启动服务器
 	go func() {
 		log.Printf("Starting Mini App HTTP server on %s", httpServer.Addr)
@@ -249,19 +430,42 @@ func startExpireOldOrdersMonitoring(rechargeService services.RechargeService) {
 	}
 }
 
+// startProviderOrderOutboxTask 启动第三方下单定时任务
+func startProviderOrderOutboxTask(worker services.ProviderOrderWorker, appLogger *logger.Logger) {
+	// 每5秒执行一次，新订单尽快提交到第三方
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	log.Println("Provider order outbox task started, checking every 5 seconds")
+
+	for {
+		select {
+		case <-ticker.C:
+			// 每轮最多执行 20 个任务，单次调用第三方接口超时 30 秒
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+
+			if err := worker.ProcessDueTasks(ctx); err != nil {
+				appLogger.Error("Error processing provider order tasks: %v", err)
+			}
+
+			cancel()
+		}
+	}
+}
+
 // startOrderSyncTask 启动订单同步定时任务
-func startOrderSyncTask(orderSyncService services.OrderSyncService, appLogger *logger.Logger) {
-	// 每10秒执行一次同步任务
-	ticker := time.NewTicker(10 * time.Second)
+// 每隔 interval 扫描一次到达下次同步时间的订单，各订单的同步间隔按退避策略计算
+func startOrderSyncTask(orderSyncService services.OrderSyncService, interval time.Duration, appLogger *logger.Logger) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	log.Println("Order sync task started, checking every 10 seconds")
+	log.Printf("Order sync task started, checking every %v", interval)
 
 	for {
 		select {
 		case <-ticker.C:
-			// 创建带超时的上下文
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			// 每轮最多同步 sync_batch_size 个订单，单次查询第三方订单超时 sync_request_timeout
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 
 			// 处理待同步订单
 			if err := orderSyncService.ProcessPendingOrders(ctx); err != nil {
@@ -272,3 +476,89 @@ func startOrderSyncTask(orderSyncService services.OrderSyncService, appLogger *l
 		}
 	}
 }
+
+// startProviderWebhookNonceCleanupTask 启动 Webhook nonce 清理定时任务
+func startProviderWebhookNonceCleanupTask(providerWebhookService services.ProviderWebhookService, appLogger *logger.Logger) {
+	// 每10分钟清理一次超出时间戳容忍窗口的 nonce
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	log.Println("Provider webhook nonce cleanup task started, checking every 10 minutes")
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+			if _, err := providerWebhookService.PurgeNonces(ctx); err != nil {
+				appLogger.Error("Error purging provider webhook nonces: %v", err)
+			}
+
+			cancel()
+		}
+	}
+}
+
+// startEventRelayTask 启动实时事件投递任务
+func startEventRelayTask(eventRelay services.EventRelay, appLogger *logger.Logger) {
+	// 每秒投递一次新事件，每10分钟清理一次过期事件
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(10 * time.Minute)
+	defer purgeTicker.Stop()
+
+	log.Println("Event relay task started, polling every second")
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+			if _, err := eventRelay.Poll(ctx); err != nil {
+				appLogger.Error("Error relaying user events: %v", err)
+			}
+
+			cancel()
+
+		case <-purgeTicker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+			if _, err := eventRelay.PurgeEvents(ctx); err != nil {
+				appLogger.Error("Error purging user events: %v", err)
+			}
+
+			cancel()
+		}
+	}
+}
+
+// startWalletReconciliationTask 启动钱包对账定时任务（只报告差异，不自动修正）
+func startWalletReconciliationTask(reconciliationService services.ReconciliationService, appLogger *logger.Logger) {
+	// 每小时执行一次对账
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	log.Println("Wallet reconciliation task started, checking every hour")
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+
+			report, err := reconciliationService.ReconcileAll(ctx)
+			if err != nil {
+				appLogger.Error("Error reconciling wallets: %v", err)
+			}
+			if report != nil {
+				for _, d := range report.Discrepancies {
+					appLogger.Warn("Wallet drift detected: user=%d expected=%s/%s ledger=%s/%s wallet=%s/%s",
+						d.UserID, d.ExpectedBalance, d.ExpectedFrozen, d.LedgerBalance, d.LedgerFrozen, d.WalletBalance, d.WalletFrozen)
+				}
+				appLogger.Info("Wallet reconciliation finished: %d wallets checked, %d discrepancies",
+					report.WalletsCount, len(report.Discrepancies))
+			}
+
+			cancel()
+		}
+	}
+}
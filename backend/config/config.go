@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
+
+	"tg-robot-sim/pkg/tron"
 )
 
 // Duration 自定义时间间隔类型，支持 JSON 字符串解析
@@ -74,6 +77,11 @@ type Config struct {
 	Server     ServerConfig     `json:"server"`
 	EsimSDK    EsimSDKConfig    `json:"esim_sdk"`
 	Recharge   RechargeConfig   `json:"recharge"`
+	Withdrawal WithdrawalConfig `json:"withdrawal"`
+	Referral   ReferralConfig   `json:"referral"`
+	EVM        EVMConfig        `json:"evm"`
+	Stars      StarsConfig      `json:"stars"`
+	Order      OrderConfig      `json:"order"`
 }
 
 // TelegramConfig Telegram 相关配置
@@ -83,6 +91,9 @@ type TelegramConfig struct {
 	MiniAppURL string   `json:"miniapp_url"`
 	Timeout    Duration `json:"timeout"`
 	Debug      bool     `json:"debug"`
+
+	// AdminUserIDs 接收运营告警（如充值冲回）的管理员 Telegram ID
+	AdminUserIDs []int64 `json:"admin_user_ids"`
 }
 
 // DatabaseConfig 数据库配置
@@ -94,14 +105,28 @@ type DatabaseConfig struct {
 	ConnMaxLife    string `json:"conn_max_life"`
 }
 
+// 充值收款地址模式
+const (
+	DepositAddressModeExactAmount = "exact_amount" // 所有订单共用收款地址，按随机 4 位小数的精确金额匹配
+	DepositAddressModeHD          = "hd"           // 每个用户一个由 xpub 派生的收款地址，按地址匹配并按实收金额入账
+)
+
+// 少付充值的处理策略
+const (
+	UnderpaymentPolicyCredit = "credit" // 按实收金额入账
+	UnderpaymentPolicyHold   = "hold"   // 暂不入账，转入孤儿充值由管理员人工处理
+)
+
 // BlockchainConfig 区块链配置
 type BlockchainConfig struct {
 	TronAPIKey            string   `json:"tron_api_key"`
 	TronEndpoint          string   `json:"tron_endpoint"`
 	MonitorInterval       Duration `json:"monitor_interval"`
-	RequiredConfirmations int      `json:"required_confirmations"`
+	RequiredConfirmations int      `json:"required_confirmations"` // 已不用于充值入账，TRON 充值确认数见 recharge.required_confirmations / confirmation_tiers
 	MaxBlockDelay         int      `json:"max_block_delay"`
 	WalletAddress         string   `json:"wallet_address"`
+	DepositAddressMode    string   `json:"deposit_address_mode"` // 充值收款地址模式：exact_amount（默认）或 hd
+	DepositXPub           string   `json:"deposit_xpub"`         // hd 模式使用的账户级扩展公钥 m/44'/195'/0'（服务端不保存私钥）
 }
 
 // LoggingConfig 日志配置
@@ -134,9 +159,100 @@ type RechargeConfig struct {
 	MinAmount              float64 `json:"min_amount"`               // 最小充值金额
 	MaxAmount              float64 `json:"max_amount"`               // 最大充值金额
 	OrderExpireMinutes     int     `json:"order_expire_minutes"`     // 订单过期时间（分钟）
-	RequiredConfirmations  int     `json:"required_confirmations"`   // 所需确认数
+	RequiredConfirmations  int     `json:"required_confirmations"`   // TRON 充值默认所需确认数（未命中分档时使用）
 	MonitorIntervalSeconds int     `json:"monitor_interval_seconds"` // 监控间隔（秒）
 	DepositAddress         string  `json:"deposit_address"`          // 系统收款地址
+	UnderpaymentPolicy     string  `json:"underpayment_policy"`      // 少付处理策略：credit（默认）或 hold
+	ReverifyBlocks         int     `json:"reverify_blocks"`          // 入账后复核窗口：入账后再经过多少个区块仍有效才视为最终到账（0 使用默认值）
+
+	// ConfirmationTiers TRON 充值按到账金额分档的确认数
+	ConfirmationTiers []ConfirmationTier `json:"confirmation_tiers"`
+}
+
+// ConfirmationTier 充值确认数分档：到账金额（计价币种）不低于 MinAmount 时需要 Confirmations 个确认
+// 命中多个分档时取 MinAmount 最大的一档
+type ConfirmationTier struct {
+	MinAmount     float64 `json:"min_amount"`
+	Confirmations int     `json:"confirmations"`
+}
+
+// WithdrawalConfig 提现相关配置
+type WithdrawalConfig struct {
+	MinAmount  float64 `json:"min_amount"`  // 单笔最小提现金额
+	MaxAmount  float64 `json:"max_amount"`  // 单笔最大提现金额
+	DailyLimit float64 `json:"daily_limit"` // 每个用户每日提现限额（按自然日统计待审核和已打款的申请）
+}
+
+// DefaultWithdrawalConfig 默认提现配置
+func DefaultWithdrawalConfig() WithdrawalConfig {
+	return WithdrawalConfig{
+		MinAmount:  10.0,
+		MaxAmount:  5000.0,
+		DailyLimit: 10000.0,
+	}
+}
+
+// ReferralConfig 邀请奖励配置
+type ReferralConfig struct {
+	Enabled       bool    `json:"enabled"`        // 是否发放邀请奖励
+	InviterReward float64 `json:"inviter_reward"` // 被邀请人首单完成后奖励给邀请人的金额（USDT）
+	InviteeReward float64 `json:"invitee_reward"` // 被邀请人首单完成后奖励给被邀请人的金额（USDT）
+}
+
+// DefaultReferralConfig 默认邀请奖励配置（默认关闭，需显式开启）
+func DefaultReferralConfig() ReferralConfig {
+	return ReferralConfig{
+		Enabled:       false,
+		InviterReward: 2.0,
+		InviteeReward: 1.0,
+	}
+}
+
+// EVMConfig EVM 链（BSC / Ethereum）充值配置
+// 只接收资产表中登记在该链上的代币（如 USDT-BEP20）
+type EVMConfig struct {
+	Enabled               bool   `json:"enabled"`                // 是否启用 EVM 链充值
+	Chain                 string `json:"chain"`                  // 链标识，与资产表的 chain 一致（bsc, ethereum）
+	RPCEndpoint           string `json:"rpc_endpoint"`           // JSON-RPC 节点地址
+	RequiredConfirmations int    `json:"required_confirmations"` // 默认所需确认数（未命中分档时使用，也是扫描入账转账的确认区块深度）
+	DepositAddress        string `json:"deposit_address"`        // 系统收款地址
+	LogLookbackBlocks     int64  `json:"log_lookback_blocks"`    // 查询入账转账日志时回溯的区块数
+
+	// ConfirmationTiers 按到账金额分档的确认数
+	ConfirmationTiers []ConfirmationTier `json:"confirmation_tiers"`
+}
+
+// DefaultEVMConfig 默认 EVM 链配置（默认关闭）
+func DefaultEVMConfig() EVMConfig {
+	return EVMConfig{
+		Enabled:               false,
+		Chain:                 "bsc",
+		RPCEndpoint:           "https://bsc-dataseed.binance.org",
+		RequiredConfirmations: 15,
+		DepositAddress:        "${EVM_DEPOSIT_ADDRESS}",
+		LogLookbackBlocks:     1200,
+	}
+}
+
+// StarsConfig Telegram Stars 充值配置
+// 用户按计价币种（USD）金额下单，按 USDPerStar 折算为 Stars 数量（向上取整），到账金额按 Stars 数量和汇率折算
+type StarsConfig struct {
+	Enabled              bool    `json:"enabled"`                // 是否启用 Stars 充值
+	USDPerStar           float64 `json:"usd_per_star"`           // 1 Star 折合的美元金额
+	MinAmount            float64 `json:"min_amount"`             // 单笔最小充值金额（USD）
+	MaxAmount            float64 `json:"max_amount"`             // 单笔最大充值金额（USD）
+	InvoiceExpireMinutes int     `json:"invoice_expire_minutes"` // 发票有效期（分钟），过期后拒绝支付
+}
+
+// DefaultStarsConfig 默认 Stars 充值配置（默认关闭）
+func DefaultStarsConfig() StarsConfig {
+	return StarsConfig{
+		Enabled:              false,
+		USDPerStar:           0.013,
+		MinAmount:            1.0,
+		MaxAmount:            1000.0,
+		InvoiceExpireMinutes: 30,
+	}
 }
 
 // LoadConfig 从文件加载配置
@@ -155,11 +271,34 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
+	// 邀请奖励预先填入默认值，配置文件只覆盖出现的字段：
+	// 缺少 referral 或 enabled 时保持关闭，显式 "enabled": false 不会被默认值覆盖
+	config := Config{Referral: DefaultReferralConfig()}
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// 旧配置文件没有提现配置时使用默认值
+	if config.Withdrawal == (WithdrawalConfig{}) {
+		config.Withdrawal = DefaultWithdrawalConfig()
+	}
+
+	// 旧配置文件没有 EVM 链配置时使用默认值（默认关闭）
+	if !config.EVM.Enabled && config.EVM.Chain == "" && config.EVM.RPCEndpoint == "" {
+		config.EVM = DefaultEVMConfig()
+	}
+
+	// 旧配置文件没有 Stars 充值配置时使用默认值（默认关闭）
+	if config.Stars == (StarsConfig{}) {
+		config.Stars = DefaultStarsConfig()
+	}
+
+	// 旧配置文件没有订单处理配置时使用默认值
+	if config.Order == (OrderConfig{}) {
+		config.Order = DefaultOrderConfig()
+	}
+	config.Order.fillSyncPoolDefaults()
+
 	// 应用环境变量覆盖
 	applyEnvironmentOverrides(&config)
 
@@ -190,6 +329,7 @@ func CreateDefaultConfig(configPath string) error {
 			RequiredConfirmations: 12,
 			MaxBlockDelay:         100,
 			WalletAddress:         "",
+			DepositAddressMode:    DepositAddressModeExactAmount,
 		},
 		Logging: LoggingConfig{
 			Level:    "info",
@@ -217,7 +357,14 @@ func CreateDefaultConfig(configPath string) error {
 			RequiredConfirmations:  19,
 			MonitorIntervalSeconds: 30,
 			DepositAddress:         "${DEPOSIT_WALLET_ADDRESS}",
+			UnderpaymentPolicy:     UnderpaymentPolicyCredit,
+			ReverifyBlocks:         20,
 		},
+		Withdrawal: DefaultWithdrawalConfig(),
+		Referral:   DefaultReferralConfig(),
+		EVM:        DefaultEVMConfig(),
+		Stars:      DefaultStarsConfig(),
+		Order:      DefaultOrderConfig(),
 	}
 
 	data, err := json.MarshalIndent(defaultConfig, "", "  ")
@@ -274,6 +421,10 @@ func applyEnvironmentOverrides(config *Config) {
 	if depositAddress := os.Getenv("DEPOSIT_WALLET_ADDRESS"); depositAddress != "" {
 		config.Recharge.DepositAddress = depositAddress
 	}
+
+	if evmDepositAddress := os.Getenv("EVM_DEPOSIT_ADDRESS"); evmDepositAddress != "" {
+		config.EVM.DepositAddress = evmDepositAddress
+	}
 }
 
 // Validate 验证配置
@@ -301,6 +452,20 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("required confirmations must be at least 1")
 	}
 
+	if err := validateTronAddress("blockchain wallet address", c.Blockchain.WalletAddress); err != nil {
+		return err
+	}
+
+	switch c.Blockchain.DepositAddressMode {
+	case "", DepositAddressModeExactAmount:
+	case DepositAddressModeHD:
+		if c.Blockchain.DepositXPub == "" {
+			return fmt.Errorf("deposit xpub is required in hd deposit address mode")
+		}
+	default:
+		return fmt.Errorf("unsupported deposit address mode: %s", c.Blockchain.DepositAddressMode)
+	}
+
 	// 验证充值配置
 	if c.Recharge.MinAmount <= 0 {
 		return fmt.Errorf("recharge min amount must be greater than 0")
@@ -318,5 +483,104 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("recharge required confirmations must be at least 1")
 	}
 
+	if err := validateConfirmationTiers(c.Recharge.ConfirmationTiers); err != nil {
+		return fmt.Errorf("recharge %w", err)
+	}
+
+	if err := validateTronAddress("recharge deposit address", c.Recharge.DepositAddress); err != nil {
+		return err
+	}
+
+	if c.Recharge.ReverifyBlocks < 0 {
+		return fmt.Errorf("recharge reverify blocks must not be negative")
+	}
+
+	switch c.Recharge.UnderpaymentPolicy {
+	case "", UnderpaymentPolicyCredit, UnderpaymentPolicyHold:
+	default:
+		return fmt.Errorf("unsupported underpayment policy: %s", c.Recharge.UnderpaymentPolicy)
+	}
+
+	// 验证提现配置
+	if c.Withdrawal.MinAmount <= 0 {
+		return fmt.Errorf("withdrawal min amount must be greater than 0")
+	}
+
+	if c.Withdrawal.MaxAmount < c.Withdrawal.MinAmount {
+		return fmt.Errorf("withdrawal max amount must not be less than min amount")
+	}
+
+	if c.Withdrawal.DailyLimit < c.Withdrawal.MinAmount {
+		return fmt.Errorf("withdrawal daily limit must not be less than min amount")
+	}
+
+	// 验证邀请奖励配置
+	if c.Referral.InviterReward < 0 || c.Referral.InviteeReward < 0 {
+		return fmt.Errorf("referral rewards must not be negative")
+	}
+
+	// 验证 EVM 链配置
+	if c.EVM.Enabled {
+		if c.EVM.Chain == "" || c.EVM.RPCEndpoint == "" {
+			return fmt.Errorf("evm chain and rpc endpoint are required when evm is enabled")
+		}
+		if c.EVM.RequiredConfirmations < 1 {
+			return fmt.Errorf("evm required confirmations must be at least 1")
+		}
+		if c.EVM.LogLookbackBlocks < 1 {
+			return fmt.Errorf("evm log lookback blocks must be at least 1")
+		}
+		if err := validateConfirmationTiers(c.EVM.ConfirmationTiers); err != nil {
+			return fmt.Errorf("evm %w", err)
+		}
+	}
+
+	// 验证 Stars 充值配置
+	if c.Stars.Enabled {
+		if c.Stars.USDPerStar <= 0 {
+			return fmt.Errorf("stars usd per star must be greater than 0")
+		}
+		if c.Stars.MinAmount <= 0 || c.Stars.MaxAmount < c.Stars.MinAmount {
+			return fmt.Errorf("stars amount range is invalid")
+		}
+		if c.Stars.InvoiceExpireMinutes <= 0 {
+			return fmt.Errorf("stars invoice expire minutes must be greater than 0")
+		}
+	}
+
+	// 验证订单处理配置
+	if err := c.Order.Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateTronAddress 离线校验配置中的 TRON 地址，未设置或仍为环境变量占位符时跳过
+func validateTronAddress(name, address string) error {
+	if address == "" || strings.HasPrefix(address, "${") {
+		return nil
+	}
+	if !tron.IsValidAddress(address) {
+		return fmt.Errorf("invalid %s: %s", name, address)
+	}
+	return nil
+}
+
+// validateConfirmationTiers 校验确认数分档：金额不能为负，确认数至少为 1，同一金额不能重复分档
+func validateConfirmationTiers(tiers []ConfirmationTier) error {
+	seen := make(map[float64]bool, len(tiers))
+	for _, tier := range tiers {
+		if tier.MinAmount < 0 {
+			return fmt.Errorf("confirmation tier min amount must not be negative")
+		}
+		if tier.Confirmations < 1 {
+			return fmt.Errorf("confirmation tier confirmations must be at least 1")
+		}
+		if seen[tier.MinAmount] {
+			return fmt.Errorf("duplicate confirmation tier for min amount %g", tier.MinAmount)
+		}
+		seen[tier.MinAmount] = true
+	}
 	return nil
 }
@@ -1,41 +1,108 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // OrderConfig 订单处理相关配置
 type OrderConfig struct {
 	// 同步配置
-	SyncInterval    time.Duration `json:"sync_interval"`     // 同步间隔
-	MaxSyncAttempts int           `json:"max_sync_attempts"` // 最大同步尝试次数
-	OrderTimeout    time.Duration `json:"order_timeout"`     // 订单超时时间
+	SyncInterval    Duration `json:"sync_interval"`     // 扫描待同步订单的间隔
+	MaxSyncAttempts int      `json:"max_sync_attempts"` // 最大同步尝试次数，超过后订单标记为失败并退款
+	OrderTimeout    Duration `json:"order_timeout"`     // 订单超时时间，处理中超过该时间的订单标记为失败并退款
+
+	// 并发同步配置：多个实例（bot、miniapp、多副本）通过订单上的同步租约保证同一订单同一时间只由一个 worker 同步
+	SyncWorkers        int      `json:"sync_workers"`         // 每轮并发同步的 worker 数
+	SyncBatchSize      int      `json:"sync_batch_size"`      // 每轮最多同步的订单数
+	SyncRequestTimeout Duration `json:"sync_request_timeout"` // 单次查询第三方订单的超时时间
+	SyncLease          Duration `json:"sync_lease"`           // 同步租约时长，超过后视为实例已崩溃，订单可被重新领取
 
 	// 通知配置
 	NotificationEnabled bool `json:"notification_enabled"` // 是否启用通知
 
-	// 重试配置
+	// 重试配置：订单下次同步时间按同步次数指数退避
 	RetryConfig RetryConfig `json:"retry_config"`
 }
 
 // RetryConfig 重试配置
+// 第 n 次同步（从 0 开始）后等待 InitialDelay * BackoffFactor^n，最长 MaxDelay，再叠加 ±Jitter 比例的随机抖动
 type RetryConfig struct {
-	MaxAttempts   int           `json:"max_attempts"`   // 最大重试次数
-	InitialDelay  time.Duration `json:"initial_delay"`  // 初始延迟
-	MaxDelay      time.Duration `json:"max_delay"`      // 最大延迟
-	BackoffFactor float64       `json:"backoff_factor"` // 退避因子
+	InitialDelay  Duration `json:"initial_delay"`  // 初始延迟
+	MaxDelay      Duration `json:"max_delay"`      // 最大延迟
+	BackoffFactor float64  `json:"backoff_factor"` // 退避因子
+	Jitter        float64  `json:"jitter"`         // 随机抖动比例（0-1），避免同一批订单同时查询第三方
 }
 
 // DefaultOrderConfig 默认订单配置
-func DefaultOrderConfig() *OrderConfig {
-	return &OrderConfig{
-		SyncInterval:        10 * time.Second,
+func DefaultOrderConfig() OrderConfig {
+	return OrderConfig{
+		SyncInterval:        Duration(10 * time.Second),
 		MaxSyncAttempts:     100,
-		OrderTimeout:        30 * time.Minute,
+		OrderTimeout:        Duration(30 * time.Minute),
+		SyncWorkers:         5,
+		SyncBatchSize:       50,
+		SyncRequestTimeout:  Duration(30 * time.Second),
+		SyncLease:           Duration(2 * time.Minute),
 		NotificationEnabled: true,
 		RetryConfig: RetryConfig{
-			MaxAttempts:   5,
-			InitialDelay:  2 * time.Second,
-			MaxDelay:      5 * time.Minute,
+			InitialDelay:  Duration(2 * time.Second),
+			MaxDelay:      Duration(5 * time.Minute),
 			BackoffFactor: 2.0,
+			Jitter:        0.2,
 		},
 	}
 }
+
+// fillSyncPoolDefaults 旧配置文件没有并发同步配置时使用默认值
+func (c *OrderConfig) fillSyncPoolDefaults() {
+	defaults := DefaultOrderConfig()
+	if c.SyncWorkers == 0 {
+		c.SyncWorkers = defaults.SyncWorkers
+	}
+	if c.SyncBatchSize == 0 {
+		c.SyncBatchSize = defaults.SyncBatchSize
+	}
+	if c.SyncRequestTimeout == 0 {
+		c.SyncRequestTimeout = defaults.SyncRequestTimeout
+	}
+	if c.SyncLease == 0 {
+		c.SyncLease = defaults.SyncLease
+	}
+}
+
+// Validate 校验订单配置
+func (c *OrderConfig) Validate() error {
+	if c.SyncInterval <= 0 {
+		return fmt.Errorf("order sync interval must be greater than 0")
+	}
+	if c.MaxSyncAttempts < 1 {
+		return fmt.Errorf("order max sync attempts must be at least 1")
+	}
+	if c.OrderTimeout <= 0 {
+		return fmt.Errorf("order timeout must be greater than 0")
+	}
+	if c.SyncWorkers < 1 {
+		return fmt.Errorf("order sync workers must be at least 1")
+	}
+	if c.SyncBatchSize < 1 {
+		return fmt.Errorf("order sync batch size must be at least 1")
+	}
+	if c.SyncRequestTimeout <= 0 {
+		return fmt.Errorf("order sync request timeout must be greater than 0")
+	}
+	// 领取的订单最多等待一个请求超时才开始同步，租约需覆盖等待和同步两段时间
+	if c.SyncLease <= 2*c.SyncRequestTimeout {
+		return fmt.Errorf("order sync lease must be longer than twice the sync request timeout")
+	}
+	if c.RetryConfig.InitialDelay <= 0 || c.RetryConfig.MaxDelay < c.RetryConfig.InitialDelay {
+		return fmt.Errorf("order retry delay range is invalid")
+	}
+	if c.RetryConfig.BackoffFactor < 1 {
+		return fmt.Errorf("order retry backoff factor must be at least 1")
+	}
+	if c.RetryConfig.Jitter < 0 || c.RetryConfig.Jitter > 1 {
+		return fmt.Errorf("order retry jitter must be between 0 and 1")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-robot-sim/pkg/logger"
+	"tg-robot-sim/services"
+)
+
+// ReferralHandler 处理 /invite 命令和主菜单中的「邀请好友」按钮
+type ReferralHandler struct {
+	bot             *tgbotapi.BotAPI
+	referralService services.ReferralService
+	logger          logger.ILogger
+}
+
+// NewReferralHandler 创建邀请处理器
+func NewReferralHandler(bot *tgbotapi.BotAPI, referralService services.ReferralService, logger logger.ILogger) *ReferralHandler {
+	return &ReferralHandler{
+		bot:             bot,
+		referralService: referralService,
+		logger:          logger,
+	}
+}
+
+// HandleCommand 处理命令
+func (h *ReferralHandler) HandleCommand(ctx context.Context, message *tgbotapi.Message) error {
+	text, err := h.buildReferralText(ctx, message.From.ID)
+	if err != nil {
+		h.logger.Error("Failed to get referral info for user %d: %v", message.From.ID, err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 获取邀请信息失败，请稍后重试")
+		_, err = h.bot.Send(msg)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+	_, err = h.bot.Send(msg)
+	return err
+}
+
+// GetCommand 获取处理的命令名称
+func (h *ReferralHandler) GetCommand() string {
+	return "invite"
+}
+
+// GetDescription 获取命令描述
+func (h *ReferralHandler) GetDescription() string {
+	return "邀请好友获得奖励"
+}
+
+// HandleCallback 处理回调查询
+func (h *ReferralHandler) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	if _, err := h.bot.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		h.logger.Error("Failed to answer callback: %v", err)
+	}
+	if callback.Message == nil {
+		return nil
+	}
+
+	text, err := h.buildReferralText(ctx, callback.From.ID)
+	if err != nil {
+		h.logger.Error("Failed to get referral info for user %d: %v", callback.From.ID, err)
+		text = "❌ 获取邀请信息失败，请稍后重试"
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "main_menu"),
+		),
+	)
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	editMsg.ParseMode = "HTML"
+	editMsg.DisableWebPagePreview = true
+	_, err = h.bot.Send(editMsg)
+	return err
+}
+
+// CanHandle 判断是否能处理该回调
+func (h *ReferralHandler) CanHandle(callback *tgbotapi.CallbackQuery) bool {
+	return callback.Data == "referral"
+}
+
+// GetHandlerName 获取处理器名称
+func (h *ReferralHandler) GetHandlerName() string {
+	return "referral"
+}
+
+// buildReferralText 生成邀请信息文本
+func (h *ReferralHandler) buildReferralText(ctx context.Context, userID int64) (string, error) {
+	info, err := h.referralService.GetReferralInfo(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	text := "<b>🎁 邀请好友</b>\n\n"
+	text += fmt.Sprintf("好友通过您的专属链接注册并完成首个 eSIM 订单后，您将获得 <b>%s USDT</b>，好友获得 <b>%s USDT</b>。\n\n", info.InviterBonus, info.InviteeBonus)
+	text += fmt.Sprintf("🔗 <b>邀请链接:</b>\n<code>%s</code>\n\n", html.EscapeString(info.Link))
+	text += fmt.Sprintf("👥 <b>已邀请:</b> %d 人\n", info.InvitedCount)
+	text += fmt.Sprintf("✅ <b>已完成首单:</b> %d 人\n", info.RewardedNum)
+	text += fmt.Sprintf("💰 <b>累计奖励:</b> %s USDT", info.TotalEarned)
+	return text, nil
+}
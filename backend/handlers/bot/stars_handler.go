@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-robot-sim/pkg/logger"
+	"tg-robot-sim/services"
+)
+
+// StarsHandler 处理 /stars 命令和 Telegram Stars 支付回调
+// 用法: /stars <金额>，金额为 USD，机器人发送 XTR 发票；预结账和支付成功消息由同一处理器校验入账
+type StarsHandler struct {
+	bot     *tgbotapi.BotAPI
+	gateway services.PaymentGateway
+	logger  logger.ILogger
+}
+
+// NewStarsHandler 创建 Stars 充值处理器
+func NewStarsHandler(bot *tgbotapi.BotAPI, gateway services.PaymentGateway, logger logger.ILogger) *StarsHandler {
+	return &StarsHandler{
+		bot:     bot,
+		gateway: gateway,
+		logger:  logger,
+	}
+}
+
+// HandleCommand 处理命令
+func (h *StarsHandler) HandleCommand(ctx context.Context, message *tgbotapi.Message) error {
+	amount := strings.TrimSpace(message.CommandArguments())
+	if amount == "" {
+		return h.sendText(message.Chat.ID, "用法: /stars <金额>\n例如: /stars 10 使用 Telegram Stars 充值 10 USD")
+	}
+
+	if _, err := h.gateway.SendInvoice(ctx, message.Chat.ID, message.From.ID, amount); err != nil {
+		h.logger.Error("Failed to send stars invoice to user %d: %v", message.From.ID, err)
+		return h.sendText(message.Chat.ID, "❌ "+err.Error())
+	}
+	return nil
+}
+
+// GetCommand 获取处理的命令名称
+func (h *StarsHandler) GetCommand() string {
+	return "stars"
+}
+
+// GetDescription 获取命令描述
+func (h *StarsHandler) GetDescription() string {
+	return "使用 Telegram Stars 充值"
+}
+
+// HandlePreCheckoutQuery 校验发票后应答预结账查询
+func (h *StarsHandler) HandlePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error {
+	err := h.gateway.ValidateCheckout(ctx, &services.GatewayCheckout{
+		UserID:      query.From.ID,
+		Payload:     query.InvoicePayload,
+		Currency:    query.Currency,
+		TotalAmount: int64(query.TotalAmount),
+	})
+
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: err == nil}
+	if err != nil {
+		h.logger.Info("Rejected stars checkout %s from user %d: %v", query.InvoicePayload, query.From.ID, err)
+		answer.ErrorMessage = checkoutErrorMessage(err)
+	}
+	_, err = h.bot.Request(answer)
+	return err
+}
+
+// HandleSuccessfulPayment 支付成功后入账，到账通知由支付渠道发送
+func (h *StarsHandler) HandleSuccessfulPayment(ctx context.Context, message *tgbotapi.Message) error {
+	payment := message.SuccessfulPayment
+	result, err := h.gateway.CompletePayment(ctx, &services.GatewayCheckout{
+		UserID:      message.From.ID,
+		Payload:     payment.InvoicePayload,
+		Currency:    payment.Currency,
+		TotalAmount: int64(payment.TotalAmount),
+		ChargeID:    payment.TelegramPaymentChargeID,
+	})
+	if err != nil {
+		h.logger.Error("Failed to credit stars payment %s (charge %s) for user %d: %v",
+			payment.InvoicePayload, payment.TelegramPaymentChargeID, message.From.ID, err)
+		return h.sendText(message.Chat.ID, fmt.Sprintf("⚠️ 已收到您的支付，但入账失败，请联系客服处理\n支付单号: %s", payment.InvoicePayload))
+	}
+
+	h.logger.Info("Credited stars payment %s: user %d, %d stars, %s USD",
+		result.PaymentNo, result.UserID, result.TotalAmount, result.Amount)
+	return nil
+}
+
+// GetHandlerName 获取处理器名称
+func (h *StarsHandler) GetHandlerName() string {
+	return "stars"
+}
+
+// sendText 发送文本消息
+func (h *StarsHandler) sendText(chatID int64, text string) error {
+	_, err := h.bot.Send(tgbotapi.NewMessage(chatID, text))
+	return err
+}
+
+// checkoutErrorMessage 预结账失败时展示给用户的原因
+func checkoutErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrGatewayPaymentExpired):
+		return "发票已过期，请重新发起充值"
+	case errors.Is(err, services.ErrGatewayPaymentNotPending):
+		return "该发票已支付，请勿重复支付"
+	case errors.Is(err, services.ErrGatewayPaymentNotFound), errors.Is(err, services.ErrGatewayPaymentMismatch):
+		return "发票无效，请重新发起充值"
+	default:
+		return "支付暂时无法处理，请稍后重试"
+	}
+}
@@ -45,16 +45,19 @@ type StartHandler struct {
 	dialogService   services.DialogService
 	productsHandler *ProductsHandler // 添加 ProductsHandler 引用
 	config          *config.Config   // 添加配置依赖
+	referralService services.ReferralService
 }
 
 // NewStartHandler 创建 Start 命令处理器
-func NewStartHandler(bot *tgbotapi.BotAPI, userRepo repository.UserRepository, dialogService services.DialogService, productsHandler *ProductsHandler, cfg *config.Config) *StartHandler {
+// referralService 为 nil 时忽略邀请链接
+func NewStartHandler(bot *tgbotapi.BotAPI, userRepo repository.UserRepository, dialogService services.DialogService, productsHandler *ProductsHandler, cfg *config.Config, referralService services.ReferralService) *StartHandler {
 	return &StartHandler{
 		bot:             bot,
 		userRepo:        userRepo,
 		dialogService:   dialogService,
 		productsHandler: productsHandler,
 		config:          cfg,
+		referralService: referralService,
 	}
 }
 
@@ -68,7 +71,7 @@ func (h *StartHandler) HandleCommand(ctx context.Context, message *tgbotapi.Mess
 	// 检查是否有深度链接参数
 	args := message.CommandArguments()
 	if args != "" {
-		return h.handleDeepLink(ctx, message.Chat.ID, args)
+		return h.handleDeepLink(ctx, message.Chat.ID, message.From.ID, args)
 	}
 
 	// 发送 Mini App 欢迎消息
@@ -76,8 +79,12 @@ func (h *StartHandler) HandleCommand(ctx context.Context, message *tgbotapi.Mess
 }
 
 // handleDeepLink 处理深度链接
-func (h *StartHandler) handleDeepLink(ctx context.Context, chatID int64, args string) error {
+func (h *StartHandler) handleDeepLink(ctx context.Context, chatID int64, userID int64, args string) error {
 	switch {
+	case strings.HasPrefix(args, "ref_"):
+		// 邀请链接：绑定邀请人后显示欢迎消息
+		referrerIDStr := strings.TrimPrefix(args, "ref_")
+		return h.handleReferralDeepLink(ctx, chatID, userID, referrerIDStr)
 	case args == "inline_products":
 		return h.handleInlineProductsDeepLink(ctx, chatID)
 	case strings.HasPrefix(args, "product_detail_"):
@@ -94,6 +101,31 @@ func (h *StartHandler) handleDeepLink(ctx context.Context, chatID int64, args st
 	}
 }
 
+// handleReferralDeepLink 处理邀请链接
+// 自己邀请自己、邀请环、已绑定或已下单等情况不绑定，直接显示欢迎消息
+func (h *StartHandler) handleReferralDeepLink(ctx context.Context, chatID int64, userID int64, referrerIDStr string) error {
+	referrerID, err := strconv.ParseInt(referrerIDStr, 10, 64)
+	if err != nil || h.referralService == nil {
+		return h.sendMiniAppWelcome(ctx, chatID)
+	}
+
+	if err := h.referralService.BindReferrer(ctx, userID, referrerID); err == nil && h.config.Referral.Enabled {
+		text := "<b>🎁 您已接受好友邀请</b>\n\n"
+		if h.config.Referral.InviteeReward > 0 {
+			text += fmt.Sprintf("完成首个 eSIM 订单后，您将获得 <b>%.2f USDT</b> 奖励，直接发放到钱包余额。", h.config.Referral.InviteeReward)
+		} else {
+			text += "完成首个 eSIM 订单后，邀请您的好友将获得奖励。"
+		}
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = "HTML"
+		if _, err := h.bot.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	return h.sendMiniAppWelcome(ctx, chatID)
+}
+
 // handleInlineProductsDeepLink 处理从 Inline Mode 切换过来的用户
 func (h *StartHandler) handleInlineProductsDeepLink(ctx context.Context, chatID int64) error {
 	text := "<b>🎉 欢迎使用 eSIM 机器人！</b>\n\n"
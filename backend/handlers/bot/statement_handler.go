@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-robot-sim/pkg/logger"
+	"tg-robot-sim/services"
+)
+
+// StatementHandler 处理 /statement 命令，以文件形式发送钱包对账单
+// 用法: /statement [pdf|csv] [开始日期] [结束日期]，日期格式 YYYY-MM-DD，默认导出当月 PDF
+type StatementHandler struct {
+	bot                  *tgbotapi.BotAPI
+	walletHistoryService services.WalletHistoryService
+	logger               logger.ILogger
+}
+
+// NewStatementHandler 创建对账单处理器
+func NewStatementHandler(bot *tgbotapi.BotAPI, walletHistoryService services.WalletHistoryService, logger logger.ILogger) *StatementHandler {
+	return &StatementHandler{
+		bot:                  bot,
+		walletHistoryService: walletHistoryService,
+		logger:               logger,
+	}
+}
+
+// HandleCommand 处理命令
+func (h *StatementHandler) HandleCommand(ctx context.Context, message *tgbotapi.Message) error {
+	format := services.StatementFormatPDF
+	var dates []string
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		switch strings.ToLower(arg) {
+		case services.StatementFormatPDF, services.StatementFormatCSV:
+			format = strings.ToLower(arg)
+		default:
+			dates = append(dates, arg)
+		}
+	}
+	if len(dates) > 2 {
+		return h.sendText(message.Chat.ID, "用法: /statement [pdf|csv] [开始日期] [结束日期]\n例如: /statement pdf 2026-01-01 2026-01-31")
+	}
+	for len(dates) < 2 {
+		dates = append(dates, "")
+	}
+
+	from, to, err := services.ParseStatementPeriod(dates[0], dates[1], time.Now())
+	if err != nil {
+		return h.sendText(message.Chat.ID, "❌ "+err.Error())
+	}
+
+	statement, err := h.walletHistoryService.GetWalletStatement(ctx, message.From.ID, from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatementPeriod) {
+			return h.sendText(message.Chat.ID, "❌ "+err.Error())
+		}
+		h.logger.Error("Failed to build statement for user %d: %v", message.From.ID, err)
+		return h.sendText(message.Chat.ID, "❌ 生成对账单失败，请稍后重试")
+	}
+
+	content, _, err := services.RenderWalletStatement(statement, format)
+	if err != nil {
+		h.logger.Error("Failed to render statement for user %d: %v", message.From.ID, err)
+		return h.sendText(message.Chat.ID, "❌ 生成对账单失败，请稍后重试")
+	}
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  services.StatementFileName(statement, format),
+		Bytes: content,
+	})
+	doc.Caption = fmt.Sprintf("钱包对账单 %s 至 %s\n期初余额: %s %s\n期末余额: %s %s\n共 %d 笔资金变动",
+		from.Format("2006-01-02"), to.Format("2006-01-02"),
+		statement.OpeningBalance, statement.Currency,
+		statement.ClosingBalance, statement.Currency,
+		len(statement.Entries))
+	_, err = h.bot.Send(doc)
+	return err
+}
+
+// GetCommand 获取处理的命令名称
+func (h *StatementHandler) GetCommand() string {
+	return "statement"
+}
+
+// GetDescription 获取命令描述
+func (h *StatementHandler) GetDescription() string {
+	return "导出钱包对账单（PDF/CSV）"
+}
+
+// sendText 发送文本消息
+func (h *StatementHandler) sendText(chatID int64, text string) error {
+	_, err := h.bot.Send(tgbotapi.NewMessage(chatID, text))
+	return err
+}
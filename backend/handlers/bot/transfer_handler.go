@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+
+	"tg-robot-sim/pkg/logger"
+	"tg-robot-sim/services"
+	"tg-robot-sim/storage/repository"
+)
+
+// transferConfirmTimeout 转账确认有效期
+const transferConfirmTimeout = 5 * time.Minute
+
+// pendingTransfer 等待用户确认的转账
+type pendingTransfer struct {
+	FromUserID int64
+	ToUserID   int64
+	Amount     string
+	Memo       string
+	ExpiresAt  time.Time
+}
+
+// TransferHandler 处理 /transfer 命令和转账确认回调
+// 用法：/transfer @username 金额 [备注]
+type TransferHandler struct {
+	bot           *tgbotapi.BotAPI
+	walletService services.WalletService
+	userRepo      repository.UserRepository
+	logger        logger.ILogger
+
+	mu      sync.Mutex
+	pending map[string]*pendingTransfer
+}
+
+// NewTransferHandler 创建转账处理器
+func NewTransferHandler(bot *tgbotapi.BotAPI, walletService services.WalletService, userRepo repository.UserRepository, logger logger.ILogger) *TransferHandler {
+	return &TransferHandler{
+		bot:           bot,
+		walletService: walletService,
+		userRepo:      userRepo,
+		logger:        logger,
+		pending:       make(map[string]*pendingTransfer),
+	}
+}
+
+// HandleCommand 处理命令
+func (h *TransferHandler) HandleCommand(ctx context.Context, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+	fromUserID := message.From.ID
+
+	// 转账涉及余额信息，只在私聊中处理
+	if !message.Chat.IsPrivate() {
+		return h.sendError(chatID, "请在与机器人的私聊中发起转账")
+	}
+
+	fields := strings.Fields(message.CommandArguments())
+	if len(fields) < 2 {
+		return h.sendUsage(chatID)
+	}
+
+	username := strings.TrimPrefix(fields[0], "@")
+	amount := fields[1]
+	memo := strings.Join(fields[2:], " ")
+
+	if value, err := strconv.ParseFloat(amount, 64); err != nil || value <= 0 {
+		return h.sendError(chatID, "转账金额格式错误，请输入大于 0 的数字")
+	}
+
+	// 通过用户名解析收款方
+	recipient, err := h.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.sendError(chatID, fmt.Sprintf("未找到用户 @%s，对方需要先向机器人发送 /start", username))
+		}
+		h.logger.Error("Failed to resolve transfer recipient @%s: %v", username, err)
+		return h.sendError(chatID, "查询收款方失败，请稍后重试")
+	}
+	if recipient.TelegramID == fromUserID {
+		return h.sendError(chatID, "不能给自己转账")
+	}
+
+	token, err := h.savePending(&pendingTransfer{
+		FromUserID: fromUserID,
+		ToUserID:   recipient.TelegramID,
+		Amount:     amount,
+		Memo:       memo,
+		ExpiresAt:  time.Now().Add(transferConfirmTimeout),
+	})
+	if err != nil {
+		h.logger.Error("Failed to save pending transfer: %v", err)
+		return h.sendError(chatID, "发起转账失败，请稍后重试")
+	}
+
+	text := "<b>💸 确认转账</b>\n\n"
+	text += fmt.Sprintf("👤 <b>收款方:</b> @%s\n", html.EscapeString(recipient.Username))
+	text += fmt.Sprintf("💰 <b>金额:</b> %s USDT\n", html.EscapeString(amount))
+	if memo != "" {
+		text += fmt.Sprintf("📝 <b>备注:</b> %s\n", html.EscapeString(memo))
+	}
+	text += fmt.Sprintf("\n请在 %d 分钟内确认，转账完成后不可撤回。", int(transferConfirmTimeout.Minutes()))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认转账", "transfer:confirm:"+token),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "transfer:cancel:"+token),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = keyboard
+
+	_, err = h.bot.Send(msg)
+	return err
+}
+
+// GetCommand 获取处理的命令名称
+func (h *TransferHandler) GetCommand() string {
+	return "transfer"
+}
+
+// GetDescription 获取命令描述
+func (h *TransferHandler) GetDescription() string {
+	return "向其他用户转账"
+}
+
+// HandleCallback 处理回调查询
+func (h *TransferHandler) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	if err := h.answerCallback(callback.ID); err != nil {
+		h.logger.Error("Failed to answer callback: %v", err)
+	}
+
+	// transfer:confirm:<token> 或 transfer:cancel:<token>
+	parts := strings.Split(callback.Data, ":")
+	if len(parts) != 3 || callback.Message == nil {
+		return nil
+	}
+	action, token := parts[1], parts[2]
+
+	// 确认和取消都只能执行一次，先取出再处理，避免重复点击重复转账
+	pending := h.takePending(token, callback.From.ID)
+	if pending == nil {
+		return h.editMessage(callback.Message, "⌛ 转账请求已失效，请重新发起 /transfer")
+	}
+
+	switch action {
+	case "cancel":
+		return h.editMessage(callback.Message, "已取消转账")
+	case "confirm":
+		result, err := h.walletService.Transfer(ctx, pending.FromUserID, pending.ToUserID, pending.Amount, pending.Memo)
+		if err != nil {
+			h.logger.Info("Transfer from %d to %d failed: %v", pending.FromUserID, pending.ToUserID, err)
+			return h.editMessage(callback.Message, "❌ "+transferErrorMessage(err))
+		}
+
+		text := "✅ <b>转账成功</b>\n\n"
+		text += fmt.Sprintf("👤 <b>收款方:</b> %s\n", html.EscapeString(result.ToName))
+		text += fmt.Sprintf("💰 <b>金额:</b> %s USDT\n", result.Amount)
+		text += fmt.Sprintf("💳 <b>当前余额:</b> %s USDT\n", result.FromBalance)
+		text += fmt.Sprintf("📋 <b>转账单号:</b> <code>%s</code>", result.TransferNo)
+		return h.editMessage(callback.Message, text)
+	}
+
+	return nil
+}
+
+// CanHandle 判断是否能处理该回调
+func (h *TransferHandler) CanHandle(callback *tgbotapi.CallbackQuery) bool {
+	return strings.HasPrefix(callback.Data, "transfer:")
+}
+
+// GetHandlerName 获取处理器名称
+func (h *TransferHandler) GetHandlerName() string {
+	return "transfer"
+}
+
+// savePending 保存待确认转账并返回确认令牌，同时清理过期记录
+func (h *TransferHandler) savePending(transfer *pendingTransfer) (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for key, item := range h.pending {
+		if now.After(item.ExpiresAt) {
+			delete(h.pending, key)
+		}
+	}
+	h.pending[token] = transfer
+	return token, nil
+}
+
+// takePending 取出并删除待确认转账，令牌不存在、已过期或不属于该用户时返回 nil
+func (h *TransferHandler) takePending(token string, userID int64) *pendingTransfer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	transfer, ok := h.pending[token]
+	if !ok || transfer.FromUserID != userID {
+		return nil
+	}
+	delete(h.pending, token)
+
+	if time.Now().After(transfer.ExpiresAt) {
+		return nil
+	}
+	return transfer
+}
+
+// transferErrorMessage 将转账错误转换为用户可读的提示
+func transferErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrInsufficientBalance):
+		return "余额不足，请先充值"
+	case errors.Is(err, services.ErrInvalidTransferAmount):
+		return "转账金额必须大于 0 且最多两位小数"
+	case errors.Is(err, services.ErrTransferMemoTooLong):
+		return "转账备注过长"
+	case errors.Is(err, services.ErrTransferToSelf):
+		return "不能给自己转账"
+	case errors.Is(err, services.ErrTransferRecipientNotFound):
+		return "收款方不存在"
+	default:
+		return "转账失败，请稍后重试"
+	}
+}
+
+func (h *TransferHandler) sendUsage(chatID int64) error {
+	text := "<b>💸 转账</b>\n\n"
+	text += "用法：<code>/transfer @用户名 金额 [备注]</code>\n"
+	text += "例如：<code>/transfer @alice 10 eSIM 费用</code>\n\n"
+	text += "收款方需要先向机器人发送 /start。"
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML"
+	_, err := h.bot.Send(msg)
+	return err
+}
+
+func (h *TransferHandler) editMessage(message *tgbotapi.Message, text string) error {
+	editMsg := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	editMsg.ParseMode = "HTML"
+	_, err := h.bot.Send(editMsg)
+	return err
+}
+
+func (h *TransferHandler) sendError(chatID int64, errorMsg string) error {
+	msg := tgbotapi.NewMessage(chatID, "❌ "+errorMsg)
+	_, err := h.bot.Send(msg)
+	return err
+}
+
+func (h *TransferHandler) answerCallback(callbackID string) error {
+	callback := tgbotapi.NewCallback(callbackID, "")
+	_, err := h.bot.Request(callback)
+	return err
+}
@@ -55,6 +55,19 @@ type InlineQueryHandler interface {
 	GetHandlerName() string
 }
 
+// PaymentHandler 定义支付处理器接口
+// 负责处理发票的预结账查询和支付成功消息
+type PaymentHandler interface {
+	// HandlePreCheckoutQuery 处理预结账查询，必须在 10 秒内应答
+	HandlePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error
+
+	// HandleSuccessfulPayment 处理支付成功消息
+	HandleSuccessfulPayment(ctx context.Context, message *tgbotapi.Message) error
+
+	// GetHandlerName 获取处理器名称
+	GetHandlerName() string
+}
+
 // HandlerRegistry 定义处理器注册表接口
 // 负责管理所有处理器的注册和路由
 type HandlerRegistry interface {
@@ -70,6 +83,9 @@ type HandlerRegistry interface {
 	// RegisterInlineHandler 注册 Inline 查询处理器
 	RegisterInlineHandler(handler InlineQueryHandler) error
 
+	// RegisterPaymentHandler 注册支付处理器
+	RegisterPaymentHandler(handler PaymentHandler) error
+
 	// RouteMessage 路由消息到合适的处理器
 	RouteMessage(ctx context.Context, message *tgbotapi.Message) error
 
@@ -78,4 +94,7 @@ type HandlerRegistry interface {
 
 	// RouteInlineQuery 路由 Inline 查询到合适的处理器
 	RouteInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) error
+
+	// RoutePreCheckoutQuery 路由预结账查询到支付处理器
+	RoutePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error
 }
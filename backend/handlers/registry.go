@@ -15,6 +15,7 @@ type Registry struct {
 	callbackHandlers []CallbackHandler
 	commandHandlers  map[string]CommandHandler
 	inlineHandlers   []InlineQueryHandler
+	paymentHandler   PaymentHandler
 	middlewares      []Middleware
 	mu               sync.RWMutex
 }
@@ -91,6 +92,19 @@ func (r *Registry) RegisterInlineHandler(handler InlineQueryHandler) error {
 	return nil
 }
 
+// RegisterPaymentHandler 注册支付处理器，只保留最后注册的一个
+func (r *Registry) RegisterPaymentHandler(handler PaymentHandler) error {
+	if handler == nil {
+		return fmt.Errorf("payment handler cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paymentHandler = handler
+	return nil
+}
+
 // RouteMessage 路由消息到合适的处理器
 func (r *Registry) RouteMessage(ctx context.Context, message *tgbotapi.Message) error {
 	if message == nil {
@@ -115,6 +129,14 @@ func (r *Registry) RouteMessage(ctx context.Context, message *tgbotapi.Message)
 			}
 		}()
 
+		// 支付成功消息交给支付处理器
+		if msg.SuccessfulPayment != nil {
+			if r.paymentHandler == nil {
+				return fmt.Errorf("no payment handler registered")
+			}
+			return r.paymentHandler.HandleSuccessfulPayment(ctx, msg)
+		}
+
 		// 首先检查是否是命令
 		if msg.IsCommand() {
 			command := msg.Command()
@@ -221,6 +243,25 @@ func (r *Registry) RouteInlineQuery(ctx context.Context, query *tgbotapi.InlineQ
 	return nil
 }
 
+// RoutePreCheckoutQuery 路由预结账查询到支付处理器
+func (r *Registry) RoutePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error {
+	if query == nil {
+		return fmt.Errorf("pre-checkout query cannot be nil")
+	}
+
+	r.mu.RLock()
+	handler := r.paymentHandler
+	r.mu.RUnlock()
+
+	if handler == nil {
+		return fmt.Errorf("no payment handler registered")
+	}
+	if err := handler.HandlePreCheckoutQuery(ctx, query); err != nil {
+		return fmt.Errorf("payment handler (%s) failed: %w", handler.GetHandlerName(), err)
+	}
+	return nil
+}
+
 // GetRegisteredCommands 获取已注册的命令列表
 func (r *Registry) GetRegisteredCommands() []tgbotapi.BotCommand {
 	r.mu.RLock()
@@ -211,10 +211,41 @@ func (b *Bot) processUpdate(ctx context.Context, update tgbotapi.Update) {
 		return
 	}
 
+	// 处理预结账查询（支付处理器负责应答，失败时拒绝本次支付）
+	if update.PreCheckoutQuery != nil {
+		if err := b.registry.RoutePreCheckoutQuery(ctx, update.PreCheckoutQuery); err != nil {
+			b.logger.Error("Failed to route pre-checkout query: %v", err)
+			b.answerPreCheckoutQuery(update.PreCheckoutQuery.ID, "支付暂时无法处理，请稍后重试")
+		}
+		return
+	}
+
 	// 其他类型的更新暂时忽略
 	b.logger.Debug("Received unhandled update type")
 }
 
+// answerPreCheckoutQuery 拒绝预结账查询
+func (b *Bot) answerPreCheckoutQuery(queryID, errorMessage string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := b.errorHandler.HandleAPIRequest(ctx, func() (tgbotapi.APIResponse, error) {
+		resp, err := b.api.Request(tgbotapi.PreCheckoutConfig{
+			PreCheckoutQueryID: queryID,
+			OK:                 false,
+			ErrorMessage:       errorMessage,
+		})
+		if err != nil {
+			return tgbotapi.APIResponse{}, err
+		}
+		return *resp, nil
+	})
+
+	if err != nil {
+		b.logger.Error("Failed to answer pre-checkout query: %v", err)
+	}
+}
+
 // sendErrorMessage 发送错误消息
 func (b *Bot) sendErrorMessage(chatID int64, message string) {
 	if err := b.SendMessage(chatID, message); err != nil {
@@ -0,0 +1,252 @@
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TransferEventTopic ERC20 Transfer(address,address,uint256) 事件签名
+const TransferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// Client EVM 链 JSON-RPC 客户端（BSC、Ethereum 等兼容链通用）
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	requestID  atomic.Int64
+}
+
+// NewClient 创建 EVM JSON-RPC 客户端
+func NewClient(endpoint string) *Client {
+	return &Client{
+		endpoint: endpoint,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Log 合约事件日志
+type Log struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockTimestamp  string   `json:"blockTimestamp,omitempty"` // 部分节点在日志中返回区块时间
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+// Receipt 交易回执
+type Receipt struct {
+	TransactionHash string `json:"transactionHash"`
+	BlockNumber     string `json:"blockNumber"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Status          string `json:"status"` // 0x1 成功，0x0 失败
+	Logs            []Log  `json:"logs"`
+}
+
+// Block 区块头信息
+type Block struct {
+	Number    string `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+}
+
+// FilterQuery eth_getLogs 查询条件
+type FilterQuery struct {
+	FromBlock int64
+	ToBlock   int64
+	Addresses []string   // 合约地址，为空表示不限
+	Topics    [][]string // 按位置匹配的主题，nil 表示该位置不限
+}
+
+// RPCError JSON-RPC 错误
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// BlockNumber 获取最新区块高度
+func (c *Client) BlockNumber(ctx context.Context) (int64, error) {
+	var result string
+	if err := c.call(ctx, "eth_blockNumber", []interface{}{}, &result); err != nil {
+		return 0, err
+	}
+	return ParseHexInt(result)
+}
+
+// GetTransactionReceipt 获取交易回执，交易未上链时返回 nil
+func (c *Client) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt *Receipt
+	if err := c.call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetBlockByNumber 获取区块头（不含交易列表）
+func (c *Client) GetBlockByNumber(ctx context.Context, number int64) (*Block, error) {
+	var block *Block
+	if err := c.call(ctx, "eth_getBlockByNumber", []interface{}{ToHex(number), false}, &block); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	return block, nil
+}
+
+// GetLogs 查询合约事件日志
+func (c *Client) GetLogs(ctx context.Context, query FilterQuery) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": ToHex(query.FromBlock),
+		"toBlock":   ToHex(query.ToBlock),
+	}
+	if len(query.Addresses) > 0 {
+		filter["address"] = query.Addresses
+	}
+	if len(query.Topics) > 0 {
+		topics := make([]interface{}, len(query.Topics))
+		for i, topic := range query.Topics {
+			if len(topic) > 0 {
+				topics[i] = topic
+			}
+		}
+		filter["topics"] = topics
+	}
+
+	var logs []Log
+	if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// call 执行 JSON-RPC 调用
+func (c *Client) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.requestID.Add(1),
+		"method":  method,
+		"params":  params,
+	}
+
+	jsonBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("RPC request failed with status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+	}
+	return nil
+}
+
+// ToHex 整数转换为 0x 前缀的十六进制字符串
+func ToHex(n int64) string {
+	return "0x" + strconv.FormatInt(n, 16)
+}
+
+// ParseHexInt 解析 0x 前缀的十六进制整数
+func ParseHexInt(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+// ParseHexBig 解析 0x 前缀的十六进制大整数（如 uint256）
+func ParseHexBig(s string) (*big.Int, error) {
+	hex := strings.TrimPrefix(s, "0x")
+	if hex == "" {
+		return new(big.Int), nil
+	}
+	value, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex number: %s", s)
+	}
+	return value, nil
+}
+
+// AddressTopic 地址转换为 32 字节的事件主题（用于按转出、转入地址过滤日志）
+func AddressTopic(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(address, "0x"))
+}
+
+// TopicAddress 从 32 字节的事件主题中取出地址（小写）
+func TopicAddress(topic string) string {
+	hex := strings.TrimPrefix(topic, "0x")
+	if len(hex) < 40 {
+		return ""
+	}
+	return "0x" + strings.ToLower(hex[len(hex)-40:])
+}
+
+// FormatUnits 按精度将链上最小单位转换为十进制字符串（如 1500000 / 10^6 = 1.5）
+func FormatUnits(value *big.Int, decimals int) string {
+	if decimals <= 0 {
+		return value.String()
+	}
+
+	negative := value.Sign() < 0
+	digits := new(big.Int).Abs(value).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	integer := digits[:len(digits)-decimals]
+	fraction := strings.TrimRight(digits[len(digits)-decimals:], "0")
+
+	result := integer
+	if fraction != "" {
+		result += "." + fraction
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 页面尺寸（单位：点）
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document 最小化的 PDF 文档生成器，只支持文本和直线，不依赖外部服务和字体文件
+// ASCII 字符使用标准 Helvetica 字体，其余字符使用阅读器内置的 STSong-Light 中文字体
+type Document struct {
+	pages []*bytes.Buffer
+}
+
+// New 创建空白文档
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage 新增一页，之后的绘制都在该页上
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount 返回页数
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Text 在当前页绘制一行文本，x、y 为距页面左上角的距离
+func (d *Document) Text(x, y, size float64, text string) {
+	page := d.currentPage()
+	fmt.Fprintf(page, "BT 1 0 0 1 %.2f %.2f Tm\n", x, PageHeight-y)
+	for _, run := range splitRuns(text) {
+		if run.ascii {
+			fmt.Fprintf(page, "/F1 %.1f Tf (%s) Tj\n", size, escapeLiteral(run.text))
+		} else {
+			fmt.Fprintf(page, "/F2 %.1f Tf <%s> Tj\n", size, encodeUCS2(run.text))
+		}
+	}
+	page.WriteString("ET\n")
+}
+
+// Line 在当前页绘制直线，坐标为距页面左上角的距离
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.currentPage(), "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Bytes 生成 PDF 文件内容
+func (d *Document) Bytes() []byte {
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = []*bytes.Buffer{{}}
+	}
+
+	// 对象编号：1 目录，2 页面树，3-6 字体，之后每页占用页面和内容流两个对象
+	const firstPageObject = 7
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+i*2)
+	}
+
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [5 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 6 0 R /DW 1000 >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	)
+	for i, page := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				PageWidth, PageHeight, firstPageObject+i*2+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+// TextWidth 估算文本宽度，用于排版和截断（Helvetica 按平均字宽估算，中文为全角）
+func TextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r < 0x80 {
+			width += 0.556
+		} else {
+			width += 1
+		}
+	}
+	return width * size
+}
+
+// Truncate 截断文本使其宽度不超过 maxWidth，被截断时以 ... 结尾
+func Truncate(text string, size, maxWidth float64) string {
+	if TextWidth(text, size) <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && TextWidth(string(runes)+"...", size) > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// currentPage 返回当前页，文档为空时自动新增一页
+func (d *Document) currentPage() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// textRun 使用同一字体的连续文本
+type textRun struct {
+	text  string
+	ascii bool
+}
+
+// splitRuns 按 ASCII / 非 ASCII 将文本切分为连续片段
+func splitRuns(text string) []textRun {
+	var runs []textRun
+	var current strings.Builder
+	currentASCII := true
+
+	for _, r := range text {
+		ascii := r < 0x80
+		if current.Len() > 0 && ascii != currentASCII {
+			runs = append(runs, textRun{text: current.String(), ascii: currentASCII})
+			current.Reset()
+		}
+		currentASCII = ascii
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		runs = append(runs, textRun{text: current.String(), ascii: currentASCII})
+	}
+	return runs
+}
+
+// escapeLiteral 转义 PDF 字面量字符串，控制字符替换为空格
+func escapeLiteral(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// encodeUCS2 将文本编码为 UCS-2 大端十六进制，超出基本平面的字符（如表情）替换为 ?
+func encodeUCS2(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type RetryConfig struct {
 	InitialDelay    time.Duration // 初始延迟
 	MaxDelay        time.Duration // 最大延迟
 	BackoffFactor   float64       // 退避因子
+	Jitter          float64       // 随机抖动比例（0-1），避免并发重试同时发生
 	RetryableErrors []error       // 可重试的错误类型
 }
 
@@ -70,6 +72,11 @@ func Retry(ctx context.Context, config *RetryConfig, fn RetryFunc, isRetryable I
 	return fmt.Errorf("retry failed after %d attempts, last error: %w", config.MaxRetries+1, lastErr)
 }
 
+// Delay 返回第 attempt 次重试（从 0 开始）前的等待时间，供跨进程的定时重试（如发件箱任务）计算下次执行时间
+func (c *RetryConfig) Delay(attempt int) time.Duration {
+	return calculateDelay(c, attempt)
+}
+
 // calculateDelay 计算延迟时间（指数退避）
 func calculateDelay(config *RetryConfig, attempt int) time.Duration {
 	delay := float64(config.InitialDelay) * math.Pow(config.BackoffFactor, float64(attempt))
@@ -78,6 +85,10 @@ func calculateDelay(config *RetryConfig, attempt int) time.Duration {
 		delay = float64(config.MaxDelay)
 	}
 
+	if config.Jitter > 0 {
+		delay += delay * config.Jitter * (rand.Float64()*2 - 1)
+	}
+
 	return time.Duration(delay)
 }
 
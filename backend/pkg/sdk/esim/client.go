@@ -2,6 +2,7 @@ package esim
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -160,6 +161,11 @@ func (c *Client) request(method, path string, data interface{}) (map[string]inte
 
 // requestTyped 发送API请求并解析到指定类型
 func (c *Client) requestTyped(method, path string, data interface{}, result interface{}) error {
+	return c.requestTypedContext(context.Background(), method, path, data, result)
+}
+
+// requestTypedContext 发送API请求并解析到指定类型，ctx 取消或超时时中断请求
+func (c *Client) requestTypedContext(ctx context.Context, method, path string, data interface{}, result interface{}) error {
 	timestamp := c.getTimestamp()
 	nonce := generateNonce(16)
 
@@ -190,7 +196,7 @@ func (c *Client) requestTyped(method, path string, data interface{}, result inte
 	fmt.Printf("  Timezone Offset: %d hours\n\n", c.timezoneOffset)
 
 	reqURL := c.baseURL + path
-	req, err := http.NewRequest(method, reqURL, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, bodyReader)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
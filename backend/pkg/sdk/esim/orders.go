@@ -1,6 +1,7 @@
 package esim
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -65,6 +66,7 @@ type CreateOrderRequest struct {
 	CustomerEmail string `json:"customerEmail"`           // 客户邮箱地址（必填）
 	CustomerPhone string `json:"customerPhone,omitempty"` // 客户手机号（可选）
 	Quantity      int    `json:"quantity,omitempty"`      // 购买数量，默认为1（可选）
+	Reference     string `json:"reference,omitempty"`     // 商户订单号（可选），便于对账；接口文档未承诺按该字段去重
 }
 
 // CreateOrderData 创建订单数据
@@ -126,8 +128,13 @@ type OrderParams struct {
 
 // CreateOrder 创建订单
 func (c *Client) CreateOrder(req CreateOrderRequest) (*CreateOrderResponse, error) {
+	return c.CreateOrderContext(context.Background(), req)
+}
+
+// CreateOrderContext 创建订单，ctx 取消或超时时中断请求
+func (c *Client) CreateOrderContext(ctx context.Context, req CreateOrderRequest) (*CreateOrderResponse, error) {
 	var response CreateOrderResponse
-	err := c.requestTyped("POST", "/api/v1/orders", req, &response)
+	err := c.requestTypedContext(ctx, "POST", "/api/v1/orders", req, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -206,10 +213,15 @@ func (c *Client) GetOrders(params *OrderParams) (*OrderListResponse, error) {
 
 // GetOrder 获取订单详情
 func (c *Client) GetOrder(orderNo string) (*OrderDetailResponse, error) {
+	return c.GetOrderContext(context.Background(), orderNo)
+}
+
+// GetOrderContext 获取订单详情，ctx 取消或超时时中断请求
+func (c *Client) GetOrderContext(ctx context.Context, orderNo string) (*OrderDetailResponse, error) {
 	path := fmt.Sprintf("/api/v1/orders/%s", orderNo)
 
 	var response OrderDetailResponse
-	err := c.requestTyped("GET", path, nil, &response)
+	err := c.requestTypedContext(ctx, "GET", path, nil, &response)
 	if err != nil {
 		return nil, err
 	}
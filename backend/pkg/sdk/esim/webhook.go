@@ -0,0 +1,93 @@
+package esim
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Webhook 请求头，与 API 请求使用相同的签名头
+const (
+	HeaderTimestamp = "x-timestamp"
+	HeaderNonce     = "x-nonce"
+	HeaderSignature = "x-signature"
+)
+
+// WebhookEventType Webhook 事件类型
+type WebhookEventType string
+
+const (
+	WebhookEventOrderCompleted WebhookEventType = "order.completed" // 订单已完成，data 为订单详情（Order）
+	WebhookEventOrderFailed    WebhookEventType = "order.failed"    // 订单失败或已取消，data 为订单详情（Order）
+	WebhookEventEsimUsage      WebhookEventType = "esim.usage"      // eSIM 使用情况变化，data 为 EsimUsageData
+)
+
+// Webhook 校验错误
+var (
+	ErrWebhookSignature = errors.New("webhook signature mismatch")
+	ErrWebhookTimestamp = errors.New("webhook timestamp out of tolerance")
+)
+
+// WebhookEvent Webhook 事件
+type WebhookEvent struct {
+	ID        string           `json:"id"`        // 事件ID
+	Type      WebhookEventType `json:"type"`      // 事件类型
+	CreatedAt string           `json:"createdAt"` // 事件时间
+	Data      json.RawMessage  `json:"data"`      // 事件数据，按类型解析
+}
+
+// VerifyWebhook 校验 Webhook 请求
+// 签名方式与 API 请求相同：HMAC-SHA256(APISecret, method + path + body + timestamp + nonce)；
+// timestamp 为毫秒时间戳，按客户端时区偏移换算后与当前时间相差超过 tolerance 时拒绝
+func (c *Client) VerifyWebhook(method, path, body, timestamp, nonce, signature string, tolerance time.Duration) error {
+	expected := c.generateSignature(method, path, body, timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrWebhookSignature
+	}
+
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+	now, err := strconv.ParseInt(c.getTimestamp(), 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+	if diff := time.Duration(now-millis) * time.Millisecond; diff > tolerance || diff < -tolerance {
+		return ErrWebhookTimestamp
+	}
+	return nil
+}
+
+// ParseWebhookEvent 解析 Webhook 事件
+func ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("unmarshal webhook event: %w", err)
+	}
+	if event.Type == "" {
+		return nil, errors.New("webhook event type is empty")
+	}
+	return &event, nil
+}
+
+// OrderDetail 解析订单事件数据
+func (e *WebhookEvent) OrderDetail() (*Order, error) {
+	var order Order
+	if err := json.Unmarshal(e.Data, &order); err != nil {
+		return nil, fmt.Errorf("unmarshal webhook order: %w", err)
+	}
+	return &order, nil
+}
+
+// UsageData 解析 eSIM 使用情况事件数据
+func (e *WebhookEvent) UsageData() (*EsimUsageData, error) {
+	var usage EsimUsageData
+	if err := json.Unmarshal(e.Data, &usage); err != nil {
+		return nil, fmt.Errorf("unmarshal webhook usage: %w", err)
+	}
+	return &usage, nil
+}
@@ -0,0 +1,141 @@
+package tron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// AddressPrefix TRON 主网地址的版本前缀
+const AddressPrefix = 0x41
+
+// base58Alphabet Bitcoin 风格的 Base58 字母表
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// HexToBase58 将十六进制地址（41 开头的 21 字节，或不带前缀的 20 字节）转换为 base58check 地址
+func HexToBase58(hexAddress string) (string, error) {
+	hexAddress = strings.TrimPrefix(strings.ToLower(hexAddress), "0x")
+	raw, err := hex.DecodeString(hexAddress)
+	if err != nil {
+		return "", fmt.Errorf("invalid hex address %q: %w", hexAddress, err)
+	}
+
+	switch len(raw) {
+	case 20:
+		raw = append([]byte{AddressPrefix}, raw...)
+	case 21:
+		if raw[0] != AddressPrefix {
+			return "", fmt.Errorf("invalid address prefix 0x%02x", raw[0])
+		}
+	default:
+		return "", fmt.Errorf("invalid address length %d", len(raw))
+	}
+
+	return encodeBase58Check(raw), nil
+}
+
+// DecodeAddress 离线解码 base58check 地址，校验校验和、长度和 0x41 前缀，返回 21 字节地址
+func DecodeAddress(address string) ([]byte, error) {
+	if len(address) != 34 {
+		return nil, fmt.Errorf("invalid address length %d", len(address))
+	}
+	raw, err := decodeBase58Check(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 21 {
+		return nil, fmt.Errorf("invalid address length %d", len(raw))
+	}
+	if raw[0] != AddressPrefix {
+		return nil, fmt.Errorf("invalid address prefix 0x%02x", raw[0])
+	}
+	return raw, nil
+}
+
+// IsValidAddress 离线校验 TRON base58check 地址（T 开头、0x41 前缀、双重 SHA256 校验和），不需要访问节点
+func IsValidAddress(address string) bool {
+	_, err := DecodeAddress(address)
+	return err == nil
+}
+
+// Base58ToHex 将 base58check 地址转换为 41 开头的十六进制地址
+func Base58ToHex(address string) (string, error) {
+	raw, err := DecodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// PublicKeyToAddress 将 33 字节压缩公钥转换为 TRON base58check 地址
+// 地址为 0x41 + Keccak-256(X||Y) 的后 20 字节
+func PublicKeyToAddress(compressed []byte) (string, error) {
+	point, err := decompressPoint(compressed)
+	if err != nil {
+		return "", err
+	}
+	hash := keccak256(point.uncompressed())
+	return encodeBase58Check(append([]byte{AddressPrefix}, hash[12:]...)), nil
+}
+
+// encodeBase58Check 追加双重 SHA256 校验和后进行 Base58 编码
+func encodeBase58Check(payload []byte) string {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	data := append(append([]byte{}, payload...), second[:4]...)
+
+	value := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	var encoded []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, base, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	// 每个前导零字节编码为字符 1
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// decodeBase58Check Base58 解码并校验双重 SHA256 校验和，返回去掉校验和的数据
+func decodeBase58Check(encoded string) ([]byte, error) {
+	value := new(big.Int)
+	base := big.NewInt(58)
+	for _, ch := range encoded {
+		index := strings.IndexRune(base58Alphabet, ch)
+		if index < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", ch)
+		}
+		value.Mul(value, base).Add(value, big.NewInt(int64(index)))
+	}
+
+	decoded := value.Bytes()
+	for _, ch := range encoded {
+		if ch != rune(base58Alphabet[0]) {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+	if len(decoded) < 5 {
+		return nil, fmt.Errorf("base58check data too short")
+	}
+
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if string(second[:4]) != string(checksum) {
+		return nil, fmt.Errorf("invalid base58check checksum")
+	}
+	return payload, nil
+}
@@ -144,44 +144,34 @@ func (c *Client) GetAddressTransactions(ctx context.Context, address string, lim
 	return response.Data, nil
 }
 
-// GetLatestBlock 获取最新区块信息
+// GetLatestBlock 获取最新区块信息（/wallet/getnowblock）
 func (c *Client) GetLatestBlock(ctx context.Context) (*BlockInfo, error) {
-	url := fmt.Sprintf("%s/wallet/getnowblock", c.baseURL)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte("{}")))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("TRON-PRO-API-KEY", c.apiKey)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var blockInfo BlockInfo
-	if err := json.Unmarshal(body, &blockInfo); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	return &blockInfo, nil
+	var raw struct {
+		BlockID     string `json:"blockID"`
+		BlockHeader struct {
+			RawData struct {
+				Number    int64 `json:"number"`
+				Timestamp int64 `json:"timestamp"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/wallet/getnowblock", nil, struct{}{}, &raw); err != nil {
+		return nil, err
+	}
+	if raw.BlockHeader.RawData.Number <= 0 {
+		return nil, fmt.Errorf("invalid latest block response")
+	}
+
+	return &BlockInfo{
+		BlockNumber: raw.BlockHeader.RawData.Number,
+		BlockHash:   raw.BlockID,
+		Timestamp:   raw.BlockHeader.RawData.Timestamp,
+		TxCount:     len(raw.Transactions),
+	}, nil
 }
 
-// ValidateAddress 验证 TRON 地址格式
+// ValidateAddress 通过节点验证 TRON 地址格式，需要网络请求；只校验格式时使用离线的 IsValidAddress
 func (c *Client) ValidateAddress(ctx context.Context, address string) (bool, error) {
 	url := fmt.Sprintf("%s/wallet/validateaddress", c.baseURL)
 
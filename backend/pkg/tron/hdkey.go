@@ -0,0 +1,116 @@
+package tron
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// BIP32 / BIP44 常量
+const (
+	// xpubVersion 主网扩展公钥版本号
+	xpubVersion = 0x0488B21E
+	// HardenedKeyStart 强化派生的起始索引，扩展公钥无法派生强化子密钥
+	HardenedKeyStart = 0x80000000
+	// AccountKeyDepth BIP44 账户级扩展公钥 m/44'/195'/account' 的深度
+	AccountKeyDepth = 3
+	// ExternalChain BIP44 收款链（m/44'/195'/account'/0/index）
+	ExternalChain = 0
+)
+
+// ErrHardenedDerivation 扩展公钥不能派生强化子密钥
+var ErrHardenedDerivation = errors.New("cannot derive hardened child from extended public key")
+
+// ExtendedPublicKey BIP32 扩展公钥
+type ExtendedPublicKey struct {
+	Depth       uint8
+	ChildNumber uint32
+	ChainCode   []byte // 32 字节链码
+	PublicKey   []byte // 33 字节压缩公钥
+}
+
+// ParseExtendedPublicKey 解析 base58check 编码的 xpub
+func ParseExtendedPublicKey(xpub string) (*ExtendedPublicKey, error) {
+	payload, err := decodeBase58Check(xpub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xpub: %w", err)
+	}
+	if len(payload) != 78 {
+		return nil, fmt.Errorf("invalid xpub length %d", len(payload))
+	}
+	if version := binary.BigEndian.Uint32(payload[0:4]); version != xpubVersion {
+		return nil, fmt.Errorf("unsupported xpub version 0x%08x (private keys are not accepted)", version)
+	}
+
+	key := &ExtendedPublicKey{
+		Depth:       payload[4],
+		ChildNumber: binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:   append([]byte{}, payload[13:45]...),
+		PublicKey:   append([]byte{}, payload[45:78]...),
+	}
+	if _, err := decompressPoint(key.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid xpub public key: %w", err)
+	}
+	return key, nil
+}
+
+// Child 按 BIP32 CKDpub 派生非强化子公钥
+func (k *ExtendedPublicKey) Child(index uint32) (*ExtendedPublicKey, error) {
+	if index >= HardenedKeyStart {
+		return nil, ErrHardenedDerivation
+	}
+
+	parent, err := decompressPoint(k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 37)
+	copy(data, k.PublicKey)
+	binary.BigEndian.PutUint32(data[33:], index)
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	// IL 不小于 n 或结果为无穷远点时该索引无效（概率约 2^-127），调用方应跳到下一个索引
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveN) >= 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	child := addPoints(scalarBaseMult(tweak), parent)
+	if child == nil {
+		return nil, fmt.Errorf("invalid child key at index %d: %w", index, errPointAtInfinity)
+	}
+
+	return &ExtendedPublicKey{
+		Depth:       k.Depth + 1,
+		ChildNumber: index,
+		ChainCode:   append([]byte{}, sum[32:]...),
+		PublicKey:   child.compress(),
+	}, nil
+}
+
+// Address 返回该公钥对应的 TRON 地址
+func (k *ExtendedPublicKey) Address() (string, error) {
+	return PublicKeyToAddress(k.PublicKey)
+}
+
+// DeriveDepositAddress 从账户级扩展公钥（m/44'/195'/account'）派生收款地址 m/44'/195'/account'/0/index
+func DeriveDepositAddress(account *ExtendedPublicKey, index uint32) (string, error) {
+	if account.Depth != AccountKeyDepth {
+		return "", fmt.Errorf("xpub must be an account key at depth %d (m/44'/195'/account'), got depth %d", AccountKeyDepth, account.Depth)
+	}
+
+	external, err := account.Child(ExternalChain)
+	if err != nil {
+		return "", err
+	}
+	child, err := external.Child(index)
+	if err != nil {
+		return "", err
+	}
+	return child.Address()
+}
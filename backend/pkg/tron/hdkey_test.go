@@ -0,0 +1,92 @@
+package tron
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	got := hex.EncodeToString(keccak256(nil))
+	if want := "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"; got != want {
+		t.Errorf("keccak256(\"\") = %s, want %s", got, want)
+	}
+}
+
+func TestPublicKeyToAddress(t *testing.T) {
+	// 私钥 1 的公钥为生成元 G，对应以太坊地址 0x7e5f4552091a69125d5dfcb7b8c2659029395bdf
+	compressed := scalarBaseMult(big.NewInt(1)).compress()
+	got, err := PublicKeyToAddress(compressed)
+	if err != nil {
+		t.Fatalf("PublicKeyToAddress failed: %v", err)
+	}
+	want, _ := HexToBase58("7e5f4552091a69125d5dfcb7b8c2659029395bdf")
+	if got != want {
+		t.Errorf("PublicKeyToAddress(G) = %s, want %s", got, want)
+	}
+
+	double := scalarBaseMult(big.NewInt(2))
+	if x := hex.EncodeToString(double.x.Bytes()); x != "c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5" {
+		t.Errorf("2G.x = %s", x)
+	}
+}
+
+func TestExtendedPublicKeyChild(t *testing.T) {
+	// BIP32 测试向量 1：m/0H 的扩展公钥派生 m/0H/1
+	parent, err := ParseExtendedPublicKey("xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw")
+	if err != nil {
+		t.Fatalf("ParseExtendedPublicKey failed: %v", err)
+	}
+	if parent.Depth != 1 {
+		t.Errorf("depth = %d, want 1", parent.Depth)
+	}
+
+	child, err := parent.Child(1)
+	if err != nil {
+		t.Fatalf("Child failed: %v", err)
+	}
+	if got := hex.EncodeToString(child.PublicKey); got != "03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c" {
+		t.Errorf("child public key = %s", got)
+	}
+	if got := hex.EncodeToString(child.ChainCode); got != "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19" {
+		t.Errorf("child chain code = %s", got)
+	}
+
+	if _, err := parent.Child(HardenedKeyStart); err != ErrHardenedDerivation {
+		t.Errorf("hardened derivation error = %v", err)
+	}
+	// 深度不是账户级时拒绝派生收款地址
+	if _, err := DeriveDepositAddress(parent, 0); err == nil {
+		t.Errorf("expected error for non-account xpub")
+	}
+}
+
+func TestOfflineAddressValidation(t *testing.T) {
+	// USDT-TRC20 合约地址及其十六进制形式
+	const usdt = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	const usdtHex = "41a614f803b6fd780986a42c78ec9c7f77e6ded13c"
+
+	if !IsValidAddress(usdt) {
+		t.Errorf("IsValidAddress(%s) = false", usdt)
+	}
+	if got, err := Base58ToHex(usdt); err != nil || got != usdtHex {
+		t.Errorf("Base58ToHex = %s, %v; want %s", got, err, usdtHex)
+	}
+	if got, err := HexToBase58(usdtHex); err != nil || got != usdt {
+		t.Errorf("HexToBase58 = %s, %v; want %s", got, err, usdt)
+	}
+
+	invalid := []string{
+		"",
+		"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u", // 校验和错误
+		"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6",  // 长度错误
+		"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj0t", // 非 base58 字符
+		"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", // 比特币地址（前缀不是 0x41）
+		"0xa614f803b6fd780986a42c78ec9c7f77e6ded13c",
+	}
+	for _, address := range invalid {
+		if IsValidAddress(address) {
+			t.Errorf("IsValidAddress(%q) = true", address)
+		}
+	}
+}
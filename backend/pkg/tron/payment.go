@@ -0,0 +1,22 @@
+package tron
+
+import (
+	"net/url"
+)
+
+// PaymentURI 生成 TRON 收款 URI：tron:<收款地址>?amount=<数量>[&token=<TRC20 合约地址>]
+// amount 为资产数量（非最小单位），contract 为空表示 TRX 转账；支持 URI 的钱包扫码后自动填写地址和金额
+func PaymentURI(address, amount, contract string) string {
+	query := url.Values{}
+	if amount != "" {
+		query.Set("amount", amount)
+	}
+	if contract != "" {
+		query.Set("token", contract)
+	}
+	uri := "tron:" + address
+	if encoded := query.Encode(); encoded != "" {
+		uri += "?" + encoded
+	}
+	return uri
+}
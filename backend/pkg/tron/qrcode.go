@@ -0,0 +1,510 @@
+package tron
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QRCode 本地生成的二维码（字节模式、纠错等级 M），用于在充值页面展示收款地址和金额
+// 只实现版本 1-10（最多 213 字节），足以容纳支付 URI
+type QRCode struct {
+	size    int
+	modules [][]bool // modules[y][x] 为 true 表示深色模块
+}
+
+// qrQuietZone 二维码四周的空白区宽度（模块数）
+const qrQuietZone = 4
+
+// qrVersionM 纠错等级 M 下各版本的纠错码字数和分块
+type qrVersionM struct {
+	ecPerBlock int      // 每块纠错码字数
+	blocks     [][2]int // 分组：块数、每块数据码字数
+	align      []int    // 校正图形中心坐标
+}
+
+var qrVersionsM = []qrVersionM{
+	1:  {10, [][2]int{{1, 16}}, nil},
+	2:  {16, [][2]int{{1, 28}}, []int{6, 18}},
+	3:  {26, [][2]int{{1, 44}}, []int{6, 22}},
+	4:  {18, [][2]int{{2, 32}}, []int{6, 26}},
+	5:  {24, [][2]int{{2, 43}}, []int{6, 30}},
+	6:  {16, [][2]int{{4, 27}}, []int{6, 34}},
+	7:  {18, [][2]int{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+// dataCodewords 版本可容纳的数据码字数
+func (v qrVersionM) dataCodewords() int {
+	total := 0
+	for _, group := range v.blocks {
+		total += group[0] * group[1]
+	}
+	return total
+}
+
+// EncodeQRCode 将内容编码为二维码，自动选择能容纳内容的最小版本
+func EncodeQRCode(content string) (*QRCode, error) {
+	data := []byte(content)
+	for version := 1; version < len(qrVersionsM); version++ {
+		spec := qrVersionsM[version]
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 > spec.dataCodewords()*8 {
+			continue
+		}
+
+		codewords := qrEncodeData(data, countBits, spec.dataCodewords())
+		qr := newQRCode(version)
+		qr.placeCodewords(qrInterleave(codewords, spec))
+		qr.applyBestMask()
+		return &QRCode{size: qr.size, modules: qr.modules}, nil
+	}
+	return nil, fmt.Errorf("content too long for QR code: %d bytes", len(data))
+}
+
+// Size 二维码边长（模块数，不含空白区）
+func (q *QRCode) Size() int {
+	return q.size
+}
+
+// Dark 返回第 y 行第 x 列的模块是否为深色
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// PNG 渲染为 PNG 图片，scale 为每个模块的像素数，四周保留 4 个模块的空白区
+func (q *QRCode) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (q.size + 2*qrQuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG 渲染为 SVG 图片，scale 为每个模块的像素数，四周保留 4 个模块的空白区
+func (q *QRCode) SVG(scale int) string {
+	if scale < 1 {
+		scale = 1
+	}
+	width := q.size + 2*qrQuietZone
+	var path strings.Builder
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		width*scale, width*scale, width, width, path.String())
+}
+
+// qrEncodeData 字节模式编码：模式指示符、字符计数、数据、终止符，补齐到数据码字数
+func qrEncodeData(data []byte, countBits, capacity int) []byte {
+	var bits []bool
+	appendBits := func(value, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	appendBits(0x4, 4)
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	terminator := capacity*8 - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// qrInterleave 按版本分块计算纠错码字，数据码字和纠错码字分别按列交错排列
+func qrInterleave(data []byte, spec qrVersionM) []byte {
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for _, group := range spec.blocks {
+		for i := 0; i < group[0]; i++ {
+			block := data[offset : offset+group[1]]
+			offset += group[1]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, reedSolomonRemainder(block, spec.ecPerBlock))
+		}
+	}
+
+	var result []byte
+	for i := 0; ; i++ {
+		appended := false
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+				appended = true
+			}
+		}
+		if !appended {
+			break
+		}
+	}
+	for i := 0; i < spec.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply GF(256) 乘法，本原多项式 x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		carry := z >> 7
+		z = z<<1 ^ carry*0x1D
+		z ^= (y >> i & 1) * x
+	}
+	return z
+}
+
+// reedSolomonRemainder 计算数据块的纠错码字（生成多项式的根为 α^0 .. α^(degree-1)）
+func reedSolomonRemainder(data []byte, degree int) []byte {
+	// 生成多项式系数（不含最高次项），从高次到低次
+	generator := make([]byte, degree)
+	generator[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			generator[j] = gfMultiply(generator[j], root)
+			if j+1 < degree {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	remainder := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[degree-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMultiply(generator[i], factor)
+		}
+	}
+	return remainder
+}
+
+// qrBuilder 构造二维码矩阵，记录功能图形所在的模块
+type qrBuilder struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// newQRCode 绘制定位、分隔、定时、校正图形，并为格式信息和版本信息预留位置
+func newQRCode(version int) *qrBuilder {
+	size := version*4 + 17
+	qr := &qrBuilder{version: version, size: size}
+	qr.modules = make([][]bool, size)
+	qr.isFunction = make([][]bool, size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, size)
+		qr.isFunction[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(size-4, 3)
+	qr.drawFinder(3, size-4)
+
+	align := qrVersionsM[version].align
+	last := len(align) - 1
+	for i, y := range align {
+		for j, x := range align {
+			// 与定位图形重叠的三个角不绘制校正图形
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			qr.drawAlignment(x, y)
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+	return qr
+}
+
+// setFunction 设置功能图形模块
+func (qr *qrBuilder) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+// drawFinder 绘制以 (x, y) 为中心的定位图形及其分隔符
+func (qr *qrBuilder) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= qr.size || yy < 0 || yy >= qr.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			qr.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment 绘制以 (x, y) 为中心的校正图形
+func (qr *qrBuilder) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			qr.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits 绘制两份格式信息（纠错等级 M 的指示位为 00）和固定的深色模块
+func (qr *qrBuilder) drawFormatBits(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true)
+}
+
+// qrFormatBits 计算 15 位格式信息：纠错等级和掩码的 BCH(15,5) 编码并与 0x5412 异或
+func qrFormatBits(mask int) int {
+	data := mask // 纠错等级 M 的指示位为 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawVersion 版本 7 及以上绘制两份 18 位版本信息
+func (qr *qrBuilder) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+	bits := qrVersionBits(qr.version)
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunction(a, b, dark)
+		qr.setFunction(b, a, dark)
+	}
+}
+
+// qrVersionBits 计算 18 位版本信息：版本号的 BCH(18,6) 编码
+func qrVersionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// placeCodewords 按之字形从右下角开始两列一组放置码字，跳过功能图形和第 6 列定时图形
+func (qr *qrBuilder) placeCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if qr.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				qr.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// qrMask 判断掩码图形在 (x, y) 处是否翻转
+func qrMask(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask 对数据区模块应用掩码（异或，再次应用即撤销）
+func (qr *qrBuilder) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.isFunction[y][x] && qrMask(mask, x, y) {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask 依次尝试 8 种掩码，选用惩罚分最低的一种
+func (qr *qrBuilder) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask)
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+}
+
+// penalty 按规范的四条规则计算掩码惩罚分
+func (qr *qrBuilder) penalty() int {
+	score := 0
+	line := func(get func(i int) bool) {
+		run := 1
+		for i := 1; i <= qr.size; i++ {
+			if i < qr.size && get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				score += 3 + run - 5
+			}
+			run = 1
+		}
+		// 1:1:3:1:1 的类定位图形，一侧带 4 个浅色模块
+		for i := 0; i+len(qrFinderLike[0]) <= qr.size; i++ {
+			if qrMatches(get, i, qrFinderLike[0]) || qrMatches(get, i, qrFinderLike[1]) {
+				score += 40
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < qr.size; y++ {
+		line(func(i int) bool { return qr.modules[y][i] })
+		line(func(i int) bool { return qr.modules[i][y] })
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := qr.size * qr.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+// qrFinderLike 惩罚规则 3 的两种类定位图形
+var qrFinderLike = [2][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// qrMatches 检查一行（列）从 start 开始的模块是否与图形一致
+func qrMatches(get func(i int) bool, start int, pattern []bool) bool {
+	for j, dark := range pattern {
+		if get(start+j) != dark {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
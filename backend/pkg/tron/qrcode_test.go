@@ -0,0 +1,200 @@
+package tron
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestQRCodeReedSolomonAndFormat(t *testing.T) {
+	// 版本 1-M 的数据码字 -> 纠错码字
+	vectors := map[string]string{
+		"10200c566180ec11ec11ec11ec11ec11": "a524d4c1ed36c7872c55", // ISO/IEC 18004 附录示例 "01234567"
+		"205b0b78d172dc4d4340ec11ec11ec11": "c4232777ebd7e7e25d17", // "HELLO WORLD"
+	}
+	for data, want := range vectors {
+		raw, _ := hex.DecodeString(data)
+		if got := hex.EncodeToString(reedSolomonRemainder(raw, 10)); got != want {
+			t.Errorf("reed-solomon remainder of %s = %s, want %s", data, got, want)
+		}
+	}
+
+	if got := qrFormatBits(0); got != 0x5412 {
+		t.Errorf("format bits (M, mask 0) = %#x, want 0x5412", got)
+	}
+	if got := qrVersionBits(7); got != 0x07c94 {
+		t.Errorf("version bits (7) = %#x, want 0x07c94", got)
+	}
+}
+
+func TestEncodeQRCodeRoundTrip(t *testing.T) {
+	address := "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	contents := []string{
+		"hello",
+		PaymentURI(address, "10.1234", ""),
+		PaymentURI(address, "10.1234", address) + "&memo=" + strings.Repeat("x", 60),
+	}
+	for _, content := range contents {
+		qr, err := EncodeQRCode(content)
+		if err != nil {
+			t.Fatalf("EncodeQRCode(%q) failed: %v", content, err)
+		}
+		if got := decodeQRCode(t, qr); got != content {
+			t.Errorf("decoded %q, want %q", got, content)
+		}
+
+		image, err := qr.PNG(4)
+		if err != nil {
+			t.Fatalf("PNG failed: %v", err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(image))
+		if err != nil {
+			t.Fatalf("invalid PNG: %v", err)
+		}
+		if width := decoded.Bounds().Dx(); width != (qr.Size()+8)*4 {
+			t.Errorf("PNG width = %d", width)
+		}
+		if svg := qr.SVG(4); !strings.HasPrefix(svg, "<svg") {
+			t.Errorf("SVG = %q", svg)
+		}
+	}
+
+	if _, err := EncodeQRCode(strings.Repeat("x", 300)); err == nil {
+		t.Errorf("expected error for content exceeding version 10")
+	}
+}
+
+// decodeQRCode 按编码的逆过程读取二维码内容，并校验格式信息和纠错码字
+func decodeQRCode(t *testing.T, qr *QRCode) string {
+	t.Helper()
+	version := (qr.Size() - 17) / 4
+	spec := qrVersionsM[version]
+	layout := newQRCode(version)
+
+	// 两份格式信息应一致
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var x1, y1, x2, y2 int
+		switch {
+		case i <= 5:
+			x1, y1 = 8, i
+		case i == 6:
+			x1, y1 = 8, 7
+		case i == 7:
+			x1, y1 = 8, 8
+		case i == 8:
+			x1, y1 = 7, 8
+		default:
+			x1, y1 = 14-i, 8
+		}
+		if i < 8 {
+			x2, y2 = qr.Size()-1-i, 8
+		} else {
+			x2, y2 = 8, qr.Size()-15+i
+		}
+		if qr.Dark(x1, y1) {
+			first |= 1 << i
+		}
+		if qr.Dark(x2, y2) {
+			second |= 1 << i
+		}
+	}
+	if first != second {
+		t.Fatalf("format copies differ: %#x vs %#x", first, second)
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if qrFormatBits(m) == first {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("invalid format bits %#x", first)
+	}
+
+	// 按之字形读取码字
+	var bits []bool
+	for right := qr.Size() - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size(); vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = qr.Size() - 1 - vert
+				}
+				if !layout.isFunction[y][x] {
+					bits = append(bits, qr.Dark(x, y) != qrMask(mask, x, y))
+				}
+			}
+		}
+	}
+	total := spec.dataCodewords()
+	for _, group := range spec.blocks {
+		total += group[0] * spec.ecPerBlock
+	}
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 1 << (7 - j)
+			}
+		}
+	}
+
+	// 反交错并校验纠错码字
+	var blocks [][]byte
+	for _, group := range spec.blocks {
+		for i := 0; i < group[0]; i++ {
+			blocks = append(blocks, make([]byte, 0, group[1]))
+		}
+	}
+	index := 0
+	for i := 0; index < spec.dataCodewords(); i++ {
+		for b := range blocks {
+			if i < cap(blocks[b]) {
+				blocks[b] = append(blocks[b], codewords[index])
+				index++
+			}
+		}
+	}
+	var data []byte
+	for b, block := range blocks {
+		ec := make([]byte, spec.ecPerBlock)
+		for i := range ec {
+			ec[i] = codewords[spec.dataCodewords()+i*len(blocks)+b]
+		}
+		if !bytes.Equal(reedSolomonRemainder(block, spec.ecPerBlock), ec) {
+			t.Fatalf("block %d error correction mismatch", b)
+		}
+		data = append(data, block...)
+	}
+
+	// 字节模式：4 位模式指示符 + 字符计数 + 数据
+	readBits := func(offset, length int) int {
+		value := 0
+		for i := 0; i < length; i++ {
+			value <<= 1
+			if data[(offset+i)/8]>>(7-(offset+i)%8)&1 == 1 {
+				value |= 1
+			}
+		}
+		return value
+	}
+	if mode := readBits(0, 4); mode != 0x4 {
+		t.Fatalf("mode = %#x, want byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	length := readBits(4, countBits)
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(readBits(4+countBits+i*8, 8))
+	}
+	return string(content)
+}
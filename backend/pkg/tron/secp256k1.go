@@ -0,0 +1,115 @@
+package tron
+
+import (
+	"errors"
+	"math/big"
+)
+
+// secp256k1 曲线参数（y² = x³ + 7，定义在素数域 p 上）
+// 只实现公钥推导需要的点运算，服务端不处理私钥，因此不需要常数时间实现
+var (
+	curveP, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	curveN, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	curveGx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	curveGy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+	curveB     = big.NewInt(7)
+)
+
+// errPointAtInfinity 点运算结果为无穷远点
+var errPointAtInfinity = errors.New("point at infinity")
+
+// curvePoint 仿射坐标下的曲线点，nil 表示无穷远点
+type curvePoint struct {
+	x, y *big.Int
+}
+
+// decompressPoint 解析 33 字节压缩公钥
+func decompressPoint(compressed []byte) (*curvePoint, error) {
+	if len(compressed) != 33 || (compressed[0] != 0x02 && compressed[0] != 0x03) {
+		return nil, errors.New("invalid compressed public key")
+	}
+
+	x := new(big.Int).SetBytes(compressed[1:])
+	if x.Cmp(curveP) >= 0 {
+		return nil, errors.New("public key x out of range")
+	}
+
+	// y² = x³ + 7，p ≡ 3 (mod 4)，平方根为 (y²)^((p+1)/4)
+	ySquared := new(big.Int).Exp(x, big.NewInt(3), curveP)
+	ySquared.Add(ySquared, curveB).Mod(ySquared, curveP)
+	exponent := new(big.Int).Add(curveP, big.NewInt(1))
+	exponent.Rsh(exponent, 2)
+	y := new(big.Int).Exp(ySquared, exponent, curveP)
+	if new(big.Int).Exp(y, big.NewInt(2), curveP).Cmp(ySquared) != 0 {
+		return nil, errors.New("public key is not on curve")
+	}
+
+	if y.Bit(0) != uint(compressed[0]&1) {
+		y.Sub(curveP, y)
+	}
+	return &curvePoint{x: x, y: y}, nil
+}
+
+// compress 序列化为 33 字节压缩公钥
+func (pt *curvePoint) compress() []byte {
+	out := make([]byte, 33)
+	out[0] = 0x02 | byte(pt.y.Bit(0))
+	pt.x.FillBytes(out[1:])
+	return out
+}
+
+// uncompressed 序列化为 64 字节 X||Y（不含 0x04 前缀）
+func (pt *curvePoint) uncompressed() []byte {
+	out := make([]byte, 64)
+	pt.x.FillBytes(out[:32])
+	pt.y.FillBytes(out[32:])
+	return out
+}
+
+// addPoints 计算 a + b
+func addPoints(a, b *curvePoint) *curvePoint {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		sum := new(big.Int).Add(a.y, b.y)
+		if sum.Mod(sum, curveP).Sign() == 0 {
+			return nil
+		}
+		// 倍点：slope = 3x² / 2y
+		numerator := new(big.Int).Mul(a.x, a.x)
+		numerator.Mul(numerator, big.NewInt(3))
+		denominator := new(big.Int).Lsh(a.y, 1)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, curveP))
+	} else {
+		numerator := new(big.Int).Sub(b.y, a.y)
+		denominator := new(big.Int).Sub(b.x, a.x)
+		denominator.Mod(denominator, curveP)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, curveP))
+	}
+	slope.Mod(slope, curveP)
+
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, curveP)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope).Sub(y, a.y).Mod(y, curveP)
+	return &curvePoint{x: x, y: y}
+}
+
+// scalarBaseMult 计算 k·G
+func scalarBaseMult(k *big.Int) *curvePoint {
+	var result *curvePoint
+	addend := &curvePoint{x: new(big.Int).Set(curveGx), y: new(big.Int).Set(curveGy)}
+	for i := 0; i < k.BitLen(); i++ {
+		if k.Bit(i) == 1 {
+			result = addPoints(result, addend)
+		}
+		addend = addPoints(addend, addend)
+	}
+	return result
+}
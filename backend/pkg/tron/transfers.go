@@ -0,0 +1,375 @@
+package tron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TransferEventTopic TRC20 Transfer(address,address,uint256) 事件签名（不带 0x）
+const TransferEventTopic = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// transferPageSize TronGrid 单页最大条数
+const transferPageSize = 200
+
+// TokenInfo TRC20 代币信息
+type TokenInfo struct {
+	Symbol   string `json:"symbol"`
+	Address  string `json:"address"` // 合约地址（base58）
+	Decimals int    `json:"decimals"`
+	Name     string `json:"name"`
+}
+
+// TRC20Transfer TronGrid 返回的 TRC20 转账记录
+type TRC20Transfer struct {
+	TransactionID  string    `json:"transaction_id"`
+	TokenInfo      TokenInfo `json:"token_info"`
+	BlockTimestamp int64     `json:"block_timestamp"` // 毫秒
+	From           string    `json:"from"`
+	To             string    `json:"to"`
+	Type           string    `json:"type"`
+	Value          string    `json:"value"` // 链上最小单位的整数
+}
+
+// TRC20TransferPage 一页 TRC20 转账记录，Fingerprint 为空表示没有下一页
+type TRC20TransferPage struct {
+	Transfers   []*TRC20Transfer
+	Fingerprint string
+}
+
+// TRXTransfer TRX 原生转账记录
+type TRXTransfer struct {
+	TxID           string
+	BlockNumber    int64
+	BlockTimestamp int64 // 毫秒
+	From           string
+	To             string
+	Amount         int64  // 单位 sun（1 TRX = 10^6 sun）
+	ContractRet    string // 执行结果，SUCCESS 表示成功
+}
+
+// TRXTransferPage 一页 TRX 转账记录，Fingerprint 为空表示没有下一页
+type TRXTransferPage struct {
+	Transfers   []*TRXTransfer
+	Fingerprint string
+}
+
+// EventLog 交易事件日志
+type EventLog struct {
+	Address string   // 合约地址（base58）
+	Topics  []string // 不带 0x 的十六进制
+	Data    string
+}
+
+// SolidifiedTransaction 已固化交易的执行信息
+type SolidifiedTransaction struct {
+	TxID           string
+	BlockNumber    int64
+	BlockTimestamp int64  // 毫秒
+	ContractRet    string // 执行结果，SUCCESS 表示成功
+	ContractType   string // 合约类型，如 TransferContract、TriggerSmartContract
+	From           string // 发起地址（base58）
+	To             string // TRX 转账的收款地址（base58），合约调用为空
+	Amount         int64  // TRX 转账金额（sun），合约调用为 0
+	Logs           []EventLog
+}
+
+// transactionContract 交易原始数据中的合约调用
+type transactionContract struct {
+	Type      string `json:"type"`
+	Parameter struct {
+		Value struct {
+			Amount       int64  `json:"amount"`
+			OwnerAddress string `json:"owner_address"`
+			ToAddress    string `json:"to_address"`
+		} `json:"value"`
+	} `json:"parameter"`
+}
+
+// rawTransaction TronGrid / 节点返回的交易结构
+type rawTransaction struct {
+	TxID           string `json:"txID"`
+	BlockNumber    int64  `json:"blockNumber"`
+	BlockTimestamp int64  `json:"block_timestamp"`
+	Ret            []struct {
+		ContractRet string `json:"contractRet"`
+	} `json:"ret"`
+	RawData struct {
+		Contract []transactionContract `json:"contract"`
+	} `json:"raw_data"`
+}
+
+// contractRet 返回交易执行结果
+func (t *rawTransaction) contractRet() string {
+	if len(t.Ret) == 0 {
+		return ""
+	}
+	return t.Ret[0].ContractRet
+}
+
+// GetTRC20Transfers 分页获取地址收到的指定合约 TRC20 转账（只包含已固化的交易，按区块时间升序）
+// minTimestamp 为毫秒时间戳，fingerprint 为上一页返回的翻页标记，首页传空
+func (c *Client) GetTRC20Transfers(ctx context.Context, address, contract string, minTimestamp int64, fingerprint string) (*TRC20TransferPage, error) {
+	query := url.Values{}
+	query.Set("only_confirmed", "true")
+	query.Set("only_to", "true")
+	query.Set("limit", strconv.Itoa(transferPageSize))
+	query.Set("order_by", "block_timestamp,asc")
+	query.Set("contract_address", contract)
+	if minTimestamp > 0 {
+		query.Set("min_timestamp", strconv.FormatInt(minTimestamp, 10))
+	}
+	if fingerprint != "" {
+		query.Set("fingerprint", fingerprint)
+	}
+
+	var response struct {
+		Data    []*TRC20Transfer `json:"data"`
+		Success bool             `json:"success"`
+		Meta    struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"meta"`
+	}
+	path := fmt.Sprintf("/v1/accounts/%s/transactions/trc20", address)
+	if err := c.doJSON(ctx, http.MethodGet, path, query, nil, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("TronGrid returned unsuccessful response for %s", path)
+	}
+
+	// TronGrid 按合约过滤，这里再校验一次，防止同名假币混入
+	page := &TRC20TransferPage{Fingerprint: response.Meta.Fingerprint}
+	for _, transfer := range response.Data {
+		if transfer.TokenInfo.Address == contract && transfer.Type == "Transfer" {
+			page.Transfers = append(page.Transfers, transfer)
+		}
+	}
+	return page, nil
+}
+
+// GetTRXTransfers 分页获取地址收到的 TRX 原生转账（只包含已固化的交易，按区块时间升序）
+func (c *Client) GetTRXTransfers(ctx context.Context, address string, minTimestamp int64, fingerprint string) (*TRXTransferPage, error) {
+	query := url.Values{}
+	query.Set("only_confirmed", "true")
+	query.Set("only_to", "true")
+	query.Set("limit", strconv.Itoa(transferPageSize))
+	query.Set("order_by", "block_timestamp,asc")
+	if minTimestamp > 0 {
+		query.Set("min_timestamp", strconv.FormatInt(minTimestamp, 10))
+	}
+	if fingerprint != "" {
+		query.Set("fingerprint", fingerprint)
+	}
+
+	var response struct {
+		Data    []*rawTransaction `json:"data"`
+		Success bool              `json:"success"`
+		Meta    struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"meta"`
+	}
+	path := fmt.Sprintf("/v1/accounts/%s/transactions", address)
+	if err := c.doJSON(ctx, http.MethodGet, path, query, nil, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("TronGrid returned unsuccessful response for %s", path)
+	}
+
+	page := &TRXTransferPage{Fingerprint: response.Meta.Fingerprint}
+	for _, tx := range response.Data {
+		// 该接口同时返回合约调用等其他交易，只保留 TRX 转账
+		if len(tx.RawData.Contract) != 1 || tx.RawData.Contract[0].Type != "TransferContract" {
+			continue
+		}
+		value := tx.RawData.Contract[0].Parameter.Value
+		from, err := HexToBase58(value.OwnerAddress)
+		if err != nil {
+			continue
+		}
+		to, err := HexToBase58(value.ToAddress)
+		if err != nil {
+			continue
+		}
+		page.Transfers = append(page.Transfers, &TRXTransfer{
+			TxID:           tx.TxID,
+			BlockNumber:    tx.BlockNumber,
+			BlockTimestamp: tx.BlockTimestamp,
+			From:           from,
+			To:             to,
+			Amount:         value.Amount,
+			ContractRet:    tx.contractRet(),
+		})
+	}
+	return page, nil
+}
+
+// GetSolidifiedTransaction 从固化节点获取交易及其执行信息，交易不存在或尚未固化时返回 nil
+func (c *Client) GetSolidifiedTransaction(ctx context.Context, txID string) (*SolidifiedTransaction, error) {
+	request := map[string]string{"value": txID}
+
+	var tx rawTransaction
+	if err := c.doJSON(ctx, http.MethodPost, "/walletsolidity/gettransactionbyid", nil, request, &tx); err != nil {
+		return nil, err
+	}
+	if tx.TxID == "" {
+		return nil, nil
+	}
+
+	var info struct {
+		ID             string `json:"id"`
+		BlockNumber    int64  `json:"blockNumber"`
+		BlockTimeStamp int64  `json:"blockTimeStamp"`
+		Log            []struct {
+			Address string   `json:"address"`
+			Topics  []string `json:"topics"`
+			Data    string   `json:"data"`
+		} `json:"log"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/walletsolidity/gettransactioninfobyid", nil, request, &info); err != nil {
+		return nil, err
+	}
+	if info.ID == "" {
+		return nil, nil
+	}
+
+	result := &SolidifiedTransaction{
+		TxID:           tx.TxID,
+		BlockNumber:    info.BlockNumber,
+		BlockTimestamp: info.BlockTimeStamp,
+		ContractRet:    tx.contractRet(),
+	}
+	if len(tx.RawData.Contract) > 0 {
+		contract := tx.RawData.Contract[0]
+		result.ContractType = contract.Type
+		if from, err := HexToBase58(contract.Parameter.Value.OwnerAddress); err == nil {
+			result.From = from
+		}
+		if contract.Type == "TransferContract" {
+			if to, err := HexToBase58(contract.Parameter.Value.ToAddress); err == nil {
+				result.To = to
+			}
+			result.Amount = contract.Parameter.Value.Amount
+		}
+	}
+	for _, log := range info.Log {
+		address, err := HexToBase58(log.Address)
+		if err != nil {
+			continue
+		}
+		result.Logs = append(result.Logs, EventLog{Address: address, Topics: log.Topics, Data: log.Data})
+	}
+
+	return result, nil
+}
+
+// ParseTransferLog 解析 TRC20 Transfer 事件，返回转出地址、收款地址和原始金额
+func ParseTransferLog(log EventLog) (from, to string, value *big.Int, ok bool) {
+	if len(log.Topics) != 3 || !strings.EqualFold(strings.TrimPrefix(log.Topics[0], "0x"), TransferEventTopic) {
+		return "", "", nil, false
+	}
+
+	from, err := topicToBase58(log.Topics[1])
+	if err != nil {
+		return "", "", nil, false
+	}
+	to, err = topicToBase58(log.Topics[2])
+	if err != nil {
+		return "", "", nil, false
+	}
+	value, success := new(big.Int).SetString(strings.TrimPrefix(log.Data, "0x"), 16)
+	if !success {
+		return "", "", nil, false
+	}
+	return from, to, value, true
+}
+
+// FormatTokenAmount 按精度将链上最小单位的整数转换为十进制字符串（如 1500000 / 10^6 = 1.5）
+func FormatTokenAmount(raw string, decimals int) (string, error) {
+	value, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid token amount: %s", raw)
+	}
+	if decimals <= 0 {
+		return value.String(), nil
+	}
+
+	negative := value.Sign() < 0
+	digits := new(big.Int).Abs(value).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	result := digits[:len(digits)-decimals]
+	if fraction := strings.TrimRight(digits[len(digits)-decimals:], "0"); fraction != "" {
+		result += "." + fraction
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result, nil
+}
+
+// topicToBase58 取 32 字节主题的后 20 字节作为地址
+func topicToBase58(topic string) (string, error) {
+	topic = strings.TrimPrefix(topic, "0x")
+	if len(topic) < 40 {
+		return "", fmt.Errorf("invalid address topic: %s", topic)
+	}
+	return HexToBase58(topic[len(topic)-40:])
+}
+
+// doJSON 执行 TronGrid 请求并解析 JSON 响应
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status %d", resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
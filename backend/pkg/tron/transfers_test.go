@@ -0,0 +1,132 @@
+package tron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testUSDTContract = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+
+func TestGetTRC20TransfersPaging(t *testing.T) {
+	const address = "TDepositAddress"
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/accounts/"+address+"/transactions/trc20" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("contract_address") != testUSDTContract || query.Get("only_confirmed") != "true" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("TRON-PRO-API-KEY") != "test-key" {
+			t.Errorf("missing api key header")
+		}
+
+		switch query.Get("fingerprint") {
+		case "":
+			// 第一页混入一笔同名假币，应被过滤
+			fmt.Fprintf(w, `{"success":true,"meta":{"fingerprint":"page-2"},"data":[
+				{"transaction_id":"tx-1","token_info":{"symbol":"USDT","address":"%s","decimals":6},"block_timestamp":1700000000000,"from":"TSender","to":"%s","type":"Transfer","value":"12345678"},
+				{"transaction_id":"tx-fake","token_info":{"symbol":"USDT","address":"TFakeContract","decimals":6},"block_timestamp":1700000000000,"from":"TSender","to":"%s","type":"Transfer","value":"12345678"}
+			]}`, testUSDTContract, address, address)
+		case "page-2":
+			fmt.Fprintf(w, `{"success":true,"meta":{},"data":[
+				{"transaction_id":"tx-2","token_info":{"symbol":"USDT","address":"%s","decimals":6},"block_timestamp":1700000001000,"from":"TSender","to":"%s","type":"Transfer","value":"500000"}
+			]}`, testUSDTContract, address)
+		default:
+			t.Errorf("unexpected fingerprint: %s", query.Get("fingerprint"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", nil)
+	ctx := context.Background()
+
+	first, err := client.GetTRC20Transfers(ctx, address, testUSDTContract, 1699999999000, "")
+	if err != nil {
+		t.Fatalf("GetTRC20Transfers failed: %v", err)
+	}
+	if len(first.Transfers) != 1 || first.Transfers[0].TransactionID != "tx-1" {
+		t.Fatalf("expected only tx-1 on first page, got %+v", first.Transfers)
+	}
+	if first.Fingerprint != "page-2" {
+		t.Fatalf("fingerprint = %q, want page-2", first.Fingerprint)
+	}
+
+	second, err := client.GetTRC20Transfers(ctx, address, testUSDTContract, 1699999999000, first.Fingerprint)
+	if err != nil {
+		t.Fatalf("GetTRC20Transfers failed: %v", err)
+	}
+	if len(second.Transfers) != 1 || second.Fingerprint != "" {
+		t.Fatalf("unexpected last page: %+v, fingerprint %q", second.Transfers, second.Fingerprint)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
+
+func TestFormatTokenAmount(t *testing.T) {
+	tests := []struct {
+		raw      string
+		decimals int
+		want     string
+	}{
+		{"12345678", 6, "12.345678"},
+		{"500000", 6, "0.5"},
+		{"10000000", 6, "10"},
+		{"1", 6, "0.000001"},
+		{"0", 6, "0"},
+		{"42", 0, "42"},
+		{"1000000000000000000", 18, "1"},
+	}
+	for _, tt := range tests {
+		got, err := FormatTokenAmount(tt.raw, tt.decimals)
+		if err != nil {
+			t.Fatalf("FormatTokenAmount(%s, %d) failed: %v", tt.raw, tt.decimals, err)
+		}
+		if got != tt.want {
+			t.Errorf("FormatTokenAmount(%s, %d) = %s, want %s", tt.raw, tt.decimals, got, tt.want)
+		}
+	}
+
+	if _, err := FormatTokenAmount("1.5", 6); err == nil {
+		t.Errorf("expected error for non-integer amount")
+	}
+}
+
+func TestHexToBase58(t *testing.T) {
+	for _, input := range []string{
+		"41a614f803b6fd780986a42c78ec9c7f77e6ded13c",
+		"a614f803b6fd780986a42c78ec9c7f77e6ded13c",
+	} {
+		got, err := HexToBase58(input)
+		if err != nil {
+			t.Fatalf("HexToBase58(%s) failed: %v", input, err)
+		}
+		if got != testUSDTContract {
+			t.Errorf("HexToBase58(%s) = %s, want %s", input, got, testUSDTContract)
+		}
+	}
+}
+
+func TestGetLatestBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/wallet/getnowblock" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"blockID":"0000000003f5a1c2","block_header":{"raw_data":{"number":66429378,"timestamp":1730000000000}},"transactions":[{},{}]}`)
+	}))
+	defer server.Close()
+
+	block, err := NewClient(server.URL, "", nil).GetLatestBlock(context.Background())
+	if err != nil {
+		t.Fatalf("GetLatestBlock failed: %v", err)
+	}
+	if block.BlockNumber != 66429378 || block.BlockHash != "0000000003f5a1c2" || block.TxCount != 2 {
+		t.Errorf("unexpected block: %+v", block)
+	}
+}
@@ -0,0 +1,524 @@
+// Package trontest 提供基于 httptest 的 TronGrid 模拟服务，用于在不访问真实网络的情况下测试充值流程
+//
+// 模拟服务维护一条内存中的链：每笔铸造的转账单独出块，AdvanceBlocks 推进区块高度；
+// 交易所在区块之上的区块数达到固化深度后才出现在只返回已固化交易的接口中（only_confirmed 列表、walletsolidity）。
+// 支持的接口与 tron.Client 使用的一致：
+//   - GET  /v1/accounts/{address}/transactions/trc20
+//   - GET  /v1/accounts/{address}/transactions
+//   - POST /wallet/getnowblock
+//   - POST /wallet/validateaddress
+//   - POST /walletsolidity/gettransactionbyid
+//   - POST /walletsolidity/gettransactioninfobyid
+package trontest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tg-robot-sim/pkg/tron"
+)
+
+const (
+	// genesisBlock 模拟链的起始区块高度
+	genesisBlock = 1000
+	// blockInterval TRON 出块间隔
+	blockInterval = 3 * time.Second
+	// defaultPageSize 请求未指定 limit 时的分页大小
+	defaultPageSize = 20
+)
+
+// token 已登记的 TRC20 代币
+type token struct {
+	symbol   string
+	decimals int
+}
+
+// transaction 模拟链上的一笔转账
+type transaction struct {
+	id          string
+	blockNumber int64
+	timestamp   int64  // 毫秒
+	contract    string // TRC20 合约地址（base58），TRX 转账为空
+	from        string
+	to          string
+	value       *big.Int // 链上最小单位
+	contractRet string
+}
+
+// failure 注入的错误响应
+type failure struct {
+	pathPrefix string
+	status     int
+	remaining  int
+}
+
+// Server 模拟 TronGrid 服务
+type Server struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mu             sync.Mutex
+	head           int64
+	headTimestamp  int64
+	solidifyDepth  int64
+	tokens         map[string]*token
+	transactions   []*transaction
+	byID           map[string]*transaction
+	failures       []*failure
+	requestCounter int
+}
+
+// New 启动模拟服务，测试结束时自动关闭
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		t:             t,
+		head:          genesisBlock,
+		headTimestamp: time.Now().UnixMilli(),
+		tokens:        make(map[string]*token),
+		byID:          make(map[string]*transaction),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// URL 返回服务地址，用作 tron.NewClient 的 baseURL
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Client 返回指向模拟服务的 TRON 客户端
+func (s *Server) Client() *tron.Client {
+	return tron.NewClient(s.server.URL, "", nil)
+}
+
+// Close 关闭服务
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// RegisterToken 登记 TRC20 代币，铸造转账前必须先登记合约
+func (s *Server) RegisterToken(contract, symbol string, decimals int) {
+	s.t.Helper()
+	s.mustAddress(contract)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[contract] = &token{symbol: symbol, decimals: decimals}
+}
+
+// MintTRC20 在新区块中写入一笔 TRC20 转账，amount 为十进制数量（按登记的精度换算），返回交易ID
+func (s *Server) MintTRC20(contract, from, to, amount string) string {
+	s.t.Helper()
+	s.mustAddress(from)
+	s.mustAddress(to)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, ok := s.tokens[contract]
+	if !ok {
+		s.t.Fatalf("trontest: token %s is not registered", contract)
+	}
+	value, err := parseUnits(amount, tok.decimals)
+	if err != nil {
+		s.t.Fatalf("trontest: %v", err)
+	}
+	return s.mint(&transaction{contract: contract, from: from, to: to, value: value})
+}
+
+// MintTRX 在新区块中写入一笔 TRX 转账，amount 单位为 sun，返回交易ID
+func (s *Server) MintTRX(from, to string, amount int64) string {
+	s.t.Helper()
+	s.mustAddress(from)
+	s.mustAddress(to)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mint(&transaction{from: from, to: to, value: big.NewInt(amount)})
+}
+
+// AdvanceBlocks 出 n 个空块
+func (s *Server) AdvanceBlocks(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.nextBlock()
+	}
+}
+
+// Head 返回最新区块高度
+func (s *Server) Head() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head
+}
+
+// SetConfirmationDepth 设置固化深度：交易所在区块之上至少有 depth 个区块后才视为已固化，默认 0（出块即固化）
+func (s *Server) SetConfirmationDepth(depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.solidifyDepth = int64(depth)
+}
+
+// Revert 将交易标记为执行失败（REVERT）：不再产生 Transfer 事件，也不会出现在 TRC20 转账列表中
+func (s *Server) Revert(txID string) {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.byID[txID]
+	if !ok {
+		s.t.Fatalf("trontest: transaction %s not found", txID)
+	}
+	tx.contractRet = "REVERT"
+}
+
+// FailNext 让之后 n 个路径以 pathPrefix 开头的请求返回 status（如 429、500），pathPrefix 为空时匹配所有请求
+func (s *Server) FailNext(pathPrefix string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{pathPrefix: pathPrefix, status: status, remaining: n})
+}
+
+// Requests 返回已收到的请求数（包括注入错误的请求）
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requestCounter
+}
+
+// mint 出一个包含该交易的新区块，调用方持有锁
+func (s *Server) mint(tx *transaction) string {
+	s.nextBlock()
+	tx.id = newTxID()
+	tx.blockNumber = s.head
+	tx.timestamp = s.headTimestamp
+	tx.contractRet = "SUCCESS"
+	s.transactions = append(s.transactions, tx)
+	s.byID[tx.id] = tx
+	return tx.id
+}
+
+// nextBlock 推进一个区块，区块时间不早于当前时间，调用方持有锁
+func (s *Server) nextBlock() {
+	s.head++
+	s.headTimestamp += blockInterval.Milliseconds()
+	if now := time.Now().UnixMilli(); now > s.headTimestamp {
+		s.headTimestamp = now
+	}
+}
+
+// solidified 交易是否已固化，调用方持有锁
+func (s *Server) solidified(tx *transaction) bool {
+	return s.head-tx.blockNumber >= s.solidifyDepth
+}
+
+// mustAddress 校验测试传入的地址，TronGrid 的十六进制字段需要由合法地址转换
+func (s *Server) mustAddress(address string) {
+	s.t.Helper()
+	if !tron.IsValidAddress(address) {
+		s.t.Fatalf("trontest: invalid TRON address %q", address)
+	}
+}
+
+// handle 分发请求
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requestCounter++
+
+	for i, f := range s.failures {
+		if strings.HasPrefix(r.URL.Path, f.pathPrefix) {
+			f.remaining--
+			if f.remaining <= 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+			writeJSON(w, f.status, map[string]interface{}{"Error": http.StatusText(f.status), "statusCode": f.status})
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/accounts/") && strings.HasSuffix(r.URL.Path, "/transactions/trc20"):
+		address := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/accounts/"), "/transactions/trc20")
+		s.handleTRC20Transfers(w, r, address)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/accounts/") && strings.HasSuffix(r.URL.Path, "/transactions"):
+		address := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/accounts/"), "/transactions")
+		s.handleTRXTransfers(w, r, address)
+	case r.Method == http.MethodPost && r.URL.Path == "/wallet/getnowblock":
+		s.handleNowBlock(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/wallet/validateaddress":
+		s.handleValidateAddress(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/walletsolidity/gettransactionbyid":
+		s.handleTransactionByID(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/walletsolidity/gettransactioninfobyid":
+		s.handleTransactionInfoByID(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"Error": "not found", "statusCode": http.StatusNotFound})
+	}
+}
+
+// handleTRC20Transfers 地址收到的已固化 TRC20 转账，按区块时间升序分页
+func (s *Server) handleTRC20Transfers(w http.ResponseWriter, r *http.Request, address string) {
+	query := r.URL.Query()
+	contract := query.Get("contract_address")
+
+	var matched []*transaction
+	for _, tx := range s.listed(address, query) {
+		if tx.contract == "" || tx.contractRet != "SUCCESS" || (contract != "" && tx.contract != contract) {
+			continue
+		}
+		matched = append(matched, tx)
+	}
+
+	page, fingerprint := paginate(matched, query)
+	data := make([]map[string]interface{}, 0, len(page))
+	for _, tx := range page {
+		tok := s.tokens[tx.contract]
+		data = append(data, map[string]interface{}{
+			"transaction_id":  tx.id,
+			"token_info":      map[string]interface{}{"symbol": tok.symbol, "address": tx.contract, "decimals": tok.decimals, "name": tok.symbol},
+			"block_timestamp": tx.timestamp,
+			"from":            tx.from,
+			"to":              tx.to,
+			"type":            "Transfer",
+			"value":           tx.value.String(),
+		})
+	}
+	writeList(w, data, fingerprint)
+}
+
+// handleTRXTransfers 地址收到的已固化 TRX 转账（包括执行失败的），按区块时间升序分页
+func (s *Server) handleTRXTransfers(w http.ResponseWriter, r *http.Request, address string) {
+	query := r.URL.Query()
+
+	var matched []*transaction
+	for _, tx := range s.listed(address, query) {
+		if tx.contract == "" {
+			matched = append(matched, tx)
+		}
+	}
+
+	page, fingerprint := paginate(matched, query)
+	data := make([]map[string]interface{}, 0, len(page))
+	for _, tx := range page {
+		data = append(data, s.rawTransaction(tx))
+	}
+	writeList(w, data, fingerprint)
+}
+
+// listed 按列表接口的通用参数过滤收款地址上的交易：only_confirmed、min_timestamp，按区块时间升序
+func (s *Server) listed(address string, query map[string][]string) []*transaction {
+	var minTimestamp int64
+	if values := query["min_timestamp"]; len(values) > 0 {
+		minTimestamp, _ = strconv.ParseInt(values[0], 10, 64)
+	}
+	onlyConfirmed := len(query["only_confirmed"]) > 0 && query["only_confirmed"][0] == "true"
+
+	var result []*transaction
+	for _, tx := range s.transactions {
+		if tx.to != address || tx.timestamp < minTimestamp {
+			continue
+		}
+		if onlyConfirmed && !s.solidified(tx) {
+			continue
+		}
+		result = append(result, tx)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].timestamp < result[j].timestamp })
+	return result
+}
+
+// handleNowBlock 最新区块
+func (s *Server) handleNowBlock(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"blockID": fmt.Sprintf("%016x%048x", s.head, s.head),
+		"block_header": map[string]interface{}{
+			"raw_data": map[string]interface{}{"number": s.head, "timestamp": s.headTimestamp},
+		},
+		"transactions": []interface{}{},
+	})
+}
+
+// handleValidateAddress 地址格式校验
+func (s *Server) handleValidateAddress(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"Error": err.Error()})
+		return
+	}
+	valid := tron.IsValidAddress(request.Address)
+	message := "Base58check format"
+	if !valid {
+		message = "Invalid address"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": valid, "message": message})
+}
+
+// handleTransactionByID 已固化交易，不存在或未固化时返回空对象
+func (s *Server) handleTransactionByID(w http.ResponseWriter, r *http.Request) {
+	tx := s.solidifiedByID(r)
+	if tx == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.rawTransaction(tx))
+}
+
+// handleTransactionInfoByID 已固化交易的执行信息，TRC20 转账成功时包含 Transfer 事件
+func (s *Server) handleTransactionInfoByID(w http.ResponseWriter, r *http.Request) {
+	tx := s.solidifiedByID(r)
+	if tx == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+
+	info := map[string]interface{}{
+		"id":             tx.id,
+		"blockNumber":    tx.blockNumber,
+		"blockTimeStamp": tx.timestamp,
+		"receipt":        map[string]interface{}{"result": tx.contractRet},
+	}
+	if tx.contract != "" {
+		info["contract_address"] = hexAddress(tx.contract)
+		if tx.contractRet == "SUCCESS" {
+			info["log"] = []map[string]interface{}{{
+				"address": hexAddress(tx.contract)[2:],
+				"topics":  []string{tron.TransferEventTopic, addressTopic(tx.from), addressTopic(tx.to)},
+				"data":    fmt.Sprintf("%064x", tx.value),
+			}}
+		} else {
+			info["result"] = "FAILED"
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// solidifiedByID 读取请求中的交易ID并返回已固化的交易，调用方持有锁
+func (s *Server) solidifiedByID(r *http.Request) *transaction {
+	var request struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil
+	}
+	tx, ok := s.byID[request.Value]
+	if !ok || !s.solidified(tx) {
+		return nil
+	}
+	return tx
+}
+
+// rawTransaction 节点格式的交易：TRX 转账为 TransferContract，TRC20 转账为 TriggerSmartContract
+func (s *Server) rawTransaction(tx *transaction) map[string]interface{} {
+	value := map[string]interface{}{"owner_address": hexAddress(tx.from)}
+	contractType := "TransferContract"
+	if tx.contract != "" {
+		contractType = "TriggerSmartContract"
+		value["contract_address"] = hexAddress(tx.contract)
+		value["data"] = "a9059cbb" + addressTopic(tx.to) + fmt.Sprintf("%064x", tx.value)
+	} else {
+		value["to_address"] = hexAddress(tx.to)
+		value["amount"] = tx.value.Int64()
+	}
+
+	return map[string]interface{}{
+		"txID":            tx.id,
+		"blockNumber":     tx.blockNumber,
+		"block_timestamp": tx.timestamp,
+		"ret":             []map[string]interface{}{{"contractRet": tx.contractRet}},
+		"raw_data": map[string]interface{}{
+			"contract": []map[string]interface{}{{
+				"type":      contractType,
+				"parameter": map[string]interface{}{"value": value},
+			}},
+			"timestamp": tx.timestamp,
+		},
+	}
+}
+
+// paginate 按 limit 和 fingerprint（本实现为下一页的起始下标）分页，返回当前页和下一页的 fingerprint
+func paginate(transactions []*transaction, query map[string][]string) ([]*transaction, string) {
+	limit := defaultPageSize
+	if values := query["limit"]; len(values) > 0 {
+		if n, err := strconv.Atoi(values[0]); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	offset := 0
+	if values := query["fingerprint"]; len(values) > 0 {
+		offset, _ = strconv.Atoi(values[0])
+	}
+	if offset > len(transactions) {
+		offset = len(transactions)
+	}
+
+	end := offset + limit
+	if end >= len(transactions) {
+		return transactions[offset:], ""
+	}
+	return transactions[offset:end], strconv.Itoa(end)
+}
+
+// writeList 写入 TronGrid v1 列表响应
+func writeList(w http.ResponseWriter, data []map[string]interface{}, fingerprint string) {
+	meta := map[string]interface{}{"at": time.Now().UnixMilli(), "page_size": len(data)}
+	if fingerprint != "" {
+		meta["fingerprint"] = fingerprint
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "meta": meta, "data": data})
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// hexAddress 41 开头的十六进制地址，调用前地址已校验
+func hexAddress(address string) string {
+	value, _ := tron.Base58ToHex(address)
+	return value
+}
+
+// addressTopic 事件主题格式的地址：20 字节地址左侧补零到 32 字节
+func addressTopic(address string) string {
+	return strings.Repeat("0", 24) + hexAddress(address)[2:]
+}
+
+// parseUnits 将十进制数量按精度换算为链上最小单位
+func parseUnits(amount string, decimals int) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %s exceeds %d decimals", amount, decimals)
+	}
+	value, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return value, nil
+}
+
+// newTxID 随机生成 32 字节交易ID
+func newTxID() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
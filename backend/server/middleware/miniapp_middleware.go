@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -8,9 +9,22 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+
+	"tg-robot-sim/pkg/telegram"
 )
 
+// telegramUserIDKey 上下文中保存已验证用户 ID 的键
+type telegramUserIDKey struct{}
+
+// TelegramUserID 返回通过 initData 签名校验的用户 ID
+// 请求没有携带 initData 时返回 false，涉及资金和隐私的接口必须使用它而不是请求参数中的用户 ID
+func TelegramUserID(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(telegramUserIDKey{}).(int64)
+	return userID, ok && userID > 0
+}
+
 // TelegramWebAppMiddleware Telegram Web App 身份验证中间件
+// 校验通过的 initData 中的用户 ID 写入请求上下文，通过 TelegramUserID 读取
 func TelegramWebAppMiddleware(botToken string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -33,6 +47,10 @@ func TelegramWebAppMiddleware(botToken string) func(http.Handler) http.Handler {
 				return
 			}
 
+			if userID, err := telegram.GetUserID(initData); err == nil && userID > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), telegramUserIDKey{}, userID))
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -1,6 +1,14 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -54,3 +62,62 @@ func TestValidateTelegramWebAppData_InvalidFormat(t *testing.T) {
 		t.Error("Expected validation to fail with invalid format")
 	}
 }
+
+// signInitData signs init data the way Telegram does
+func signInitData(values url.Values, botToken string) string {
+	var pairs []string
+	for key := range values {
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+
+	signed := url.Values{}
+	for key := range values {
+		signed.Set(key, values.Get(key))
+	}
+	signed.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return signed.Encode()
+}
+
+func TestTelegramWebAppMiddleware_UserID(t *testing.T) {
+	botToken := "test_bot_token"
+	valid := signInitData(url.Values{"user": {`{"id":123}`}, "auth_date": {"1762283720"}}, botToken)
+
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		wantStatus int
+		wantUserID int64
+	}{
+		{name: "valid header", target: "/api", header: valid, wantStatus: http.StatusOK, wantUserID: 123},
+		{name: "valid query parameter", target: "/api?init_data=" + url.QueryEscape(valid), wantStatus: http.StatusOK, wantUserID: 123},
+		{name: "no init data ignores user_id", target: "/api?user_id=456", wantStatus: http.StatusOK},
+		{name: "invalid hash", target: "/api", header: "user=%7B%22id%22%3A456%7D&hash=invalid", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID int64
+			handler := TelegramWebAppMiddleware(botToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = TelegramUserID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Telegram-Init-Data", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus || gotUserID != tt.wantUserID {
+				t.Errorf("Expected status %d and user %d, got %d and %d", tt.wantStatus, tt.wantUserID, rec.Code, gotUserID)
+			}
+		})
+	}
+}
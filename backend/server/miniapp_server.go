@@ -18,6 +18,11 @@ func NewMiniAppHTTPServer(
 	walletHistoryService services.WalletHistoryService,
 	rechargeService services.RechargeService,
 	esimCardService services.EsimCardService,
+	withdrawalService services.WithdrawalService,
+	referralService services.ReferralService,
+	starsGateway services.PaymentGateway,
+	eventHub services.EventHub,
+	providerWebhookService services.ProviderWebhookService,
 ) *http.Server {
 	mux := http.NewServeMux()
 
@@ -29,6 +34,11 @@ func NewMiniAppHTTPServer(
 		walletHistoryService,
 		rechargeService,
 		esimCardService,
+		withdrawalService,
+		referralService,
+		starsGateway,
+		eventHub,
+		providerWebhookService,
 	)
 
 	// 注册路由
@@ -50,11 +60,16 @@ func NewMiniAppHTTPServer(
 	handler = middleware.CORSMiddleware(handler)
 	handler = middleware.TelegramWebAppMiddleware(cfg.Telegram.BotToken)(handler)
 
-	return &http.Server{
+	httpServer := &http.Server{
 		Addr:         ":8080",
 		Handler:      handler,
 		ReadTimeout:  cfg.Server.ReadTimeout.ToDuration(),
 		WriteTimeout: cfg.Server.WriteTimeout.ToDuration(),
 		IdleTimeout:  cfg.Server.IdleTimeout.ToDuration(),
 	}
+	// 关闭时先断开事件流，否则 Shutdown 会一直等待长连接结束
+	if eventHub != nil {
+		httpServer.RegisterOnShutdown(eventHub.Close)
+	}
+	return httpServer
 }
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAssetNotFound 资产未登记
+	ErrAssetNotFound = errors.New("资产不存在")
+	// ErrAssetNotSupported 资产已停用或所在链未配置收款
+	ErrAssetNotSupported = errors.New("暂不支持该资产充值")
+	// ErrAssetRateUnavailable 资产尚未设置汇率
+	ErrAssetRateUnavailable = errors.New("资产汇率未设置，暂不可用")
+)
+
+// AssetService 资产登记服务接口
+type AssetService interface {
+	// ListAssets 列出资产，activeOnly 为 true 时只返回可用资产
+	ListAssets(ctx context.Context, activeOnly bool) ([]*models.Asset, error)
+
+	// GetAsset 获取资产登记信息（不校验资产状态）
+	GetAsset(ctx context.Context, code string) (*models.Asset, error)
+
+	// GetActiveAsset 获取可用于充值的资产，资产停用或未设置汇率时返回错误
+	GetActiveAsset(ctx context.Context, code string) (*models.Asset, error)
+
+	// UpdateRate 更新资产折合计价币种的汇率（管理员）
+	UpdateRate(ctx context.Context, code string, rate string) error
+}
+
+// assetService 资产登记服务实现
+type assetService struct {
+	assetRepo repository.AssetRepository
+}
+
+// NewAssetService 创建资产登记服务实例
+func NewAssetService(assetRepo repository.AssetRepository) AssetService {
+	return &assetService{assetRepo: assetRepo}
+}
+
+// ListAssets 列出资产
+func (s *assetService) ListAssets(ctx context.Context, activeOnly bool) ([]*models.Asset, error) {
+	assets, err := s.assetRepo.List(ctx, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("获取资产列表失败: %w", err)
+	}
+	return assets, nil
+}
+
+// GetAsset 获取资产登记信息
+func (s *assetService) GetAsset(ctx context.Context, code string) (*models.Asset, error) {
+	asset, err := s.assetRepo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, fmt.Errorf("获取资产失败: %w", err)
+	}
+	return asset, nil
+}
+
+// GetActiveAsset 获取可用于充值的资产
+func (s *assetService) GetActiveAsset(ctx context.Context, code string) (*models.Asset, error) {
+	asset, err := s.GetAsset(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !asset.IsActive() {
+		return nil, ErrAssetNotSupported
+	}
+
+	rate, err := parseDecimal(asset.UsdRate)
+	if err != nil || rate.Sign() <= 0 {
+		return nil, ErrAssetRateUnavailable
+	}
+
+	return asset, nil
+}
+
+// UpdateRate 更新资产汇率
+func (s *assetService) UpdateRate(ctx context.Context, code string, rate string) error {
+	value, err := parseDecimal(rate)
+	if err != nil || value.Sign() <= 0 {
+		return fmt.Errorf("汇率必须为正数: %s", rate)
+	}
+
+	if err := s.assetRepo.UpdateRate(ctx, code, value.Text('f', 8)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssetNotFound
+		}
+		return fmt.Errorf("更新资产汇率失败: %w", err)
+	}
+	return nil
+}
+
+// assetQuantity 按汇率将计价币种金额折算为资产数量
+func assetQuantity(amount string, rate string) (*big.Float, error) {
+	amountValue, err := parseDecimal(amount)
+	if err != nil {
+		return nil, fmt.Errorf("金额格式错误: %w", err)
+	}
+	rateValue, err := parseDecimal(rate)
+	if err != nil || rateValue.Sign() <= 0 {
+		return nil, ErrAssetRateUnavailable
+	}
+	return new(big.Float).Quo(amountValue, rateValue), nil
+}
+
+// pricingAmount 按汇率将资产数量折算为计价币种金额，向下取整到分，避免多入账
+func pricingAmount(quantity string, rate string) (string, error) {
+	quantityValue, err := parseDecimal(quantity)
+	if err != nil {
+		return "", fmt.Errorf("金额格式错误: %w", err)
+	}
+	rateValue, err := parseDecimal(rate)
+	if err != nil || rateValue.Sign() <= 0 {
+		return "", ErrAssetRateUnavailable
+	}
+
+	cents, _ := new(big.Float).Mul(new(big.Float).Mul(quantityValue, rateValue), big.NewFloat(100)).Int(nil)
+	return new(big.Float).Quo(new(big.Float).SetInt(cents), big.NewFloat(100)).Text('f', 2), nil
+}
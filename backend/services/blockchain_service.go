@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,11 +13,20 @@ import (
 	"tg-robot-sim/storage/repository"
 )
 
-// blockchainService 区块链服务实现
+// incomingLookback 查询入账转账时回溯的时间范围
+const incomingLookback = 24 * time.Hour
+
+// maxTransferPages 单次查询每个代币最多翻页数，防止地址转账过多时耗尽 API 配额
+const maxTransferPages = 10
+
+// blockchainService TRON 区块链服务实现
+// 只识别资产表中登记在 TRON 上的代币（按合约地址），登记了 TRX 时同时识别原生转账
 type blockchainService struct {
 	tronClient   *tron.Client
 	txRepo       repository.TransactionRepository
 	config       *config.BlockchainConfig
+	tokens       map[string]*models.Asset // 合约地址（base58）-> 资产
+	native       *models.Asset            // TRX 资产，未登记时为 nil
 	logger       Logger
 	isMonitoring bool
 	stopChan     chan struct{}
@@ -26,44 +36,47 @@ type blockchainService struct {
 }
 
 // NewBlockchainService 创建区块链服务
+// assets 为资产表中的资产，只保留 TRON 链上的资产
 func NewBlockchainService(
 	tronClient *tron.Client,
 	config *config.BlockchainConfig,
+	assets []*models.Asset,
 	logger Logger,
 ) BlockchainService {
+	tokens := make(map[string]*models.Asset)
+	var native *models.Asset
+	for _, asset := range assets {
+		if asset.Chain != models.ChainTron {
+			continue
+		}
+		if asset.IsNative() {
+			native = asset
+		} else {
+			tokens[asset.ContractAddress] = asset
+		}
+	}
+
 	return &blockchainService{
 		tronClient:   tronClient,
 		config:       config,
+		tokens:       tokens,
+		native:       native,
 		logger:       logger,
 		stopChan:     make(chan struct{}),
 		watchedAddrs: make(map[string]bool),
 	}
 }
 
-// ValidateTransaction 验证交易
+// Chain 返回所属链标识
+func (b *blockchainService) Chain() string {
+	return models.ChainTron
+}
+
+// ValidateTransaction 验证交易：读取已固化交易中已登记代币的 Transfer 事件或 TRX 转账
 func (b *blockchainService) ValidateTransaction(txHash string) (*TransactionInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-
-	// 从 TRON API 获取交易信息
-	tronTx, err := b.tronClient.GetTransaction(ctx, txHash)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction from TRON API: %w", err)
-	}
-
-	// 转换为内部格式
-	txInfo := &TransactionInfo{
-		TxHash:        tronTx.TxID,
-		FromAddress:   tronTx.From,
-		ToAddress:     tronTx.To,
-		Amount:        tronTx.Amount,
-		Confirmations: tronTx.Confirmations,
-		BlockNumber:   tronTx.BlockNumber,
-		Timestamp:     time.Unix(tronTx.Timestamp/1000, 0),
-		Status:        b.mapTronStatus(tronTx.Status),
-	}
-
-	return txInfo, nil
+	return b.GetTransactionByHash(ctx, txHash)
 }
 
 // GetTransactionStatus 获取交易状态
@@ -86,15 +99,7 @@ func (b *blockchainService) GetTransactionStatus(txHash string) (TransactionStat
 // MonitorAddress 监控指定地址的交易
 func (b *blockchainService) MonitorAddress(address string) error {
 	// 验证地址格式
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	isValid, err := b.tronClient.ValidateAddress(ctx, address)
-	if err != nil {
-		return fmt.Errorf("failed to validate address: %w", err)
-	}
-
-	if !isValid {
+	if !tron.IsValidAddress(address) {
 		return fmt.Errorf("invalid TRON address: %s", address)
 	}
 
@@ -107,6 +112,11 @@ func (b *blockchainService) MonitorAddress(address string) error {
 	return nil
 }
 
+// ValidateAddress 离线校验 TRON 地址（base58check 校验和、0x41 前缀），不访问节点
+func (b *blockchainService) ValidateAddress(ctx context.Context, address string) (bool, error) {
+	return tron.IsValidAddress(address), nil
+}
+
 // GetAddressTransactions 获取地址的交易记录
 func (b *blockchainService) GetAddressTransactions(address string, limit int) ([]*TransactionInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -116,6 +126,10 @@ func (b *blockchainService) GetAddressTransactions(address string, limit int) ([
 	if err != nil {
 		return nil, fmt.Errorf("failed to get address transactions: %w", err)
 	}
+	latest, err := b.tronClient.GetLatestBlock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
 
 	var transactions []*TransactionInfo
 	for _, tronTx := range tronTxs {
@@ -124,7 +138,8 @@ func (b *blockchainService) GetAddressTransactions(address string, limit int) ([
 			FromAddress:   tronTx.From,
 			ToAddress:     tronTx.To,
 			Amount:        tronTx.Amount,
-			Confirmations: tronTx.Confirmations,
+			TokenSymbol:   tronTx.TokenSymbol,
+			Confirmations: tronConfirmations(latest.BlockNumber, tronTx.BlockNumber),
 			BlockNumber:   tronTx.BlockNumber,
 			Timestamp:     time.Unix(tronTx.Timestamp/1000, 0),
 			Status:        b.mapTronStatus(tronTx.Status),
@@ -170,68 +185,256 @@ func (b *blockchainService) checkPendingTransactions() error {
 
 // updateTransactionStatus 更新交易状态
 func (b *blockchainService) updateTransactionStatus(ctx context.Context, tx *models.Transaction) error {
-	// 从区块链获取最新状态
-	tronTx, err := b.tronClient.GetTransaction(ctx, tx.TxHash)
+	// 从区块链获取最新状态（已固化交易，确认数按区块高度计算）
+	txInfo, err := b.GetTransactionByHash(ctx, tx.TxHash)
 	if err != nil {
 		return fmt.Errorf("failed to get transaction from blockchain: %w", err)
 	}
 
 	// 检查状态是否有变化
-	newStatus := b.mapTronStatus(tronTx.Status)
-	if string(tx.Status) == newStatus && tx.Confirmations == tronTx.Confirmations {
+	newStatus := txInfo.Status
+	if string(tx.Status) == newStatus && tx.Confirmations == txInfo.Confirmations {
 		return nil // 没有变化
 	}
 
 	// 更新数据库中的交易状态
-	err = b.txRepo.UpdateStatus(ctx, tx.TxHash, models.TransactionStatus(newStatus), tronTx.Confirmations)
+	err = b.txRepo.UpdateStatus(ctx, tx.TxHash, models.TransactionStatus(newStatus), txInfo.Confirmations)
 	if err != nil {
 		return fmt.Errorf("failed to update transaction status in database: %w", err)
 	}
 
 	b.logger.Info("Updated transaction %s: status=%s, confirmations=%d",
-		tx.TxHash, newStatus, tronTx.Confirmations)
+		tx.TxHash, newStatus, txInfo.Confirmations)
 
 	return nil
 }
 
-// GetAddressIncomingTransactions 获取地址的入账交易
+// GetAddressIncomingTransactions 获取地址在回溯时间范围内收到的已登记资产转账
+// 代币转账按合约地址过滤，假币和未登记的代币不会返回
 func (b *blockchainService) GetAddressIncomingTransactions(ctx context.Context, address string, minAmount string) ([]*TransactionInfo, error) {
-	// 获取地址的所有交易
-	allTxs, err := b.GetAddressTransactions(address, 50) // 获取最近50笔交易
-	if err != nil {
-		return nil, fmt.Errorf("获取地址交易失败: %w", err)
+	assets := make([]*models.Asset, 0, len(b.tokens)+1)
+	for _, token := range b.tokens {
+		assets = append(assets, token)
+	}
+	if b.native != nil {
+		assets = append(assets, b.native)
 	}
 
 	var incomingTxs []*TransactionInfo
-	for _, tx := range allTxs {
-		// 只返回入账交易（ToAddress 是目标地址）
-		if tx.ToAddress == address {
-			incomingTxs = append(incomingTxs, tx)
+	for _, asset := range assets {
+		result, err := b.ScanIncomingTransfers(ctx, address, asset, ScanCursor{})
+		if err != nil {
+			return nil, fmt.Errorf("获取地址交易失败: %w", err)
 		}
+		incomingTxs = append(incomingTxs, result.Transfers...)
 	}
 
 	return incomingTxs, nil
 }
 
-// GetTransactionByHash 根据哈希获取交易详情
+// ScanIncomingTransfers 从游标时间开始按 fingerprint 翻页扫描地址收到的指定资产转账
+// 翻完所有页后游标推进到最后一笔转账的区块时间（包含该时间，重复的转账由调用方去重）；
+// 超过翻页上限时保留起始时间并记录 fingerprint，下次从该页继续
+func (b *blockchainService) ScanIncomingTransfers(ctx context.Context, address string, asset *models.Asset, cursor ScanCursor) (*ScanResult, error) {
+	if asset.Chain != models.ChainTron {
+		return nil, fmt.Errorf("%w: %s 不在 TRON 链上", ErrAssetNotSupported, asset.Code)
+	}
+
+	minTimestamp := cursor.Timestamp
+	if minTimestamp <= 0 {
+		minTimestamp = time.Now().Add(-incomingLookback).UnixMilli()
+	}
+
+	result := &ScanResult{}
+	latest := minTimestamp
+	fingerprint := cursor.Fingerprint
+	for page := 0; page < maxTransferPages; page++ {
+		var transfers []*TransactionInfo
+		var next string
+		var err error
+		if asset.IsNative() {
+			transfers, next, err = b.nativeTransferPage(ctx, address, asset, minTimestamp, fingerprint)
+		} else {
+			transfers, next, err = b.tokenTransferPage(ctx, address, asset, minTimestamp, fingerprint)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, transfer := range transfers {
+			if timestamp := transfer.Timestamp.UnixMilli(); timestamp > latest {
+				latest = timestamp
+			}
+		}
+		result.Transfers = append(result.Transfers, transfers...)
+
+		if next == "" {
+			result.Next = ScanCursor{Timestamp: latest}
+			return result, nil
+		}
+		fingerprint = next
+	}
+
+	result.Next = ScanCursor{Timestamp: minTimestamp, Fingerprint: fingerprint}
+	return result, nil
+}
+
+// GetTransactionByHash 根据哈希获取已固化交易详情，交易未固化时视为不存在
+// 确认数按最新区块高度减去交易所在区块高度计算，不使用接口返回的确认数
 func (b *blockchainService) GetTransactionByHash(ctx context.Context, txHash string) (*TransactionInfo, error) {
-	return b.ValidateTransaction(txHash)
+	tx, err := b.tronClient.GetSolidifiedTransaction(ctx, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction from TRON API: %w", err)
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, txHash)
+	}
+	latest, err := b.tronClient.GetLatestBlock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	txInfo := &TransactionInfo{
+		TxHash:        tx.TxID,
+		FromAddress:   tx.From,
+		ToAddress:     tx.To,
+		Amount:        "0",
+		Confirmations: tronConfirmations(latest.BlockNumber, tx.BlockNumber),
+		BlockNumber:   tx.BlockNumber,
+		Timestamp:     time.UnixMilli(tx.BlockTimestamp),
+		Status:        b.mapTronStatus(tx.ContractRet),
+	}
+
+	if tx.ContractType == "TransferContract" {
+		if b.native != nil {
+			amount, err := tron.FormatTokenAmount(strconv.FormatInt(tx.Amount, 10), b.native.Decimals)
+			if err != nil {
+				return nil, err
+			}
+			txInfo.Amount = amount
+			txInfo.TokenSymbol = b.native.Symbol
+		}
+		return txInfo, nil
+	}
+
+	// 取第一笔已登记代币的 Transfer 事件作为交易金额和收款方
+	for _, log := range tx.Logs {
+		token, ok := b.tokens[log.Address]
+		if !ok {
+			continue
+		}
+		from, to, value, ok := tron.ParseTransferLog(log)
+		if !ok {
+			continue
+		}
+		amount, err := tron.FormatTokenAmount(value.String(), token.Decimals)
+		if err != nil {
+			return nil, err
+		}
+		txInfo.FromAddress = from
+		txInfo.ToAddress = to
+		txInfo.Amount = amount
+		txInfo.TokenSymbol = token.Symbol
+		txInfo.TokenContract = token.ContractAddress
+		break
+	}
+
+	return txInfo, nil
 }
 
-// MatchTransactionAmount 匹配交易金额
+// MatchTransactionAmount 按数值比较交易金额（链上金额会去掉末尾的 0）
 func (b *blockchainService) MatchTransactionAmount(txAmount string, targetAmount string) bool {
-	// 简单的字符串比较，实际应用中可能需要更精确的数值比较
-	return txAmount == targetAmount
+	txValue, err := parseDecimal(txAmount)
+	if err != nil {
+		return false
+	}
+	targetValue, err := parseDecimal(targetAmount)
+	if err != nil {
+		return false
+	}
+	return txValue.Cmp(targetValue) == 0
+}
+
+// tokenTransferPage 获取一页地址收到的代币转账，返回下一页的 fingerprint
+// 列表接口不返回可信的确认数，确认数在入账前由 GetTransactionByHash 按区块高度计算
+func (b *blockchainService) tokenTransferPage(ctx context.Context, address string, token *models.Asset, minTimestamp int64, fingerprint string) ([]*TransactionInfo, string, error) {
+	result, err := b.tronClient.GetTRC20Transfers(ctx, address, token.ContractAddress, minTimestamp, fingerprint)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var transactions []*TransactionInfo
+	for _, transfer := range result.Transfers {
+		if transfer.To != address {
+			continue
+		}
+		// 金额按资产表登记的精度换算，不信任接口返回的代币信息
+		amount, err := tron.FormatTokenAmount(transfer.Value, token.Decimals)
+		if err != nil {
+			b.logger.Warn("Skipping TRC20 transfer %s with invalid value %q", transfer.TransactionID, transfer.Value)
+			continue
+		}
+		transactions = append(transactions, &TransactionInfo{
+			TxHash:        transfer.TransactionID,
+			FromAddress:   transfer.From,
+			ToAddress:     transfer.To,
+			Amount:        amount,
+			TokenSymbol:   token.Symbol,
+			TokenContract: token.ContractAddress,
+			Timestamp:     time.UnixMilli(transfer.BlockTimestamp),
+			Status:        string(TransactionStatusConfirmed),
+		})
+	}
+	return transactions, result.Fingerprint, nil
+}
+
+// nativeTransferPage 获取一页地址收到的成功 TRX 转账，返回下一页的 fingerprint
+func (b *blockchainService) nativeTransferPage(ctx context.Context, address string, native *models.Asset, minTimestamp int64, fingerprint string) ([]*TransactionInfo, string, error) {
+	result, err := b.tronClient.GetTRXTransfers(ctx, address, minTimestamp, fingerprint)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var transactions []*TransactionInfo
+	for _, transfer := range result.Transfers {
+		if transfer.To != address || transfer.ContractRet != "SUCCESS" {
+			continue
+		}
+		amount, err := tron.FormatTokenAmount(strconv.FormatInt(transfer.Amount, 10), native.Decimals)
+		if err != nil {
+			continue
+		}
+		transactions = append(transactions, &TransactionInfo{
+			TxHash:      transfer.TxID,
+			FromAddress: transfer.From,
+			ToAddress:   transfer.To,
+			Amount:      amount,
+			TokenSymbol: native.Symbol,
+			BlockNumber: transfer.BlockNumber,
+			Timestamp:   time.UnixMilli(transfer.BlockTimestamp),
+			Status:      string(TransactionStatusConfirmed),
+		})
+	}
+	return transactions, result.Fingerprint, nil
+}
+
+// tronConfirmations 确认数 = 最新区块高度 - 交易所在区块高度
+func tronConfirmations(latest, blockNumber int64) int {
+	if blockNumber <= 0 || latest < blockNumber {
+		return 0
+	}
+	return int(latest - blockNumber)
 }
 
 // mapTronStatus 映射 TRON 状态到内部状态
+// 只有 SUCCESS 视为成功；REVERT、OUT_OF_ENERGY 等执行失败的结果一律视为失败，避免失败的 TRC20 转账被入账
 func (b *blockchainService) mapTronStatus(tronStatus string) string {
 	switch tronStatus {
 	case "SUCCESS":
 		return string(TransactionStatusConfirmed)
-	case "FAILED":
-		return string(TransactionStatusFailed)
-	default:
+	case "":
 		return string(TransactionStatusPending)
+	default:
+		return string(TransactionStatusFailed)
 	}
 }
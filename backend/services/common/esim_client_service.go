@@ -63,12 +63,12 @@ func (s *esimClientServiceImpl) GetProduct(ctx context.Context, productID int) (
 
 // CreateOrder 创建订单
 func (s *esimClientServiceImpl) CreateOrder(ctx context.Context, req esim.CreateOrderRequest) (*esim.CreateOrderResponse, error) {
-	return s.client.CreateOrder(req)
+	return s.client.CreateOrderContext(ctx, req)
 }
 
 // GetOrder 获取订单详情
 func (s *esimClientServiceImpl) GetOrder(ctx context.Context, orderNo string) (*esim.OrderDetailResponse, error) {
-	return s.client.GetOrder(orderNo)
+	return s.client.GetOrderContext(ctx, orderNo)
 }
 
 // GetEsimUsage 获取eSIM使用情况
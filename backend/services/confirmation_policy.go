@@ -0,0 +1,64 @@
+package services
+
+import (
+	"math/big"
+	"sort"
+
+	"tg-robot-sim/config"
+)
+
+// ConfirmationPolicy 充值入账确认数策略：按到账金额（计价币种）分档，金额越大可以要求越多的确认
+// 充值扫描器和手动检查充值状态都经由 verifyTransaction 使用同一策略
+type ConfirmationPolicy struct {
+	base  int
+	tiers []confirmationTier // 按起始金额升序
+}
+
+// confirmationTier 解析后的确认数分档
+type confirmationTier struct {
+	minAmount     *big.Float
+	confirmations int
+}
+
+// NewConfirmationPolicy 创建确认数策略，base 为未命中任何分档时的确认数
+func NewConfirmationPolicy(base int, tiers []config.ConfirmationTier) *ConfirmationPolicy {
+	policy := &ConfirmationPolicy{base: base}
+	for _, tier := range tiers {
+		policy.tiers = append(policy.tiers, confirmationTier{
+			minAmount:     new(big.Float).SetFloat64(tier.MinAmount),
+			confirmations: tier.Confirmations,
+		})
+	}
+	sort.SliceStable(policy.tiers, func(i, j int) bool {
+		return policy.tiers[i].minAmount.Cmp(policy.tiers[j].minAmount) < 0
+	})
+	return policy
+}
+
+// Required 返回到账金额所需的确认数，金额无法解析时按最严格的一档要求
+func (p *ConfirmationPolicy) Required(amount string) int {
+	value, err := parseDecimal(amount)
+	if err != nil {
+		return p.Max()
+	}
+
+	required := p.base
+	for _, tier := range p.tiers {
+		if value.Cmp(tier.minAmount) < 0 {
+			break
+		}
+		required = tier.confirmations
+	}
+	return required
+}
+
+// Max 返回策略中最大的确认数
+func (p *ConfirmationPolicy) Max() int {
+	max := p.base
+	for _, tier := range p.tiers {
+		if tier.confirmations > max {
+			max = tier.confirmations
+		}
+	}
+	return max
+}
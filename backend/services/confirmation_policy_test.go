@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+func TestConfirmationPolicyRequired(t *testing.T) {
+	policy := NewConfirmationPolicy(19, []config.ConfirmationTier{
+		{MinAmount: 1000, Confirmations: 40},
+		{MinAmount: 0, Confirmations: 1},
+		{MinAmount: 100, Confirmations: 19},
+	})
+
+	tests := []struct {
+		amount string
+		want   int
+	}{
+		{"5", 1},
+		{"99.99", 1},
+		{"100", 19},
+		{"999", 19},
+		{"1000.00", 40},
+		{"not-a-number", 40},
+	}
+	for _, tt := range tests {
+		if got := policy.Required(tt.amount); got != tt.want {
+			t.Errorf("Required(%s) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+
+	if got := NewConfirmationPolicy(12, nil).Required("5000"); got != 12 {
+		t.Errorf("no tiers: Required = %d, want base 12", got)
+	}
+}
+
+// TestTieredConfirmationsForRecharge 小额充值 1 个确认即入账，大额充值等待足够确认后由扫描器补入账
+func TestTieredConfirmationsForRecharge(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	tron := &fakeChainService{chain: models.ChainTron}
+	policy := NewConfirmationPolicy(19, []config.ConfirmationTier{
+		{MinAmount: 0, Confirmations: 1},
+		{MinAmount: 100, Confirmations: 19},
+	})
+	rechargeService := NewRechargeService(
+		repository.NewRechargeOrderRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewDepositCursorRepository(db),
+		repository.NewOrphanDepositRepository(db),
+		NewAssetService(repository.NewAssetRepository(db)),
+		nil,
+		walletRepo,
+		map[string]*DepositChain{
+			models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: policy},
+		},
+		nil,
+		nil,
+		NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo),
+		db,
+		1, 1000,
+		"",
+		0,
+	)
+
+	small, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", models.AssetUSDTTRC20)
+	if err != nil {
+		t.Fatalf("创建充值订单失败: %v", err)
+	}
+	large, err := rechargeService.CreateRechargeOrder(ctx, 2, "500", models.AssetUSDTTRC20)
+	if err != nil {
+		t.Fatalf("创建充值订单失败: %v", err)
+	}
+
+	largeTx := &TransactionInfo{TxHash: "tx-large", ToAddress: "TDepositAddress", Amount: large.ExactAmount, TokenSymbol: "USDT", Confirmations: 5}
+	tron.transactions = []*TransactionInfo{
+		{TxHash: "tx-small", ToAddress: "TDepositAddress", Amount: small.ExactAmount, TokenSymbol: "USDT", Confirmations: 1},
+		largeTx,
+	}
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	status := func(order *models.RechargeOrder) models.RechargeStatus {
+		t.Helper()
+		current, err := rechargeService.GetRechargeOrder(ctx, order.OrderNo)
+		if err != nil {
+			t.Fatalf("获取充值订单失败: %v", err)
+		}
+		return current.Status
+	}
+	if got := status(small); got != models.RechargeStatusConfirmed {
+		t.Errorf("小额订单状态 = %s, 期望 1 个确认即入账", got)
+	}
+	if got := status(large); got != models.RechargeStatusPending {
+		t.Fatalf("大额订单状态 = %s, 期望确认数不足时保持待支付", got)
+	}
+
+	// 手动检查同样遵循确认数策略，确认数不足时不报错
+	checked, err := rechargeService.CheckRechargeStatus(ctx, large.OrderNo)
+	if err != nil {
+		t.Fatalf("检查充值状态失败: %v", err)
+	}
+	if checked.Status != models.RechargeStatusPending {
+		t.Errorf("手动检查后大额订单状态 = %s, 期望待支付", checked.Status)
+	}
+
+	// 确认数达到要求后，扫描器重试未处理的转账
+	largeTx.Confirmations = 19
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	if got := status(large); got != models.RechargeStatusConfirmed {
+		t.Errorf("大额订单状态 = %s, 期望达到 19 个确认后入账", got)
+	}
+}
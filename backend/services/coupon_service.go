@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidCoupon 优惠码不可用，以下具体原因均包装该错误
+	ErrInvalidCoupon = errors.New("优惠码不可用")
+
+	ErrCouponNotFound          = fmt.Errorf("%w: 优惠码不存在", ErrInvalidCoupon)
+	ErrCouponInactive          = fmt.Errorf("%w: 优惠码已停用", ErrInvalidCoupon)
+	ErrCouponNotStarted        = fmt.Errorf("%w: 优惠码尚未生效", ErrInvalidCoupon)
+	ErrCouponExpired           = fmt.Errorf("%w: 优惠码已过期", ErrInvalidCoupon)
+	ErrCouponMinSpendNotMet    = fmt.Errorf("%w: 未达到最低消费金额", ErrInvalidCoupon)
+	ErrCouponNotApplicable     = fmt.Errorf("%w: 该商品不适用此优惠码", ErrInvalidCoupon)
+	ErrCouponUsageLimitReached = fmt.Errorf("%w: 优惠码已被领完", ErrInvalidCoupon)
+	ErrCouponUserLimitReached  = fmt.Errorf("%w: 已达到该优惠码的使用次数上限", ErrInvalidCoupon)
+	ErrCouponUnavailable       = fmt.Errorf("%w: 优惠码功能未启用", ErrInvalidCoupon)
+)
+
+// minPayableAmount 使用优惠后订单的最低实付金额（0.01）
+// 冻结和扣款要求金额为正数，优惠不能把订单金额抵扣到零
+var minPayableAmount = big.NewRat(1, 100)
+
+// CouponDiscount 优惠码对某笔订单的计算结果
+type CouponDiscount struct {
+	Coupon *models.Coupon
+	Amount *big.Rat // 优惠金额（已按分向下取整）
+}
+
+// CouponService 优惠券服务接口
+// 下单时先用 Evaluate 计算优惠，订单创建后用 Redeem 占用使用次数，订单失败时用 ReleaseForOrder 退回
+type CouponService interface {
+	// Evaluate 校验优惠码对指定用户、商品和金额是否可用，并计算优惠金额
+	Evaluate(ctx context.Context, userID int64, code string, product *models.Product, subtotal *big.Rat) (*CouponDiscount, error)
+
+	// Redeem 为订单核销优惠码，在同一事务中校验总次数和每用户次数上限
+	Redeem(ctx context.Context, userID int64, discount *CouponDiscount, order *models.Order) error
+
+	// RedeemInTx 在调用方事务内核销优惠码，用于与订单创建一起提交
+	RedeemInTx(ctx context.Context, tx *gorm.DB, userID int64, discount *CouponDiscount, order *models.Order) error
+
+	// ReleaseForOrder 释放订单的优惠码核销并退回使用次数，订单没有核销记录或已释放时直接返回
+	ReleaseForOrder(ctx context.Context, orderNo string) error
+
+	// ReleaseForOrderInTx 在调用方事务内释放订单的优惠码核销，用于与订单失败退款一起提交
+	ReleaseForOrderInTx(ctx context.Context, tx *gorm.DB, orderNo string) error
+
+	// CreateCoupon 创建优惠券（管理员）
+	CreateCoupon(ctx context.Context, coupon *models.Coupon) error
+
+	// ListCoupons 按状态列出优惠券（管理员），status 为空时返回全部
+	ListCoupons(ctx context.Context, status models.CouponStatus, limit, offset int) ([]*models.Coupon, error)
+
+	// DisableCoupon 停用优惠券（管理员）
+	DisableCoupon(ctx context.Context, code string) error
+}
+
+// couponService 优惠券服务实现
+type couponService struct {
+	db         *gorm.DB
+	couponRepo repository.CouponRepository
+}
+
+// NewCouponService 创建优惠券服务实例
+func NewCouponService(db *gorm.DB, couponRepo repository.CouponRepository) CouponService {
+	return &couponService{
+		db:         db,
+		couponRepo: couponRepo,
+	}
+}
+
+// Evaluate 校验优惠码并计算优惠金额
+func (s *couponService) Evaluate(ctx context.Context, userID int64, code string, product *models.Product, subtotal *big.Rat) (*CouponDiscount, error) {
+	coupon, err := s.couponRepo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, fmt.Errorf("获取优惠券失败: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case coupon.Status != models.CouponStatusActive:
+		return nil, ErrCouponInactive
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return nil, ErrCouponNotStarted
+	case coupon.ExpiresAt != nil && !now.Before(*coupon.ExpiresAt):
+		return nil, ErrCouponExpired
+	}
+
+	if !couponMatchesProduct(coupon, product) {
+		return nil, ErrCouponNotApplicable
+	}
+
+	if minSpend := parseCouponAmount(coupon.MinSpend); minSpend.Sign() > 0 && subtotal.Cmp(minSpend) < 0 {
+		return nil, fmt.Errorf("%w (%s USDT)", ErrCouponMinSpendNotMet, minSpend.FloatString(2))
+	}
+
+	// 次数上限在 Redeem 中会在事务内再次校验，这里提前拦截以便报价时就能提示
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return nil, ErrCouponUsageLimitReached
+	}
+	if coupon.PerUserLimit > 0 {
+		used, err := s.couponRepo.CountUserRedemptions(ctx, coupon.ID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("获取优惠券使用次数失败: %w", err)
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return nil, ErrCouponUserLimitReached
+		}
+	}
+
+	return &CouponDiscount{
+		Coupon: coupon,
+		Amount: calculateCouponDiscount(coupon, subtotal),
+	}, nil
+}
+
+// Redeem 为订单核销优惠码
+func (s *couponService) Redeem(ctx context.Context, userID int64, discount *CouponDiscount, order *models.Order) error {
+	return RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return s.RedeemInTx(ctx, tx, userID, discount, order)
+		})
+	})
+}
+
+// RedeemInTx 在调用方事务内核销优惠码
+func (s *couponService) RedeemInTx(ctx context.Context, tx *gorm.DB, userID int64, discount *CouponDiscount, order *models.Order) error {
+	coupon := discount.Coupon
+	couponRepo := s.couponRepo.WithTx(tx)
+
+	// 先占用总次数：条件更新会锁住优惠券行，同一优惠券的并发核销在此串行
+	ok, err := couponRepo.IncrementUsage(ctx, coupon.ID)
+	if err != nil {
+		return fmt.Errorf("占用优惠券次数失败: %w", err)
+	}
+	if !ok {
+		return ErrCouponUsageLimitReached
+	}
+
+	if coupon.PerUserLimit > 0 {
+		used, err := couponRepo.CountUserRedemptions(ctx, coupon.ID, userID)
+		if err != nil {
+			return fmt.Errorf("获取优惠券使用次数失败: %w", err)
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return ErrCouponUserLimitReached
+		}
+	}
+
+	redemption := &models.CouponRedemption{
+		CouponID:       coupon.ID,
+		Code:           coupon.Code,
+		UserID:         userID,
+		OrderID:        order.ID,
+		OrderNo:        order.OrderNo,
+		DiscountAmount: discount.Amount.FloatString(2),
+		Status:         models.CouponRedemptionApplied,
+	}
+	if err := couponRepo.CreateRedemption(ctx, redemption); err != nil {
+		return fmt.Errorf("创建优惠券核销记录失败: %w", err)
+	}
+	return nil
+}
+
+// ReleaseForOrder 释放订单的优惠码核销并退回使用次数
+func (s *couponService) ReleaseForOrder(ctx context.Context, orderNo string) error {
+	return RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return s.ReleaseForOrderInTx(ctx, tx, orderNo)
+		})
+	})
+}
+
+// ReleaseForOrderInTx 在调用方事务内释放订单的优惠码核销
+func (s *couponService) ReleaseForOrderInTx(ctx context.Context, tx *gorm.DB, orderNo string) error {
+	couponRepo := s.couponRepo.WithTx(tx)
+
+	redemption, err := couponRepo.GetRedemptionByOrderNo(ctx, orderNo)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("获取优惠券核销记录失败: %w", err)
+	}
+
+	// 以状态作为条件更新，重复释放不会重复退回次数
+	released, err := couponRepo.ReleaseRedemption(ctx, redemption.ID)
+	if err != nil {
+		return fmt.Errorf("释放优惠券核销记录失败: %w", err)
+	}
+	if !released {
+		return nil
+	}
+
+	if err := couponRepo.DecrementUsage(ctx, redemption.CouponID); err != nil {
+		return fmt.Errorf("退回优惠券次数失败: %w", err)
+	}
+	return nil
+}
+
+// CreateCoupon 创建优惠券
+func (s *couponService) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	coupon.Code = models.NormalizeCouponCode(coupon.Code)
+	if coupon.Code == "" || len(coupon.Code) > 32 {
+		return errors.New("优惠码不能为空且不能超过 32 个字符")
+	}
+
+	value := parseCouponAmount(coupon.DiscountValue)
+	switch coupon.DiscountType {
+	case models.CouponDiscountPercentage:
+		if value.Sign() <= 0 || value.Cmp(big.NewRat(100, 1)) >= 0 {
+			return errors.New("折扣比例必须在 0 到 100 之间")
+		}
+	case models.CouponDiscountFixed:
+		if value.Sign() <= 0 {
+			return errors.New("立减金额必须大于 0")
+		}
+	default:
+		return fmt.Errorf("未知的折扣类型: %s", coupon.DiscountType)
+	}
+
+	for _, amount := range []*string{&coupon.MaxDiscount, &coupon.MinSpend} {
+		if *amount == "" {
+			*amount = "0"
+		}
+		if parseCouponAmount(*amount).Sign() < 0 {
+			return errors.New("金额不能为负数")
+		}
+	}
+	if coupon.UsageLimit < 0 || coupon.PerUserLimit < 0 {
+		return errors.New("使用次数上限不能为负数")
+	}
+	if coupon.StartsAt != nil && coupon.ExpiresAt != nil && !coupon.ExpiresAt.After(*coupon.StartsAt) {
+		return errors.New("过期时间必须晚于生效时间")
+	}
+	if coupon.Status == "" {
+		coupon.Status = models.CouponStatusActive
+	}
+
+	if err := s.couponRepo.Create(ctx, coupon); err != nil {
+		return fmt.Errorf("创建优惠券失败: %w", err)
+	}
+	return nil
+}
+
+// ListCoupons 按状态列出优惠券
+func (s *couponService) ListCoupons(ctx context.Context, status models.CouponStatus, limit, offset int) ([]*models.Coupon, error) {
+	coupons, err := s.couponRepo.List(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("获取优惠券列表失败: %w", err)
+	}
+	return coupons, nil
+}
+
+// DisableCoupon 停用优惠券
+func (s *couponService) DisableCoupon(ctx context.Context, code string) error {
+	coupon, err := s.couponRepo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCouponNotFound
+		}
+		return fmt.Errorf("获取优惠券失败: %w", err)
+	}
+
+	if err := s.couponRepo.UpdateStatus(ctx, coupon.ID, models.CouponStatusInactive); err != nil {
+		return fmt.Errorf("停用优惠券失败: %w", err)
+	}
+	return nil
+}
+
+// calculateCouponDiscount 计算优惠金额，按分向下取整，且保证订单至少需支付 minPayableAmount
+// 全程使用精确的十进制运算，取整只在最后按分向下取整一次
+func calculateCouponDiscount(coupon *models.Coupon, subtotal *big.Rat) *big.Rat {
+	value := parseCouponAmount(coupon.DiscountValue)
+
+	discount := new(big.Rat)
+	switch coupon.DiscountType {
+	case models.CouponDiscountPercentage:
+		discount.Mul(subtotal, value)
+		discount.Quo(discount, big.NewRat(100, 1))
+		if maxDiscount := parseCouponAmount(coupon.MaxDiscount); maxDiscount.Sign() > 0 && discount.Cmp(maxDiscount) > 0 {
+			discount.Set(maxDiscount)
+		}
+	case models.CouponDiscountFixed:
+		discount.Set(value)
+	}
+
+	if limit := new(big.Rat).Sub(subtotal, minPayableAmount); discount.Cmp(limit) > 0 {
+		discount.Set(limit)
+	}
+	if discount.Sign() < 0 {
+		return new(big.Rat)
+	}
+	cents := new(big.Int).Quo(new(big.Int).Mul(discount.Num(), big.NewInt(100)), discount.Denom())
+	return new(big.Rat).SetFrac(cents, big.NewInt(100))
+}
+
+// couponMatchesProduct 检查优惠券的产品类型和国家限制
+func couponMatchesProduct(coupon *models.Coupon, product *models.Product) bool {
+	if types := coupon.ProductTypeList(); len(types) > 0 && !slices.Contains(types, strings.ToLower(product.Type)) {
+		return false
+	}
+
+	countries := coupon.CountryList()
+	if len(countries) == 0 {
+		return true
+	}
+
+	var productCountries []struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(product.Countries), &productCountries); err != nil {
+		return false
+	}
+	for _, country := range productCountries {
+		if slices.Contains(countries, strings.ToUpper(country.Code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCouponAmount 解析优惠券金额字段，格式错误时按 0 处理
+func parseCouponAmount(value string) *big.Rat {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return new(big.Rat)
+	}
+	return amount
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestCouponConcurrentRedeem 并发核销不能超过总次数和每用户次数上限，释放后次数退回
+func TestCouponConcurrentRedeem(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	couponRepo := repository.NewCouponRepository(db)
+	couponService := NewCouponService(db, couponRepo)
+
+	coupon := &models.Coupon{
+		Code:          "race10",
+		DiscountType:  models.CouponDiscountPercentage,
+		DiscountValue: "10",
+		UsageLimit:    5,
+		PerUserLimit:  2,
+	}
+	if err := couponService.CreateCoupon(ctx, coupon); err != nil {
+		t.Fatalf("创建优惠券失败: %v", err)
+	}
+	product := &models.Product{ID: 1, Type: "local", Countries: `[{"code":"JP"}]`}
+
+	// 4 个用户各下 3 单：每人最多成功 2 单，总共最多成功 5 单
+	const users, ordersPerUser = 4, 3
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := map[int64]int{}
+	total := 0
+
+	for u := 1; u <= users; u++ {
+		for i := 0; i < ordersPerUser; i++ {
+			wg.Add(1)
+			go func(userID int64, i int) {
+				defer wg.Done()
+				discount := &CouponDiscount{Coupon: coupon, Amount: big.NewRat(1, 1)}
+				order := &models.Order{ID: uint(userID*10) + uint(i), OrderNo: fmt.Sprintf("CPN-%d-%d", userID, i)}
+				err := couponService.Redeem(ctx, userID, discount, order)
+				switch {
+				case err == nil:
+					mu.Lock()
+					succeeded[userID]++
+					total++
+					mu.Unlock()
+				case errors.Is(err, ErrCouponUsageLimitReached), errors.Is(err, ErrCouponUserLimitReached):
+				default:
+					t.Errorf("用户 %d 核销失败: %v", userID, err)
+				}
+			}(int64(u), i)
+		}
+	}
+	wg.Wait()
+
+	if total != 5 {
+		t.Errorf("成功核销 %d 次, 期望 5 次", total)
+	}
+	for userID, n := range succeeded {
+		if n > 2 {
+			t.Errorf("用户 %d 核销 %d 次, 超过每用户上限 2", userID, n)
+		}
+	}
+
+	stored, err := couponRepo.GetByID(ctx, coupon.ID)
+	if err != nil {
+		t.Fatalf("获取优惠券失败: %v", err)
+	}
+	if stored.UsedCount != 5 {
+		t.Errorf("已使用次数 = %d, 期望 5", stored.UsedCount)
+	}
+
+	// 已领完时报价直接拒绝
+	if _, err := couponService.Evaluate(ctx, 99, "RACE10", product, big.NewRat(10, 1)); !errors.Is(err, ErrCouponUsageLimitReached) {
+		t.Errorf("领完后报价应返回 ErrCouponUsageLimitReached, 实际: %v", err)
+	}
+
+	// 释放一单后次数退回，重复释放不会重复退回
+	var redemption models.CouponRedemption
+	if err := db.Where("status = ?", models.CouponRedemptionApplied).First(&redemption).Error; err != nil {
+		t.Fatalf("获取核销记录失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := couponService.ReleaseForOrder(ctx, redemption.OrderNo); err != nil {
+			t.Fatalf("释放优惠券失败: %v", err)
+		}
+	}
+	stored, _ = couponRepo.GetByID(ctx, coupon.ID)
+	if stored.UsedCount != 4 {
+		t.Errorf("释放后已使用次数 = %d, 期望 4", stored.UsedCount)
+	}
+
+	discount, err := couponService.Evaluate(ctx, 99, "race10", product, big.NewRat(25, 2))
+	if err != nil {
+		t.Fatalf("释放后报价失败: %v", err)
+	}
+	if got := discount.Amount.FloatString(2); got != "1.25" {
+		t.Errorf("优惠金额 = %s, 期望 1.25", got)
+	}
+}
+
+// TestCalculateCouponDiscount 优惠金额的上限、取整和最低实付金额
+func TestCalculateCouponDiscount(t *testing.T) {
+	cases := []struct {
+		name     string
+		coupon   models.Coupon
+		subtotal string
+		want     string
+	}{
+		{"按比例", models.Coupon{DiscountType: models.CouponDiscountPercentage, DiscountValue: "15"}, "20", "3.00"},
+		{"按比例封顶", models.Coupon{DiscountType: models.CouponDiscountPercentage, DiscountValue: "50", MaxDiscount: "4"}, "20", "4.00"},
+		{"按分向下取整", models.Coupon{DiscountType: models.CouponDiscountPercentage, DiscountValue: "33"}, "1", "0.33"},
+		{"十进制金额不受浮点误差影响", models.Coupon{DiscountType: models.CouponDiscountPercentage, DiscountValue: "10"}, "3", "0.30"},
+		{"固定立减", models.Coupon{DiscountType: models.CouponDiscountFixed, DiscountValue: "2"}, "9.99", "2.00"},
+		{"立减超过订单金额", models.Coupon{DiscountType: models.CouponDiscountFixed, DiscountValue: "10"}, "3", "2.99"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			subtotal, _ := new(big.Rat).SetString(tc.subtotal)
+			if got := calculateCouponDiscount(&tc.coupon, subtotal).FloatString(2); got != tc.want {
+				t.Errorf("优惠金额 = %s, 期望 %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tg-robot-sim/pkg/tron"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+// DepositAddressService 用户专属充值地址服务接口
+type DepositAddressService interface {
+	// GetUserAddress 获取用户的专属充值地址，首次调用时分配派生索引并派生地址
+	GetUserAddress(ctx context.Context, userID int64) (string, error)
+
+	// ListAddresses 获取已分配的全部专属充值地址（充值扫描器使用）
+	ListAddresses(ctx context.Context) ([]string, error)
+}
+
+// hdDepositAddressService 基于扩展公钥的 TRON 充值地址服务实现
+// 服务端只持有账户级 xpub，按 m/44'/195'/0'/0/index 派生地址，私钥离线保管
+type hdDepositAddressService struct {
+	db      *gorm.DB
+	repo    repository.DepositAddressRepository
+	account *tron.ExtendedPublicKey
+}
+
+// NewHDDepositAddressService 创建 TRON 充值地址服务，xpub 必须是账户级扩展公钥（m/44'/195'/account'）
+func NewHDDepositAddressService(db *gorm.DB, repo repository.DepositAddressRepository, xpub string) (DepositAddressService, error) {
+	account, err := tron.ParseExtendedPublicKey(xpub)
+	if err != nil {
+		return nil, fmt.Errorf("解析充值扩展公钥失败: %w", err)
+	}
+	if _, err := tron.DeriveDepositAddress(account, 0); err != nil {
+		return nil, fmt.Errorf("充值扩展公钥不可用: %w", err)
+	}
+
+	return &hdDepositAddressService{
+		db:      db,
+		repo:    repo,
+		account: account,
+	}, nil
+}
+
+// GetUserAddress 获取用户的专属充值地址
+// 新用户先插入记录取得自增 ID 作为派生索引，再在同一事务中写入派生的地址；并发创建时以先提交的记录为准
+func (s *hdDepositAddressService) GetUserAddress(ctx context.Context, userID int64) (string, error) {
+	record, err := s.repo.GetByUserID(ctx, models.ChainTron, userID)
+	if err == nil && record.Address != "" {
+		return record.Address, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("获取充值地址失败: %w", err)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		record = &models.DepositAddress{UserID: userID, Chain: models.ChainTron}
+		if err := repo.Create(ctx, record); err != nil {
+			return err
+		}
+		if record.ID >= tron.HardenedKeyStart {
+			return fmt.Errorf("派生索引已用尽: %d", record.ID)
+		}
+
+		address, err := tron.DeriveDepositAddress(s.account, record.DerivationIndex())
+		if err != nil {
+			return fmt.Errorf("派生充值地址失败: %w", err)
+		}
+		record.Address = address
+		return repo.Update(ctx, record)
+	})
+	if err != nil {
+		// 并发请求已为该用户创建地址时直接使用已有地址
+		if existing, getErr := s.repo.GetByUserID(ctx, models.ChainTron, userID); getErr == nil && existing.Address != "" {
+			return existing.Address, nil
+		}
+		return "", fmt.Errorf("分配充值地址失败: %w", err)
+	}
+
+	return record.Address, nil
+}
+
+// ListAddresses 获取已分配的全部专属充值地址
+func (s *hdDepositAddressService) ListAddresses(ctx context.Context) ([]string, error) {
+	records, err := s.repo.ListByChain(ctx, models.ChainTron)
+	if err != nil {
+		return nil, fmt.Errorf("获取充值地址失败: %w", err)
+	}
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		addresses = append(addresses, record.Address)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// testAccountXPub 测试用账户级扩展公钥（深度 3，公钥为生成元 G）
+const testAccountXPub = "xpub6BemYiVNp19ZzyABypvqjpfjBDNKWAyFSBLqpJxRxqiNASWqs8PvPi53jrvBHMDZxkrnCbEwWkCapTmHtKgc6mLpk5AUtNZoEKCWpi7CPAJ"
+
+// TestHDDepositAddressRecharge 专属地址订单按地址匹配，按实收数量入账；没有订单的专属地址同样扫描，收到的转账记为孤儿充值
+func TestHDDepositAddressRecharge(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	addressService, err := NewHDDepositAddressService(db, repository.NewDepositAddressRepository(db), testAccountXPub)
+	if err != nil {
+		t.Fatalf("创建充值地址服务失败: %v", err)
+	}
+	if _, err := NewHDDepositAddressService(db, repository.NewDepositAddressRepository(db), "xprv-not-a-key"); err == nil {
+		t.Errorf("无效的扩展公钥应返回错误")
+	}
+
+	first, err := addressService.GetUserAddress(ctx, 1)
+	if err != nil {
+		t.Fatalf("获取充值地址失败: %v", err)
+	}
+	again, _ := addressService.GetUserAddress(ctx, 1)
+	other, _ := addressService.GetUserAddress(ctx, 2)
+	if !strings.HasPrefix(first, "T") || first != again || first == other {
+		t.Fatalf("充值地址 = %s / %s / %s, 期望同一用户地址固定、不同用户地址不同", first, again, other)
+	}
+
+	walletRepo := repository.NewWalletRepository(db)
+	tron := &fakeChainService{chain: models.ChainTron}
+	rechargeService := NewRechargeService(
+		repository.NewRechargeOrderRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewDepositCursorRepository(db),
+		repository.NewOrphanDepositRepository(db),
+		NewAssetService(repository.NewAssetRepository(db)),
+		nil,
+		walletRepo,
+		map[string]*DepositChain{
+			models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: NewConfirmationPolicy(19, nil), Addresses: addressService},
+		},
+		nil,
+		nil,
+		NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo),
+		db,
+		1, 1000,
+		"",
+		0,
+	)
+
+	order, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", models.AssetUSDTTRC20)
+	if err != nil {
+		t.Fatalf("创建充值订单失败: %v", err)
+	}
+	if order.WalletAddress != first || order.MatchMode != models.RechargeMatchAddress {
+		t.Fatalf("订单收款地址 = %s, 匹配方式 = %s", order.WalletAddress, order.MatchMode)
+	}
+
+	// 用户扣除手续费后只到账 9.5 USDT，下单前到账的转账不属于该订单
+	tron.transactions = []*TransactionInfo{
+		{TxHash: "tx-before", ToAddress: first, Amount: "3", TokenSymbol: "USDT", Confirmations: 19, Timestamp: order.CreatedAt.Add(-time.Hour)},
+		{TxHash: "tx-paid", ToAddress: first, Amount: "9.5", TokenSymbol: "USDT", Confirmations: 19, Timestamp: time.Now()},
+		{TxHash: "tx-no-order", ToAddress: other, Amount: "4", TokenSymbol: "USDT", Confirmations: 19, Timestamp: time.Now()},
+	}
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	current, err := rechargeService.GetRechargeOrder(ctx, order.OrderNo)
+	if err != nil {
+		t.Fatalf("获取充值订单失败: %v", err)
+	}
+	if current.Status != models.RechargeStatusConfirmed || current.TxHash != "tx-paid" || normalizeAmount(current.CreditedAmount) != "9.50000000" {
+		t.Fatalf("订单状态 = %s, 交易 = %s, 到账金额 = %s", current.Status, current.TxHash, current.CreditedAmount)
+	}
+	wallet, err := walletRepo.GetByUserID(ctx, 1)
+	if err != nil {
+		t.Fatalf("获取钱包失败: %v", err)
+	}
+	if normalizeAmount(wallet.Balance) != "9.50000000" {
+		t.Errorf("钱包余额 = %s, 期望按实收 9.5 入账", wallet.Balance)
+	}
+
+	// 用户 2 没有下单，转账到其专属地址也会被扫描并记为孤儿充值
+	orphans, err := repository.NewOrphanDepositRepository(db).GetByStatus(ctx, models.OrphanStatusPending, 0, 0)
+	if err != nil {
+		t.Fatalf("获取孤儿充值失败: %v", err)
+	}
+	var orphan *models.OrphanDeposit
+	for _, candidate := range orphans {
+		if candidate.TxHash == "tx-no-order" {
+			orphan = candidate
+		}
+	}
+	if orphan == nil || orphan.Address != other || orphan.Reason != models.OrphanReasonUnmatched {
+		t.Errorf("无订单转账的孤儿充值 = %+v", orphan)
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// depositClockSkew 判断转账是否在下单之后时允许的链上时间与服务器时间偏差
+	depositClockSkew = time.Minute
+	// lateDepositWindow 订单过期后仍接受逾期到账的时间窗口，超出窗口的转账记为孤儿充值
+	lateDepositWindow = 24 * time.Hour
+	// reverifyWindow 入账后复核的时间窗口，窗口内仍未复核通过的订单（如链服务长期不可用）不再自动处理
+	reverifyWindow = 24 * time.Hour
+	// reverifyMissThreshold 入账后复核连续多少次查不到交易才冲回，避免节点暂时不同步或查询抖动导致误冲回
+	reverifyMissThreshold = 3
+)
+
+// ProcessPendingRecharges 处理待支付的充值订单（定时任务调用）
+// 每条链的共用收款地址和已分配的全部专属地址按该链资产各扫描一次（专属地址永久有效，没有订单时收到的转账同样需要入库）；
+// 扫描位置由持久化游标记录，新入账转账写入 transactions 表（按交易哈希去重）后一次性与待支付及最近过期的订单匹配，
+// 没有可匹配订单的转账记为孤儿充值；
+// 扫描位置和入账转账在同一事务中提交，重启后不会漏扫或重复入账；最后复核最近入账的订单
+func (s *rechargeService) ProcessPendingRecharges(ctx context.Context) error {
+	if err := s.rechargeRepo.ExpireOldOrders(ctx); err != nil {
+		fmt.Printf("更新过期订单失败: %v\n", err)
+	}
+
+	assets, err := s.assetService.ListAssets(ctx, true)
+	if err != nil {
+		return fmt.Errorf("获取资产列表失败: %w", err)
+	}
+	assetByCode := make(map[string]*models.Asset, len(assets))
+	for _, asset := range assets {
+		assetByCode[asset.Code] = asset
+	}
+
+	orders, err := s.rechargeRepo.GetPendingOrders(ctx)
+	if err != nil {
+		return fmt.Errorf("获取待支付订单失败: %w", err)
+	}
+	expired, err := s.rechargeRepo.GetExpiredSince(ctx, time.Now().Add(-lateDepositWindow))
+	if err != nil {
+		return fmt.Errorf("获取已过期订单失败: %w", err)
+	}
+	orders = append(orders, expired...)
+
+	chainNames := make([]string, 0, len(s.chains))
+	for name := range s.chains {
+		chainNames = append(chainNames, name)
+	}
+	sort.Strings(chainNames)
+
+	for _, name := range chainNames {
+		chain := s.chains[name]
+
+		// 收款地址 -> 需要扫描的资产
+		targets := make(map[string]map[string]*models.Asset)
+		addTarget := func(address string, asset *models.Asset) {
+			if targets[address] == nil {
+				targets[address] = make(map[string]*models.Asset)
+			}
+			targets[address][asset.Code] = asset
+		}
+		addChainAssets := func(address string) {
+			for _, asset := range assets {
+				if asset.Chain == name {
+					addTarget(address, asset)
+				}
+			}
+		}
+		if chain.DepositAddress != "" {
+			addChainAssets(chain.DepositAddress)
+		}
+		if chain.Addresses != nil {
+			allocated, err := chain.Addresses.ListAddresses(ctx)
+			if err != nil {
+				// 仍按订单扫描专属地址，已分配但没有订单的地址下次再扫描
+				fmt.Printf("获取 %s 的专属充值地址失败: %v\n", name, err)
+			}
+			for _, address := range allocated {
+				addChainAssets(address)
+			}
+		}
+		for _, order := range orders {
+			asset, ok := assetByCode[order.Asset]
+			if ok && asset.Chain == name && order.MatchMode == models.RechargeMatchAddress {
+				addTarget(order.WalletAddress, asset)
+			}
+		}
+
+		addresses := make([]string, 0, len(targets))
+		for address := range targets {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+
+		for _, address := range addresses {
+			for _, asset := range targets[address] {
+				if err := s.scanDeposits(ctx, chain, address, asset); err != nil {
+					// 记录错误但继续扫描其他资产，游标未推进，下次从原位置重试
+					fmt.Printf("扫描 %s 在 %s 的充值转账失败: %v\n", asset.Code, address, err)
+				}
+			}
+			if err := s.matchDeposits(ctx, name, chain, address, orders); err != nil {
+				fmt.Printf("匹配 %s 的充值订单失败: %v\n", address, err)
+			}
+		}
+	}
+
+	s.reverifyCredited(ctx)
+	return nil
+}
+
+// scanDeposits 从游标位置扫描收款地址收到的指定资产转账，写入交易表并推进游标
+func (s *rechargeService) scanDeposits(ctx context.Context, chain *DepositChain, address string, asset *models.Asset) error {
+	chainName := chain.Service.Chain()
+	cursor, err := s.cursorRepo.Get(ctx, chainName, address, asset.Code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		cursor = &models.DepositCursor{Chain: chainName, Address: address, Asset: asset.Code}
+	} else if err != nil {
+		return fmt.Errorf("获取扫描游标失败: %w", err)
+	}
+
+	result, err := chain.Service.ScanIncomingTransfers(ctx, address, asset, ScanCursor{
+		Block:       cursor.LastBlock,
+		Timestamp:   cursor.LastTimestamp,
+		Fingerprint: cursor.Fingerprint,
+	})
+	if err != nil {
+		return fmt.Errorf("扫描入账转账失败: %w", err)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		transactionRepo := s.transactionRepo.WithTx(tx)
+		for _, transfer := range result.Transfers {
+			// 确认数在与订单匹配入账时按确认数策略检查，不足的转账保留为未处理，下次重试
+			if transfer.ToAddress != address || !transactionMatchesAsset(transfer, asset) {
+				continue
+			}
+			record := &models.Transaction{
+				TxHash:        transfer.TxHash,
+				Chain:         chainName,
+				Asset:         asset.Code,
+				TokenContract: transfer.TokenContract,
+				FromAddress:   transfer.FromAddress,
+				ToAddress:     transfer.ToAddress,
+				Amount:        transfer.Amount,
+				TokenSymbol:   asset.Symbol,
+				Status:        models.TransactionStatusConfirmed,
+				Confirmations: transfer.Confirmations,
+				BlockNumber:   transfer.BlockNumber,
+				Timestamp:     transfer.Timestamp,
+			}
+			if _, err := transactionRepo.CreateIfNotExists(ctx, record); err != nil {
+				return fmt.Errorf("保存入账转账失败: %w", err)
+			}
+		}
+
+		cursor.LastBlock = result.Next.Block
+		cursor.LastTimestamp = result.Next.Timestamp
+		cursor.Fingerprint = result.Next.Fingerprint
+		if err := s.cursorRepo.WithTx(tx).Save(ctx, cursor); err != nil {
+			return fmt.Errorf("保存扫描游标失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// matchDeposits 将收款地址上尚未处理的入账转账与订单一次性匹配
+// 共用地址按资产和精确金额匹配；专属地址按资产匹配下单后收到的转账（同一地址多笔订单时先到先得）；
+// 待支付订单优先，其次是最近过期的订单（逾期到账）。确认失败的转账保留为未处理，下次重试；
+// 没有可匹配订单的转账记为孤儿充值，由管理员分配
+func (s *rechargeService) matchDeposits(ctx context.Context, chainName string, chain *DepositChain, address string, orders []*models.RechargeOrder) error {
+	deposits, err := s.transactionRepo.GetUnprocessed(ctx, chainName, address)
+	if err != nil {
+		return fmt.Errorf("获取未处理转账失败: %w", err)
+	}
+	if len(deposits) == 0 {
+		return nil
+	}
+
+	exact := make(map[string]*models.RechargeOrder)
+	byAsset := make(map[string][]*models.RechargeOrder)
+	for _, order := range orders {
+		if order.WalletAddress != address || !depositMatchable(order) {
+			continue
+		}
+		if order.MatchMode == models.RechargeMatchAddress {
+			byAsset[order.Asset] = append(byAsset[order.Asset], order)
+			continue
+		}
+		key := depositMatchKey(order.Asset, order.ExactAmount)
+		if current, ok := exact[key]; !ok || depositOrderBefore(order, current) {
+			exact[key] = order
+		}
+	}
+	for _, list := range byAsset {
+		sort.SliceStable(list, func(i, j int) bool { return depositOrderBefore(list[i], list[j]) })
+	}
+
+	for _, deposit := range deposits {
+		var order *models.RechargeOrder
+		if candidate := exact[depositMatchKey(deposit.Asset, deposit.Amount)]; candidate != nil &&
+			depositMatchable(candidate) && depositAfterOrder(candidate, deposit.Timestamp) {
+			order = candidate
+		}
+		if order == nil {
+			for _, candidate := range byAsset[deposit.Asset] {
+				if depositMatchable(candidate) && depositAfterOrder(candidate, deposit.Timestamp) {
+					order = candidate
+					break
+				}
+			}
+		}
+		if order == nil {
+			if err := s.recordOrphan(ctx, chainName, deposit); err != nil {
+				fmt.Printf("记录孤儿充值 %s 失败: %v\n", deposit.TxHash, err)
+			}
+			continue
+		}
+
+		// 确认成功后订单状态更新为已确认，不会再被后续转账匹配；少付转人工时订单保持原状态
+		rechargeNo := order.OrderNo
+		if err := s.confirmDeposit(ctx, order, deposit.TxHash, true); err != nil {
+			if errors.Is(err, ErrInsufficientConfirmations) {
+				continue
+			}
+			// 链上执行失败的转账永远不会入账，标记为已处理不再重试
+			if errors.Is(err, ErrTransactionFailed) {
+				fmt.Printf("转账 %s 执行失败，不予入账: %v\n", deposit.TxHash, err)
+			} else if !errors.Is(err, ErrRechargeUnderpaidHeld) {
+				fmt.Printf("确认订单 %s 充值失败: %v\n", order.OrderNo, err)
+				continue
+			}
+			rechargeNo = ""
+		}
+		if err := s.transactionRepo.MarkProcessed(ctx, deposit.ID, rechargeNo); err != nil {
+			fmt.Printf("标记转账 %s 失败: %v\n", deposit.TxHash, err)
+		}
+	}
+
+	return nil
+}
+
+// recordOrphan 将没有可匹配订单的转账记为孤儿充值，并在同一事务中标记为已处理
+func (s *rechargeService) recordOrphan(ctx context.Context, chainName string, deposit *models.Transaction) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := s.orphanRepo.WithTx(tx).CreateIfNotExists(ctx, &models.OrphanDeposit{
+			Chain:       chainName,
+			Address:     deposit.ToAddress,
+			Asset:       deposit.Asset,
+			TxHash:      deposit.TxHash,
+			FromAddress: deposit.FromAddress,
+			Amount:      deposit.Amount,
+			Reason:      models.OrphanReasonUnmatched,
+		})
+		if err != nil {
+			return err
+		}
+		return s.transactionRepo.WithTx(tx).MarkProcessed(ctx, deposit.ID, "")
+	})
+}
+
+// depositMatchable 订单是否还能匹配入账转账（待支付，或已过期但仍在逾期到账窗口内）
+func depositMatchable(order *models.RechargeOrder) bool {
+	switch order.Status {
+	case models.RechargeStatusPending:
+		return true
+	case models.RechargeStatusExpired:
+		return time.Since(order.ExpiresAt) < lateDepositWindow
+	default:
+		return false
+	}
+}
+
+// depositOrderBefore 匹配优先级：待支付订单先于已过期订单，待支付订单先下单的优先，已过期订单最近过期的优先
+func depositOrderBefore(a, b *models.RechargeOrder) bool {
+	aPending := a.Status == models.RechargeStatusPending
+	bPending := b.Status == models.RechargeStatusPending
+	if aPending != bPending {
+		return aPending
+	}
+	if aPending {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ExpiresAt.After(b.ExpiresAt)
+}
+
+// depositAfterOrder 专属地址上收到的转账是否在下单之后（下单前的转账不属于该订单）
+func depositAfterOrder(order *models.RechargeOrder, timestamp time.Time) bool {
+	return timestamp.IsZero() || !timestamp.Before(order.CreatedAt.Add(-depositClockSkew))
+}
+
+// depositMatchKey 按资产和数值金额生成匹配键（链上金额和数据库读回的金额末尾 0 可能不同）
+func depositMatchKey(asset, amount string) string {
+	return models.NormalizeAssetCode(asset) + "|" + normalizeAmount(amount)
+}
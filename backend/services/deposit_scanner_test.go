@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestDepositScannerSinglePassAndRestart 每种资产每轮只扫描一次，转账只入账一次，重启后从持久化游标继续
+func TestDepositScannerSinglePassAndRestart(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	cursorRepo := repository.NewDepositCursorRepository(db)
+	tron := &fakeChainService{chain: models.ChainTron}
+	newService := func() RechargeService {
+		return NewRechargeService(
+			repository.NewRechargeOrderRepository(db),
+			transactionRepo,
+			cursorRepo,
+			repository.NewOrphanDepositRepository(db),
+			NewAssetService(repository.NewAssetRepository(db)),
+			nil,
+			walletRepo,
+			map[string]*DepositChain{
+				models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: NewConfirmationPolicy(19, nil)},
+			},
+			nil,
+			nil,
+			NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo),
+			db,
+			1, 1000,
+			"",
+			0,
+		)
+	}
+	rechargeService := newService()
+
+	var orders []*models.RechargeOrder
+	for userID := int64(1); userID <= 3; userID++ {
+		order, err := rechargeService.CreateRechargeOrder(ctx, userID, "10", models.AssetUSDTTRC20)
+		if err != nil {
+			t.Fatalf("创建充值订单失败: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	// 用户 1、2 已支付，另有一笔与订单无关的转账
+	tron.transactions = []*TransactionInfo{
+		{TxHash: "tx-1", ToAddress: "TDepositAddress", Amount: orders[0].ExactAmount, TokenSymbol: "USDT", Confirmations: 19},
+		{TxHash: "tx-2", ToAddress: "TDepositAddress", Amount: orders[1].ExactAmount, TokenSymbol: "USDT", Confirmations: 19},
+		{TxHash: "tx-other", ToAddress: "TDepositAddress", Amount: "3.5", TokenSymbol: "USDT", Confirmations: 19},
+	}
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	// TRON 上可用资产为 USDT-TRC20 和 TRX，每轮各扫描一次，与订单数量无关
+	if tron.scans != 2 {
+		t.Errorf("扫描次数 = %d, 期望 2", tron.scans)
+	}
+	for i, want := range []models.RechargeStatus{models.RechargeStatusConfirmed, models.RechargeStatusConfirmed, models.RechargeStatusPending} {
+		current, err := rechargeService.GetRechargeOrder(ctx, orders[i].OrderNo)
+		if err != nil {
+			t.Fatalf("获取充值订单失败: %v", err)
+		}
+		if current.Status != want {
+			t.Errorf("订单 %d 状态 = %s, 期望 %s", i+1, current.Status, want)
+		}
+	}
+
+	matched, err := transactionRepo.GetByTxHash(ctx, "tx-1")
+	if err != nil {
+		t.Fatalf("获取入账转账失败: %v", err)
+	}
+	if matched.RechargeNo != orders[0].OrderNo || matched.ProcessedAt == nil || matched.Asset != models.AssetUSDTTRC20 {
+		t.Errorf("转账匹配结果 = %s / %v / %s", matched.RechargeNo, matched.ProcessedAt, matched.Asset)
+	}
+	if unprocessed, _ := transactionRepo.GetUnprocessed(ctx, models.ChainTron, "TDepositAddress"); len(unprocessed) != 0 {
+		t.Errorf("未处理转账数量 = %d, 期望 0", len(unprocessed))
+	}
+
+	// 模拟重启：新的服务实例从持久化游标继续，已入账的转账再次返回也不会重复入账
+	rechargeService = newService()
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	cursor, err := cursorRepo.Get(ctx, models.ChainTron, "TDepositAddress", models.AssetUSDTTRC20)
+	if err != nil {
+		t.Fatalf("获取扫描游标失败: %v", err)
+	}
+	if cursor.LastTimestamp != 2 {
+		t.Errorf("游标位置 = %d, 期望 2（重启后从已保存的位置继续）", cursor.LastTimestamp)
+	}
+
+	var count int64
+	db.Model(&models.Transaction{}).Count(&count)
+	if count != 3 {
+		t.Errorf("交易表记录数 = %d, 期望 3", count)
+	}
+	for _, userID := range []int64{1, 2} {
+		wallet, err := walletRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if normalizeAmount(wallet.Balance) != "10.00000000" {
+			t.Errorf("用户 %d 余额 = %s, 期望 10（不能重复入账）", userID, wallet.Balance)
+		}
+	}
+}
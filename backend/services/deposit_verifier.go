@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// reverifyCredited 入账后复核：最近入账且尚未复核通过的订单重新到链上核对交易
+// 交易在入账确认数之上再经过 reverifyBlocks 个区块仍然有效时标记为复核通过；
+// 交易执行失败或与订单不一致时冲回入账并告警管理员，连续 reverifyMissThreshold 次复核查不到交易（未固化或被回滚）时同样冲回
+func (s *rechargeService) reverifyCredited(ctx context.Context) {
+	orders, err := s.rechargeRepo.GetUnverifiedSince(ctx, time.Now().Add(-reverifyWindow))
+	if err != nil {
+		fmt.Printf("获取待复核充值订单失败: %v\n", err)
+		return
+	}
+
+	for _, order := range orders {
+		if err := s.reverifyDeposit(ctx, order); err != nil {
+			// 链服务暂不可用等错误不冲回，下次继续复核
+			fmt.Printf("复核充值订单 %s 失败: %v\n", order.OrderNo, err)
+		}
+	}
+}
+
+// reverifyDeposit 复核单笔已入账订单
+func (s *rechargeService) reverifyDeposit(ctx context.Context, order *models.RechargeOrder) error {
+	assetInfo, chain, err := s.orderChain(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	txDetail, err := chain.Service.GetTransactionByHash(ctx, order.TxHash)
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			misses, err := s.rechargeRepo.RecordReverifyMiss(ctx, order.ID)
+			if err != nil {
+				return fmt.Errorf("记录复核结果失败: %w", err)
+			}
+			if misses < reverifyMissThreshold {
+				return nil
+			}
+			return s.reverseDeposit(ctx, order, fmt.Sprintf("连续 %d 次复核链上查不到该交易（未固化或已被回滚）", misses))
+		}
+		return fmt.Errorf("获取交易详情失败: %w", err)
+	}
+	if order.ReverifyMiss > 0 {
+		if err := s.rechargeRepo.ResetReverifyMiss(ctx, order.ID); err != nil {
+			return fmt.Errorf("记录复核结果失败: %w", err)
+		}
+	}
+	if err := checkTransactionMatches(chain, assetInfo, order, txDetail); err != nil {
+		return s.reverseDeposit(ctx, order, err.Error())
+	}
+
+	if txDetail.Confirmations < order.Confirmations+s.reverifyBlocks {
+		return nil
+	}
+	if _, err := s.rechargeRepo.MarkVerified(ctx, order.ID, time.Now()); err != nil {
+		return fmt.Errorf("标记复核通过失败: %w", err)
+	}
+	return nil
+}
+
+// reverseDeposit 冲回已入账的充值
+// 订单状态、账本分录和钱包流水在同一事务中写入，以已确认状态作为条件更新，同一订单只会冲回一次；
+// 扣回前锁定入账所在的计价币种钱包，余额不足以全额扣回时扣回全部可用余额，差额体现在对账结果中并在告警中注明，需人工追缴
+func (s *rechargeService) reverseDeposit(ctx context.Context, order *models.RechargeOrder, reason string) error {
+	var clawback, shortfall string
+	now := time.Now()
+	remark := fmt.Sprintf("充值冲回，订单号: %s，交易: %s，原因: %s", order.OrderNo, order.TxHash, reason)
+
+	err := RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.RechargeOrder{}).
+				Where("id = ? AND status = ?", order.ID, models.RechargeStatusConfirmed).
+				Updates(map[string]interface{}{
+					"status":      models.RechargeStatusReversed,
+					"reversed_at": now,
+					"remark":      remark,
+				})
+			if result.Error != nil {
+				return fmt.Errorf("更新订单状态失败: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("订单状态已变更，跳过冲回")
+			}
+
+			// 扣回金额为入账金额与当前可用余额中的较小者；充值按汇率折算后记在计价币种钱包上，
+			// 加锁读取该钱包，避免计算扣回金额后余额被并发消费
+			wallet, err := s.walletRepo.WithTx(tx).GetOrCreateForUpdate(ctx, order.UserID)
+			if err != nil {
+				return fmt.Errorf("获取钱包失败: %w", err)
+			}
+			credited, err := parseDecimal(order.CreditedAmount)
+			if err != nil {
+				return fmt.Errorf("入账金额格式错误: %w", err)
+			}
+			available, err := parseDecimal(wallet.Balance)
+			if err != nil {
+				return fmt.Errorf("钱包余额格式错误: %w", err)
+			}
+			amount := credited
+			if available.Cmp(credited) < 0 {
+				amount = available
+			}
+			if amount.Sign() < 0 {
+				amount = big.NewFloat(0)
+			}
+			clawback = amount.Text('f', 8)
+			shortfall = new(big.Float).Sub(credited, amount).Text('f', 8)
+			if amount.Sign() == 0 {
+				return nil
+			}
+
+			posting := NewLedgerTransfer(
+				order.UserID,
+				models.LedgerEntryTypeRechargeRevert,
+				models.LedgerAccountUserAvailable,
+				models.LedgerAccountDepositClearing,
+				clawback,
+				order.OrderNo,
+				remark,
+			)
+			posting.Idempotent = true
+
+			posted, err := s.ledgerService.PostInTx(ctx, tx, posting)
+			if err != nil {
+				return fmt.Errorf("扣回用户余额失败: %w", err)
+			}
+
+			history := &models.WalletHistory{
+				UserID:        order.UserID,
+				Type:          models.WalletHistoryTypeChargeback,
+				Amount:        "-" + clawback,
+				BalanceBefore: posted.WalletBefore.Balance,
+				BalanceAfter:  posted.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   remark,
+				RelatedType:   "recharge_order",
+				RelatedID:     order.OrderNo,
+				TxHash:        order.TxHash,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return fmt.Errorf("创建冲回记录失败: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	order.Status = models.RechargeStatusReversed
+	order.ReversedAt = &now
+	order.Remark = remark
+
+	// 告警在事务外发送，失败不影响冲回
+	if s.notificationService != nil {
+		alert := fmt.Sprintf("充值订单 %s 已冲回\n用户: %d\n交易: %s\n原因: %s\n入账金额: %s，已扣回: %s，未扣回: %s",
+			order.OrderNo, order.UserID, order.TxHash, reason, order.CreditedAmount, normalizeAmount(clawback), normalizeAmount(shortfall))
+		if err := s.notificationService.SendAdminAlert(ctx, alert); err != nil {
+			fmt.Printf("发送充值冲回告警失败: %v\n", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// fakeAlertNotifier 测试用通知服务，记录充值到账通知的订单号和发送给管理员的告警
+type fakeAlertNotifier struct {
+	NotificationService
+	recharges []string
+	alerts    []string
+}
+
+func (f *fakeAlertNotifier) SendRechargeSuccessNotification(ctx context.Context, userID int64, amount string, orderNo string) error {
+	f.recharges = append(f.recharges, orderNo)
+	return nil
+}
+
+func (f *fakeAlertNotifier) SendAdminAlert(ctx context.Context, message string) error {
+	f.alerts = append(f.alerts, message)
+	return nil
+}
+
+// TestReverifyCreditedDeposits 入账后复核：交易执行失败或连续多次从链上查不到时冲回入账并告警，稳定的交易复核通过，
+// 执行失败的转账从一开始就不会入账
+func TestReverifyCreditedDeposits(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	rechargeRepo := repository.NewRechargeOrderRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	tron := &fakeChainService{chain: models.ChainTron}
+	notifier := &fakeAlertNotifier{}
+	rechargeService := NewRechargeService(
+		rechargeRepo,
+		repository.NewTransactionRepository(db),
+		repository.NewDepositCursorRepository(db),
+		repository.NewOrphanDepositRepository(db),
+		NewAssetService(repository.NewAssetRepository(db)),
+		nil,
+		walletRepo,
+		map[string]*DepositChain{
+			models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: NewConfirmationPolicy(19, nil)},
+		},
+		notifier,
+		nil,
+		ledgerService,
+		db,
+		1, 1000,
+		"",
+		20,
+	)
+
+	var orders []*models.RechargeOrder
+	for userID := int64(1); userID <= 4; userID++ {
+		order, err := rechargeService.CreateRechargeOrder(ctx, userID, "10", models.AssetUSDTTRC20)
+		if err != nil {
+			t.Fatalf("创建充值订单失败: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	reverted := &TransactionInfo{TxHash: "tx-reverted", ToAddress: "TDepositAddress", Amount: orders[0].ExactAmount, TokenSymbol: "USDT", Confirmations: 19}
+	spent := &TransactionInfo{TxHash: "tx-spent", ToAddress: "TDepositAddress", Amount: orders[1].ExactAmount, TokenSymbol: "USDT", Confirmations: 19}
+	stable := &TransactionInfo{TxHash: "tx-stable", ToAddress: "TDepositAddress", Amount: orders[2].ExactAmount, TokenSymbol: "USDT", Confirmations: 19}
+	failed := &TransactionInfo{TxHash: "tx-failed", ToAddress: "TDepositAddress", Amount: orders[3].ExactAmount, TokenSymbol: "USDT", Confirmations: 19,
+		Status: string(TransactionStatusFailed)}
+	tron.transactions = []*TransactionInfo{reverted, spent, stable, failed}
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	assertOrder := func(order *models.RechargeOrder, status models.RechargeStatus) *models.RechargeOrder {
+		t.Helper()
+		current, err := rechargeService.GetRechargeOrder(ctx, order.OrderNo)
+		if err != nil {
+			t.Fatalf("获取充值订单失败: %v", err)
+		}
+		if current.Status != status {
+			t.Errorf("订单 %s 状态 = %s, 期望 %s", order.OrderNo, current.Status, status)
+		}
+		return current
+	}
+	assertBalance := func(userID int64, want string) {
+		t.Helper()
+		wallet, err := walletRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			if want == "0" {
+				return
+			}
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if normalizeAmount(wallet.Balance) != normalizeAmount(want) {
+			t.Errorf("用户 %d 余额 = %s, 期望 %s", userID, wallet.Balance, want)
+		}
+	}
+
+	// 执行失败的转账不入账，订单保持待支付
+	assertOrder(orders[3], models.RechargeStatusPending)
+	assertBalance(4, "0")
+	if got := assertOrder(orders[0], models.RechargeStatusConfirmed); got.Confirmations != 19 {
+		t.Errorf("入账确认数 = %d, 期望 19", got.Confirmations)
+	}
+
+	// 用户 2 入账后消费了 7，随后交易从链上消失，只能扣回剩余的 3
+	if _, err := ledgerService.Post(ctx, NewLedgerTransfer(2, models.LedgerEntryTypePayment,
+		models.LedgerAccountUserAvailable, models.LedgerAccountPlatformRevenue, "7", "order-2", "购买套餐")); err != nil {
+		t.Fatalf("扣款失败: %v", err)
+	}
+
+	reverted.Status = string(TransactionStatusFailed)
+	tron.transactions = []*TransactionInfo{reverted, stable, failed}
+	stable.Confirmations = 39
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	reversed := assertOrder(orders[0], models.RechargeStatusReversed)
+	if reversed.ReversedAt == nil {
+		t.Errorf("冲回订单缺少冲回时间: %+v", reversed)
+	}
+
+	// 查不到交易可能只是节点暂时不同步，连续多次查不到才冲回
+	assertOrder(orders[1], models.RechargeStatusConfirmed)
+	assertBalance(2, "3")
+	for i := 1; i < reverifyMissThreshold; i++ {
+		if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+			t.Fatalf("处理充值订单失败: %v", err)
+		}
+	}
+	assertOrder(orders[1], models.RechargeStatusReversed)
+	assertBalance(1, "0")
+	assertBalance(2, "0")
+	if verified := assertOrder(orders[2], models.RechargeStatusConfirmed); verified.VerifiedAt == nil {
+		t.Errorf("确认数达到复核窗口后应标记复核通过")
+	}
+	assertBalance(3, "10")
+
+	if len(notifier.alerts) != 2 {
+		t.Fatalf("告警 = %v, 期望两条冲回告警", notifier.alerts)
+	}
+	var partial string
+	for _, alert := range notifier.alerts {
+		if strings.Contains(alert, orders[1].OrderNo) {
+			partial = alert
+		}
+	}
+	if !strings.Contains(partial, "已扣回: 3.00000000") || !strings.Contains(partial, "未扣回: 7.00000000") {
+		t.Errorf("部分扣回告警 = %q", partial)
+	}
+
+	// 再次处理不会重复冲回
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	if len(notifier.alerts) != 2 {
+		t.Errorf("重复处理产生了新的告警: %v", notifier.alerts)
+	}
+
+	histories, err := repository.NewWalletHistoryRepository(db).GetByUserIDAndType(ctx, 2, models.WalletHistoryTypeChargeback, 0, 0)
+	if err != nil {
+		t.Fatalf("获取钱包流水失败: %v", err)
+	}
+	if len(histories) != 1 || normalizeAmount(histories[0].Amount) != normalizeAmount("-3") {
+		t.Errorf("冲回流水 = %+v, 期望一条 -3", histories)
+	}
+
+	// 全额扣回的用户对账平衡，未扣回的差额体现在对账结果中
+	reconciliation := NewReconciliationService(walletRepo, repository.NewWalletHistoryRepository(db), rechargeRepo,
+		repository.NewOrderRepository(db), repository.NewWithdrawalRepository(db), repository.NewLedgerRepository(db), ledgerService)
+	result, err := reconciliation.ReconcileUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("对账失败: %v", err)
+	}
+	if normalizeAmount(result.BalanceDiff) != normalizeAmount("0") {
+		t.Errorf("用户 1 对账结果不平: %+v", result)
+	}
+}
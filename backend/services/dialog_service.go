@@ -149,6 +149,9 @@ func (d *dialogService) handleHelpCommand(ctx context.Context, userID int64, use
 /start - 开始使用机器人
 /help - 显示帮助信息
 /menu - 显示主菜单
+/transfer - 向其他用户转账（/transfer @用户名 金额 [备注]）
+/invite - 邀请好友获得奖励
+/statement - 导出钱包对账单（/statement [pdf|csv] [开始日期] [结束日期]）
 
 <b>功能介绍：</b>
 • 💬 智能对话处理
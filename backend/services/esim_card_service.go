@@ -220,23 +220,15 @@ func (s *esimCardService) UpdateEsimCardUsage(ctx context.Context, esimID uint,
 		return errors.New("无效的使用情况数据格式")
 	}
 
-	// 3. 更新使用情况
-	if err := s.esimCardRepo.UpdateUsage(
-		ctx,
-		esimID,
-		usage.DataUsed,
-		usage.DataRemaining,
-		usage.UsagePercentage,
-	); err != nil {
-		return fmt.Errorf("更新使用情况失败: %w", err)
-	}
-
-	// 4. 更新状态
-	if err := s.esimCardRepo.UpdateStatus(ctx, esimID, models.EsimStatus(usage.Status)); err != nil {
-		return fmt.Errorf("更新状态失败: %w", err)
+	// 3. 更新使用情况和状态（与时间信息一起保存，避免整行保存时覆盖为旧值）
+	esimCard.DataUsed = usage.DataUsed
+	esimCard.DataRemaining = usage.DataRemaining
+	esimCard.UsagePercent = usage.UsagePercentage
+	if usage.Status != "" {
+		esimCard.Status = models.EsimStatus(usage.Status)
 	}
 
-	// 5. 更新时间信息
+	// 4. 更新时间信息
 	if usage.ActivationTime != "" {
 		if activatedAt, err := time.Parse(time.RFC3339, usage.ActivationTime); err == nil {
 			esimCard.ActivatedAt = &activatedAt
@@ -249,7 +241,7 @@ func (s *esimCardService) UpdateEsimCardUsage(ctx context.Context, esimID uint,
 		}
 	}
 
-	// 6. 保存更新
+	// 5. 保存更新
 	if err := s.esimCardRepo.Update(ctx, esimCard); err != nil {
 		return fmt.Errorf("保存更新失败: %w", err)
 	}
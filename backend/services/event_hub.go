@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 实时事件类型
+const (
+	EventRechargeConfirmed = "recharge.confirmed" // 充值到账
+	EventOrderCompleted    = "order.completed"    // eSIM 订单完成
+	EventOrderFailed       = "order.failed"       // eSIM 订单失败，冻结金额已退还
+)
+
+const (
+	// defaultEventBufferSize 每个用户保留的最近事件数，用于断线重连时补发
+	defaultEventBufferSize = 50
+	// defaultEventBufferTTL 事件保留时长，超过后不再补发
+	defaultEventBufferTTL = 10 * time.Minute
+	// eventSubscriberQueue 每个订阅者的待发送队列长度，写满时断开订阅，由客户端带 Last-Event-ID 重连补发
+	eventSubscriberQueue = 32
+)
+
+// ErrEventHubClosed 事件中心已关闭
+var ErrEventHubClosed = errors.New("event hub closed")
+
+// UserEvent 推送给单个用户的实时事件
+// ID 由启动纪元和递增序号组成，进程重启后旧 ID 不会与新事件混淆
+type UserEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int64           `json:"user_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	seq uint64
+}
+
+// EventPublisher 定义事件发布接口
+// 业务服务在状态变更提交后发布事件，发布失败不影响业务流程
+type EventPublisher interface {
+	// Publish 向用户发布事件，data 在发布时序列化为 JSON
+	Publish(userID int64, eventType string, data interface{})
+}
+
+// EventSubscription 用户事件订阅
+type EventSubscription struct {
+	// Replay 订阅时需要补发的事件（Last-Event-ID 之后的缓存事件），按发布顺序排列
+	Replay []*UserEvent
+	// Cursor 订阅时最新的事件 ID，客户端以它作为下次重连的 Last-Event-ID，不会遗漏订阅之后的事件
+	Cursor string
+	// Resync 为 true 表示 Last-Event-ID 之后的事件已无法完整补发（进程重启或已淘汰），客户端应重新拉取状态
+	Resync bool
+	// Events 新事件，订阅被取消、队列写满或事件中心关闭时关闭
+	Events <-chan *UserEvent
+
+	hub    *eventHub
+	userID int64
+	ch     chan *UserEvent
+	once   sync.Once
+}
+
+// Close 取消订阅
+func (s *EventSubscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// EventHub 定义进程内的用户事件中心
+// 按用户缓存最近的事件，订阅时根据 Last-Event-ID 补发，供 SSE 等长连接推送使用
+// 跨进程的事件（Bot 入账、其他副本的订单变更）写入 user_events 表，由 EventRelay 转发到各进程的事件中心
+type EventHub interface {
+	EventPublisher
+
+	// Subscribe 订阅用户事件，lastEventID 为客户端最后收到的事件 ID（可为空）
+	Subscribe(userID int64, lastEventID string) (*EventSubscription, error)
+
+	// Close 关闭事件中心并断开所有订阅
+	Close()
+}
+
+// userEventBuffer 单个用户的事件缓存
+type userEventBuffer struct {
+	events  []*UserEvent
+	evicted uint64 // 已淘汰的最大序号，Last-Event-ID 早于它时无法完整补发
+}
+
+// eventHub 事件中心实现
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	bufferSize  int
+	bufferTTL   time.Duration
+	buffers     map[int64]*userEventBuffer
+	dropped     uint64 // 已删除缓存的用户中被淘汰的最大序号
+	subscribers map[int64]map[*EventSubscription]struct{}
+	closed      bool
+}
+
+// NewEventHub 创建事件中心实例
+// bufferSize / bufferTTL 不大于 0 时使用默认值
+func NewEventHub(bufferSize int, bufferTTL time.Duration) EventHub {
+	if bufferSize <= 0 {
+		bufferSize = defaultEventBufferSize
+	}
+	if bufferTTL <= 0 {
+		bufferTTL = defaultEventBufferTTL
+	}
+	return &eventHub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		bufferSize:  bufferSize,
+		bufferTTL:   bufferTTL,
+		buffers:     make(map[int64]*userEventBuffer),
+		subscribers: make(map[int64]map[*EventSubscription]struct{}),
+	}
+}
+
+// Publish 发布事件
+func (h *eventHub) Publish(userID int64, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("序列化事件 %s 失败: %v\n", eventType, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	h.seq++
+	now := time.Now()
+	event := &UserEvent{
+		ID:        fmt.Sprintf("%s-%d", h.epoch, h.seq),
+		Type:      eventType,
+		UserID:    userID,
+		Data:      payload,
+		CreatedAt: now,
+		seq:       h.seq,
+	}
+
+	buffer := h.buffers[userID]
+	if buffer == nil {
+		buffer = &userEventBuffer{}
+		h.buffers[userID] = buffer
+	}
+	buffer.events = append(buffer.events, event)
+	if len(buffer.events) > h.bufferSize {
+		buffer.evicted = buffer.events[0].seq
+		buffer.events = buffer.events[1:]
+	}
+	// 定期清理所有用户的过期事件，避免长期不活跃的用户占用内存
+	if h.seq%uint64(h.bufferSize) == 0 {
+		h.pruneLocked(now)
+	}
+
+	for sub := range h.subscribers[userID] {
+		select {
+		case sub.ch <- event:
+		default:
+			// 客户端消费过慢，断开订阅，重连后从缓存补发
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe 订阅用户事件
+// 补发和注册在同一把锁内完成，补发与新事件之间不会遗漏或重复
+func (h *eventHub) Subscribe(userID int64, lastEventID string) (*EventSubscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrEventHubClosed
+	}
+
+	sub := &EventSubscription{
+		hub:    h,
+		userID: userID,
+		ch:     make(chan *UserEvent, eventSubscriberQueue),
+	}
+	sub.Events = sub.ch
+	sub.Cursor = fmt.Sprintf("%s-%d", h.epoch, h.seq)
+
+	if lastEventID != "" {
+		lastSeq, ok := h.parseEventID(lastEventID)
+		if !ok {
+			// 其他进程（或重启前）签发的 ID，无法判断遗漏了哪些事件
+			sub.Resync = true
+		} else {
+			h.pruneLocked(time.Now())
+			buffer := h.buffers[userID]
+			if buffer == nil {
+				// 缓存已整体删除时无法区分该用户是否有过事件，保守地要求重新拉取
+				sub.Resync = lastSeq < h.dropped
+			} else {
+				sub.Resync = lastSeq < buffer.evicted
+				for _, event := range buffer.events {
+					if event.seq > lastSeq {
+						sub.Replay = append(sub.Replay, event)
+					}
+				}
+			}
+		}
+	}
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*EventSubscription]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	return sub, nil
+}
+
+// Close 关闭事件中心
+func (h *eventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// unsubscribe 取消订阅
+func (h *eventHub) unsubscribe(sub *EventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+// removeLocked 移除订阅并关闭其事件通道，调用方需持有锁
+func (h *eventHub) removeLocked(sub *EventSubscription) {
+	if subs := h.subscribers[sub.userID]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subscribers, sub.userID)
+		}
+	}
+	sub.once.Do(func() { close(sub.ch) })
+}
+
+// pruneLocked 淘汰超过保留时长的事件，调用方需持有锁
+func (h *eventHub) pruneLocked(now time.Time) {
+	cutoff := now.Add(-h.bufferTTL)
+	for userID, buffer := range h.buffers {
+		expired := 0
+		for expired < len(buffer.events) && buffer.events[expired].CreatedAt.Before(cutoff) {
+			expired++
+		}
+		if expired == 0 {
+			continue
+		}
+		buffer.evicted = buffer.events[expired-1].seq
+		buffer.events = buffer.events[expired:]
+		// 没有缓存事件也没有订阅者的用户不再保留记录
+		if len(buffer.events) == 0 && h.subscribers[userID] == nil {
+			if buffer.evicted > h.dropped {
+				h.dropped = buffer.evicted
+			}
+			delete(h.buffers, userID)
+		}
+	}
+}
+
+// parseEventID 解析本进程签发的事件 ID，返回序号
+func (h *eventHub) parseEventID(id string) (uint64, bool) {
+	epoch, seqText, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || seq > h.seq {
+		return 0, false
+	}
+	return seq, true
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// drainEvents 读取通道中已有的事件，返回事件类型列表以及通道是否已关闭
+func drainEvents(sub *EventSubscription) ([]string, bool) {
+	var types []string
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return types, true
+			}
+			types = append(types, event.Type)
+		default:
+			return types, false
+		}
+	}
+}
+
+func TestEventHubReplayAndResync(t *testing.T) {
+	hub := NewEventHub(2, 0)
+	defer hub.Close()
+
+	live, err := hub.Subscribe(1, "")
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	hub.Publish(1, "a", map[string]string{"n": "1"})
+	hub.Publish(2, "other", nil)
+	hub.Publish(1, "b", nil)
+	hub.Publish(1, "c", nil)
+
+	if got, closed := drainEvents(live); closed || len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Fatalf("实时事件 = %v (closed=%v), 期望 [a b c]", got, closed)
+	}
+
+	current, err := hub.Subscribe(1, "")
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	current.Close()
+
+	// 用户 1 的缓存只保留最近 2 条：a 已淘汰
+	tests := []struct {
+		name       string
+		lastID     func() string
+		wantReplay []string
+		wantResync bool
+	}{
+		{name: "新连接不补发", lastID: func() string { return "" }},
+		{name: "游标之后没有新事件", lastID: func() string { return current.Cursor }},
+		{name: "收到 a 之后重连补发 b c", lastID: func() string { return hubEventID(t, hub, 1) }, wantReplay: []string{"b", "c"}},
+		{name: "a 之前的事件已淘汰", lastID: func() string { return hubEventID(t, hub, 0) }, wantReplay: []string{"b", "c"}, wantResync: true},
+		{name: "其他进程签发的 ID", lastID: func() string { return "zz-1" }, wantResync: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := hub.Subscribe(1, tt.lastID())
+			if err != nil {
+				t.Fatalf("订阅失败: %v", err)
+			}
+			defer sub.Close()
+
+			var replay []string
+			for _, event := range sub.Replay {
+				replay = append(replay, event.Type)
+			}
+			if len(replay) != len(tt.wantReplay) || sub.Resync != tt.wantResync {
+				t.Fatalf("补发 = %v, resync = %v, 期望 %v, %v", replay, sub.Resync, tt.wantReplay, tt.wantResync)
+			}
+			for i := range replay {
+				if replay[i] != tt.wantReplay[i] {
+					t.Fatalf("补发 = %v, 期望 %v", replay, tt.wantReplay)
+				}
+			}
+		})
+	}
+}
+
+// hubEventID 构造本事件中心第 seq 个事件的 ID
+func hubEventID(t *testing.T, hub EventHub, seq int) string {
+	t.Helper()
+	h := hub.(*eventHub)
+	return h.epoch + "-" + strconv.Itoa(seq)
+}
+
+func TestEventHubSlowSubscriberAndClose(t *testing.T) {
+	hub := NewEventHub(0, 0)
+
+	slow, err := hub.Subscribe(1, "")
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	for i := 0; i <= eventSubscriberQueue; i++ {
+		hub.Publish(1, "tick", i)
+	}
+	got, closed := drainEvents(slow)
+	if !closed || len(got) != eventSubscriberQueue {
+		t.Fatalf("消费过慢的订阅应在队列写满后断开: 收到 %d 条, closed=%v", len(got), closed)
+	}
+	slow.Close() // 重复关闭是安全的
+
+	// 断开后带最后收到的 ID 重连，补发剩余事件
+	resumed, err := hub.Subscribe(1, hubEventID(t, hub, eventSubscriberQueue))
+	if err != nil {
+		t.Fatalf("重连失败: %v", err)
+	}
+	if len(resumed.Replay) != 1 || resumed.Resync {
+		t.Fatalf("重连补发 %d 条, resync=%v, 期望 1 条", len(resumed.Replay), resumed.Resync)
+	}
+
+	hub.Close()
+	if _, closed := drainEvents(resumed); !closed {
+		t.Errorf("关闭事件中心后订阅应被断开")
+	}
+	if _, err := hub.Subscribe(1, ""); !errors.Is(err, ErrEventHubClosed) {
+		t.Errorf("关闭后订阅 = %v, 期望 %v", err, ErrEventHubClosed)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+const (
+	// eventRelayBatchSize 每次从事件表读取的事件数
+	eventRelayBatchSize = 100
+	// eventRelayGapWait 事件 ID 不连续时等待较小 ID 提交的时长，超过后视为该 ID 已回滚
+	eventRelayGapWait = 3 * time.Second
+	// userEventRetention 事件表保留时长，需大于事件中心的补发窗口
+	userEventRetention = time.Hour
+	// eventPublishTimeout 写入事件表的超时时间
+	eventPublishTimeout = 5 * time.Second
+)
+
+// dbEventPublisher 写入 user_events 表的事件发布者
+// Bot 与 Mini App 的各个副本都通过事件表发布，由每个 Mini App 进程的 EventRelay 投递给本进程的订阅者
+type dbEventPublisher struct {
+	repo repository.UserEventRepository
+}
+
+// NewDBEventPublisher 创建写入事件表的事件发布者
+func NewDBEventPublisher(repo repository.UserEventRepository) EventPublisher {
+	return &dbEventPublisher{repo: repo}
+}
+
+// Publish 发布事件，写入失败只记录日志
+func (p *dbEventPublisher) Publish(userID int64, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("序列化事件 %s 失败: %v\n", eventType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+	if err := p.repo.Create(ctx, &models.UserEventRecord{
+		UserID: userID,
+		Type:   eventType,
+		Data:   string(payload),
+	}); err != nil {
+		fmt.Printf("[ERROR] 写入事件 %s 失败: %v\n", eventType, err)
+	}
+}
+
+// EventRelay 把事件表中的新事件投递到进程内事件中心
+type EventRelay interface {
+	// Poll 读取上次位置之后的新事件并发布到事件中心，返回投递条数
+	Poll(ctx context.Context) (int, error)
+
+	// PurgeEvents 清理超过保留时长的事件，返回删除条数
+	PurgeEvents(ctx context.Context) (int64, error)
+}
+
+// eventRelay 事件表轮询投递实现
+type eventRelay struct {
+	repo   repository.UserEventRepository
+	hub    EventPublisher
+	lastID uint
+}
+
+// NewEventRelay 创建事件投递实例，从当前最新的事件之后开始投递（启动前的事件由客户端重新拉取状态）
+func NewEventRelay(ctx context.Context, repo repository.UserEventRepository, hub EventPublisher) (EventRelay, error) {
+	lastID, err := repo.LatestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取事件位置失败: %w", err)
+	}
+	return &eventRelay{repo: repo, hub: hub, lastID: lastID}, nil
+}
+
+// Poll 读取新事件并发布到事件中心
+// 自增 ID 按分配顺序而非提交顺序可见，遇到不连续的 ID 时先等待较小的 ID 提交，避免跳过晚提交的事件
+func (r *eventRelay) Poll(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		events, err := r.repo.ListAfter(ctx, r.lastID, eventRelayBatchSize)
+		if err != nil {
+			return delivered, fmt.Errorf("读取事件失败: %w", err)
+		}
+
+		for _, event := range events {
+			if event.ID != r.lastID+1 && time.Since(event.CreatedAt) < eventRelayGapWait {
+				return delivered, nil
+			}
+			r.hub.Publish(event.UserID, event.Type, json.RawMessage(event.Data))
+			r.lastID = event.ID
+			delivered++
+		}
+		if len(events) < eventRelayBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// PurgeEvents 清理超过保留时长的事件
+func (r *eventRelay) PurgeEvents(ctx context.Context) (int64, error) {
+	return r.repo.DeleteBefore(ctx, time.Now().Add(-userEventRetention))
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"tg-robot-sim/storage/repository"
+)
+
+// TestEventRelayDeliversPublishedEvents 通过事件表发布的事件由 EventRelay 转发到事件中心，启动前的事件不重复投递
+func TestEventRelayDeliversPublishedEvents(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	repo := repository.NewUserEventRepository(db)
+	publisher := NewDBEventPublisher(repo)
+
+	publisher.Publish(1, EventOrderCompleted, map[string]string{"order_no": "old"})
+
+	hub := NewEventHub(0, 0)
+	defer hub.Close()
+	relay, err := NewEventRelay(ctx, repo, hub)
+	if err != nil {
+		t.Fatalf("创建事件投递失败: %v", err)
+	}
+	sub, err := hub.Subscribe(1, "")
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	defer sub.Close()
+
+	publisher.Publish(1, EventRechargeConfirmed, map[string]string{"payment_no": "P-1"})
+	publisher.Publish(2, EventOrderFailed, nil)
+
+	delivered, err := relay.Poll(ctx)
+	if err != nil {
+		t.Fatalf("投递事件失败: %v", err)
+	}
+	if delivered != 2 {
+		t.Fatalf("投递条数 = %d, 期望 2", delivered)
+	}
+
+	select {
+	case event := <-sub.Events:
+		var data map[string]string
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatalf("解析事件数据失败: %v", err)
+		}
+		if event.Type != EventRechargeConfirmed || data["payment_no"] != "P-1" {
+			t.Fatalf("收到事件 %s %v, 期望 recharge.confirmed P-1", event.Type, data)
+		}
+	default:
+		t.Fatal("订阅者没有收到事件")
+	}
+	if got, _ := drainEvents(sub); len(got) != 0 {
+		t.Fatalf("多余的事件 %v", got)
+	}
+
+	if delivered, err := relay.Poll(ctx); err != nil || delivered != 0 {
+		t.Fatalf("再次投递 = %d (%v), 期望 0", delivered, err)
+	}
+}
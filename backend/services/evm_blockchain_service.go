@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/evm"
+	"tg-robot-sim/storage/models"
+)
+
+// evmAddressPattern EVM 地址格式：0x 开头的 40 位十六进制
+var evmAddressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// evmBlockchainService EVM 链（BSC / Ethereum）区块链服务实现
+// 只识别资产表中登记在该链上的 ERC20 代币转账，地址统一以小写返回
+type evmBlockchainService struct {
+	client       *evm.Client
+	config       *config.EVMConfig
+	tokens       map[string]*models.Asset // 小写合约地址 -> 资产
+	logger       Logger
+	watchedAddrs map[string]bool
+	addrMutex    sync.RWMutex
+}
+
+// NewEVMBlockchainService 创建 EVM 链区块链服务
+// tokens 为资产表中的资产，只保留该链上的代币
+func NewEVMBlockchainService(
+	client *evm.Client,
+	cfg *config.EVMConfig,
+	tokens []*models.Asset,
+	logger Logger,
+) BlockchainService {
+	tokenMap := make(map[string]*models.Asset)
+	for _, token := range tokens {
+		if token.Chain == cfg.Chain && !token.IsNative() {
+			tokenMap[strings.ToLower(token.ContractAddress)] = token
+		}
+	}
+
+	return &evmBlockchainService{
+		client:       client,
+		config:       cfg,
+		tokens:       tokenMap,
+		logger:       logger,
+		watchedAddrs: make(map[string]bool),
+	}
+}
+
+// Chain 返回所属链标识
+func (e *evmBlockchainService) Chain() string {
+	return e.config.Chain
+}
+
+// ValidateTransaction 验证交易：读取交易回执中已登记代币的 Transfer 事件
+func (e *evmBlockchainService) ValidateTransaction(txHash string) (*TransactionInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return e.GetTransactionByHash(ctx, txHash)
+}
+
+// GetTransactionStatus 获取交易状态
+func (e *evmBlockchainService) GetTransactionStatus(txHash string) (TransactionStatus, error) {
+	txInfo, err := e.ValidateTransaction(txHash)
+	if err != nil {
+		return TransactionStatusFailed, fmt.Errorf("failed to validate transaction: %w", err)
+	}
+	return TransactionStatus(txInfo.Status), nil
+}
+
+// MonitorAddress 监控指定地址的交易
+func (e *evmBlockchainService) MonitorAddress(address string) error {
+	if !evmAddressPattern.MatchString(address) {
+		return fmt.Errorf("invalid EVM address: %s", address)
+	}
+
+	e.addrMutex.Lock()
+	e.watchedAddrs[strings.ToLower(address)] = true
+	e.addrMutex.Unlock()
+
+	e.logger.Info("Added %s address to monitoring: %s", e.config.Chain, address)
+	return nil
+}
+
+// GetAddressTransactions 获取地址最近的代币转账记录（转入和转出）
+func (e *evmBlockchainService) GetAddressTransactions(address string, limit int) ([]*TransactionInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	latest, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	incoming, err := e.getTransferLogs(ctx, latest, nil, []string{evm.AddressTopic(address)})
+	if err != nil {
+		return nil, err
+	}
+	outgoing, err := e.getTransferLogs(ctx, latest, []string{evm.AddressTopic(address)}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := append(incoming, outgoing...)
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].BlockNumber > transactions[j].BlockNumber
+	})
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// IsTransactionConfirmed 检查交易是否已确认
+func (e *evmBlockchainService) IsTransactionConfirmed(txHash string, requiredConfirmations int) (bool, error) {
+	txInfo, err := e.ValidateTransaction(txHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate transaction: %w", err)
+	}
+	return txInfo.Status == string(TransactionStatusConfirmed) && txInfo.Confirmations >= requiredConfirmations, nil
+}
+
+// GetAddressIncomingTransactions 获取地址在回溯区块范围内收到的代币转账
+func (e *evmBlockchainService) GetAddressIncomingTransactions(ctx context.Context, address string, minAmount string) ([]*TransactionInfo, error) {
+	latest, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取最新区块失败: %w", err)
+	}
+
+	transactions, err := e.getTransferLogs(ctx, latest, nil, []string{evm.AddressTopic(address)})
+	if err != nil {
+		return nil, fmt.Errorf("获取地址交易失败: %w", err)
+	}
+	return transactions, nil
+}
+
+// GetTransactionByHash 根据哈希获取交易详情
+func (e *evmBlockchainService) GetTransactionByHash(ctx context.Context, txHash string) (*TransactionInfo, error) {
+	receipt, err := e.client.GetTransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, txHash)
+	}
+
+	latest, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	blockNumber, err := evm.ParseHexInt(receipt.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number: %w", err)
+	}
+
+	status := string(TransactionStatusConfirmed)
+	if receipt.Status != "0x1" {
+		status = string(TransactionStatusFailed)
+	}
+
+	txInfo := &TransactionInfo{
+		TxHash:        receipt.TransactionHash,
+		FromAddress:   strings.ToLower(receipt.From),
+		ToAddress:     strings.ToLower(receipt.To),
+		Amount:        "0",
+		Confirmations: confirmationsSince(latest, blockNumber),
+		BlockNumber:   blockNumber,
+		Status:        status,
+	}
+
+	// 取第一笔已登记代币的 Transfer 事件作为交易金额和收款方
+	for _, log := range receipt.Logs {
+		if transfer, ok := e.parseTransferLog(log, latest); ok {
+			transfer.Status = status
+			txInfo = transfer
+			break
+		}
+	}
+
+	if block, err := e.client.GetBlockByNumber(ctx, blockNumber); err == nil {
+		if timestamp, err := evm.ParseHexInt(block.Timestamp); err == nil {
+			txInfo.Timestamp = time.Unix(timestamp, 0)
+		}
+	}
+
+	return txInfo, nil
+}
+
+// ScanIncomingTransfers 从游标区块之后扫描地址收到的指定代币转账
+// 只扫描到已达到入账确认数的区块，单次最多扫描 LogLookbackBlocks 个区块
+func (e *evmBlockchainService) ScanIncomingTransfers(ctx context.Context, address string, asset *models.Asset, cursor ScanCursor) (*ScanResult, error) {
+	contract := strings.ToLower(asset.ContractAddress)
+	if _, ok := e.tokens[contract]; !ok || asset.Chain != e.config.Chain {
+		return nil, fmt.Errorf("%w: %s 不是 %s 链上已登记的代币", ErrAssetNotSupported, asset.Code, e.config.Chain)
+	}
+
+	latest, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取最新区块失败: %w", err)
+	}
+
+	// 已达到确认数的最高区块
+	confirmedHead := latest - int64(e.config.RequiredConfirmations) + 1
+	fromBlock := cursor.Block + 1
+	if cursor.Block <= 0 {
+		fromBlock = confirmedHead - e.config.LogLookbackBlocks + 1
+	}
+	if fromBlock < 0 {
+		fromBlock = 0
+	}
+	toBlock := confirmedHead
+	if toBlock > fromBlock+e.config.LogLookbackBlocks-1 {
+		toBlock = fromBlock + e.config.LogLookbackBlocks - 1
+	}
+	if toBlock < fromBlock {
+		return &ScanResult{Next: cursor}, nil
+	}
+
+	transfers, err := e.queryTransferLogs(ctx, []string{contract}, fromBlock, toBlock, latest, nil, []string{evm.AddressTopic(address)})
+	if err != nil {
+		return nil, fmt.Errorf("获取地址交易失败: %w", err)
+	}
+	return &ScanResult{Transfers: transfers, Next: ScanCursor{Block: toBlock}}, nil
+}
+
+// MatchTransactionAmount 按数值比较交易金额（链上金额精度可能高于订单金额）
+func (e *evmBlockchainService) MatchTransactionAmount(txAmount string, targetAmount string) bool {
+	txValue, err := parseDecimal(txAmount)
+	if err != nil {
+		return false
+	}
+	targetValue, err := parseDecimal(targetAmount)
+	if err != nil {
+		return false
+	}
+	return txValue.Cmp(targetValue) == 0
+}
+
+// ValidateAddress 校验 EVM 地址格式
+func (e *evmBlockchainService) ValidateAddress(ctx context.Context, address string) (bool, error) {
+	return evmAddressPattern.MatchString(address), nil
+}
+
+// getTransferLogs 查询回溯区块范围内已登记代币的 Transfer 事件
+// fromTopics / toTopics 为 nil 时不限制转出 / 转入地址
+func (e *evmBlockchainService) getTransferLogs(ctx context.Context, latest int64, fromTopics, toTopics []string) ([]*TransactionInfo, error) {
+	if len(e.tokens) == 0 {
+		return nil, nil
+	}
+
+	contracts := make([]string, 0, len(e.tokens))
+	for contract := range e.tokens {
+		contracts = append(contracts, contract)
+	}
+
+	fromBlock := latest - e.config.LogLookbackBlocks + 1
+	if fromBlock < 0 {
+		fromBlock = 0
+	}
+	return e.queryTransferLogs(ctx, contracts, fromBlock, latest, latest, fromTopics, toTopics)
+}
+
+// queryTransferLogs 查询指定合约在区块范围内的 Transfer 事件，latest 用于计算确认数
+func (e *evmBlockchainService) queryTransferLogs(ctx context.Context, contracts []string, fromBlock, toBlock, latest int64, fromTopics, toTopics []string) ([]*TransactionInfo, error) {
+	logs, err := e.client.GetLogs(ctx, evm.FilterQuery{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Addresses: contracts,
+		Topics:    [][]string{{evm.TransferEventTopic}, fromTopics, toTopics},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer logs: %w", err)
+	}
+
+	var transactions []*TransactionInfo
+	blockTimes := make(map[int64]time.Time)
+	for _, log := range logs {
+		txInfo, ok := e.parseTransferLog(log, latest)
+		if !ok {
+			continue
+		}
+
+		// 日志通过 eth_getLogs 返回即已打包成功，区块时间按区块缓存
+		txInfo.Status = string(TransactionStatusConfirmed)
+		if log.BlockTimestamp != "" {
+			if timestamp, err := evm.ParseHexInt(log.BlockTimestamp); err == nil {
+				txInfo.Timestamp = time.Unix(timestamp, 0)
+			}
+		} else if blockTime, ok := blockTimes[txInfo.BlockNumber]; ok {
+			txInfo.Timestamp = blockTime
+		} else if block, err := e.client.GetBlockByNumber(ctx, txInfo.BlockNumber); err == nil {
+			if timestamp, err := evm.ParseHexInt(block.Timestamp); err == nil {
+				txInfo.Timestamp = time.Unix(timestamp, 0)
+				blockTimes[txInfo.BlockNumber] = txInfo.Timestamp
+			}
+		}
+
+		transactions = append(transactions, txInfo)
+	}
+
+	return transactions, nil
+}
+
+// parseTransferLog 解析已登记代币的 Transfer 事件，非 Transfer 事件或未登记代币返回 false
+func (e *evmBlockchainService) parseTransferLog(log evm.Log, latest int64) (*TransactionInfo, bool) {
+	if log.Removed || len(log.Topics) != 3 || !strings.EqualFold(log.Topics[0], evm.TransferEventTopic) {
+		return nil, false
+	}
+
+	token, ok := e.tokens[strings.ToLower(log.Address)]
+	if !ok {
+		return nil, false
+	}
+
+	value, err := evm.ParseHexBig(log.Data)
+	if err != nil {
+		return nil, false
+	}
+	blockNumber, err := evm.ParseHexInt(log.BlockNumber)
+	if err != nil {
+		return nil, false
+	}
+
+	return &TransactionInfo{
+		TxHash:        log.TransactionHash,
+		FromAddress:   evm.TopicAddress(log.Topics[1]),
+		ToAddress:     evm.TopicAddress(log.Topics[2]),
+		Amount:        evm.FormatUnits(value, token.Decimals),
+		TokenSymbol:   token.Symbol,
+		TokenContract: strings.ToLower(token.ContractAddress),
+		Confirmations: confirmationsSince(latest, blockNumber),
+		BlockNumber:   blockNumber,
+	}, true
+}
+
+// confirmationsSince 计算区块确认数（所在区块本身算一次确认）
+func confirmationsSince(latest, blockNumber int64) int {
+	if blockNumber <= 0 || latest < blockNumber {
+		return 0
+	}
+	return int(latest-blockNumber) + 1
+}
@@ -2,10 +2,14 @@ package services
 
 import (
 	"context"
+	"errors"
 	"tg-robot-sim/storage/models"
 	"time"
 )
 
+// ErrTransactionNotFound 链上查不到该交易（尚未固化、已被回滚或哈希不存在）
+var ErrTransactionNotFound = errors.New("transaction not found")
+
 // DialogResponse 对话响应结构
 type DialogResponse struct {
 	Message    string                 `json:"message"`
@@ -37,12 +41,27 @@ type TransactionInfo struct {
 	FromAddress   string    `json:"from_address"`
 	ToAddress     string    `json:"to_address"`
 	Amount        string    `json:"amount"`
+	TokenSymbol   string    `json:"token_symbol"`   // 代币符号（原生币转账为空或链原生币符号）
+	TokenContract string    `json:"token_contract"` // 代币合约地址（原生币转账为空）
 	Confirmations int       `json:"confirmations"`
 	BlockNumber   int64     `json:"block_number"`
 	Timestamp     time.Time `json:"timestamp"`
 	Status        string    `json:"status"`
 }
 
+// ScanCursor 入账扫描游标，由各链的区块链服务解释
+type ScanCursor struct {
+	Block       int64  // 已扫描到的区块高度（EVM），0 表示从回溯范围开始
+	Timestamp   int64  // 扫描起始区块时间，毫秒（TRON），0 表示从回溯范围开始
+	Fingerprint string // 上次未翻完时的翻页标记（TRON）
+}
+
+// ScanResult 一次入账扫描的结果
+type ScanResult struct {
+	Transfers []*TransactionInfo // 本次扫描到的入账转账（可能与上次扫描重复，由调用方按交易哈希去重）
+	Next      ScanCursor         // 下次扫描使用的游标
+}
+
 // TransactionStatus 交易状态枚举
 type TransactionStatus string
 
@@ -91,8 +110,10 @@ type MenuService interface {
 }
 
 // BlockchainService 定义区块链服务接口
-// 负责监控和验证区块链交易
+// 负责监控和验证区块链交易，每个实现对应一条链（TRON、EVM 链等）
 type BlockchainService interface {
+	// Chain 返回所属链标识（与资产表的 chain 一致）
+	Chain() string
 
 	// ValidateTransaction 验证交易
 	ValidateTransaction(txHash string) (*TransactionInfo, error)
@@ -112,11 +133,17 @@ type BlockchainService interface {
 	// GetAddressIncomingTransactions 获取地址的入账交易
 	GetAddressIncomingTransactions(ctx context.Context, address string, minAmount string) ([]*TransactionInfo, error)
 
-	// GetTransactionByHash 根据哈希获取交易详情
+	// GetTransactionByHash 根据哈希获取交易详情，交易不存在时返回 ErrTransactionNotFound
 	GetTransactionByHash(ctx context.Context, txHash string) (*TransactionInfo, error)
 
+	// ScanIncomingTransfers 从游标位置开始扫描地址收到的指定资产转账，只返回已达到入账确认数的转账
+	ScanIncomingTransfers(ctx context.Context, address string, asset *models.Asset, cursor ScanCursor) (*ScanResult, error)
+
 	// MatchTransactionAmount 匹配交易金额
 	MatchTransactionAmount(txAmount string, targetAmount string) bool
+
+	// ValidateAddress 校验该链的地址格式（TRON 离线校验 base58check 校验和）
+	ValidateAddress(ctx context.Context, address string) (bool, error)
 }
 
 // NotificationService 定义通知服务接口
@@ -136,13 +163,22 @@ type NotificationService interface {
 
 	// SendRechargeSuccessNotification 发送充值成功通知
 	SendRechargeSuccessNotification(ctx context.Context, userID int64, amount string, orderNo string) error
+
+	// SendTransferNotification 发送转账通知，incoming 为 true 时通知收款方，否则通知付款方
+	SendTransferNotification(ctx context.Context, userID int64, transfer *TransferResult, incoming bool) error
+
+	// SendAdminAlert 向配置的全部管理员发送运营告警，未配置管理员时只记录日志
+	SendAdminAlert(ctx context.Context, message string) error
 }
 
 // RechargeService 定义充值服务接口
 // 负责处理用户充值相关业务逻辑
 type RechargeService interface {
-	// CreateRechargeOrder 创建充值订单
-	CreateRechargeOrder(ctx context.Context, userID int64, amount string) (*models.RechargeOrder, error)
+	// ListRechargeAssets 列出可用于充值的资产
+	ListRechargeAssets(ctx context.Context) ([]*models.Asset, error)
+
+	// CreateRechargeOrder 创建充值订单，amount 为计价币种金额，asset 为支付资产代码（为空时使用 USDT-TRC20）
+	CreateRechargeOrder(ctx context.Context, userID int64, amount string, asset string) (*models.RechargeOrder, error)
 
 	// GetRechargeOrder 获取充值订单详情
 	GetRechargeOrder(ctx context.Context, orderNo string) (*models.RechargeOrder, error)
@@ -150,6 +186,9 @@ type RechargeService interface {
 	// GetUserRechargeHistory 获取用户充值历史
 	GetUserRechargeHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.RechargeOrder, int64, error)
 
+	// GetPaymentURI 获取订单的收款内容（用于生成二维码）：TRON 资产为带收款地址和精确金额的支付 URI，其他链为收款地址
+	GetPaymentURI(ctx context.Context, order *models.RechargeOrder) (string, error)
+
 	// CheckRechargeStatus 手动检查充值状态
 	CheckRechargeStatus(ctx context.Context, orderNo string) (*models.RechargeOrder, error)
 
@@ -162,8 +201,49 @@ type RechargeService interface {
 	// ExpireOldOrders 将过期订单标记为已过期
 	ExpireOldOrders(ctx context.Context) error
 
-	// GenerateExactAmount 生成唯一的精确金额
-	GenerateExactAmount(ctx context.Context, baseAmount string) (string, error)
+	// GenerateExactAmount 为指定资产生成唯一的精确金额
+	GenerateExactAmount(ctx context.Context, asset string, baseAmount string) (string, error)
+}
+
+// GatewayInvoice 支付渠道发票
+type GatewayInvoice struct {
+	Payment     *models.GatewayPayment `json:"payment"`
+	InvoiceLink string                 `json:"invoice_link"` // 发票链接（Mini App 中通过 openInvoice 打开）
+}
+
+// GatewayCheckout 支付渠道回调的支付信息
+// 预结账时 ChargeID 为空，支付成功时为渠道支付ID
+type GatewayCheckout struct {
+	UserID      int64  `json:"user_id"`
+	Payload     string `json:"payload"`      // 发票载荷（支付单号）
+	Currency    string `json:"currency"`     // 币种
+	TotalAmount int64  `json:"total_amount"` // 渠道币种的最小单位数量
+	ChargeID    string `json:"charge_id"`    // 渠道支付ID
+}
+
+// PaymentGateway 定义支付渠道接口
+// 与链上充值（RechargeService）并列，用户通过第三方支付渠道付款后按渠道汇率入账到钱包
+type PaymentGateway interface {
+	// Name 支付渠道标识
+	Name() string
+
+	// CreateInvoiceLink 创建充值发票并返回发票链接，amount 为计价币种金额
+	CreateInvoiceLink(ctx context.Context, userID int64, amount string) (*GatewayInvoice, error)
+
+	// SendInvoice 创建充值发票并直接发送到聊天
+	SendInvoice(ctx context.Context, chatID int64, userID int64, amount string) (*models.GatewayPayment, error)
+
+	// ValidateCheckout 预结账校验：发票存在、待支付、未过期，且用户、币种和数量与发票一致
+	ValidateCheckout(ctx context.Context, checkout *GatewayCheckout) error
+
+	// CompletePayment 支付成功后入账，以渠道支付ID幂等，重复回调返回首次入账的记录
+	CompletePayment(ctx context.Context, checkout *GatewayCheckout) (*models.GatewayPayment, error)
+
+	// Refund 退款并从钱包扣回入账金额，用户余额不足时拒绝退款
+	Refund(ctx context.Context, paymentNo, operator, reason string) (*models.GatewayPayment, error)
+
+	// GetPayment 获取支付记录
+	GetPayment(ctx context.Context, paymentNo string) (*models.GatewayPayment, error)
 }
 
 // WalletHistoryFilters 钱包历史筛选条件
@@ -180,8 +260,8 @@ type WalletHistoryFilters struct {
 // WalletHistoryStats 钱包历史统计
 type WalletHistoryStats struct {
 	TotalRecords    int64  `json:"total_records"`
-	TotalIncome     string `json:"total_income"`     // 总收入（充值+退款）
-	TotalExpense    string `json:"total_expense"`    // 总支出（支付）
+	TotalIncome     string `json:"total_income"`     // 总收入（充值+退款+转入）
+	TotalExpense    string `json:"total_expense"`    // 总支出（支付+转出）
 	PendingAmount   string `json:"pending_amount"`   // 处理中金额
 	CompletedAmount string `json:"completed_amount"` // 已完成金额
 }
@@ -195,6 +275,9 @@ type WalletHistoryService interface {
 	// GetWalletHistoryStats 获取钱包历史统计
 	GetWalletHistoryStats(ctx context.Context, userID int64) (*WalletHistoryStats, error)
 
+	// GetWalletStatement 生成 from 至 to（均含当天）的钱包对账单
+	GetWalletStatement(ctx context.Context, userID int64, from, to time.Time) (*WalletStatement, error)
+
 	// GetHistoryRecord 获取单条历史记录详情
 	GetHistoryRecord(ctx context.Context, recordID uint, userID int64) (*models.WalletHistory, error)
 
@@ -219,6 +302,18 @@ type CreateEsimOrderRequest struct {
 	TotalAmount   string `json:"total_amount" validate:"required"`
 	CustomerEmail string `json:"customer_email" validate:"required,email"`
 	Remark        string `json:"remark,omitempty"`
+	CouponCode    string `json:"coupon_code,omitempty"` // 优惠码（可选），TotalAmount 需为优惠后金额
+}
+
+// EsimOrderQuote eSIM 订单报价（含优惠计算）
+type EsimOrderQuote struct {
+	ProductID      int    `json:"product_id"`
+	Quantity       int    `json:"quantity"`
+	UnitPrice      string `json:"unit_price"`
+	Subtotal       string `json:"subtotal"`        // 优惠前金额
+	DiscountAmount string `json:"discount_amount"` // 优惠金额
+	TotalAmount    string `json:"total_amount"`    // 实付金额，下单时作为 CreateEsimOrderRequest.TotalAmount 提交
+	CouponCode     string `json:"coupon_code,omitempty"`
 }
 
 // EsimOrderResponse eSIM 订单响应
@@ -228,6 +323,9 @@ type EsimOrderResponse struct {
 	Status      models.OrderStatus `json:"status"`
 	TotalAmount string             `json:"total_amount"`
 	CreatedAt   time.Time          `json:"created_at"`
+
+	CouponCode     string `json:"coupon_code,omitempty"`
+	DiscountAmount string `json:"discount_amount"`
 }
 
 // OrderWithDetail 包含详情的订单信息
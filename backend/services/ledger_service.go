@@ -0,0 +1,472 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"tg-robot-sim/pkg/retry"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInsufficientBalance 可用余额不足
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrInsufficientFrozenBalance 冻结余额不足
+	ErrInsufficientFrozenBalance = errors.New("insufficient frozen balance")
+	// ErrUnbalancedEntry 分录借贷不平
+	ErrUnbalancedEntry = errors.New("ledger entry is not balanced")
+	// ErrOperationConflict 幂等键已被参数不同的操作使用
+	ErrOperationConflict = errors.New("wallet operation already applied with different parameters")
+)
+
+// LedgerPostingLine 记账明细
+type LedgerPostingLine struct {
+	Account models.LedgerAccountType
+	Side    models.LedgerSide
+	Amount  string
+}
+
+// LedgerPosting 记账请求
+type LedgerPosting struct {
+	UserID      int64
+	EntryType   models.LedgerEntryType
+	RelatedID   string
+	Description string
+	Lines       []LedgerPostingLine
+
+	// Idempotent 为 true 时以 (EntryType, RelatedID) 作为幂等键，重复记账直接返回首次结果
+	Idempotent bool
+}
+
+// NewLedgerTransfer 构造两行分录：借 debit，贷 credit
+func NewLedgerTransfer(userID int64, entryType models.LedgerEntryType, debit, credit models.LedgerAccountType, amount, relatedID, description string) *LedgerPosting {
+	return &LedgerPosting{
+		UserID:      userID,
+		EntryType:   entryType,
+		RelatedID:   relatedID,
+		Description: description,
+		Lines: []LedgerPostingLine{
+			{Account: debit, Side: models.LedgerSideDebit, Amount: amount},
+			{Account: credit, Side: models.LedgerSideCredit, Amount: amount},
+		},
+	}
+}
+
+// LedgerResult 记账结果
+type LedgerResult struct {
+	Entry        *models.LedgerEntry
+	WalletBefore models.Wallet
+	WalletAfter  *models.Wallet
+
+	// Replayed 表示该操作此前已执行，本次未重复记账
+	Replayed bool
+}
+
+// LedgerService 复式记账服务接口
+// 钱包余额是账本科目余额的缓存，所有余额变动都必须通过分录完成
+type LedgerService interface {
+	// Post 在新事务中记账并刷新钱包缓存余额
+	Post(ctx context.Context, posting *LedgerPosting) (*LedgerResult, error)
+
+	// PostInTx 在调用方事务中记账并刷新钱包缓存余额
+	PostInTx(ctx context.Context, tx *gorm.DB, posting *LedgerPosting) (*LedgerResult, error)
+
+	// Transaction 在新事务中执行 fn，并发冲突时整体重试，用于需要多笔记账的原子操作
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+
+	// GetUserAccounts 获取用户科目
+	GetUserAccounts(ctx context.Context, userID int64) ([]*models.LedgerAccount, error)
+
+	// GetEntriesByRelatedID 根据关联ID获取分录
+	GetEntriesByRelatedID(ctx context.Context, relatedID string) ([]*models.LedgerEntry, error)
+
+	// HasOperation 判断幂等操作 (entryType, relatedID) 是否已经记账
+	HasOperation(ctx context.Context, entryType models.LedgerEntryType, relatedID string) (bool, error)
+}
+
+// ledgerService 复式记账服务实现
+type ledgerService struct {
+	db         *gorm.DB
+	ledgerRepo repository.LedgerRepository
+	walletRepo repository.WalletRepository
+}
+
+// NewLedgerService 创建复式记账服务实例
+func NewLedgerService(
+	db *gorm.DB,
+	ledgerRepo repository.LedgerRepository,
+	walletRepo repository.WalletRepository,
+) LedgerService {
+	return &ledgerService{
+		db:         db,
+		ledgerRepo: ledgerRepo,
+		walletRepo: walletRepo,
+	}
+}
+
+// Post 在新事务中记账并刷新钱包缓存余额，并发冲突时整体重试
+func (s *ledgerService) Post(ctx context.Context, posting *LedgerPosting) (*LedgerResult, error) {
+	var result *LedgerResult
+	err := s.Transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		result, err = s.PostInTx(ctx, tx, posting)
+		return err
+	})
+	if err != nil {
+		// 并发的重复调用（其他协程或其他进程）先提交，唯一索引冲突后返回首次结果
+		// 其他唯一索引冲突没有对应的幂等记录，返回原始错误
+		if posting.Idempotent && repository.IsDuplicateKeyError(err) {
+			result, replayErr := s.replayOperation(ctx, s.ledgerRepo, posting)
+			if replayErr == nil {
+				return result, nil
+			}
+			if !errors.Is(replayErr, gorm.ErrRecordNotFound) {
+				return nil, replayErr
+			}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Transaction 在新事务中执行 fn，乐观锁冲突、数据库锁定或死锁时整体重试
+// fn 可能被执行多次，不应在其中产生事务外的副作用
+func (s *ledgerService) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(fn)
+	})
+}
+
+// PostInTx 在调用方事务中记账并刷新钱包缓存余额
+// 钱包和科目均以版本号 CAS 更新，冲突时返回 repository.ErrVersionConflict，由调用方用 RetryOnConflict 重试整个事务
+func (s *ledgerService) PostInTx(ctx context.Context, tx *gorm.DB, posting *LedgerPosting) (*LedgerResult, error) {
+	lines, total, err := normalizePostingLines(posting.Lines)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerRepo := s.ledgerRepo.WithTx(tx)
+	walletRepo := s.walletRepo.WithTx(tx)
+
+	if posting.Idempotent && posting.RelatedID == "" {
+		return nil, errors.New("idempotent wallet operation requires relatedID")
+	}
+
+	// 先锁钱包，保证同一用户的记账串行执行（幂等检查也在锁内，重复调用会看到首次的提交）
+	wallet, err := walletRepo.GetOrCreateForUpdate(ctx, posting.UserID)
+	if err != nil {
+		return nil, err
+	}
+	before := *wallet
+
+	if posting.Idempotent {
+		result, err := s.replayOperation(ctx, ledgerRepo, posting)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	accounts := make(map[models.LedgerAccountType]*models.LedgerAccount)
+	if err := s.ensureUserAccounts(ctx, ledgerRepo, wallet, accounts); err != nil {
+		return nil, err
+	}
+
+	entry, err := s.applyEntry(ctx, ledgerRepo, accounts, posting.UserID, posting.EntryType, posting.RelatedID, posting.Description, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	// 用户资金净变动：贷记用户科目为增加，借记为减少
+	net := new(big.Float)
+	for _, line := range lines {
+		if !line.Account.IsUserAccount() {
+			continue
+		}
+		amount, _ := parseDecimal(line.Amount)
+		if line.Side == models.LedgerSideCredit {
+			net.Add(net, amount)
+		} else {
+			net.Sub(net, amount)
+		}
+	}
+
+	// 从账本刷新钱包缓存
+	wallet.Balance = accounts[models.LedgerAccountUserAvailable].Balance
+	wallet.FrozenBalance = accounts[models.LedgerAccountUserFrozen].Balance
+	switch net.Sign() {
+	case 1:
+		totalIncome, _ := parseDecimal(wallet.TotalIncome)
+		wallet.TotalIncome = new(big.Float).Add(totalIncome, net).Text('f', 8)
+	case -1:
+		totalExpense, _ := parseDecimal(wallet.TotalExpense)
+		wallet.TotalExpense = new(big.Float).Sub(totalExpense, net).Text('f', 8)
+	}
+
+	if err := walletRepo.Update(ctx, wallet); err != nil {
+		return nil, fmt.Errorf("更新钱包缓存余额失败: %w", err)
+	}
+
+	// 记录幂等键，唯一索引保证并发重复调用只有一个能提交
+	if posting.Idempotent {
+		operation := &models.WalletOperation{
+			OperationType: posting.EntryType,
+			RelatedID:     posting.RelatedID,
+			UserID:        posting.UserID,
+			Amount:        total,
+			EntryID:       entry.ID,
+			BalanceBefore: before.Balance,
+			BalanceAfter:  wallet.Balance,
+			FrozenBefore:  before.FrozenBalance,
+			FrozenAfter:   wallet.FrozenBalance,
+		}
+		if err := ledgerRepo.CreateOperation(ctx, operation); err != nil {
+			return nil, fmt.Errorf("记录钱包操作失败: %w", err)
+		}
+	}
+
+	return &LedgerResult{
+		Entry:        entry,
+		WalletBefore: before,
+		WalletAfter:  wallet,
+	}, nil
+}
+
+// GetUserAccounts 获取用户科目
+func (s *ledgerService) GetUserAccounts(ctx context.Context, userID int64) ([]*models.LedgerAccount, error) {
+	return s.ledgerRepo.GetUserAccounts(ctx, userID)
+}
+
+// GetEntriesByRelatedID 根据关联ID获取分录
+func (s *ledgerService) GetEntriesByRelatedID(ctx context.Context, relatedID string) ([]*models.LedgerEntry, error) {
+	return s.ledgerRepo.GetEntriesByRelatedID(ctx, relatedID)
+}
+
+// HasOperation 判断幂等操作是否已经记账
+func (s *ledgerService) HasOperation(ctx context.Context, entryType models.LedgerEntryType, relatedID string) (bool, error) {
+	_, err := s.ledgerRepo.GetOperation(ctx, entryType, relatedID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// walletConflictRetry 钱包并发冲突重试配置（有界指数退避）
+var walletConflictRetry = &retry.RetryConfig{
+	MaxRetries:    8,
+	InitialDelay:  5 * time.Millisecond,
+	MaxDelay:      200 * time.Millisecond,
+	BackoffFactor: 2.0,
+	Jitter:        0.5,
+}
+
+// RetryOnConflict 在乐观锁冲突、数据库锁定或死锁时按有界退避重试 fn
+// fn 应包含完整的数据库事务，每次重试都会重新读取最新数据
+func RetryOnConflict(ctx context.Context, fn func() error) error {
+	err := retry.Retry(ctx, walletConflictRetry, fn, repository.IsRetryableConflict)
+	if err != nil && repository.IsRetryableConflict(err) {
+		return fmt.Errorf("钱包并发更新冲突，请稍后重试: %w", err)
+	}
+	return err
+}
+
+// replayOperation 返回已执行操作的首次结果，未执行过时返回 gorm.ErrRecordNotFound
+func (s *ledgerService) replayOperation(ctx context.Context, ledgerRepo repository.LedgerRepository, posting *LedgerPosting) (*LedgerResult, error) {
+	operation, err := ledgerRepo.GetOperation(ctx, posting.EntryType, posting.RelatedID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, total, err := normalizePostingLines(posting.Lines)
+	if err != nil {
+		return nil, err
+	}
+	if operation.UserID != posting.UserID || normalizeAmount(operation.Amount) != total {
+		return nil, fmt.Errorf("%w: %s/%s", ErrOperationConflict, posting.EntryType, posting.RelatedID)
+	}
+
+	entry, err := ledgerRepo.GetEntryByID(ctx, operation.EntryID)
+	if err != nil {
+		return nil, fmt.Errorf("获取原始分录失败: %w", err)
+	}
+
+	return &LedgerResult{
+		Entry: entry,
+		WalletBefore: models.Wallet{
+			UserID:        operation.UserID,
+			Balance:       operation.BalanceBefore,
+			FrozenBalance: operation.FrozenBefore,
+		},
+		WalletAfter: &models.Wallet{
+			UserID:        operation.UserID,
+			Balance:       operation.BalanceAfter,
+			FrozenBalance: operation.FrozenAfter,
+		},
+		Replayed: true,
+	}, nil
+}
+
+// ensureUserAccounts 锁定用户科目，首次建立科目时把已有钱包余额作为期初余额入账
+func (s *ledgerService) ensureUserAccounts(ctx context.Context, ledgerRepo repository.LedgerRepository, wallet *models.Wallet, accounts map[models.LedgerAccountType]*models.LedgerAccount) error {
+	var opening []LedgerPostingLine
+	openingTotal := new(big.Float)
+
+	walletBalances := map[models.LedgerAccountType]string{
+		models.LedgerAccountUserAvailable: wallet.Balance,
+		models.LedgerAccountUserFrozen:    wallet.FrozenBalance,
+	}
+
+	for _, accountType := range []models.LedgerAccountType{models.LedgerAccountUserAvailable, models.LedgerAccountUserFrozen} {
+		account, created, err := ledgerRepo.GetOrCreateAccountForUpdate(ctx, wallet.UserID, accountType)
+		if err != nil {
+			return err
+		}
+		accounts[accountType] = account
+
+		if !created {
+			continue
+		}
+		amount, err := parseDecimal(walletBalances[accountType])
+		if err != nil || amount.Sign() <= 0 {
+			continue
+		}
+		opening = append(opening, LedgerPostingLine{Account: accountType, Side: models.LedgerSideCredit, Amount: amount.Text('f', 8)})
+		openingTotal.Add(openingTotal, amount)
+	}
+
+	if len(opening) == 0 {
+		return nil
+	}
+
+	opening = append(opening, LedgerPostingLine{
+		Account: models.LedgerAccountDepositClearing,
+		Side:    models.LedgerSideDebit,
+		Amount:  openingTotal.Text('f', 8),
+	})
+
+	_, err := s.applyEntry(ctx, ledgerRepo, accounts, wallet.UserID, models.LedgerEntryTypeOpeningBalance, "", "迁移历史钱包余额", opening)
+	return err
+}
+
+// applyEntry 写入分录并更新科目余额
+func (s *ledgerService) applyEntry(
+	ctx context.Context,
+	ledgerRepo repository.LedgerRepository,
+	accounts map[models.LedgerAccountType]*models.LedgerAccount,
+	userID int64,
+	entryType models.LedgerEntryType,
+	relatedID, description string,
+	lines []LedgerPostingLine,
+) (*models.LedgerEntry, error) {
+	entry := &models.LedgerEntry{
+		UserID:      userID,
+		EntryType:   entryType,
+		RelatedID:   relatedID,
+		Description: description,
+	}
+	touched := make(map[models.LedgerAccountType]bool)
+
+	for _, line := range lines {
+		account, ok := accounts[line.Account]
+		if !ok {
+			// 平台科目不区分用户
+			var err error
+			account, _, err = ledgerRepo.GetOrCreateAccountForUpdate(ctx, 0, line.Account)
+			if err != nil {
+				return nil, err
+			}
+			accounts[line.Account] = account
+		}
+
+		balance, err := parseDecimal(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ledger account balance: %w", err)
+		}
+		amount, _ := parseDecimal(line.Amount)
+		if line.Side == line.Account.NormalSide() {
+			balance.Add(balance, amount)
+		} else {
+			balance.Sub(balance, amount)
+		}
+
+		if balance.Sign() < 0 {
+			switch line.Account {
+			case models.LedgerAccountUserAvailable:
+				return nil, ErrInsufficientBalance
+			case models.LedgerAccountUserFrozen:
+				return nil, ErrInsufficientFrozenBalance
+			}
+		}
+
+		account.Balance = balance.Text('f', 8)
+		touched[line.Account] = true
+		entry.Lines = append(entry.Lines, models.LedgerLine{
+			AccountID: account.ID,
+			Side:      line.Side,
+			Amount:    line.Amount,
+		})
+	}
+
+	if err := ledgerRepo.CreateEntry(ctx, entry); err != nil {
+		return nil, fmt.Errorf("写入账本分录失败: %w", err)
+	}
+
+	for accountType := range touched {
+		account := accounts[accountType]
+		if err := ledgerRepo.UpdateAccountBalance(ctx, account); err != nil {
+			return nil, fmt.Errorf("更新科目余额失败: %w", err)
+		}
+	}
+
+	return entry, nil
+}
+
+// normalizePostingLines 校验金额并检查借贷平衡，返回规范化后的明细和借方合计
+func normalizePostingLines(lines []LedgerPostingLine) ([]LedgerPostingLine, string, error) {
+	if len(lines) < 2 {
+		return nil, "", fmt.Errorf("%w: at least two lines required", ErrUnbalancedEntry)
+	}
+
+	debits := new(big.Float)
+	credits := new(big.Float)
+	normalized := make([]LedgerPostingLine, 0, len(lines))
+
+	for _, line := range lines {
+		amount, err := parseDecimal(line.Amount)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid amount format: %w", err)
+		}
+		if amount.Sign() <= 0 {
+			return nil, "", errors.New("amount must be positive")
+		}
+
+		switch line.Side {
+		case models.LedgerSideDebit:
+			debits.Add(debits, amount)
+		case models.LedgerSideCredit:
+			credits.Add(credits, amount)
+		default:
+			return nil, "", fmt.Errorf("invalid ledger side: %s", line.Side)
+		}
+
+		line.Amount = amount.Text('f', 8)
+		normalized = append(normalized, line)
+	}
+
+	if debits.Text('f', 8) != credits.Text('f', 8) {
+		return nil, "", fmt.Errorf("%w: debit %s, credit %s", ErrUnbalancedEntry, debits.Text('f', 8), credits.Text('f', 8))
+	}
+
+	return normalized, debits.Text('f', 8), nil
+}
@@ -176,6 +176,13 @@ func (m *menuService) initializeDefaultMenus() {
 				Icon:        "💰",
 				Action:      "wallet_menu",
 			},
+			{
+				ID:          "referral",
+				Text:        "🎁 邀请好友",
+				Description: "查看邀请链接和邀请奖励",
+				Icon:        "🎁",
+				Action:      "referral",
+			},
 			{
 				ID:          "settings",
 				Text:        "⚙️ 设置",
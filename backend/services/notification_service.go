@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
@@ -11,15 +12,17 @@ import (
 
 // notificationService 通知服务实现
 type notificationService struct {
-	bot    *tgbotapi.BotAPI
-	logger Logger
+	bot      *tgbotapi.BotAPI
+	logger   Logger
+	adminIDs []int64 // 接收运营告警的管理员 Telegram ID
 }
 
-// NewNotificationService 创建通知服务
-func NewNotificationService(bot *tgbotapi.BotAPI, logger Logger) NotificationService {
+// NewNotificationService 创建通知服务，adminIDs 为接收运营告警的管理员
+func NewNotificationService(bot *tgbotapi.BotAPI, logger Logger, adminIDs []int64) NotificationService {
 	return &notificationService{
-		bot:    bot,
-		logger: logger,
+		bot:      bot,
+		logger:   logger,
+		adminIDs: adminIDs,
 	}
 }
 
@@ -150,6 +153,81 @@ func (n *notificationService) SendRechargeSuccessNotification(ctx context.Contex
 	return nil
 }
 
+// SendTransferNotification 发送转账通知
+func (n *notificationService) SendTransferNotification(ctx context.Context, userID int64, transfer *TransferResult, incoming bool) error {
+	var message string
+	if incoming {
+		message = fmt.Sprintf(
+			"💸 <b>收到转账</b>\n\n"+
+				"👤 <b>付款方:</b> %s\n"+
+				"💰 <b>金额:</b> %s USDT\n"+
+				"💳 <b>当前余额:</b> %s USDT\n",
+			html.EscapeString(transfer.FromName),
+			transfer.Amount,
+			transfer.ToBalance,
+		)
+	} else {
+		message = fmt.Sprintf(
+			"📤 <b>转账成功</b>\n\n"+
+				"👤 <b>收款方:</b> %s\n"+
+				"💰 <b>金额:</b> %s USDT\n"+
+				"💳 <b>当前余额:</b> %s USDT\n",
+			html.EscapeString(transfer.ToName),
+			transfer.Amount,
+			transfer.FromBalance,
+		)
+	}
+	if transfer.Memo != "" {
+		message += fmt.Sprintf("📝 <b>备注:</b> %s\n", html.EscapeString(transfer.Memo))
+	}
+	message += fmt.Sprintf(
+		"📋 <b>转账单号:</b> <code>%s</code>\n"+
+			"⏰ <b>时间:</b> %s",
+		transfer.TransferNo,
+		transfer.CreatedAt.Format("2006-01-02 15:04:05"),
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💳 查看钱包", "wallet:balance"),
+			tgbotapi.NewInlineKeyboardButtonData("📋 钱包记录", "wallet:history"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(userID, message)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = keyboard
+
+	if err := n.sendMessageWithRetry(ctx, msg, 2); err != nil {
+		n.logger.Error("发送转账通知失败: user_id=%d, transfer_no=%s, error=%v", userID, transfer.TransferNo, err)
+		return err
+	}
+
+	n.logger.Info("转账通知已发送: user_id=%d, transfer_no=%s", userID, transfer.TransferNo)
+	return nil
+}
+
+// SendAdminAlert 发送运营告警
+// 告警同时写入错误日志，逐个发送给管理员，部分管理员发送失败时返回最后一个错误
+func (n *notificationService) SendAdminAlert(ctx context.Context, message string) error {
+	n.logger.Error("运营告警: %s", message)
+	if len(n.adminIDs) == 0 {
+		return nil
+	}
+
+	text := fmt.Sprintf("🚨 <b>运营告警</b>\n\n%s\n\n⏰ %s", html.EscapeString(message), time.Now().Format("2006-01-02 15:04:05"))
+	var lastErr error
+	for _, adminID := range n.adminIDs {
+		msg := tgbotapi.NewMessage(adminID, text)
+		msg.ParseMode = tgbotapi.ModeHTML
+		if err := n.sendMessageWithRetry(ctx, msg, 2); err != nil {
+			n.logger.Error("发送运营告警失败: admin_id=%d, error=%v", adminID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
 // sendMessageWithRetry 带重试机制的消息发送
 func (n *notificationService) sendMessageWithRetry(ctx context.Context, msg tgbotapi.MessageConfig, maxRetries int) error {
 	var lastErr error
@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"regexp"
+	"strconv"
 	"time"
 
 	"tg-robot-sim/pkg/sdk/esim"
 	service_common "tg-robot-sim/services/common"
 	"tg-robot-sim/storage/models"
 	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
 )
 
 // OrderService 订单服务接口
@@ -21,20 +25,26 @@ type OrderService interface {
 	GetOrderByOrderNo(ctx context.Context, orderNo string) (*models.Order, error)
 	GetUserOrders(ctx context.Context, userID int64, limit, offset int) ([]*models.Order, error)
 	GetUserOrderByID(ctx context.Context, id uint, userID int64) (*models.Order, error)
-	PayOrder(ctx context.Context, orderNo string) error
 	CompleteOrder(ctx context.Context, orderNo string) error
 	CancelOrder(ctx context.Context, orderNo string) error
 	GetOrderStats(ctx context.Context, userID int64) (*OrderStats, error)
 
 	// eSIM 订单处理相关方法
-	// CreateEsimOrder 创建 eSIM 商品购买订单（含余额冻结）
+	// QuoteEsimOrder 计算 eSIM 订单金额，传入优惠码时校验并计算优惠
+	QuoteEsimOrder(ctx context.Context, userID int64, productID int, quantity int, couponCode string) (*EsimOrderQuote, error)
+
+	// CreateEsimOrder 创建 eSIM 商品购买订单
+	// 订单、优惠码核销、余额冻结和第三方下单任务在同一事务内提交，第三方订单由 ProviderOrderWorker 异步创建
 	CreateEsimOrder(ctx context.Context, req *CreateEsimOrderRequest) (*EsimOrderResponse, error)
 
-	// ProcessOrderCompletion 处理订单完成（确认扣费）
-	ProcessOrderCompletion(ctx context.Context, orderID uint, providerOrderData *ProviderOrderData) error
+	// ProcessOrderCompletion 处理订单完成（确认扣费），providerOrderData 作为第三方原始数据写入订单事件
+	ProcessOrderCompletion(ctx context.Context, orderID uint, providerOrderData *ProviderOrderData, actor models.OrderEventActor) error
+
+	// ProcessOrderFailure 处理订单失败（退还冻结金额并释放优惠码），providerPayload 为第三方原始数据，可为 nil
+	ProcessOrderFailure(ctx context.Context, orderID uint, actor models.OrderEventActor, reason string, providerPayload interface{}) error
 
-	// ProcessOrderFailure 处理订单失败（退还冻结金额）
-	ProcessOrderFailure(ctx context.Context, orderID uint, reason string) error
+	// GetOrderEvents 获取订单状态变更记录，按发生顺序排列
+	GetOrderEvents(ctx context.Context, orderID uint) ([]*models.OrderEvent, error)
 
 	// UpdateOrderSyncInfo 更新订单同步信息
 	UpdateOrderSyncInfo(ctx context.Context, orderID uint, syncAttempts int, nextSyncAt *time.Time) error
@@ -53,27 +63,46 @@ type OrderStats struct {
 
 // orderService 订单服务实现
 type orderService struct {
+	db                *gorm.DB
 	orderRepo         repository.OrderRepository
+	stateMachine      OrderStateMachine
+	outboxRepo        repository.OrderOutboxRepository
 	productRepo       repository.ProductRepository
 	walletService     WalletService
 	esimClientService service_common.EsimClientService
 	esimCardService   EsimCardService
+	couponService     CouponService
+	referralService   ReferralService
+	events            EventPublisher
 }
 
 // NewOrderService 创建订单服务实例
+// events 可以为 nil，此时订单完成或失败时不推送实时事件
 func NewOrderService(
+	db *gorm.DB,
 	orderRepo repository.OrderRepository,
+	stateMachine OrderStateMachine,
+	outboxRepo repository.OrderOutboxRepository,
 	productRepo repository.ProductRepository,
 	walletService WalletService,
 	esimClientService service_common.EsimClientService,
 	esimCardService EsimCardService,
+	couponService CouponService,
+	referralService ReferralService,
+	events EventPublisher,
 ) OrderService {
 	return &orderService{
+		db:                db,
 		orderRepo:         orderRepo,
+		stateMachine:      stateMachine,
+		outboxRepo:        outboxRepo,
 		productRepo:       productRepo,
 		walletService:     walletService,
 		esimClientService: esimClientService,
 		esimCardService:   esimCardService,
+		couponService:     couponService,
+		referralService:   referralService,
+		events:            events,
 	}
 }
 
@@ -96,10 +125,9 @@ func (s *orderService) CreateOrder(ctx context.Context, userID int64, productID
 		ProductID:   productID,
 		ProductName: product.Name,
 		Amount:      fmt.Sprintf("%.2f", product.Price),
-		Status:      models.OrderStatusPending,
 	}
 
-	if err := s.orderRepo.Create(ctx, order); err != nil {
+	if err := s.stateMachine.Create(ctx, order, userOrderTransition(userID, models.OrderStatusPending, "用户下单")); err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
@@ -155,37 +183,6 @@ func (s *orderService) GetUserOrders(ctx context.Context, userID int64, limit, o
 	return orders, nil
 }
 
-// PayOrder 支付订单
-func (s *orderService) PayOrder(ctx context.Context, orderNo string) error {
-	// 获取订单
-	order, err := s.orderRepo.GetByOrderNo(ctx, orderNo)
-	if err != nil {
-		return fmt.Errorf("order not found: %w", err)
-	}
-
-	// 检查订单状态
-	if order.Status != models.OrderStatusPending {
-		return errors.New("order cannot be paid")
-	}
-
-	// 处理支付
-	result, err := s.walletService.ProcessPayment(ctx, order.UserID, order.ProductID, order.Amount)
-	if err != nil || !result.Success {
-		return fmt.Errorf("payment failed: %w", err)
-	}
-
-	// 更新订单状态
-	now := time.Now()
-	order.Status = models.OrderStatusPaid
-	order.PaidAt = &now
-
-	if err := s.orderRepo.Update(ctx, order); err != nil {
-		return fmt.Errorf("failed to update order: %w", err)
-	}
-
-	return nil
-}
-
 // CompleteOrder 完成订单
 func (s *orderService) CompleteOrder(ctx context.Context, orderNo string) error {
 	// 获取订单
@@ -194,17 +191,13 @@ func (s *orderService) CompleteOrder(ctx context.Context, orderNo string) error
 		return fmt.Errorf("order not found: %w", err)
 	}
 
-	// 检查订单状态
-	if order.Status != models.OrderStatusPaid {
-		return errors.New("order cannot be completed")
-	}
-
 	// 更新订单状态
-	now := time.Now()
-	order.Status = models.OrderStatusCompleted
-	order.CompletedAt = &now
-
-	if err := s.orderRepo.Update(ctx, order); err != nil {
+	err = s.stateMachine.Transition(ctx, order, &OrderTransition{
+		To:     models.OrderStatusCompleted,
+		Actor:  models.OrderActorSystem,
+		Reason: "订单完成",
+	})
+	if err != nil {
 		return fmt.Errorf("failed to update order: %w", err)
 	}
 
@@ -219,15 +212,8 @@ func (s *orderService) CancelOrder(ctx context.Context, orderNo string) error {
 		return fmt.Errorf("order not found: %w", err)
 	}
 
-	// 检查订单状态
-	if order.Status != models.OrderStatusPending {
-		return errors.New("order cannot be cancelled")
-	}
-
 	// 更新订单状态
-	order.Status = models.OrderStatusCancelled
-
-	if err := s.orderRepo.Update(ctx, order); err != nil {
+	if err := s.stateMachine.Transition(ctx, order, userOrderTransition(order.UserID, models.OrderStatusCancelled, "用户取消")); err != nil {
 		return fmt.Errorf("failed to update order: %w", err)
 	}
 
@@ -269,7 +255,25 @@ func (s *orderService) GetOrderStats(ctx context.Context, userID int64) (*OrderS
 	return stats, nil
 }
 
-// CreateEsimOrder 创建 eSIM 商品购买订单（含余额冻结）
+// QuoteEsimOrder 计算 eSIM 订单金额
+func (s *orderService) QuoteEsimOrder(ctx context.Context, userID int64, productID int, quantity int, couponCode string) (*EsimOrderQuote, error) {
+	if productID == 0 {
+		return nil, errors.New("产品ID不能为空")
+	}
+	if quantity <= 0 {
+		return nil, errors.New("购买数量必须大于0")
+	}
+
+	product, err := s.getActiveProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, _, err := s.quoteEsimOrder(ctx, userID, product, quantity, couponCode)
+	return quote, err
+}
+
+// CreateEsimOrder 创建 eSIM 商品购买订单
 func (s *orderService) CreateEsimOrder(ctx context.Context, req *CreateEsimOrderRequest) (*EsimOrderResponse, error) {
 	// 1. 验证输入参数
 	if req.UserID == 0 {
@@ -289,24 +293,20 @@ func (s *orderService) CreateEsimOrder(ctx context.Context, req *CreateEsimOrder
 	}
 
 	// 2. 获取产品信息
-	product, err := s.productRepo.GetByID(ctx, req.ProductID)
+	product, err := s.getActiveProduct(ctx, req.ProductID)
 	if err != nil {
-		return nil, fmt.Errorf("产品不存在: %w", err)
+		return nil, err
 	}
 
-	// 检查产品状态
-	if product.Status != "active" {
-		return nil, errors.New("产品暂不可用")
+	// 3. 计算订单金额（优惠在服务端计算，不信任前端传入的折扣）
+	quote, discount, err := s.quoteEsimOrder(ctx, req.UserID, product, req.Quantity, req.CouponCode)
+	if err != nil {
+		return nil, err
 	}
 
-	// 3. 计算订单金额
-	unitPrice := product.Price
-	totalAmount := unitPrice * float64(req.Quantity)
-	totalAmountStr := fmt.Sprintf("%.4f", totalAmount)
-
 	// 验证前端传入的金额是否正确
-	if req.TotalAmount != totalAmountStr {
-		return nil, fmt.Errorf("订单金额不匹配，期望: %s，实际: %s", totalAmountStr, req.TotalAmount)
+	if req.TotalAmount != quote.TotalAmount {
+		return nil, fmt.Errorf("订单金额不匹配，期望: %s，实际: %s", quote.TotalAmount, req.TotalAmount)
 	}
 
 	// 4. 检查用户余额是否充足
@@ -318,67 +318,141 @@ func (s *orderService) CreateEsimOrder(ctx context.Context, req *CreateEsimOrder
 		return nil, errors.New("余额不足，请先充值")
 	}
 
-	// 5. 创建订单记录
-	order := &models.Order{
-		UserID:      req.UserID,
-		ProductID:   req.ProductID,
-		ProductName: product.Name,
-		Quantity:    req.Quantity,
-		UnitPrice:   fmt.Sprintf("%.4f", unitPrice),
-		Amount:      req.TotalAmount,
-		Status:      models.OrderStatusProcessing, // 直接设为处理中状态
-		Remark:      req.Remark,
+	// 5. 准备第三方下单参数，参数无效时不创建订单
+	payload, err := newProviderOrderPayload(product, req)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.orderRepo.Create(ctx, order); err != nil {
-		return nil, fmt.Errorf("创建订单失败: %w", err)
-	}
+	// 6. 创建订单记录
+	order := &models.Order{
+		UserID:         req.UserID,
+		ProductID:      req.ProductID,
+		ProductName:    product.Name,
+		Quantity:       req.Quantity,
+		UnitPrice:      quote.UnitPrice,
+		Amount:         req.TotalAmount,
+		Remark:         req.Remark,
+		CouponCode:     quote.CouponCode,
+		DiscountAmount: quote.DiscountAmount,
+	}
+
+	// 7. 订单（直接设为处理中）、优惠码核销、余额冻结和第三方下单任务一起提交
+	// 任一步失败整体回滚，不会留下已冻结资金却没有下单任务的订单
+	err = RetryOnConflict(ctx, func() error {
+		order.ID = 0 // 冲突重试时重新插入
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := s.stateMachine.CreateInTx(ctx, tx, order, userOrderTransition(req.UserID, models.OrderStatusProcessing, "用户下单")); err != nil {
+				return err
+			}
 
-	// 6. 冻结用户余额
-	err = s.walletService.FreezeBalance(
-		ctx,
-		req.UserID,
-		req.TotalAmount,
-		order.OrderNo,
-		fmt.Sprintf("eSIM订单支付 - 订单号: %s", order.OrderNo),
-	)
-	if err != nil {
-		// 冻结失败，需要删除订单或标记为失败
-		s.orderRepo.UpdateStatus(ctx, order.ID, models.OrderStatusFailed)
-		return nil, fmt.Errorf("冻结余额失败: %w", err)
-	}
-
-	// 7. 调用第三方 eSIM API 创建订单
-	if s.esimClientService != nil {
-		providerOrder, err := s.createProviderOrder(ctx, order, product, req.CustomerEmail)
-		if err != nil {
-			// 创建第三方订单失败，解冻余额
-			s.walletService.UnfreezeBalance(ctx, req.UserID, req.TotalAmount, order.OrderNo, "订单创建失败退款")
-			s.orderRepo.UpdateStatus(ctx, order.ID, models.OrderStatusFailed)
-			return nil, fmt.Errorf("创建第三方订单失败: %w", err)
-		}
+			// 核销优惠码（事务内校验使用次数上限，并发下单时不会超发）
+			if discount != nil {
+				if err := s.couponService.RedeemInTx(ctx, tx, req.UserID, discount, order); err != nil {
+					return err
+				}
+			}
 
-		// 更新订单的第三方订单ID
-		order.ProviderOrderID = fmt.Sprint(providerOrder.OrderID)
-		order.ProviderOrderNo = providerOrder.OrderNumber
-		if err := s.orderRepo.Update(ctx, order); err != nil {
-			// 更新失败，记录日志但不影响订单创建
-			fmt.Printf("Warning: failed to update provider order ID: %v\n", err)
-		}
+			err := s.walletService.FreezeBalanceInTx(
+				ctx,
+				tx,
+				req.UserID,
+				req.TotalAmount,
+				order.OrderNo,
+				fmt.Sprintf("eSIM订单支付 - 订单号: %s", order.OrderNo),
+			)
+			if err != nil {
+				return fmt.Errorf("冻结余额失败: %w", err)
+			}
+
+			// 以订单号作为幂等引用，后台任务重试时第三方不会重复下单
+			task := &models.OrderOutboxTask{
+				OrderID:   order.ID,
+				TaskType:  models.OutboxTaskCreateProviderOrder,
+				Reference: order.OrderNo,
+				Payload:   payload,
+			}
+			if err := s.outboxRepo.WithTx(tx).Create(ctx, task); err != nil {
+				return fmt.Errorf("创建第三方下单任务失败: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// 8. 返回订单响应
 	return &EsimOrderResponse{
-		OrderID:     order.ID,
-		OrderNo:     order.OrderNo,
-		Status:      order.Status,
-		TotalAmount: order.Amount,
-		CreatedAt:   order.CreatedAt,
+		OrderID:        order.ID,
+		OrderNo:        order.OrderNo,
+		Status:         order.Status,
+		TotalAmount:    order.Amount,
+		CreatedAt:      order.CreatedAt,
+		CouponCode:     order.CouponCode,
+		DiscountAmount: order.DiscountAmount,
 	}, nil
 }
 
+// getActiveProduct 获取可购买的产品
+func (s *orderService) getActiveProduct(ctx context.Context, productID int) (*models.Product, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("产品不存在: %w", err)
+	}
+
+	// 检查产品状态
+	if product.Status != "active" {
+		return nil, errors.New("产品暂不可用")
+	}
+	return product, nil
+}
+
+// quoteEsimOrder 计算订单金额，使用优惠码时同时返回优惠计算结果供核销使用
+func (s *orderService) quoteEsimOrder(ctx context.Context, userID int64, product *models.Product, quantity int, couponCode string) (*EsimOrderQuote, *CouponDiscount, error) {
+	// 商品价格为两位小数的 decimal，按十进制字符串转换，避免二进制浮点误差进入金额计算
+	unitPrice, ok := new(big.Rat).SetString(strconv.FormatFloat(product.Price, 'f', -1, 64))
+	if !ok {
+		return nil, nil, fmt.Errorf("商品价格格式错误: %v", product.Price)
+	}
+	subtotal := new(big.Rat).Mul(unitPrice, big.NewRat(int64(quantity), 1))
+
+	quote := &EsimOrderQuote{
+		ProductID:      product.ID,
+		Quantity:       quantity,
+		UnitPrice:      formatQuoteAmount(unitPrice),
+		Subtotal:       formatQuoteAmount(subtotal),
+		DiscountAmount: formatQuoteAmount(new(big.Rat)),
+		TotalAmount:    formatQuoteAmount(subtotal),
+	}
+
+	couponCode = models.NormalizeCouponCode(couponCode)
+	if couponCode == "" {
+		return quote, nil, nil
+	}
+	if s.couponService == nil {
+		return nil, nil, ErrCouponUnavailable
+	}
+
+	discount, err := s.couponService.Evaluate(ctx, userID, couponCode, product, subtotal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quote.CouponCode = discount.Coupon.Code
+	quote.DiscountAmount = formatQuoteAmount(discount.Amount)
+	quote.TotalAmount = formatQuoteAmount(new(big.Rat).Sub(subtotal, discount.Amount))
+	return quote, discount, nil
+}
+
+// formatQuoteAmount 报价金额统一保留 4 位小数
+// 单价和优惠金额都精确到分，小计和实付金额无需再次取整
+func formatQuoteAmount(amount *big.Rat) string {
+	return amount.FloatString(4)
+}
+
 // ProcessOrderCompletion 处理订单完成（确认扣费）
-func (s *orderService) ProcessOrderCompletion(ctx context.Context, orderID uint, providerOrderData *ProviderOrderData) error {
+func (s *orderService) ProcessOrderCompletion(ctx context.Context, orderID uint, providerOrderData *ProviderOrderData, actor models.OrderEventActor) error {
 	// 获取订单信息
 	order, err := s.orderRepo.GetByID(ctx, orderID)
 	if err != nil {
@@ -386,30 +460,56 @@ func (s *orderService) ProcessOrderCompletion(ctx context.Context, orderID uint,
 	}
 
 	// 检查订单状态
-	if order.Status != models.OrderStatusProcessing {
-		return fmt.Errorf("订单状态不正确，当前状态: %s", order.Status)
-	}
-
-	// 确认冻结金额的支付
-	err = s.walletService.ConfirmFrozenPayment(
-		ctx,
-		order.UserID,
-		order.Amount,
-		order.OrderNo,
-		fmt.Sprintf("eSIM订单支付完成 - 订单号: %s", order.OrderNo),
-	)
-	if err != nil {
-		return fmt.Errorf("确认支付失败: %w", err)
+	if err := order.CheckTransition(models.OrderStatusCompleted); err != nil {
+		return err
 	}
 
-	// 更新订单状态为已完成
-	now := time.Now()
-	order.Status = models.OrderStatusCompleted
-	order.CompletedAt = &now
-	if err := s.orderRepo.Update(ctx, order); err != nil {
+	reason := "第三方订单已完成"
+	if providerOrderData != nil {
+		reason = fmt.Sprintf("第三方订单状态: %s", providerOrderData.Status)
+	}
+
+	// 更新订单状态为已完成并确认冻结金额的支付（同一事务）
+	// 状态以条件更新流转，并发的完成与失败只有一个能更新成功，另一个回滚且不动账
+	from := order.Status
+	err = RetryOnConflict(ctx, func() error {
+		order.Status = from
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := s.stateMachine.TransitionInTx(ctx, tx, order, &OrderTransition{
+				To:      models.OrderStatusCompleted,
+				Actor:   actor,
+				Reason:  reason,
+				Payload: providerOrderData,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = s.walletService.ConfirmFrozenPaymentInTx(
+				ctx,
+				tx,
+				order.UserID,
+				order.Amount,
+				order.OrderNo,
+				fmt.Sprintf("eSIM订单支付完成 - 订单号: %s", order.OrderNo),
+			)
+			if err != nil {
+				return fmt.Errorf("确认支付失败: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
 		return fmt.Errorf("更新订单状态失败: %w", err)
 	}
 
+	// 被邀请用户首单完成后发放邀请奖励（只发一次），失败不影响订单完成
+	if s.referralService != nil {
+		if err := s.referralService.RewardFirstOrder(ctx, order.UserID, order.OrderNo); err != nil {
+			fmt.Printf("[ERROR] Failed to reward referral for order %d: %v\n", orderID, err)
+		}
+	}
+
 	// 保存订单详情
 	if providerOrderData != nil {
 		fmt.Printf("[DEBUG] Saving order detail for order %d\n", orderID)
@@ -449,11 +549,14 @@ func (s *orderService) ProcessOrderCompletion(ctx context.Context, orderID uint,
 		fmt.Printf("[WARNING] Provider order data is nil for order %d\n", orderID)
 	}
 
+	// eSIM 卡写入后再推送，Mini App 收到事件时即可拉取到卡片信息
+	s.publishOrderEvent(order, EventOrderCompleted, "")
+
 	return nil
 }
 
 // ProcessOrderFailure 处理订单失败（退还冻结金额）
-func (s *orderService) ProcessOrderFailure(ctx context.Context, orderID uint, reason string) error {
+func (s *orderService) ProcessOrderFailure(ctx context.Context, orderID uint, actor models.OrderEventActor, reason string, providerPayload interface{}) error {
 	// 获取订单信息
 	order, err := s.orderRepo.GetByID(ctx, orderID)
 	if err != nil {
@@ -461,32 +564,92 @@ func (s *orderService) ProcessOrderFailure(ctx context.Context, orderID uint, re
 	}
 
 	// 检查订单状态
-	if order.Status != models.OrderStatusProcessing {
-		return fmt.Errorf("订单状态不正确，当前状态: %s", order.Status)
-	}
-
-	// 解冻余额（退还给用户）
-	err = s.walletService.UnfreezeBalance(
-		ctx,
-		order.UserID,
-		order.Amount,
-		order.OrderNo,
-		fmt.Sprintf("eSIM订单失败退款 - 订单号: %s, 原因: %s", order.OrderNo, reason),
-	)
-	if err != nil {
-		return fmt.Errorf("退还余额失败: %w", err)
+	if err := order.CheckTransition(models.OrderStatusFailed); err != nil {
+		return err
 	}
 
-	// 更新订单状态为失败
-	order.Status = models.OrderStatusFailed
+	// 更新订单状态为失败、退还冻结金额并释放优惠码（同一事务）
+	// 状态以条件更新流转，并发的完成与失败只有一个能更新成功，另一个回滚且不动账
 	order.Remark = fmt.Sprintf("%s\n失败原因: %s", order.Remark, reason)
-	if err := s.orderRepo.Update(ctx, order); err != nil {
+	from := order.Status
+	err = RetryOnConflict(ctx, func() error {
+		order.Status = from
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := s.stateMachine.TransitionInTx(ctx, tx, order, &OrderTransition{
+				To:      models.OrderStatusFailed,
+				Actor:   actor,
+				Reason:  reason,
+				Payload: providerPayload,
+			})
+			if err != nil {
+				return err
+			}
+
+			// 解冻余额（退还给用户）
+			err = s.walletService.UnfreezeBalanceInTx(
+				ctx,
+				tx,
+				order.UserID,
+				order.Amount,
+				order.OrderNo,
+				fmt.Sprintf("eSIM订单失败退款 - 订单号: %s, 原因: %s", order.OrderNo, reason),
+			)
+			if err != nil {
+				return fmt.Errorf("退还余额失败: %w", err)
+			}
+
+			// 释放优惠码，使用次数退回给用户（重复执行不会重复退回）
+			if order.CouponCode != "" && s.couponService != nil {
+				if err := s.couponService.ReleaseForOrderInTx(ctx, tx, order.OrderNo); err != nil {
+					return fmt.Errorf("释放优惠码失败: %w", err)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
 		return fmt.Errorf("更新订单状态失败: %w", err)
 	}
 
+	s.publishOrderEvent(order, EventOrderFailed, reason)
+
 	return nil
 }
 
+// publishOrderEvent 推送订单状态变更事件
+func (s *orderService) publishOrderEvent(order *models.Order, eventType, reason string) {
+	if s.events == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"order_id":     order.ID,
+		"order_no":     order.OrderNo,
+		"product_name": order.ProductName,
+		"amount":       order.Amount,
+		"status":       order.Status,
+		"completed_at": order.CompletedAt,
+	}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	s.events.Publish(order.UserID, eventType, data)
+}
+
+// GetOrderEvents 获取订单状态变更记录
+func (s *orderService) GetOrderEvents(ctx context.Context, orderID uint) ([]*models.OrderEvent, error) {
+	return s.stateMachine.GetEvents(ctx, orderID)
+}
+
+// userOrderTransition 用户发起的订单状态流转
+func userOrderTransition(userID int64, to models.OrderStatus, reason string) *OrderTransition {
+	return &OrderTransition{
+		To:       to,
+		Actor:    models.OrderActorUser,
+		Operator: strconv.FormatInt(userID, 10),
+		Reason:   reason,
+	}
+}
+
 // UpdateOrderSyncInfo 更新订单同步信息
 func (s *orderService) UpdateOrderSyncInfo(ctx context.Context, orderID uint, syncAttempts int, nextSyncAt *time.Time) error {
 	return s.orderRepo.UpdateSyncInfo(ctx, orderID, syncAttempts, nextSyncAt)
@@ -504,46 +667,3 @@ func isValidEmail(email string) bool {
 	matched, _ := regexp.MatchString(emailRegex, email)
 	return matched
 }
-
-// createProviderOrder 调用第三方 eSIM API 创建订单
-func (s *orderService) createProviderOrder(ctx context.Context, order *models.Order, product *models.Product, customerEmail string) (*esim.CreateOrderData, error) {
-	// 将 ThirdPartyID 转换为整数
-	var productID int
-	_, err := fmt.Sscanf(product.ThirdPartyID, "%d", &productID)
-	if err != nil {
-		return nil, fmt.Errorf("无效的第三方产品ID: %w", err)
-	}
-
-	// 构建 eSIM 订单请求
-	createOrderReq := esim.CreateOrderRequest{
-		ProductID:     productID,
-		CustomerEmail: customerEmail,
-		Quantity:      order.Quantity,
-	}
-
-	// 调用 eSIM 服务创建订单
-	providerOrder, err := s.esimClientService.CreateOrder(ctx, createOrderReq)
-	if err != nil {
-		return nil, fmt.Errorf("调用第三方 API 失败: %w", err)
-	}
-
-	// 检查订单创建是否成功
-	if !providerOrder.Success {
-		// 尝试从 Data 字段获取错误消息
-		var errorMsg string
-		if len(providerOrder.Data) > 0 {
-			errorMsg = string(providerOrder.Data)
-		} else if len(providerOrder.Message) > 0 {
-			errorMsg = string(providerOrder.Message)
-		}
-		return nil, fmt.Errorf("第三方订单创建失败: %s", errorMsg)
-	}
-
-	// 检查解析后的订单数据
-	if providerOrder.OrderData == nil || providerOrder.OrderData.OrderNumber == "" {
-		return nil, fmt.Errorf("第三方订单创建失败: 未返回订单号")
-	}
-
-	// 返回第三方订单号
-	return providerOrder.OrderData, nil
-}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+// OrderTransition 订单状态流转请求
+type OrderTransition struct {
+	To       models.OrderStatus     // 目标状态
+	Actor    models.OrderEventActor // 发起方
+	Operator string                 // 操作人（管理员用户名、用户ID等），可为空
+	Reason   string                 // 变更原因
+	Payload  interface{}            // 第三方返回的原始数据，序列化为 JSON 保存，可为 nil
+}
+
+// OrderStateMachine 订单状态机
+// 订单状态只能经由状态机变更：按 models.OrderStatus 定义的流转规则校验，并在同一事务内写入订单事件
+type OrderStateMachine interface {
+	// Create 创建订单并记录创建事件，订单初始状态取 t.To
+	Create(ctx context.Context, order *models.Order, t *OrderTransition) error
+
+	// CreateInTx 在调用方事务内创建订单并记录创建事件，用于与资金冻结等操作一起提交
+	CreateInTx(ctx context.Context, tx *gorm.DB, order *models.Order, t *OrderTransition) error
+
+	// Transition 流转订单状态，同时保存 order.Remark
+	// 非法流转（包括订单状态已被并发修改）返回 *models.OrderTransitionError；成功后 order 更新为新状态
+	Transition(ctx context.Context, order *models.Order, t *OrderTransition) error
+
+	// TransitionInTx 在调用方事务内流转订单状态，用于与资金结算等操作一起提交
+	// 以 order.Status 作为条件更新，未更新到行时返回 *models.OrderTransitionError，调用方应回滚事务、不得动账；
+	// 成功后 order 更新为新状态，调用方重试事务前需恢复 order.Status
+	TransitionInTx(ctx context.Context, tx *gorm.DB, order *models.Order, t *OrderTransition) error
+
+	// GetEvents 获取订单的状态变更记录，按发生顺序排列
+	GetEvents(ctx context.Context, orderID uint) ([]*models.OrderEvent, error)
+}
+
+// orderStateMachine 订单状态机实现
+type orderStateMachine struct {
+	db             *gorm.DB
+	orderRepo      repository.OrderRepository
+	orderEventRepo repository.OrderEventRepository
+}
+
+// NewOrderStateMachine 创建订单状态机实例
+func NewOrderStateMachine(db *gorm.DB, orderRepo repository.OrderRepository, orderEventRepo repository.OrderEventRepository) OrderStateMachine {
+	return &orderStateMachine{
+		db:             db,
+		orderRepo:      orderRepo,
+		orderEventRepo: orderEventRepo,
+	}
+}
+
+// Create 创建订单并记录创建事件
+func (m *orderStateMachine) Create(ctx context.Context, order *models.Order, t *OrderTransition) error {
+	return RetryOnConflict(ctx, func() error {
+		return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return m.CreateInTx(ctx, tx, order, t)
+		})
+	})
+}
+
+// CreateInTx 在调用方事务内创建订单并记录创建事件
+func (m *orderStateMachine) CreateInTx(ctx context.Context, tx *gorm.DB, order *models.Order, t *OrderTransition) error {
+	if !models.OrderStatus("").CanTransitionTo(t.To) {
+		return &models.OrderTransitionError{OrderNo: order.OrderNo, To: t.To}
+	}
+	payload, err := marshalOrderPayload(t.Payload)
+	if err != nil {
+		return err
+	}
+
+	order.Status = t.To
+	if err := m.orderRepo.WithTx(tx).Create(ctx, order); err != nil {
+		return fmt.Errorf("创建订单失败: %w", err)
+	}
+	return m.createEvent(ctx, tx, order, "", t, payload)
+}
+
+// Transition 流转订单状态
+func (m *orderStateMachine) Transition(ctx context.Context, order *models.Order, t *OrderTransition) error {
+	from := order.Status
+	return RetryOnConflict(ctx, func() error {
+		order.Status = from
+		return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return m.TransitionInTx(ctx, tx, order, t)
+		})
+	})
+}
+
+// TransitionInTx 在调用方事务内流转订单状态
+func (m *orderStateMachine) TransitionInTx(ctx context.Context, tx *gorm.DB, order *models.Order, t *OrderTransition) error {
+	if err := order.CheckTransition(t.To); err != nil {
+		return err
+	}
+	payload, err := marshalOrderPayload(t.Payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"remark": order.Remark}
+	switch t.To {
+	case models.OrderStatusPaid:
+		updates["paid_at"] = now
+	case models.OrderStatusCompleted:
+		updates["completed_at"] = now
+	}
+
+	from := order.Status
+	orderRepo := m.orderRepo.WithTx(tx)
+	updated, err := orderRepo.TransitionStatus(ctx, order.ID, from, t.To, updates)
+	if err != nil {
+		return fmt.Errorf("更新订单状态失败: %w", err)
+	}
+	if !updated {
+		// 状态已被其他请求修改，按最新状态报告
+		current, err := orderRepo.GetByID(ctx, order.ID)
+		if err != nil {
+			return fmt.Errorf("查询订单失败: %w", err)
+		}
+		return &models.OrderTransitionError{OrderNo: order.OrderNo, From: current.Status, To: t.To}
+	}
+	if err := m.createEvent(ctx, tx, order, from, t, payload); err != nil {
+		return err
+	}
+
+	order.Status = t.To
+	switch t.To {
+	case models.OrderStatusPaid:
+		order.PaidAt = &now
+	case models.OrderStatusCompleted:
+		order.CompletedAt = &now
+	}
+	return nil
+}
+
+// GetEvents 获取订单的状态变更记录
+func (m *orderStateMachine) GetEvents(ctx context.Context, orderID uint) ([]*models.OrderEvent, error) {
+	events, err := m.orderEventRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单事件失败: %w", err)
+	}
+	return events, nil
+}
+
+// createEvent 在事务内写入订单事件
+func (m *orderStateMachine) createEvent(ctx context.Context, tx *gorm.DB, order *models.Order, from models.OrderStatus, t *OrderTransition, payload string) error {
+	event := &models.OrderEvent{
+		OrderID:    order.ID,
+		OrderNo:    order.OrderNo,
+		FromStatus: from,
+		ToStatus:   t.To,
+		Actor:      t.Actor,
+		Operator:   t.Operator,
+		Reason:     t.Reason,
+		Payload:    payload,
+	}
+	if err := m.orderEventRepo.WithTx(tx).Create(ctx, event); err != nil {
+		return fmt.Errorf("写入订单事件失败: %w", err)
+	}
+	return nil
+}
+
+// marshalOrderPayload 序列化第三方原始数据
+func marshalOrderPayload(payload interface{}) (string, error) {
+	if payload == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("序列化订单事件数据失败: %w", err)
+	}
+	if string(data) == "null" {
+		return "", nil
+	}
+	return string(data), nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to models.OrderStatus
+		allowed  bool
+	}{
+		{"", models.OrderStatusPending, true},
+		{"", models.OrderStatusCompleted, false},
+		{models.OrderStatusPending, models.OrderStatusPaid, true},
+		{models.OrderStatusPending, models.OrderStatusFailed, false},
+		{models.OrderStatusProcessing, models.OrderStatusCompleted, true},
+		{models.OrderStatusProcessing, models.OrderStatusFailed, true},
+		{models.OrderStatusCompleted, models.OrderStatusRefunded, true},
+		{models.OrderStatusCompleted, models.OrderStatusFailed, false},
+		{models.OrderStatusFailed, models.OrderStatusCompleted, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.allowed {
+			t.Errorf("%q -> %q = %v, 期望 %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+	if !models.OrderStatusFailed.IsTerminal() || models.OrderStatusCompleted.IsTerminal() {
+		t.Errorf("failed 应为终态，completed 可退款不是终态")
+	}
+}
+
+func TestOrderStateMachine(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	orderRepo := repository.NewOrderRepository(db)
+	machine := NewOrderStateMachine(db, orderRepo, repository.NewOrderEventRepository(db))
+
+	order := &models.Order{UserID: 1, ProductID: 1, Amount: "5.00"}
+	err := machine.Create(ctx, order, &OrderTransition{To: models.OrderStatusProcessing, Actor: models.OrderActorUser, Operator: "1", Reason: "用户下单"})
+	if err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+
+	// 普通更新不会改写状态
+	order.Status = models.OrderStatusCompleted
+	order.ProviderOrderID = "P1"
+	if err := orderRepo.Update(ctx, order); err != nil {
+		t.Fatalf("更新订单失败: %v", err)
+	}
+	stale, err := orderRepo.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	if stale.Status != models.OrderStatusProcessing || stale.ProviderOrderID != "P1" {
+		t.Fatalf("更新后订单 = %s/%s, 期望 processing/P1", stale.Status, stale.ProviderOrderID)
+	}
+	order.Status = models.OrderStatusProcessing
+
+	err = machine.Transition(ctx, order, &OrderTransition{
+		To:      models.OrderStatusCompleted,
+		Actor:   models.OrderActorSync,
+		Reason:  "第三方订单状态: completed",
+		Payload: &ProviderOrderData{OrderNumber: "P1", Status: "completed"},
+	})
+	if err != nil {
+		t.Fatalf("流转订单失败: %v", err)
+	}
+	if order.Status != models.OrderStatusCompleted || order.CompletedAt == nil {
+		t.Errorf("流转后订单 = %s, completed_at=%v", order.Status, order.CompletedAt)
+	}
+
+	// 旧快照仍为 processing，按数据库最新状态报告非法流转
+	err = machine.Transition(ctx, stale, &OrderTransition{To: models.OrderStatusFailed, Actor: models.OrderActorSync, Reason: "同步超时"})
+	var transitionErr *models.OrderTransitionError
+	if !errors.As(err, &transitionErr) || transitionErr.From != models.OrderStatusCompleted || transitionErr.To != models.OrderStatusFailed {
+		t.Fatalf("并发流转 = %v, 期望 completed -> failed 的 OrderTransitionError", err)
+	}
+	if err := machine.Transition(ctx, order, &OrderTransition{To: models.OrderStatusPaid, Actor: models.OrderActorAdmin}); !errors.As(err, &transitionErr) {
+		t.Errorf("非法流转 = %v, 期望 OrderTransitionError", err)
+	}
+
+	events, err := machine.GetEvents(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("查询订单事件失败: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("订单事件 %d 条, 期望 2 条", len(events))
+	}
+	created, completed := events[0], events[1]
+	if created.FromStatus != "" || created.ToStatus != models.OrderStatusProcessing || created.Actor != models.OrderActorUser || created.Operator != "1" {
+		t.Errorf("创建事件 = %+v", created)
+	}
+	if completed.FromStatus != models.OrderStatusProcessing || completed.ToStatus != models.OrderStatusCompleted ||
+		completed.Actor != models.OrderActorSync || completed.Payload == "" || completed.OrderNo != order.OrderNo {
+		t.Errorf("完成事件 = %+v", completed)
+	}
+}
+
+// TestOrderSettlementConcurrentOutcomes 同一订单并发完成与失败时只有一个结果生效，资金只结算一次
+func TestOrderSettlementConcurrentOutcomes(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+	order, _ := f.createOrder(t)
+
+	const rounds = 4
+	var wg sync.WaitGroup
+	results := make(chan error, rounds*2)
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			results <- f.orderService.ProcessOrderCompletion(ctx, order.OrderID, nil, models.OrderActorSync)
+		}()
+		go func() {
+			defer wg.Done()
+			results <- f.orderService.ProcessOrderFailure(ctx, order.OrderID, models.OrderActorWebhook, "第三方订单状态: failed", nil)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		var transitionErr *models.OrderTransitionError
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.As(err, &transitionErr):
+			t.Errorf("非预期错误: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("成功处理 %d 次, 期望 1 次", succeeded)
+	}
+
+	stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	switch stored.Status {
+	case models.OrderStatusCompleted:
+		f.assertWallet(t, "15.00000000", zeroAmount)
+	case models.OrderStatusFailed:
+		f.assertWallet(t, "20.00000000", zeroAmount)
+	default:
+		t.Fatalf("订单状态 = %s, 期望 completed 或 failed", stored.Status)
+	}
+}
@@ -2,14 +2,23 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/retry"
 	"tg-robot-sim/pkg/sdk/esim"
 	"tg-robot-sim/storage/models"
 	"tg-robot-sim/storage/repository"
 )
 
+// ErrOrderSyncBusy 订单正在被其他 worker 同步（持有同步租约），稍后重试
+var ErrOrderSyncBusy = errors.New("order sync in progress")
+
 // SyncResult 同步结果
 type SyncResult struct {
 	OrderID     uint   `json:"order_id"`
@@ -17,16 +26,32 @@ type SyncResult struct {
 	Message     string `json:"message"`
 	NewStatus   string `json:"new_status,omitempty"`
 	SyncAttempt int    `json:"sync_attempt"`
+
+	providerPending bool // 第三方确认订单仍在处理中，只有这种情况超时后才能失败退款
 }
 
+// syncErrorHistoryLimit 同步状态中返回的失败记录条数
+const syncErrorHistoryLimit = 20
+
 // SyncTaskStatus 同步任务状态
 type SyncTaskStatus struct {
-	OrderID      uint       `json:"order_id"`
-	IsRunning    bool       `json:"is_running"`
-	LastSyncAt   *time.Time `json:"last_sync_at"`
-	NextSyncAt   *time.Time `json:"next_sync_at"`
-	SyncAttempts int        `json:"sync_attempts"`
-	LastError    string     `json:"last_error,omitempty"`
+	OrderID         uint               `json:"order_id"`
+	OrderStatus     models.OrderStatus `json:"order_status"`
+	IsRunning       bool               `json:"is_running"`
+	LastSyncAt      *time.Time         `json:"last_sync_at"`
+	NextSyncAt      *time.Time         `json:"next_sync_at"`
+	SyncAttempts    int                `json:"sync_attempts"`
+	MaxSyncAttempts int                `json:"max_sync_attempts"`
+	TimeoutAt       time.Time          `json:"timeout_at"` // 订单仍在处理中时，超过该时间后标记为失败并退款
+	LastError       string             `json:"last_error,omitempty"`
+	Errors          []SyncErrorEntry   `json:"errors"` // 最近的同步失败记录，按时间倒序
+}
+
+// SyncErrorEntry 同步失败记录
+type SyncErrorEntry struct {
+	Attempt   int       `json:"attempt"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // OrderSyncService 定义订单同步服务接口
@@ -40,6 +65,10 @@ type OrderSyncService interface {
 	// SyncOrderStatus 手动同步订单状态
 	SyncOrderStatus(ctx context.Context, orderID uint) (*SyncResult, error)
 
+	// ApplyProviderOrder 按第三方推送的订单详情处理本地订单（Webhook），与 SyncOrderStatus 走相同的处理流程
+	// 处理前领取订单的同步租约，订单正在被轮询同步时返回 ErrOrderSyncBusy
+	ApplyProviderOrder(ctx context.Context, detail *esim.Order) (*SyncResult, error)
+
 	// GetSyncStatus 获取同步状态
 	GetSyncStatus(orderID uint) (*SyncTaskStatus, error)
 
@@ -50,24 +79,56 @@ type OrderSyncService interface {
 // orderSyncService 订单同步服务实现
 type orderSyncService struct {
 	orderRepo       repository.OrderRepository
+	syncErrorRepo   repository.OrderSyncErrorRepository
 	orderService    OrderService
 	esimClient      *esim.Client
-	syncInterval    time.Duration
+	backoff         *retry.RetryConfig
 	maxSyncAttempts int
+	orderTimeout    time.Duration
+
+	// notificationService 订单超时但无法确认第三方状态时发送运营告警，可为 nil
+	notificationService NotificationService
+
+	owner          string // 同步租约持有者标识（主机名-进程号）
+	workers        int
+	batchSize      int
+	requestTimeout time.Duration
+	lease          time.Duration
 }
 
 // NewOrderSyncService 创建订单同步服务实例
+// 每次同步后按 cfg.RetryConfig 指数退避（带随机抖动）安排下次同步；
+// 定时任务以 cfg.SyncWorkers 个 worker 并发同步，每个订单先领取同步租约，多实例部署时不会重复同步
 func NewOrderSyncService(
 	orderRepo repository.OrderRepository,
+	syncErrorRepo repository.OrderSyncErrorRepository,
 	orderService OrderService,
 	esimClient *esim.Client,
+	notificationService NotificationService,
+	cfg *config.OrderConfig,
 ) OrderSyncService {
+	hostname, _ := os.Hostname()
 	return &orderSyncService{
-		orderRepo:       orderRepo,
-		orderService:    orderService,
-		esimClient:      esimClient,
-		syncInterval:    10 * time.Second, // 默认10秒同步间隔
-		maxSyncAttempts: 100,              // 最大同步尝试次数
+		orderRepo:     orderRepo,
+		syncErrorRepo: syncErrorRepo,
+		orderService:  orderService,
+		esimClient:    esimClient,
+		backoff: &retry.RetryConfig{
+			InitialDelay:  cfg.RetryConfig.InitialDelay.ToDuration(),
+			MaxDelay:      cfg.RetryConfig.MaxDelay.ToDuration(),
+			BackoffFactor: cfg.RetryConfig.BackoffFactor,
+			Jitter:        cfg.RetryConfig.Jitter,
+		},
+		maxSyncAttempts: cfg.MaxSyncAttempts,
+		orderTimeout:    cfg.OrderTimeout.ToDuration(),
+
+		notificationService: notificationService,
+
+		owner:          fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		workers:        cfg.SyncWorkers,
+		batchSize:      cfg.SyncBatchSize,
+		requestTimeout: cfg.SyncRequestTimeout.ToDuration(),
+		lease:          cfg.SyncLease.ToDuration(),
 	}
 }
 
@@ -89,7 +150,7 @@ func (s *orderSyncService) StartSyncTask(ctx context.Context, orderID uint) erro
 	}
 
 	// 设置下次同步时间
-	nextSyncAt := time.Now().Add(s.syncInterval)
+	nextSyncAt := s.nextSyncAt(order.SyncAttempts)
 	return s.orderRepo.UpdateSyncInfo(ctx, orderID, order.SyncAttempts, &nextSyncAt)
 }
 
@@ -127,87 +188,139 @@ func (s *orderSyncService) SyncOrderStatus(ctx context.Context, orderID uint) (*
 	}
 
 	// 调用第三方 API 查询订单状态
-	providerOrder, err := s.esimClient.GetOrder(order.ProviderOrderNo)
+	callCtx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	providerOrder, err := s.esimClient.GetOrderContext(callCtx, order.ProviderOrderNo)
+	cancel()
 	if err != nil {
-		result.Success = false
-		result.Message = fmt.Sprintf("查询第三方订单失败: %v", err)
-
-		// 更新同步尝试次数
-		nextSyncAt := time.Now().Add(s.syncInterval)
-		s.orderRepo.UpdateSyncInfo(ctx, orderID, result.SyncAttempt, &nextSyncAt)
-
-		return result, nil
+		return s.syncFailed(ctx, result, fmt.Sprintf("查询第三方订单失败: %v", err)), nil
 	}
 
 	// 检查是否成功解析订单详情
 	if providerOrder.OrderDetail == nil {
+		return s.syncFailed(ctx, result, "第三方订单数据解析失败"), nil
+	}
+
+	return s.applyProviderOrder(ctx, orderID, providerOrder.OrderDetail, models.OrderActorSync, result), nil
+}
+
+// ApplyProviderOrder 按第三方推送的订单详情处理本地订单
+func (s *orderSyncService) ApplyProviderOrder(ctx context.Context, detail *esim.Order) (*SyncResult, error) {
+	order, err := s.orderRepo.GetByProviderOrderID(ctx, strconv.Itoa(detail.ID))
+	if err != nil {
+		return nil, fmt.Errorf("订单不存在: %w", err)
+	}
+
+	result := &SyncResult{
+		OrderID:     order.ID,
+		SyncAttempt: order.SyncAttempts + 1,
+	}
+	if order.Status != models.OrderStatusProcessing {
 		result.Success = false
-		result.Message = "第三方订单数据解析失败"
+		result.Message = fmt.Sprintf("订单状态不需要同步: %s", string(order.Status))
 		return result, nil
 	}
 
+	// 与轮询 worker 共用同步租约，同一订单同一时间只由一方处理
+	claimed, err := s.orderRepo.ClaimSyncOrder(ctx, order.ID, s.owner, s.lease)
+	if err != nil {
+		return nil, fmt.Errorf("领取订单同步租约失败: %w", err)
+	}
+	if !claimed {
+		return nil, ErrOrderSyncBusy
+	}
+	defer func() {
+		if err := s.orderRepo.ReleaseSyncClaim(context.WithoutCancel(ctx), order.ID, s.owner); err != nil {
+			fmt.Printf("[ERROR] Failed to release sync claim for order %d: %v\n", order.ID, err)
+		}
+	}()
+
+	return s.applyProviderOrder(ctx, order.ID, detail, models.OrderActorWebhook, result), nil
+}
+
+// applyProviderOrder 按第三方订单状态完成、失败或继续等待本地订单，轮询和 Webhook 共用
+func (s *orderSyncService) applyProviderOrder(ctx context.Context, orderID uint, detail *esim.Order, actor models.OrderEventActor, result *SyncResult) *SyncResult {
 	// 处理第三方订单状态
 	// 检查订单是否已完成：状态为 completed 或者 (状态为 paid 且有 eSIM 数据)
-	isCompleted := providerOrder.OrderDetail.Status == esim.OrderStatusCompleted ||
-		(providerOrder.OrderDetail.Status == esim.OrderStatusPaid && len(providerOrder.OrderDetail.Esims) > 0)
-
-	fmt.Printf("[DEBUG] Order sync - OrderID: %d, Status: %s, Esims count: %d, isCompleted: %v\n",
-		orderID, providerOrder.OrderDetail.Status, len(providerOrder.OrderDetail.Esims), isCompleted)
+	isCompleted := detail.Status == esim.OrderStatusCompleted ||
+		(detail.Status == esim.OrderStatusPaid && len(detail.Esims) > 0)
 
 	switch {
 	case isCompleted:
 		// 订单完成
-		fmt.Printf("[DEBUG] Processing order completion for order %d\n", orderID)
 		providerOrderData := &ProviderOrderData{
-			OrderID:     providerOrder.OrderDetail.ID,
-			OrderNumber: providerOrder.OrderDetail.OrderNumber,
-			Status:      string(providerOrder.OrderDetail.Status),
-			OrderItems:  convertOrderItems(providerOrder.OrderDetail.OrderItems),
-			Esims:       convertEsims(providerOrder.OrderDetail.Esims),
+			OrderID:     detail.ID,
+			OrderNumber: detail.OrderNumber,
+			Status:      string(detail.Status),
+			OrderItems:  convertOrderItems(detail.OrderItems),
+			Esims:       convertEsims(detail.Esims),
 		}
 
-		err = s.orderService.ProcessOrderCompletion(ctx, orderID, providerOrderData)
+		err := s.orderService.ProcessOrderCompletion(ctx, orderID, providerOrderData, actor)
 		if err != nil {
-			result.Success = false
-			result.Message = fmt.Sprintf("处理订单完成失败: %v", err)
 			fmt.Printf("[ERROR] Failed to process order completion: %v\n", err)
-		} else {
-			result.Success = true
-			result.Message = "订单处理完成"
-			result.NewStatus = string(models.OrderStatusCompleted)
-			fmt.Printf("[DEBUG] Order %d completed successfully\n", orderID)
+			return s.syncFailed(ctx, result, fmt.Sprintf("处理订单完成失败: %v", err))
 		}
+		result.Success = true
+		result.Message = "订单处理完成"
+		result.NewStatus = string(models.OrderStatusCompleted)
 
-	case providerOrder.OrderDetail.Status == esim.OrderStatusCancelled || providerOrder.OrderDetail.Status == esim.OrderStatusFailed:
+	case detail.Status == esim.OrderStatusCancelled || detail.Status == esim.OrderStatusFailed:
 		// 订单失败
-		reason := fmt.Sprintf("第三方订单状态: %s", providerOrder.OrderDetail.Status)
-		err = s.orderService.ProcessOrderFailure(ctx, orderID, reason)
+		reason := fmt.Sprintf("第三方订单状态: %s", detail.Status)
+		err := s.orderService.ProcessOrderFailure(ctx, orderID, actor, reason, detail)
 		if err != nil {
-			result.Success = false
-			result.Message = fmt.Sprintf("处理订单失败失败: %v", err)
-		} else {
-			result.Success = true
-			result.Message = "订单已标记为失败"
-			result.NewStatus = string(models.OrderStatusFailed)
+			return s.syncFailed(ctx, result, fmt.Sprintf("处理订单失败失败: %v", err))
 		}
-
-	case providerOrder.OrderDetail.Status == esim.OrderStatusPending ||
-		providerOrder.OrderDetail.Status == esim.OrderStatusPaid ||
-		providerOrder.OrderDetail.Status == esim.OrderStatusProcessing:
-		// 订单仍在处理中，继续等待
 		result.Success = true
-		result.Message = fmt.Sprintf("订单仍在处理中，第三方状态: %s", providerOrder.OrderDetail.Status)
-
-		// 设置下次同步时间
-		nextSyncAt := time.Now().Add(s.syncInterval)
-		s.orderRepo.UpdateSyncInfo(ctx, orderID, result.SyncAttempt, &nextSyncAt)
+		result.Message = "订单已标记为失败"
+		result.NewStatus = string(models.OrderStatusFailed)
+
+	case detail.Status == esim.OrderStatusPending ||
+		detail.Status == esim.OrderStatusPaid ||
+		detail.Status == esim.OrderStatusProcessing:
+		// 订单仍在处理中，继续等待；同步次数和时间是超时判断的依据，写入失败按同步失败处理
+		nextSyncAt := s.nextSyncAt(result.SyncAttempt)
+		if err := s.orderRepo.UpdateSyncInfo(ctx, orderID, result.SyncAttempt, &nextSyncAt); err != nil {
+			return s.syncFailed(ctx, result, fmt.Sprintf("更新同步信息失败: %v", err))
+		}
+		result.Success = true
+		result.providerPending = true
+		result.Message = fmt.Sprintf("订单仍在处理中，第三方状态: %s", detail.Status)
 
 	default:
-		result.Success = false
-		result.Message = fmt.Sprintf("未知的第三方订单状态: %s", providerOrder.OrderDetail.Status)
+		return s.syncFailed(ctx, result, fmt.Sprintf("未知的第三方订单状态: %s", detail.Status))
+	}
+
+	return result
+}
+
+// syncFailed 记录同步失败原因并按退避间隔安排下次同步
+func (s *orderSyncService) syncFailed(ctx context.Context, result *SyncResult, message string) *SyncResult {
+	result.Success = false
+	result.Message = message
+
+	syncError := &models.OrderSyncError{
+		OrderID: result.OrderID,
+		Attempt: result.SyncAttempt,
+		Message: message,
+	}
+	if err := s.syncErrorRepo.Create(ctx, syncError); err != nil {
+		fmt.Printf("[ERROR] Failed to record sync error for order %d: %v\n", result.OrderID, err)
 	}
 
-	return result, nil
+	nextSyncAt := s.nextSyncAt(result.SyncAttempt)
+	if err := s.orderRepo.UpdateSyncInfo(ctx, result.OrderID, result.SyncAttempt, &nextSyncAt); err != nil {
+		fmt.Printf("[ERROR] Failed to update sync info for order %d: %v\n", result.OrderID, err)
+	}
+	return result
+}
+
+// nextSyncAt 计算第 attempts 次同步后的下次同步时间
+func (s *orderSyncService) nextSyncAt(attempts int) time.Time {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return time.Now().Add(s.backoff.Delay(attempts - 1))
 }
 
 // GetSyncStatus 获取同步状态
@@ -218,50 +331,138 @@ func (s *orderSyncService) GetSyncStatus(orderID uint) (*SyncTaskStatus, error)
 		return nil, fmt.Errorf("订单不存在: %w", err)
 	}
 
+	syncErrors, err := s.syncErrorRepo.GetRecentByOrderID(ctx, orderID, syncErrorHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("获取同步失败记录失败: %w", err)
+	}
+
 	status := &SyncTaskStatus{
-		OrderID:      orderID,
-		IsRunning:    order.Status == models.OrderStatusProcessing && order.NextSyncAt != nil,
-		LastSyncAt:   order.LastSyncAt,
-		NextSyncAt:   order.NextSyncAt,
-		SyncAttempts: order.SyncAttempts,
+		OrderID:         orderID,
+		OrderStatus:     order.Status,
+		IsRunning:       order.Status == models.OrderStatusProcessing && order.ProviderOrderID != "",
+		LastSyncAt:      order.LastSyncAt,
+		NextSyncAt:      order.NextSyncAt,
+		SyncAttempts:    order.SyncAttempts,
+		MaxSyncAttempts: s.maxSyncAttempts,
+		TimeoutAt:       order.CreatedAt.Add(s.orderTimeout),
+		Errors:          make([]SyncErrorEntry, 0, len(syncErrors)),
+	}
+	for _, syncError := range syncErrors {
+		status.Errors = append(status.Errors, SyncErrorEntry{
+			Attempt:   syncError.Attempt,
+			Message:   syncError.Message,
+			CreatedAt: syncError.CreatedAt,
+		})
+	}
+	if len(syncErrors) > 0 {
+		status.LastError = syncErrors[0].Message
 	}
 
 	return status, nil
 }
 
 // ProcessPendingOrders 处理所有待处理订单（定时任务）
+// 逐个领取订单的同步租约后交给 worker 并发同步，每轮最多同步 batchSize 个订单；
+// 订单在 worker 空闲时才领取，租约从领取时开始计算，不会因排队而过期。
+// 超过最大同步次数，或超过订单超时时间且最后一次同步后仍在处理中的订单，标记为失败并退款；
+// 订单只在到达下次同步时间时检查，超时最多延后一个最大退避间隔
 func (s *orderSyncService) ProcessPendingOrders(ctx context.Context) error {
-	// 获取需要同步的订单
-	orders, err := s.orderRepo.GetPendingSyncOrders(ctx, 50) // 每次处理50个订单
-	if err != nil {
-		return fmt.Errorf("获取待同步订单失败: %w", err)
+	orders := make(chan *models.Order)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range orders {
+				s.syncClaimedOrder(ctx, order)
+			}
+		}()
 	}
 
-	fmt.Printf("开始处理 %d 个待同步订单\n", len(orders))
-
-	for _, order := range orders {
-		// 检查是否超过最大尝试次数
-		if order.SyncAttempts >= s.maxSyncAttempts {
-			// 超过最大尝试次数，标记为失败
-			s.orderService.ProcessOrderFailure(ctx, order.ID, "同步超时，超过最大尝试次数")
-			continue
-		}
-
-		// 同步订单状态
-		result, err := s.SyncOrderStatus(ctx, order.ID)
+	var claimErr error
+	claimed := 0
+	for claimed < s.batchSize && ctx.Err() == nil {
+		// 每次只领取一个订单，没有可领取的订单（或均已被其他实例领取）时结束本轮
+		batch, err := s.orderRepo.ClaimPendingSyncOrders(ctx, s.owner, s.lease, 1)
 		if err != nil {
-			fmt.Printf("同步订单 %d 失败: %v\n", order.ID, err)
-			continue
+			claimErr = fmt.Errorf("领取待同步订单失败: %w", err)
+			break
+		}
+		if len(batch) == 0 {
+			break
 		}
+		claimed++
+		orders <- batch[0]
+	}
+	close(orders)
+	wg.Wait()
+
+	return claimErr
+}
 
-		if result.Success {
-			fmt.Printf("订单 %d 同步成功: %s\n", order.ID, result.Message)
-		} else {
-			fmt.Printf("订单 %d 同步失败: %s\n", order.ID, result.Message)
+// syncClaimedOrder 同步已领取租约的订单，完成后释放租约
+func (s *orderSyncService) syncClaimedOrder(ctx context.Context, order *models.Order) {
+	defer func() {
+		// 本轮已超时也要释放租约，避免订单在租约到期前无法被领取
+		if err := s.orderRepo.ReleaseSyncClaim(context.WithoutCancel(ctx), order.ID, s.owner); err != nil {
+			fmt.Printf("[ERROR] Failed to release sync claim for order %d: %v\n", order.ID, err)
 		}
+	}()
+
+	// 同步订单状态
+	result, err := s.SyncOrderStatus(ctx, order.ID)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to sync order %d: %v\n", order.ID, err)
+		return
+	}
+	if !result.Success {
+		fmt.Printf("[WARNING] Order %d sync failed: %s\n", order.ID, result.Message)
+	}
+	if result.NewStatus != "" {
+		return
+	}
+
+	var reason string
+	switch {
+	case order.SyncAttempts >= s.maxSyncAttempts:
+		reason = "同步超时，超过最大尝试次数"
+	case time.Since(order.CreatedAt) >= s.orderTimeout:
+		reason = "订单处理超时"
+	default:
+		return
+	}
+
+	// 只有第三方确认订单仍未完成时才标记失败并退款；
+	// 查询失败、状态未知或第三方已完成但本地处理失败时，第三方可能已经出卡，交由人工核查
+	if result.providerPending {
+		s.failStuckOrder(ctx, order, reason)
+		return
+	}
+	s.alertStuckOrder(ctx, order, reason, result.Message)
+}
+
+// alertStuckOrder 订单已超时但无法确认第三方状态，发送运营告警，订单保持处理中继续同步
+func (s *orderSyncService) alertStuckOrder(ctx context.Context, order *models.Order, reason, lastError string) {
+	alert := fmt.Sprintf("订单 %s %s，但无法确认第三方订单状态，需人工核查\n第三方订单: %s\n同步次数: %d\n最近错误: %s",
+		order.OrderNo, reason, order.ProviderOrderNo, order.SyncAttempts+1, lastError)
+	fmt.Printf("[ERROR] %s\n", alert)
+	if s.notificationService == nil {
+		return
+	}
+	if err := s.notificationService.SendAdminAlert(ctx, alert); err != nil {
+		fmt.Printf("[ERROR] Failed to send stuck order alert for order %d: %v\n", order.ID, err)
 	}
+}
 
-	return nil
+// failStuckOrder 将长时间未完成的订单标记为失败并退还冻结金额
+func (s *orderSyncService) failStuckOrder(ctx context.Context, order *models.Order, reason string) {
+	payload := map[string]interface{}{
+		"sync_attempts": order.SyncAttempts,
+		"created_at":    order.CreatedAt,
+	}
+	if err := s.orderService.ProcessOrderFailure(ctx, order.ID, models.OrderActorSync, reason, payload); err != nil {
+		fmt.Printf("[ERROR] Failed to fail stuck order %d: %v\n", order.ID, err)
+	}
 }
 
 // convertOrderItems 转换订单项数据格式
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/sdk/esim"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestOrderSyncBackoffAndTimeout 同步失败记录历史并按指数退避安排下次同步，第三方确认超时仍未完成的订单才失败退款
+func TestOrderSyncBackoffAndTimeout(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	var providerStatus atomic.Value
+	providerStatus.Store("error")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if providerStatus.Load() == "error" {
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"success":false,"message":"upstream unavailable"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"success":true,"data":{"id":9001,"orderNumber":"P-9001","status":%q}}`, providerStatus.Load())
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultOrderConfig()
+	cfg.RetryConfig.Jitter = 0
+	syncService := NewOrderSyncService(
+		f.orderRepo,
+		repository.NewOrderSyncErrorRepository(f.db),
+		f.orderService,
+		esim.NewClient(esim.Config{BaseURL: server.URL}),
+		nil,
+		&cfg,
+	)
+
+	order, _ := f.createOrder(t)
+	if _, err := f.orderRepo.SetProviderOrder(ctx, order.OrderID, "9001", "P-9001"); err != nil {
+		t.Fatalf("保存第三方订单失败: %v", err)
+	}
+
+	// 运行一轮同步，返回同步后的订单和距下次同步的时间
+	syncOnce := func() (*models.Order, time.Duration) {
+		t.Helper()
+		if err := syncService.ProcessPendingOrders(ctx); err != nil {
+			t.Fatalf("同步订单失败: %v", err)
+		}
+		stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+		if err != nil {
+			t.Fatalf("查询订单失败: %v", err)
+		}
+		if stored.NextSyncAt == nil {
+			return stored, 0
+		}
+		return stored, time.Until(*stored.NextSyncAt)
+	}
+	makeDue := func(updates map[string]interface{}) {
+		updates["next_sync_at"] = time.Now().Add(-time.Second)
+		f.db.Model(&models.Order{}).Where("id = ?", order.OrderID).Updates(updates)
+	}
+	assertDelay := func(got, want time.Duration) {
+		t.Helper()
+		if got < want-time.Second || got > want {
+			t.Errorf("下次同步间隔 = %v, 期望约 %v", got, want)
+		}
+	}
+
+	stored, delay := syncOnce()
+	if stored.SyncAttempts != 1 {
+		t.Fatalf("同步次数 = %d, 期望 1", stored.SyncAttempts)
+	}
+	assertDelay(delay, 2*time.Second)
+
+	status, err := syncService.GetSyncStatus(order.OrderID)
+	if err != nil {
+		t.Fatalf("获取同步状态失败: %v", err)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].Attempt != 1 || !strings.Contains(status.LastError, "查询第三方订单失败") {
+		t.Errorf("同步状态 = %+v, 期望记录第 1 次同步失败", status)
+	}
+
+	// 第三方仍在处理中：不记录失败，间隔翻倍
+	providerStatus.Store(string(esim.OrderStatusProcessing))
+	makeDue(map[string]interface{}{})
+	stored, delay = syncOnce()
+	if stored.SyncAttempts != 2 || stored.Status != models.OrderStatusProcessing {
+		t.Fatalf("订单 = %d/%s, 期望 2/processing", stored.SyncAttempts, stored.Status)
+	}
+	assertDelay(delay, 4*time.Second)
+
+	// 超过订单超时时间但查询第三方失败：无法确认状态，不退款，订单继续同步
+	providerStatus.Store("error")
+	makeDue(map[string]interface{}{"created_at": time.Now().Add(-cfg.OrderTimeout.ToDuration() - time.Minute)})
+	stored, _ = syncOnce()
+	if stored.Status != models.OrderStatusProcessing || stored.SyncAttempts != 3 {
+		t.Fatalf("查询失败的超时订单 = %d/%s, 期望 3/processing", stored.SyncAttempts, stored.Status)
+	}
+	f.assertWallet(t, "15.00000000", "5.00000000")
+
+	// 第三方确认仍未完成：标记失败并退款
+	providerStatus.Store(string(esim.OrderStatusProcessing))
+	makeDue(map[string]interface{}{})
+	stored, _ = syncOnce()
+	if stored.Status != models.OrderStatusFailed {
+		t.Fatalf("超时订单状态 = %s, 期望 failed", stored.Status)
+	}
+	f.assertWallet(t, "20.00000000", zeroAmount)
+
+	status, err = syncService.GetSyncStatus(order.OrderID)
+	if err != nil {
+		t.Fatalf("获取同步状态失败: %v", err)
+	}
+	if status.IsRunning || len(status.Errors) != 2 || status.SyncAttempts != 4 {
+		t.Errorf("超时后同步状态 = %+v", status)
+	}
+}
+
+// TestOrderSyncConcurrentInstances 两个实例同时同步时每个订单只查询一次第三方，查询超时记录为同步失败
+func TestOrderSyncConcurrentInstances(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orderNo := strings.TrimPrefix(r.URL.Path, "/api/v1/orders/")
+		mu.Lock()
+		requests[orderNo]++
+		mu.Unlock()
+
+		if orderNo == "P-3" {
+			// 第三方无响应，直到请求超时
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, `{"success":true,"data":{"id":1,"orderNumber":%q,"status":"completed"}}`, orderNo)
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultOrderConfig()
+	cfg.SyncRequestTimeout = config.Duration(300 * time.Millisecond)
+	newInstance := func() OrderSyncService {
+		return NewOrderSyncService(
+			f.orderRepo,
+			repository.NewOrderSyncErrorRepository(f.db),
+			f.orderService,
+			esim.NewClient(esim.Config{BaseURL: server.URL}),
+			nil,
+			&cfg,
+		)
+	}
+
+	orderIDs := make([]uint, 0, 3)
+	for i := 1; i <= 3; i++ {
+		order, _ := f.createOrder(t)
+		providerNo := fmt.Sprintf("P-%d", i)
+		if _, err := f.orderRepo.SetProviderOrder(ctx, order.OrderID, providerNo, providerNo); err != nil {
+			t.Fatalf("保存第三方订单失败: %v", err)
+		}
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+
+	instances := []OrderSyncService{newInstance(), newInstance()}
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(instance OrderSyncService) {
+			defer wg.Done()
+			if err := instance.ProcessPendingOrders(ctx); err != nil {
+				t.Errorf("同步订单失败: %v", err)
+			}
+		}(instance)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for orderNo, count := range requests {
+		if count != 1 {
+			t.Errorf("订单 %s 查询第三方 %d 次, 期望 1 次", orderNo, count)
+		}
+	}
+	if len(requests) != 3 {
+		t.Errorf("查询了 %d 个订单, 期望 3 个", len(requests))
+	}
+
+	for i, orderID := range orderIDs {
+		stored, err := f.orderRepo.GetByID(ctx, orderID)
+		if err != nil {
+			t.Fatalf("查询订单失败: %v", err)
+		}
+		want := models.OrderStatusCompleted
+		if i == 2 {
+			want = models.OrderStatusProcessing
+		}
+		if stored.Status != want || stored.ClaimedBy != "" || stored.ClaimedUntil != nil {
+			t.Errorf("订单 %d = %s/%q, 期望 %s 且已释放租约", orderID, stored.Status, stored.ClaimedBy, want)
+		}
+	}
+
+	status, err := instances[0].GetSyncStatus(orderIDs[2])
+	if err != nil {
+		t.Fatalf("获取同步状态失败: %v", err)
+	}
+	if len(status.Errors) != 1 || !strings.Contains(status.LastError, "查询第三方订单失败") {
+		t.Errorf("超时订单同步状态 = %+v, 期望记录查询失败", status)
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrphanDepositNotFound 孤儿充值不存在
+	ErrOrphanDepositNotFound = errors.New("orphan deposit not found")
+	// ErrOrphanDepositAssigned 孤儿充值已分配
+	ErrOrphanDepositAssigned = errors.New("orphan deposit already assigned")
+)
+
+// OrphanDepositService 孤儿充值服务接口
+// 无法自动入账的链上转账（无匹配订单、少付暂不入账）由管理员核实后分配给用户
+type OrphanDepositService interface {
+	// ListOrphanDeposits 按状态列出孤儿充值，status 为空时返回全部
+	ListOrphanDeposits(ctx context.Context, status string, limit, offset int) ([]*models.OrphanDeposit, error)
+
+	// AssignOrphanDeposit 将孤儿充值分配给用户并按实收数量折算入账
+	// 关联了充值订单的按订单汇率折算，否则按资产当前汇率折算
+	AssignOrphanDeposit(ctx context.Context, id uint, userID int64, operator, note string) (*models.OrphanDeposit, error)
+}
+
+// orphanDepositService 孤儿充值服务实现
+type orphanDepositService struct {
+	orphanRepo    repository.OrphanDepositRepository
+	rechargeRepo  repository.RechargeOrderRepository
+	assetService  AssetService
+	ledgerService LedgerService
+	db            *gorm.DB
+}
+
+// NewOrphanDepositService 创建孤儿充值服务实例
+func NewOrphanDepositService(
+	orphanRepo repository.OrphanDepositRepository,
+	rechargeRepo repository.RechargeOrderRepository,
+	assetService AssetService,
+	ledgerService LedgerService,
+	db *gorm.DB,
+) OrphanDepositService {
+	return &orphanDepositService{
+		orphanRepo:    orphanRepo,
+		rechargeRepo:  rechargeRepo,
+		assetService:  assetService,
+		ledgerService: ledgerService,
+		db:            db,
+	}
+}
+
+// ListOrphanDeposits 按状态列出孤儿充值
+func (s *orphanDepositService) ListOrphanDeposits(ctx context.Context, status string, limit, offset int) ([]*models.OrphanDeposit, error) {
+	deposits, err := s.orphanRepo.GetByStatus(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("获取孤儿充值失败: %w", err)
+	}
+	return deposits, nil
+}
+
+// AssignOrphanDeposit 分配孤儿充值
+// 分配信息、账本分录和钱包流水在同一事务中写入；以待处理状态作为条件更新，同一笔转账只会入账一次
+func (s *orphanDepositService) AssignOrphanDeposit(ctx context.Context, id uint, userID int64, operator, note string) (*models.OrphanDeposit, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, errors.New("分配备注不能为空")
+	}
+	if userID <= 0 {
+		return nil, errors.New("用户 ID 无效")
+	}
+
+	deposit, err := s.orphanRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrphanDepositNotFound
+		}
+		return nil, fmt.Errorf("获取孤儿充值失败: %w", err)
+	}
+	if deposit.Status != models.OrphanStatusPending {
+		return nil, fmt.Errorf("%w: 已分配给用户 %d", ErrOrphanDepositAssigned, deposit.AssignedUserID)
+	}
+
+	rate, err := s.depositRate(ctx, deposit)
+	if err != nil {
+		return nil, err
+	}
+	creditAmount, err := pricingAmount(deposit.Amount, rate)
+	if err != nil {
+		return nil, fmt.Errorf("折算到账金额失败: %w", err)
+	}
+	if amount, _ := parseDecimal(creditAmount); amount.Sign() <= 0 {
+		return nil, fmt.Errorf("实收金额过小: %s %s", deposit.Amount, deposit.Asset)
+	}
+
+	now := time.Now()
+	deposit.AssignedUserID = userID
+	deposit.CreditedAmount = creditAmount
+	deposit.Operator = operator
+	deposit.Note = note
+	deposit.AssignedAt = &now
+
+	relatedID := fmt.Sprintf("orphan-%d", deposit.ID)
+	remark := fmt.Sprintf("孤儿充值分配，交易: %s，支付 %s %s，汇率 %s，操作人: %s，备注: %s",
+		deposit.TxHash, deposit.Amount, deposit.Asset, rate, operator, note)
+
+	err = RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// 已被充值订单使用的交易不能再分配
+			var used int64
+			if err := tx.Model(&models.RechargeOrder{}).Where("tx_hash = ?", deposit.TxHash).Count(&used).Error; err != nil {
+				return fmt.Errorf("检查交易哈希失败: %w", err)
+			}
+			if used > 0 {
+				return fmt.Errorf("交易哈希已被充值订单使用")
+			}
+
+			updated, err := s.orphanRepo.WithTx(tx).MarkAssigned(ctx, deposit)
+			if err != nil {
+				return fmt.Errorf("更新孤儿充值失败: %w", err)
+			}
+			if !updated {
+				return ErrOrphanDepositAssigned
+			}
+
+			posting := NewLedgerTransfer(
+				userID,
+				models.LedgerEntryTypeRecharge,
+				models.LedgerAccountDepositClearing,
+				models.LedgerAccountUserAvailable,
+				creditAmount,
+				relatedID,
+				remark,
+			)
+			posting.Idempotent = true
+
+			result, err := s.ledgerService.PostInTx(ctx, tx, posting)
+			if err != nil {
+				return fmt.Errorf("更新钱包余额失败: %w", err)
+			}
+
+			history := &models.WalletHistory{
+				UserID:        userID,
+				Type:          models.WalletHistoryTypeRecharge,
+				Amount:        creditAmount,
+				BalanceBefore: result.WalletBefore.Balance,
+				BalanceAfter:  result.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   remark,
+				RelatedType:   "orphan_deposit",
+				RelatedID:     relatedID,
+				TxHash:        deposit.TxHash,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return fmt.Errorf("创建充值记录失败: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deposit.Status = models.OrphanStatusAssigned
+	return deposit, nil
+}
+
+// depositRate 孤儿充值的折算汇率：少付关联的订单使用下单汇率，否则使用资产当前汇率
+func (s *orphanDepositService) depositRate(ctx context.Context, deposit *models.OrphanDeposit) (string, error) {
+	if deposit.RechargeNo != "" {
+		order, err := s.rechargeRepo.GetByOrderNo(ctx, deposit.RechargeNo)
+		if err == nil {
+			return order.Rate, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("获取关联充值订单失败: %w", err)
+		}
+	}
+
+	asset, err := s.assetService.GetAsset(ctx, deposit.Asset)
+	if err != nil {
+		return "", err
+	}
+	return asset.UsdRate, nil
+}
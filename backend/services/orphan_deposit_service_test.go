@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestDepositClassificationAndOrphanAssign 超额、少付、逾期到账的入账方式，以及孤儿充值的分配
+func TestDepositClassificationAndOrphanAssign(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	addressService, err := NewHDDepositAddressService(db, repository.NewDepositAddressRepository(db), testAccountXPub)
+	if err != nil {
+		t.Fatalf("创建充值地址服务失败: %v", err)
+	}
+
+	walletRepo := repository.NewWalletRepository(db)
+	rechargeRepo := repository.NewRechargeOrderRepository(db)
+	orphanRepo := repository.NewOrphanDepositRepository(db)
+	assetService := NewAssetService(repository.NewAssetRepository(db))
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	tron := &fakeChainService{chain: models.ChainTron}
+	newService := func(policy string) RechargeService {
+		return NewRechargeService(
+			rechargeRepo,
+			repository.NewTransactionRepository(db),
+			repository.NewDepositCursorRepository(db),
+			orphanRepo,
+			assetService,
+			nil,
+			walletRepo,
+			map[string]*DepositChain{
+				models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: NewConfirmationPolicy(19, nil), Addresses: addressService},
+			},
+			nil,
+			nil,
+			ledgerService,
+			db,
+			1, 1000,
+			policy,
+			0,
+		)
+	}
+	holdService := newService(config.UnderpaymentPolicyHold)
+
+	createOrder := func(userID int64) *models.RechargeOrder {
+		order, err := holdService.CreateRechargeOrder(ctx, userID, "10", models.AssetUSDTTRC20)
+		if err != nil {
+			t.Fatalf("创建充值订单失败: %v", err)
+		}
+		return order
+	}
+	over := createOrder(1)
+	under := createOrder(2)
+	late := createOrder(3)
+	credited := createOrder(4)
+	lateUnder := createOrder(5)
+
+	// 订单 late 和 lateUnder 已过期，转账在过期之后才到账
+	for _, order := range []*models.RechargeOrder{late, lateUnder} {
+		order.ExpiresAt = time.Now().Add(-time.Hour)
+		order.Status = models.RechargeStatusExpired
+		if err := rechargeRepo.Update(ctx, order); err != nil {
+			t.Fatalf("更新订单失败: %v", err)
+		}
+	}
+
+	now := time.Now()
+	tron.transactions = []*TransactionInfo{
+		{TxHash: "tx-over", ToAddress: over.WalletAddress, Amount: "12", TokenSymbol: "USDT", Confirmations: 19, Timestamp: now},
+		{TxHash: "tx-under", ToAddress: under.WalletAddress, Amount: "9", TokenSymbol: "USDT", Confirmations: 19, Timestamp: now},
+		{TxHash: "tx-late", ToAddress: late.WalletAddress, Amount: "10", TokenSymbol: "USDT", Confirmations: 19, Timestamp: now},
+		{TxHash: "tx-late-under", ToAddress: lateUnder.WalletAddress, Amount: "8", TokenSymbol: "USDT", Confirmations: 19, Timestamp: now},
+		{TxHash: "tx-stray", ToAddress: "TDepositAddress", Amount: "5", TokenSymbol: "USDT", Confirmations: 19, Timestamp: now},
+	}
+	if err := holdService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+
+	// 下单金额保持不变，入账金额单独记录
+	assertOrder := func(order *models.RechargeOrder, status models.RechargeStatus, paymentType, credited string) {
+		t.Helper()
+		current, err := holdService.GetRechargeOrder(ctx, order.OrderNo)
+		if err != nil {
+			t.Fatalf("获取充值订单失败: %v", err)
+		}
+		if current.Status != status || current.PaymentType != paymentType ||
+			normalizeAmount(current.Amount) != normalizeAmount("10") || normalizeAmount(current.CreditedAmount) != normalizeAmount(credited) {
+			t.Errorf("订单 %s 状态 = %s, 到账类型 = %q, 金额 = %s, 入账金额 = %q; 期望 %s, %q, 10, %q",
+				order.OrderNo, current.Status, current.PaymentType, current.Amount, current.CreditedAmount, status, paymentType, credited)
+		}
+	}
+	assertBalance := func(userID int64, want string) {
+		t.Helper()
+		wallet, err := walletRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			if want == "0" {
+				return
+			}
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if normalizeAmount(wallet.Balance) != normalizeAmount(want) {
+			t.Errorf("用户 %d 余额 = %s, 期望 %s", userID, wallet.Balance, want)
+		}
+	}
+
+	assertOrder(over, models.RechargeStatusConfirmed, models.RechargePaymentOver, "12")
+	assertOrder(under, models.RechargeStatusPending, "", "")
+	assertOrder(late, models.RechargeStatusConfirmed, models.RechargePaymentLate, "10")
+	assertBalance(1, "12")
+	assertBalance(2, "0")
+	assertBalance(3, "10")
+	// 逾期少付同样按少付策略暂不入账
+	assertOrder(lateUnder, models.RechargeStatusExpired, "", "")
+	assertBalance(5, "0")
+
+	orphans, err := orphanRepo.GetByStatus(ctx, models.OrphanStatusPending, 0, 0)
+	if err != nil {
+		t.Fatalf("获取孤儿充值失败: %v", err)
+	}
+	byTx := make(map[string]*models.OrphanDeposit)
+	for _, orphan := range orphans {
+		byTx[orphan.TxHash] = orphan
+	}
+	if len(orphans) != 3 || byTx["tx-under"] == nil || byTx["tx-late-under"] == nil || byTx["tx-stray"] == nil {
+		t.Fatalf("孤儿充值 = %+v, 期望少付两笔、无匹配订单一笔", orphans)
+	}
+	if byTx["tx-under"].Reason != models.OrphanReasonUnderpaid || byTx["tx-under"].RechargeNo != under.OrderNo {
+		t.Errorf("少付孤儿充值 = %+v", byTx["tx-under"])
+	}
+	if byTx["tx-late-under"].Reason != models.OrphanReasonUnderpaid || byTx["tx-late-under"].RechargeNo != lateUnder.OrderNo {
+		t.Errorf("逾期少付孤儿充值 = %+v", byTx["tx-late-under"])
+	}
+	if byTx["tx-stray"].Reason != models.OrphanReasonUnmatched {
+		t.Errorf("无匹配孤儿充值 = %+v", byTx["tx-stray"])
+	}
+
+	// 少付策略为 credit 时按实收入账
+	tron.transactions = append(tron.transactions,
+		&TransactionInfo{TxHash: "tx-partial", ToAddress: credited.WalletAddress, Amount: "7.5", TokenSymbol: "USDT", Confirmations: 19, Timestamp: time.Now()})
+	if err := newService(config.UnderpaymentPolicyCredit).ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	assertOrder(credited, models.RechargeStatusConfirmed, models.RechargePaymentUnder, "7.5")
+	assertBalance(4, "7.5")
+
+	// 管理员核实后分配孤儿充值，同一笔只能分配一次
+	orphanService := NewOrphanDepositService(orphanRepo, rechargeRepo, assetService, ledgerService, db)
+	if _, err := orphanService.AssignOrphanDeposit(ctx, byTx["tx-stray"].ID, 5, "admin", ""); err == nil {
+		t.Errorf("缺少分配备注应返回错误")
+	}
+	assigned, err := orphanService.AssignOrphanDeposit(ctx, byTx["tx-stray"].ID, 5, "admin", "用户提供转账截图")
+	if err != nil {
+		t.Fatalf("分配孤儿充值失败: %v", err)
+	}
+	if assigned.Status != models.OrphanStatusAssigned || normalizeAmount(assigned.CreditedAmount) != normalizeAmount("5") {
+		t.Errorf("分配结果 = %+v", assigned)
+	}
+	if _, err := orphanService.AssignOrphanDeposit(ctx, byTx["tx-stray"].ID, 6, "admin", "重复分配"); !errors.Is(err, ErrOrphanDepositAssigned) {
+		t.Errorf("重复分配错误 = %v, 期望 ErrOrphanDepositAssigned", err)
+	}
+	if _, err := orphanService.AssignOrphanDeposit(ctx, byTx["tx-under"].ID, 2, "admin", "少付部分人工入账"); err != nil {
+		t.Fatalf("分配少付充值失败: %v", err)
+	}
+	assertBalance(5, "5")
+	assertBalance(6, "0")
+	assertBalance(2, "9")
+
+	stored, err := orphanRepo.GetByID(ctx, byTx["tx-stray"].ID)
+	if err != nil {
+		t.Fatalf("获取孤儿充值失败: %v", err)
+	}
+	if stored.AssignedUserID != 5 || stored.Operator != "admin" || stored.AssignedAt == nil {
+		t.Errorf("分配审计信息 = %+v", stored)
+	}
+
+	// 分配入账的钱包流水应通过对账
+	reconciliation := NewReconciliationService(walletRepo, repository.NewWalletHistoryRepository(db), rechargeRepo,
+		repository.NewOrderRepository(db), repository.NewWithdrawalRepository(db), repository.NewLedgerRepository(db), ledgerService)
+	for _, userID := range []int64{1, 2, 3, 4, 5} {
+		result, err := reconciliation.ReconcileUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("对账失败: %v", err)
+		}
+		if normalizeAmount(result.BalanceDiff) != normalizeAmount("0") || result.CacheMismatch {
+			t.Errorf("用户 %d 对账结果不平: %+v", userID, result)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"tg-robot-sim/pkg/retry"
+	"tg-robot-sim/pkg/sdk/esim"
+	service_common "tg-robot-sim/services/common"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+const (
+	providerOrderLease       = 2 * time.Minute  // 任务租约，超过后视为执行实例已崩溃，任务可被重新领取
+	providerOrderCallTimeout = 30 * time.Second // 单次调用第三方接口的超时时间，需小于租约
+	providerOrderMaxAttempts = 5                // 最多调用第三方接口的次数，用尽后退款或转人工核查
+	providerOrderBatchSize   = 20               // 每轮最多执行的任务数
+)
+
+// errProviderOrderRejected 第三方明确拒绝下单（或未调用第三方接口），可以确认没有创建第三方订单
+// 其他错误（超时、连接错误、响应缺少订单号）无法确认第三方是否已下单
+var errProviderOrderRejected = errors.New("第三方拒绝下单")
+
+// providerOrderBackoff 第三方下单失败后的重试间隔：10s、20s、40s……最长 5 分钟
+var providerOrderBackoff = &retry.RetryConfig{
+	InitialDelay:  10 * time.Second,
+	MaxDelay:      5 * time.Minute,
+	BackoffFactor: 2.0,
+	Jitter:        0.1,
+}
+
+// providerOrderPayload 第三方下单任务参数，在下单事务内确定，执行时不再读取可能已变化的商品信息
+type providerOrderPayload struct {
+	ProductID     int    `json:"product_id"` // 第三方产品ID
+	CustomerEmail string `json:"customer_email"`
+	Quantity      int    `json:"quantity"`
+}
+
+// providerOrderResult 第三方下单任务结果
+type providerOrderResult struct {
+	ProviderOrderID string `json:"provider_order_id,omitempty"`
+	ProviderOrderNo string `json:"provider_order_no,omitempty"`
+	Skipped         string `json:"skipped,omitempty"` // 未调用第三方接口的原因
+}
+
+// newProviderOrderPayload 构造第三方下单任务参数
+func newProviderOrderPayload(product *models.Product, req *CreateEsimOrderRequest) (string, error) {
+	var productID int
+	if _, err := fmt.Sscanf(product.ThirdPartyID, "%d", &productID); err != nil {
+		return "", fmt.Errorf("无效的第三方产品ID: %w", err)
+	}
+
+	data, err := json.Marshal(&providerOrderPayload{
+		ProductID:     productID,
+		CustomerEmail: req.CustomerEmail,
+		Quantity:      req.Quantity,
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化第三方下单参数失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// ProviderOrderWorker 第三方下单后台任务
+// 执行下单事务写入的发件箱任务：携带订单号作为商户引用调用第三方接口并保存第三方订单信息，
+// 失败按指数退避重试。重试耗尽后，只有每次调用都被第三方明确拒绝时才退还冻结金额并将订单标记为失败；
+// 第三方接口不支持按商户引用查询订单，存在结果未知的调用时无法确认是否已下单，任务转人工核查并发送运营告警
+type ProviderOrderWorker interface {
+	// ProcessDueTasks 领取并执行到期任务（定时任务），包括租约已过期的执行中任务
+	ProcessDueTasks(ctx context.Context) error
+}
+
+// providerOrderWorker 第三方下单后台任务实现
+type providerOrderWorker struct {
+	db           *gorm.DB
+	orderRepo    repository.OrderRepository
+	outboxRepo   repository.OrderOutboxRepository
+	orderService OrderService
+	esimClient   service_common.EsimClientService
+	owner        string
+
+	// notificationService 任务转人工核查时发送运营告警，可为 nil
+	notificationService NotificationService
+}
+
+// NewProviderOrderWorker 创建第三方下单后台任务实例
+func NewProviderOrderWorker(
+	db *gorm.DB,
+	orderRepo repository.OrderRepository,
+	outboxRepo repository.OrderOutboxRepository,
+	orderService OrderService,
+	esimClient service_common.EsimClientService,
+	notificationService NotificationService,
+) ProviderOrderWorker {
+	hostname, _ := os.Hostname()
+	return &providerOrderWorker{
+		db:                  db,
+		orderRepo:           orderRepo,
+		outboxRepo:          outboxRepo,
+		orderService:        orderService,
+		esimClient:          esimClient,
+		owner:               fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		notificationService: notificationService,
+	}
+}
+
+// ProcessDueTasks 领取并执行到期任务
+// 每次只领取一个任务，租约从执行时开始计算，不会因排在同一批次后面而在执行前过期
+func (w *providerOrderWorker) ProcessDueTasks(ctx context.Context) error {
+	for i := 0; i < providerOrderBatchSize && ctx.Err() == nil; i++ {
+		tasks, err := w.outboxRepo.ClaimDue(ctx, models.OutboxTaskCreateProviderOrder, w.owner, providerOrderLease, 1)
+		if err != nil {
+			return fmt.Errorf("领取第三方下单任务失败: %w", err)
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		task := tasks[0]
+		if err := w.processTask(ctx, task); err != nil {
+			fmt.Printf("[ERROR] 第三方下单任务 %d（订单 %s）处理失败: %v\n", task.ID, task.Reference, err)
+		}
+	}
+	return nil
+}
+
+// processTask 执行单个任务
+func (w *providerOrderWorker) processTask(ctx context.Context, task *models.OrderOutboxTask) error {
+	order, err := w.orderRepo.GetByID(ctx, task.OrderID)
+	if err != nil {
+		return w.retry(ctx, task, fmt.Errorf("订单不存在: %w", err))
+	}
+
+	// 上次执行已保存第三方订单但未来得及完成任务
+	if order.ProviderOrderID != "" {
+		return w.markDone(ctx, w.outboxRepo, task, &providerOrderResult{
+			ProviderOrderID: order.ProviderOrderID,
+			ProviderOrderNo: order.ProviderOrderNo,
+		})
+	}
+	// 订单已被取消、补偿或人工处理，不再下单
+	if order.Status != models.OrderStatusProcessing {
+		return w.markDone(ctx, w.outboxRepo, task, &providerOrderResult{Skipped: fmt.Sprintf("订单状态: %s", order.Status)})
+	}
+	// 上一轮已用尽次数但补偿未完成（补偿失败或执行中崩溃）
+	if task.Attempts > providerOrderMaxAttempts {
+		return w.exhausted(ctx, task, order, errors.New(task.LastError))
+	}
+
+	data, err := w.createProviderOrder(ctx, task)
+	if err != nil {
+		if !errors.Is(err, errProviderOrderRejected) {
+			task.Uncertain = true
+		}
+		if task.Attempts >= providerOrderMaxAttempts {
+			return w.exhausted(ctx, task, order, err)
+		}
+		return w.retry(ctx, task, err)
+	}
+
+	providerOrderID := fmt.Sprint(data.OrderID)
+	return RetryOnConflict(ctx, func() error {
+		return w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if _, err := w.orderRepo.WithTx(tx).SetProviderOrder(ctx, order.ID, providerOrderID, data.OrderNumber); err != nil {
+				return fmt.Errorf("保存第三方订单失败: %w", err)
+			}
+			return w.markDone(ctx, w.outboxRepo.WithTx(tx), task, &providerOrderResult{
+				ProviderOrderID: providerOrderID,
+				ProviderOrderNo: data.OrderNumber,
+			})
+		})
+	})
+}
+
+// createProviderOrder 调用第三方 eSIM API 创建订单，订单号作为商户引用
+// 第三方明确拒绝时返回的错误包装 errProviderOrderRejected
+func (w *providerOrderWorker) createProviderOrder(ctx context.Context, task *models.OrderOutboxTask) (*esim.CreateOrderData, error) {
+	var payload providerOrderPayload
+	if err := json.Unmarshal([]byte(task.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("%w: 解析第三方下单参数失败: %v", errProviderOrderRejected, err)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, providerOrderCallTimeout)
+	defer cancel()
+
+	providerOrder, err := w.esimClient.CreateOrder(callCtx, esim.CreateOrderRequest{
+		ProductID:     payload.ProductID,
+		CustomerEmail: payload.CustomerEmail,
+		Quantity:      payload.Quantity,
+		Reference:     task.Reference,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用第三方 API 失败: %w", err)
+	}
+
+	// 检查订单创建是否成功
+	if !providerOrder.Success {
+		// 尝试从 Data 字段获取错误消息
+		var errorMsg string
+		if len(providerOrder.Data) > 0 {
+			errorMsg = string(providerOrder.Data)
+		} else if len(providerOrder.Message) > 0 {
+			errorMsg = string(providerOrder.Message)
+		}
+		return nil, fmt.Errorf("%w: %s", errProviderOrderRejected, errorMsg)
+	}
+
+	// 检查解析后的订单数据
+	if providerOrder.OrderData == nil || providerOrder.OrderData.OrderNumber == "" {
+		return nil, errors.New("第三方订单创建失败: 未返回订单号")
+	}
+	return providerOrder.OrderData, nil
+}
+
+// exhausted 重试耗尽：每次调用都被第三方明确拒绝时补偿，否则转人工核查
+func (w *providerOrderWorker) exhausted(ctx context.Context, task *models.OrderOutboxTask, order *models.Order, cause error) error {
+	if task.Uncertain {
+		return w.park(ctx, task, order, cause)
+	}
+	return w.compensate(ctx, task, order, cause)
+}
+
+// park 无法确认第三方是否已下单，任务转人工核查并发送运营告警，订单保持处理中、冻结金额不退还
+func (w *providerOrderWorker) park(ctx context.Context, task *models.OrderOutboxTask, order *models.Order, cause error) error {
+	ok, err := w.outboxRepo.MarkManualReview(ctx, task.ID, w.owner, cause.Error())
+	if err != nil {
+		return fmt.Errorf("更新第三方下单任务失败: %w", err)
+	}
+	if !ok {
+		fmt.Printf("[WARNING] 第三方下单任务 %d 的租约已被其他实例接管\n", task.ID)
+		return nil
+	}
+
+	alert := fmt.Sprintf("订单 %s 第三方下单重试耗尽，无法确认第三方是否已创建订单，需人工核查\n用户: %d\n金额: %s（已冻结）\n最近错误: %v",
+		order.OrderNo, order.UserID, order.Amount, cause)
+	fmt.Printf("[ERROR] %s\n", alert)
+	if w.notificationService != nil {
+		if err := w.notificationService.SendAdminAlert(ctx, alert); err != nil {
+			fmt.Printf("[ERROR] Failed to send manual review alert for order %s: %v\n", order.OrderNo, err)
+		}
+	}
+	return nil
+}
+
+// compensate 重试耗尽，退还冻结金额、释放优惠码并将订单标记为失败
+// 补偿失败时任务回到待执行状态，下一轮直接重新补偿（退款和释放优惠码均幂等）
+func (w *providerOrderWorker) compensate(ctx context.Context, task *models.OrderOutboxTask, order *models.Order, cause error) error {
+	err := w.orderService.ProcessOrderFailure(ctx, order.ID, models.OrderActorSystem, "创建第三方订单失败", map[string]string{"error": cause.Error()})
+	if err != nil {
+		return w.retry(ctx, task, fmt.Errorf("%v；补偿失败: %w", cause, err))
+	}
+
+	ok, err := w.outboxRepo.MarkCompensated(ctx, task.ID, w.owner, cause.Error())
+	if err != nil {
+		return fmt.Errorf("更新第三方下单任务失败: %w", err)
+	}
+	if !ok {
+		fmt.Printf("[WARNING] 第三方下单任务 %d 的租约已被其他实例接管\n", task.ID)
+	}
+	return nil
+}
+
+// retry 记录失败原因并按退避间隔安排下次执行
+func (w *providerOrderWorker) retry(ctx context.Context, task *models.OrderOutboxTask, cause error) error {
+	nextRunAt := time.Now().Add(providerOrderBackoff.Delay(task.Attempts - 1))
+	ok, err := w.outboxRepo.MarkRetry(ctx, task.ID, w.owner, cause.Error(), nextRunAt, task.Uncertain)
+	if err != nil {
+		return fmt.Errorf("更新第三方下单任务失败: %w", err)
+	}
+	if !ok {
+		fmt.Printf("[WARNING] 第三方下单任务 %d 的租约已被其他实例接管\n", task.ID)
+	}
+	return cause
+}
+
+// markDone 标记任务成功，outboxRepo 可以绑定到事务
+func (w *providerOrderWorker) markDone(ctx context.Context, outboxRepo repository.OrderOutboxRepository, task *models.OrderOutboxTask, result *providerOrderResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("序列化第三方下单结果失败: %w", err)
+	}
+
+	ok, err := outboxRepo.MarkDone(ctx, task.ID, w.owner, string(data))
+	if err != nil {
+		return fmt.Errorf("更新第三方下单任务失败: %w", err)
+	}
+	if !ok {
+		// 第三方订单已保存，接管的实例会看到订单已关联第三方订单并直接完成任务
+		fmt.Printf("[WARNING] 第三方下单任务 %d 的租约已被其他实例接管\n", task.ID)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tg-robot-sim/pkg/sdk/esim"
+	service_common "tg-robot-sim/services/common"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+// fakeProviderOrderClient 第三方下单桩，只实现 CreateOrder
+type fakeProviderOrderClient struct {
+	service_common.EsimClientService
+	fail       bool // 连接错误，无法确认是否已下单
+	reject     bool // 第三方明确拒绝下单
+	references []string
+}
+
+func (c *fakeProviderOrderClient) CreateOrder(ctx context.Context, req esim.CreateOrderRequest) (*esim.CreateOrderResponse, error) {
+	c.references = append(c.references, req.Reference)
+	if c.fail {
+		return nil, errors.New("connection reset")
+	}
+	if c.reject {
+		return &esim.CreateOrderResponse{Success: false, Message: []byte(`"product unavailable"`)}, nil
+	}
+	return &esim.CreateOrderResponse{
+		Success:   true,
+		OrderData: &esim.CreateOrderData{OrderID: 9001, OrderNumber: "P-9001"},
+	}, nil
+}
+
+type providerOrderFixture struct {
+	db            *gorm.DB
+	orderRepo     repository.OrderRepository
+	outboxRepo    repository.OrderOutboxRepository
+	walletRepo    repository.WalletRepository
+	walletService WalletService
+	orderService  OrderService
+	client        *fakeProviderOrderClient
+	worker        ProviderOrderWorker
+}
+
+func newProviderOrderFixture(t *testing.T) *providerOrderFixture {
+	t.Helper()
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	f := &providerOrderFixture{
+		db:         db,
+		orderRepo:  repository.NewOrderRepository(db),
+		outboxRepo: repository.NewOrderOutboxRepository(db),
+		walletRepo: repository.NewWalletRepository(db),
+		client:     &fakeProviderOrderClient{},
+	}
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), f.walletRepo)
+	f.walletService = NewWalletService(f.walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil)
+	productRepo := repository.NewProductRepository(db)
+	machine := NewOrderStateMachine(db, f.orderRepo, repository.NewOrderEventRepository(db))
+	f.orderService = NewOrderService(db, f.orderRepo, machine, f.outboxRepo, productRepo, f.walletService, f.client, nil, nil, nil, nil)
+	f.worker = NewProviderOrderWorker(db, f.orderRepo, f.outboxRepo, f.orderService, f.client, nil)
+
+	if err := productRepo.Create(ctx, &models.Product{ID: 1, ThirdPartyID: "42", Name: "Japan 1GB", Price: 5, Status: "active"}); err != nil {
+		t.Fatalf("创建产品失败: %v", err)
+	}
+	if err := f.walletService.AddBalance(ctx, 1, "20", "seed", "初始余额"); err != nil {
+		t.Fatalf("初始化余额失败: %v", err)
+	}
+	return f
+}
+
+// createOrder 下单并返回订单和发件箱任务
+func (f *providerOrderFixture) createOrder(t *testing.T) (*EsimOrderResponse, *models.OrderOutboxTask) {
+	t.Helper()
+	ctx := context.Background()
+	order, err := f.orderService.CreateEsimOrder(ctx, &CreateEsimOrderRequest{
+		UserID:        1,
+		ProductID:     1,
+		Quantity:      1,
+		TotalAmount:   "5.0000",
+		CustomerEmail: "buyer@example.com",
+	})
+	if err != nil {
+		t.Fatalf("下单失败: %v", err)
+	}
+	return order, f.task(t, order.OrderID)
+}
+
+func (f *providerOrderFixture) task(t *testing.T, orderID uint) *models.OrderOutboxTask {
+	t.Helper()
+	tasks, err := f.outboxRepo.GetByOrderID(context.Background(), orderID)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("订单任务 = %d 条, err=%v, 期望 1 条", len(tasks), err)
+	}
+	return tasks[0]
+}
+
+func (f *providerOrderFixture) assertWallet(t *testing.T, balance, frozen string) {
+	t.Helper()
+	wallet, err := f.walletRepo.GetByUserID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("获取钱包失败: %v", err)
+	}
+	if normalizeAmount(wallet.Balance) != balance || normalizeAmount(wallet.FrozenBalance) != frozen {
+		t.Errorf("钱包 = %s/%s, 期望 %s/%s", wallet.Balance, wallet.FrozenBalance, balance, frozen)
+	}
+}
+
+// TestProviderOrderWorkerRetriesUntilCreated 下单只写入任务，第三方失败后按退避重试，成功后保存第三方订单
+func TestProviderOrderWorkerRetriesUntilCreated(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	order, task := f.createOrder(t)
+	if task.Status != models.OutboxStatusPending || task.Reference != order.OrderNo || task.TaskType != models.OutboxTaskCreateProviderOrder {
+		t.Fatalf("下单任务 = %+v", task)
+	}
+	if len(f.client.references) != 0 {
+		t.Fatalf("下单时不应直接调用第三方接口")
+	}
+	f.assertWallet(t, "15.00000000", "5.00000000")
+
+	f.client.fail = true
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+	task = f.task(t, order.OrderID)
+	if task.Status != models.OutboxStatusPending || task.Attempts != 1 || task.LastError == "" || !task.NextRunAt.After(time.Now()) {
+		t.Fatalf("失败后任务 = %+v, 期望等待重试", task)
+	}
+
+	// 未到重试时间不会再次执行
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+	if len(f.client.references) != 1 {
+		t.Fatalf("第三方调用 %d 次, 期望 1 次", len(f.client.references))
+	}
+
+	f.db.Model(&models.OrderOutboxTask{}).Where("id = ?", task.ID).Update("next_run_at", time.Now().Add(-time.Second))
+	f.client.fail = false
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+
+	for i, ref := range f.client.references {
+		if ref != order.OrderNo {
+			t.Errorf("第 %d 次调用的幂等引用 = %q, 期望 %q", i+1, ref, order.OrderNo)
+		}
+	}
+	task = f.task(t, order.OrderID)
+	if task.Status != models.OutboxStatusDone || task.Attempts != 2 || task.CompletedAt == nil {
+		t.Errorf("成功后任务 = %+v", task)
+	}
+	stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	if stored.ProviderOrderID != "9001" || stored.ProviderOrderNo != "P-9001" || stored.Status != models.OrderStatusProcessing {
+		t.Errorf("订单 = %s/%s/%s, 期望 9001/P-9001/processing", stored.ProviderOrderID, stored.ProviderOrderNo, stored.Status)
+	}
+	f.assertWallet(t, "15.00000000", "5.00000000")
+}
+
+// TestProviderOrderWorkerCompensatesRejectedTask 第三方每次都明确拒绝下单，重试耗尽后退款并将订单标记为失败
+func TestProviderOrderWorkerCompensatesRejectedTask(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	order, task := f.createOrder(t)
+	f.db.Model(&models.OrderOutboxTask{}).Where("id = ?", task.ID).Update("attempts", providerOrderMaxAttempts-1)
+
+	f.client.reject = true
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+
+	task = f.task(t, order.OrderID)
+	if task.Status != models.OutboxStatusCompensated || task.Attempts != providerOrderMaxAttempts || task.Uncertain {
+		t.Errorf("补偿后任务 = %+v", task)
+	}
+	stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	if stored.Status != models.OrderStatusFailed {
+		t.Errorf("订单状态 = %s, 期望 failed", stored.Status)
+	}
+	f.assertWallet(t, "20.00000000", zeroAmount)
+
+	// 已补偿的任务不会再被领取
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+	if len(f.client.references) != 1 {
+		t.Errorf("补偿后仍调用第三方接口")
+	}
+}
+
+// TestProviderOrderWorkerParksUncertainTask 租约过期的任务被重新领取，存在结果未知的调用时重试耗尽不退款，转人工核查
+func TestProviderOrderWorkerParksUncertainTask(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	order, task := f.createOrder(t)
+
+	// 模拟上一个实例在最后一次尝试中崩溃，第三方可能已经下单
+	f.db.Model(&models.OrderOutboxTask{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
+		"status":       models.OutboxStatusRunning,
+		"locked_by":    "crashed-1",
+		"locked_until": time.Now().Add(-time.Second),
+		"attempts":     providerOrderMaxAttempts - 1,
+	})
+
+	// 最后一次调用被明确拒绝，但崩溃的那次调用结果仍然未知
+	f.client.reject = true
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+
+	if len(f.client.references) != 1 {
+		t.Fatalf("第三方调用 %d 次, 期望 1 次", len(f.client.references))
+	}
+	task = f.task(t, order.OrderID)
+	if task.Status != models.OutboxStatusManualReview || !task.Uncertain || task.LockedBy == "crashed-1" {
+		t.Errorf("转人工核查后任务 = %+v", task)
+	}
+	stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	if stored.Status != models.OrderStatusProcessing {
+		t.Errorf("订单状态 = %s, 期望 processing", stored.Status)
+	}
+	f.assertWallet(t, "15.00000000", "5.00000000")
+
+	// 等待人工核查的任务不会再被领取
+	if err := f.worker.ProcessDueTasks(ctx); err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+	if len(f.client.references) != 1 {
+		t.Errorf("转人工核查后仍调用第三方接口")
+	}
+}
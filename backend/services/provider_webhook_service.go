@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tg-robot-sim/pkg/sdk/esim"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+var (
+	// ErrProviderWebhookUnauthorized 签名不匹配或时间戳超出容忍窗口
+	ErrProviderWebhookUnauthorized = errors.New("provider webhook unauthorized")
+	// ErrProviderWebhookReplayed nonce 已处理过，拒绝重放请求
+	ErrProviderWebhookReplayed = errors.New("provider webhook replayed")
+	// ErrProviderWebhookInvalid 事件格式错误
+	ErrProviderWebhookInvalid = errors.New("provider webhook invalid")
+	// ErrProviderWebhookBusy 订单正在同步中，第三方稍后重试即可
+	ErrProviderWebhookBusy = errors.New("provider webhook busy")
+)
+
+// providerWebhookTolerance Webhook 时间戳容忍窗口，nonce 至少保留两倍窗口时长
+const providerWebhookTolerance = 5 * time.Minute
+
+// ProviderWebhookRequest 第三方 Webhook 请求，签名覆盖 Method + Path + Body + Timestamp + Nonce
+type ProviderWebhookRequest struct {
+	Method    string
+	Path      string
+	Body      []byte
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+// ProviderWebhookService 第三方 Webhook 服务接口
+// 订单事件与 OrderSyncService 轮询走相同的处理流程，轮询作为漏推事件的兜底
+type ProviderWebhookService interface {
+	// HandleWebhook 校验签名和重放后处理事件，处理失败时释放 nonce 以便第三方重试
+	HandleWebhook(ctx context.Context, req *ProviderWebhookRequest) error
+
+	// PurgeNonces 清理超出容忍窗口的 nonce，返回删除条数
+	PurgeNonces(ctx context.Context) (int64, error)
+}
+
+// providerWebhookService 第三方 Webhook 服务实现
+type providerWebhookService struct {
+	esimClient       *esim.Client
+	nonceRepo        repository.ProviderWebhookNonceRepository
+	orderSyncService OrderSyncService
+	esimCardService  EsimCardService
+}
+
+// NewProviderWebhookService 创建第三方 Webhook 服务实例
+// 签名使用 esimClient 的 APISecret 和时区偏移校验
+func NewProviderWebhookService(
+	esimClient *esim.Client,
+	nonceRepo repository.ProviderWebhookNonceRepository,
+	orderSyncService OrderSyncService,
+	esimCardService EsimCardService,
+) ProviderWebhookService {
+	return &providerWebhookService{
+		esimClient:       esimClient,
+		nonceRepo:        nonceRepo,
+		orderSyncService: orderSyncService,
+		esimCardService:  esimCardService,
+	}
+}
+
+// HandleWebhook 处理第三方 Webhook 请求
+func (s *providerWebhookService) HandleWebhook(ctx context.Context, req *ProviderWebhookRequest) error {
+	if req.Nonce == "" {
+		return ErrProviderWebhookUnauthorized
+	}
+	if err := s.esimClient.VerifyWebhook(req.Method, req.Path, string(req.Body), req.Timestamp, req.Nonce, req.Signature, providerWebhookTolerance); err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderWebhookUnauthorized, err)
+	}
+
+	event, err := esim.ParseWebhookEvent(req.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderWebhookInvalid, err)
+	}
+
+	created, err := s.nonceRepo.Create(ctx, &models.ProviderWebhookNonce{
+		Nonce:     req.Nonce,
+		EventID:   event.ID,
+		EventType: string(event.Type),
+	})
+	if err != nil {
+		return fmt.Errorf("记录 Webhook nonce 失败: %w", err)
+	}
+	if !created {
+		return ErrProviderWebhookReplayed
+	}
+
+	if err := s.dispatch(ctx, event); err != nil {
+		if delErr := s.nonceRepo.Delete(ctx, req.Nonce); delErr != nil {
+			fmt.Printf("[ERROR] Failed to release webhook nonce %s: %v\n", req.Nonce, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// dispatch 按事件类型处理事件
+func (s *providerWebhookService) dispatch(ctx context.Context, event *esim.WebhookEvent) error {
+	switch event.Type {
+	case esim.WebhookEventOrderCompleted, esim.WebhookEventOrderFailed:
+		detail, err := event.OrderDetail()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrProviderWebhookInvalid, err)
+		}
+		// 本地处理失败已记录为同步失败，由轮询继续重试
+		if _, err := s.orderSyncService.ApplyProviderOrder(ctx, detail); err != nil {
+			if errors.Is(err, ErrOrderSyncBusy) {
+				return fmt.Errorf("%w: %v", ErrProviderWebhookBusy, err)
+			}
+			return fmt.Errorf("处理第三方订单事件失败: %w", err)
+		}
+		return nil
+
+	case esim.WebhookEventEsimUsage:
+		usage, err := event.UsageData()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrProviderWebhookInvalid, err)
+		}
+		esimCard, err := s.esimCardService.GetEsimCardByICCID(ctx, usage.Esim.ICCID)
+		if err != nil {
+			return fmt.Errorf("eSIM 卡不存在: %w", err)
+		}
+		if err := s.esimCardService.UpdateEsimCardUsage(ctx, esimCard.ID, &usage.Esim); err != nil {
+			return fmt.Errorf("更新 eSIM 使用情况失败: %w", err)
+		}
+		return nil
+
+	default:
+		fmt.Printf("[WARNING] Ignoring unknown webhook event type: %s\n", event.Type)
+		return nil
+	}
+}
+
+// PurgeNonces 清理超出容忍窗口的 nonce
+func (s *providerWebhookService) PurgeNonces(ctx context.Context) (int64, error) {
+	return s.nonceRepo.DeleteBefore(ctx, time.Now().Add(-2*providerWebhookTolerance))
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/sdk/esim"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestProviderWebhookCompletesOrder 签名校验、时间戳和重放检查通过后，订单完成事件走同步相同的完成流程
+func TestProviderWebhookCompletesOrder(t *testing.T) {
+	f := newProviderOrderFixture(t)
+	ctx := context.Background()
+
+	const secret = "webhook-secret"
+	client := esim.NewClient(esim.Config{APISecret: secret})
+	cfg := config.DefaultOrderConfig()
+	syncService := NewOrderSyncService(f.orderRepo, repository.NewOrderSyncErrorRepository(f.db), f.orderService, client, nil, &cfg)
+	webhook := NewProviderWebhookService(client, repository.NewProviderWebhookNonceRepository(f.db), syncService, nil)
+
+	order, _ := f.createOrder(t)
+	if _, err := f.orderRepo.SetProviderOrder(ctx, order.OrderID, "9001", "P-9001"); err != nil {
+		t.Fatalf("保存第三方订单失败: %v", err)
+	}
+
+	body := []byte(`{"id":"evt-1","type":"order.completed","data":{"id":9001,"orderNumber":"P-9001","status":"completed"}}`)
+	signed := func(nonce string, at time.Time) *ProviderWebhookRequest {
+		timestamp := strconv.FormatInt(at.UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(fmt.Sprintf("POST/api/provider/webhook%s%s%s", body, timestamp, nonce)))
+		return &ProviderWebhookRequest{
+			Method:    "POST",
+			Path:      "/api/provider/webhook",
+			Body:      body,
+			Timestamp: timestamp,
+			Nonce:     nonce,
+			Signature: hex.EncodeToString(mac.Sum(nil)),
+		}
+	}
+
+	tampered := signed("nonce-1", time.Now())
+	tampered.Signature = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := webhook.HandleWebhook(ctx, tampered); !errors.Is(err, ErrProviderWebhookUnauthorized) {
+		t.Fatalf("签名错误的请求返回 %v, 期望 ErrProviderWebhookUnauthorized", err)
+	}
+	if err := webhook.HandleWebhook(ctx, signed("nonce-1", time.Now().Add(-10*time.Minute))); !errors.Is(err, ErrProviderWebhookUnauthorized) {
+		t.Fatalf("过期请求返回 %v, 期望 ErrProviderWebhookUnauthorized", err)
+	}
+
+	// 轮询 worker 持有同步租约时返回可重试错误，并释放 nonce
+	if _, err := f.orderRepo.ClaimSyncOrder(ctx, order.OrderID, "other-instance", time.Minute); err != nil {
+		t.Fatalf("领取同步租约失败: %v", err)
+	}
+	req := signed("nonce-1", time.Now())
+	if err := webhook.HandleWebhook(ctx, req); !errors.Is(err, ErrProviderWebhookBusy) {
+		t.Fatalf("租约被占用时返回 %v, 期望 ErrProviderWebhookBusy", err)
+	}
+	if err := f.orderRepo.ReleaseSyncClaim(ctx, order.OrderID, "other-instance"); err != nil {
+		t.Fatalf("释放同步租约失败: %v", err)
+	}
+
+	if err := webhook.HandleWebhook(ctx, req); err != nil {
+		t.Fatalf("处理 Webhook 失败: %v", err)
+	}
+	if err := webhook.HandleWebhook(ctx, req); !errors.Is(err, ErrProviderWebhookReplayed) {
+		t.Fatalf("重放请求返回 %v, 期望 ErrProviderWebhookReplayed", err)
+	}
+
+	stored, err := f.orderRepo.GetByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("查询订单失败: %v", err)
+	}
+	if stored.Status != models.OrderStatusCompleted {
+		t.Fatalf("订单状态 = %s, 期望 completed", stored.Status)
+	}
+	f.assertWallet(t, "15.00000000", zeroAmount)
+
+	// 订单已完成，轮询不会再处理
+	if err := syncService.ProcessPendingOrders(ctx); err != nil {
+		t.Fatalf("同步订单失败: %v", err)
+	}
+	f.assertWallet(t, "15.00000000", zeroAmount)
+}
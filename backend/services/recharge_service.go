@@ -3,53 +3,140 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 	"time"
 
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/tron"
 	"tg-robot-sim/storage/models"
 	"tg-robot-sim/storage/repository"
 
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrRechargeUnderpaidHeld 少付且策略为暂不入账，转账已转入孤儿充值等待人工处理
+	ErrRechargeUnderpaidHeld = errors.New("充值金额不足，已转人工处理")
+	// ErrInsufficientConfirmations 交易确认数未达到确认数策略的要求，稍后重试
+	ErrInsufficientConfirmations = errors.New("交易确认数不足")
+	// ErrTransactionFailed 交易在链上执行失败（如 TRC20 转账 REVERT），不能入账
+	ErrTransactionFailed = errors.New("交易执行失败")
+)
+
+// defaultReverifyBlocks 未配置入账后复核窗口时使用的区块数
+const defaultReverifyBlocks = 20
+
+// rechargePaymentLabels 非足额到账在入账备注中的说明
+var rechargePaymentLabels = map[string]string{
+	models.RechargePaymentOver:  "超额支付",
+	models.RechargePaymentUnder: "少付",
+	models.RechargePaymentLate:  "逾期到账",
+}
+
+// DepositChain 一条链上的充值收款配置
+// Addresses 不为空时每个用户使用专属收款地址（按地址匹配、按实收入账），否则所有订单共用 DepositAddress 按精确金额匹配
+type DepositChain struct {
+	Service        BlockchainService     // 该链的区块链服务
+	DepositAddress string                // 系统收款地址
+	Confirmations  *ConfirmationPolicy   // 入账所需确认数策略
+	Addresses      DepositAddressService // 用户专属收款地址服务（可以为 nil）
+}
+
 // rechargeService 充值服务实现
 type rechargeService struct {
 	rechargeRepo        repository.RechargeOrderRepository
+	transactionRepo     repository.TransactionRepository
+	cursorRepo          repository.DepositCursorRepository
+	orphanRepo          repository.OrphanDepositRepository
+	assetService        AssetService
 	walletService       WalletService
-	blockchainService   BlockchainService
+	walletRepo          repository.WalletRepository
+	chains              map[string]*DepositChain // 链标识 -> 收款配置
 	notificationService NotificationService
+	events              EventPublisher
+	ledgerService       LedgerService
 	db                  *gorm.DB
-	depositAddress      string
 	minAmount           float64
 	maxAmount           float64
+	underpaymentPolicy  string // 少付处理策略，见 config.UnderpaymentPolicy*
+	reverifyBlocks      int    // 入账后复核窗口（区块数）
 }
 
 // NewRechargeService 创建充值服务实例
+// chains 按链标识配置收款地址，只有已配置链上的资产才能用于充值
+// notificationService 可以为 nil，此时充值到账后不发送通知；events 可以为 nil，此时不推送实时事件
+// transactionRepo / cursorRepo 用于充值扫描器记录入账转账和扫描位置，无法自动入账的转账记入 orphanRepo
+// underpaymentPolicy 为空时少付按实收入账，reverifyBlocks 不大于 0 时使用默认复核窗口
 func NewRechargeService(
 	rechargeRepo repository.RechargeOrderRepository,
+	transactionRepo repository.TransactionRepository,
+	cursorRepo repository.DepositCursorRepository,
+	orphanRepo repository.OrphanDepositRepository,
+	assetService AssetService,
 	walletService WalletService,
-	blockchainService BlockchainService,
+	walletRepo repository.WalletRepository,
+	chains map[string]*DepositChain,
 	notificationService NotificationService,
+	events EventPublisher,
+	ledgerService LedgerService,
 	db *gorm.DB,
-	depositAddress string,
 	minAmount, maxAmount float64,
+	underpaymentPolicy string,
+	reverifyBlocks int,
 ) RechargeService {
+	if underpaymentPolicy == "" {
+		underpaymentPolicy = config.UnderpaymentPolicyCredit
+	}
+	if reverifyBlocks <= 0 {
+		reverifyBlocks = defaultReverifyBlocks
+	}
 	return &rechargeService{
 		rechargeRepo:        rechargeRepo,
+		transactionRepo:     transactionRepo,
+		cursorRepo:          cursorRepo,
+		orphanRepo:          orphanRepo,
+		assetService:        assetService,
 		walletService:       walletService,
-		blockchainService:   blockchainService,
+		walletRepo:          walletRepo,
+		chains:              chains,
 		notificationService: notificationService,
+		events:              events,
+		ledgerService:       ledgerService,
 		db:                  db,
-		depositAddress:      depositAddress,
 		minAmount:           minAmount,
 		maxAmount:           maxAmount,
+		underpaymentPolicy:  underpaymentPolicy,
+		reverifyBlocks:      reverifyBlocks,
+	}
+}
+
+// ListRechargeAssets 列出可用于充值的资产（资产可用、已设置汇率且所在链已配置收款）
+func (s *rechargeService) ListRechargeAssets(ctx context.Context) ([]*models.Asset, error) {
+	assets, err := s.assetService.ListAssets(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []*models.Asset
+	for _, asset := range assets {
+		if _, ok := s.chains[asset.Chain]; !ok {
+			continue
+		}
+		if rate, err := parseDecimal(asset.UsdRate); err != nil || rate.Sign() <= 0 {
+			continue
+		}
+		available = append(available, asset)
 	}
+	return available, nil
 }
 
 // CreateRechargeOrder 创建充值订单
-func (s *rechargeService) CreateRechargeOrder(ctx context.Context, userID int64, amount string) (*models.RechargeOrder, error) {
+// amount 为计价币种（USD）到账金额，按下单时的汇率折算为需支付的资产数量，asset 为空时使用 USDT-TRC20
+func (s *rechargeService) CreateRechargeOrder(ctx context.Context, userID int64, amount string, asset string) (*models.RechargeOrder, error) {
 	// 1. 验证充值金额
 	amountFloat, err := strconv.ParseFloat(amount, 64)
 	if err != nil {
@@ -64,22 +151,51 @@ func (s *rechargeService) CreateRechargeOrder(ctx context.Context, userID int64,
 		return nil, fmt.Errorf("充值金额不能超过 %.2f USDT", s.maxAmount)
 	}
 
-	// 2. 生成唯一的精确金额
-	exactAmount, err := s.GenerateExactAmount(ctx, amount)
+	// 2. 校验支付资产及其所在链
+	if asset == "" {
+		asset = models.AssetUSDTTRC20
+	}
+	assetInfo, err := s.assetService.GetActiveAsset(ctx, asset)
 	if err != nil {
-		return nil, fmt.Errorf("生成精确金额失败: %w", err)
+		return nil, err
+	}
+	chain, ok := s.chains[assetInfo.Chain]
+	if !ok {
+		return nil, ErrAssetNotSupported
 	}
 
-	// 3. 创建充值订单
+	// 3. 按汇率折算资产数量：专属地址模式直接使用折算数量，否则生成唯一的精确金额
+	quantity, err := assetQuantity(amount, assetInfo.UsdRate)
+	if err != nil {
+		return nil, err
+	}
 	order := &models.RechargeOrder{
 		UserID:        userID,
 		Amount:        amount,
-		ExactAmount:   exactAmount,
-		WalletAddress: s.depositAddress,
+		Asset:         assetInfo.Code,
+		Rate:          assetInfo.UsdRate,
+		ExactAmount:   quantity.Text('f', 4),
+		WalletAddress: chain.DepositAddress,
+		MatchMode:     models.RechargeMatchExactAmount,
 		Status:        models.RechargeStatusPending,
 		ExpiresAt:     time.Now().Add(30 * time.Minute),
 	}
+	if chain.Addresses != nil {
+		address, err := chain.Addresses.GetUserAddress(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("获取充值地址失败: %w", err)
+		}
+		order.WalletAddress = address
+		order.MatchMode = models.RechargeMatchAddress
+	} else {
+		exactAmount, err := s.GenerateExactAmount(ctx, assetInfo.Code, quantity.Text('f', 4))
+		if err != nil {
+			return nil, fmt.Errorf("生成精确金额失败: %w", err)
+		}
+		order.ExactAmount = exactAmount
+	}
 
+	// 4. 创建充值订单
 	if err := s.rechargeRepo.Create(ctx, order); err != nil {
 		return nil, fmt.Errorf("创建充值订单失败: %w", err)
 	}
@@ -99,6 +215,18 @@ func (s *rechargeService) GetRechargeOrder(ctx context.Context, orderNo string)
 	return order, nil
 }
 
+// GetPaymentURI 获取订单的收款内容
+func (s *rechargeService) GetPaymentURI(ctx context.Context, order *models.RechargeOrder) (string, error) {
+	assetInfo, err := s.assetService.GetAsset(ctx, order.Asset)
+	if err != nil {
+		return "", err
+	}
+	if assetInfo.Chain != models.ChainTron {
+		return order.WalletAddress, nil
+	}
+	return tron.PaymentURI(order.WalletAddress, order.ExactAmount, assetInfo.ContractAddress), nil
+}
+
 // GetUserRechargeHistory 获取用户充值历史
 func (s *rechargeService) GetUserRechargeHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.RechargeOrder, int64, error) {
 	orders, err := s.rechargeRepo.GetByUserID(ctx, userID, limit, offset)
@@ -138,124 +266,152 @@ func (s *rechargeService) CheckRechargeStatus(ctx context.Context, orderNo strin
 	}
 
 	// 4. 查询区块链交易
-	transactions, err := s.blockchainService.GetAddressIncomingTransactions(ctx, s.depositAddress, order.ExactAmount)
+	assetInfo, chain, err := s.orderChain(ctx, order)
 	if err != nil {
-		return nil, fmt.Errorf("查询区块链交易失败: %w", err)
-	}
-
-	// 5. 查找匹配的交易
-	for _, tx := range transactions {
-		if s.blockchainService.MatchTransactionAmount(tx.Amount, order.ExactAmount) {
-			// 检查确认数
-			if tx.Confirmations >= 19 {
-				// 确认充值
-				if err := s.ConfirmRecharge(ctx, order, tx.TxHash); err != nil {
-					return nil, fmt.Errorf("确认充值失败: %w", err)
-				}
-				// 重新获取更新后的订单
-				return s.GetRechargeOrder(ctx, orderNo)
-			}
-		}
+		return nil, err
 	}
-
-	return order, nil
-}
-
-// ProcessPendingRecharges 处理待支付的充值订单（定时任务调用）
-func (s *rechargeService) ProcessPendingRecharges(ctx context.Context) error {
-	// 1. 获取所有待支付订单
-	orders, err := s.rechargeRepo.GetPendingOrders(ctx)
+	transactions, err := chain.Service.GetAddressIncomingTransactions(ctx, order.WalletAddress, order.ExactAmount)
 	if err != nil {
-		return fmt.Errorf("获取待支付订单失败: %w", err)
+		return nil, fmt.Errorf("查询区块链交易失败: %w", err)
 	}
 
-	// 2. 处理每个订单
-	for _, order := range orders {
-		// 检查是否过期
-		if order.IsExpired() {
-			order.Status = models.RechargeStatusExpired
-			if err := s.rechargeRepo.Update(ctx, order); err != nil {
-				// 记录错误但继续处理其他订单
-				fmt.Printf("更新过期订单失败: %v\n", err)
-			}
+	// 5. 查找匹配的交易（专属地址订单匹配下单后收到的任意金额）
+	for _, tx := range transactions {
+		if !transactionMatchesAsset(tx, assetInfo) {
 			continue
 		}
-
-		// 查询区块链交易（带重试机制）
-		transactions, err := s.queryTransactionsWithRetry(ctx, s.depositAddress, order.ExactAmount, 3)
-		if err != nil {
-			// 记录错误但继续处理其他订单
-			fmt.Printf("查询订单 %s 的区块链交易失败: %v\n", order.OrderNo, err)
+		if order.MatchMode == models.RechargeMatchAddress {
+			if !depositAfterOrder(order, tx.Timestamp) {
+				continue
+			}
+			if used, err := s.rechargeRepo.GetByTxHash(ctx, tx.TxHash); err == nil && used.ID != order.ID {
+				continue
+			}
+		} else if !chain.Service.MatchTransactionAmount(tx.Amount, order.ExactAmount) {
 			continue
 		}
 
-		// 查找匹配的交易
-		for _, tx := range transactions {
-			if s.blockchainService.MatchTransactionAmount(tx.Amount, order.ExactAmount) {
-				// 检查确认数
-				if tx.Confirmations >= 5 {
-					// 确认充值
-					if err := s.ConfirmRecharge(ctx, order, tx.TxHash); err != nil {
-						fmt.Printf("确认订单 %s 充值失败: %v\n", order.OrderNo, err)
-					}
-					break
-				}
+		// 确认充值：确认数由 verifyTransaction 按确认数策略检查，不足时保持待支付；少付转人工、执行失败的转账不再处理
+		if err := s.ConfirmRecharge(ctx, order, tx.TxHash); err != nil {
+			if errors.Is(err, ErrRechargeUnderpaidHeld) || errors.Is(err, ErrInsufficientConfirmations) || errors.Is(err, ErrTransactionFailed) {
+				continue
 			}
+			return nil, fmt.Errorf("确认充值失败: %w", err)
 		}
+		// 重新获取更新后的订单
+		return s.GetRechargeOrder(ctx, orderNo)
 	}
 
-	return nil
+	return order, nil
 }
 
 // ConfirmRecharge 确认充值并更新余额，并发送 Telegram 通知
 func (s *rechargeService) ConfirmRecharge(ctx context.Context, order *models.RechargeOrder, txHash string) error {
-	// 1. 首先验证交易是否真实存在且金额正确
-	if err := s.verifyTransaction(ctx, txHash, order.ExactAmount, s.depositAddress); err != nil {
+	return s.confirmDeposit(ctx, order, txHash, false)
+}
+
+// confirmDeposit 按到账类型确认充值
+// 超额和逾期（订单过期后才到账）按实收数量折算入账；少付按策略入账或转入孤儿充值并返回 ErrRechargeUnderpaidHeld
+// allowExpired 为 true 时允许确认已过期的订单（充值扫描器匹配逾期到账使用）
+func (s *rechargeService) confirmDeposit(ctx context.Context, order *models.RechargeOrder, txHash string, allowExpired bool) error {
+	// 1. 首先验证交易是否真实存在且资产、金额正确
+	assetInfo, chain, err := s.orderChain(ctx, order)
+	if err != nil {
+		return err
+	}
+	txDetail, err := s.verifyTransaction(ctx, chain, assetInfo, order, txHash)
+	if err != nil {
 		return fmt.Errorf("交易验证失败: %w", err)
 	}
 
-	// 2. 使用数据库事务确保原子性，添加重试机制处理数据库锁定
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 重新获取最新的订单状态，防止并发问题
-		var currentOrder models.RechargeOrder
-		if err := tx.Where("id = ?", order.ID).First(&currentOrder).Error; err != nil {
-			return fmt.Errorf("获取订单失败: %w", err)
-		}
-
-		// 检查订单状态，防止重复处理
-		if currentOrder.Status != models.RechargeStatusPending {
-			return fmt.Errorf("订单已处理，当前状态: %s", currentOrder.Status)
-		}
+	paymentType, err := classifyPayment(order, txDetail)
+	if err != nil {
+		return err
+	}
+	if paymentType == models.RechargePaymentUnder && s.underpaymentPolicy == config.UnderpaymentPolicyHold {
+		return s.holdUnderpayment(ctx, assetInfo, order, txHash, txDetail)
+	}
 
-		// 检查交易哈希是否已被使用
-		var existingOrder models.RechargeOrder
-		err := tx.Where("tx_hash = ? AND id != ?", txHash, order.ID).First(&existingOrder).Error
-		if err == nil {
-			return fmt.Errorf("交易哈希已被使用")
+	// 精确金额订单足额支付时按下单金额入账，其余按实收数量折算
+	creditAmount := order.Amount
+	if order.MatchMode == models.RechargeMatchAddress || paymentType != models.RechargePaymentExact {
+		creditAmount, err = pricingAmount(txDetail.Amount, order.Rate)
+		if err != nil {
+			return fmt.Errorf("折算到账金额失败: %w", err)
 		}
-		if err != gorm.ErrRecordNotFound {
-			return fmt.Errorf("检查交易哈希失败: %w", err)
+		if amount, _ := parseDecimal(creditAmount); amount.Sign() <= 0 {
+			return fmt.Errorf("实收金额过小: %s %s", txDetail.Amount, order.Asset)
 		}
+	}
 
-		// 更新订单状态
-		now := time.Now()
-		currentOrder.Status = models.RechargeStatusConfirmed
-		currentOrder.TxHash = txHash
-		currentOrder.ConfirmedAt = &now
+	// 2. 使用数据库事务确保原子性，钱包版本冲突或数据库锁定时整体重试
+	err = RetryOnConflict(ctx, func() error {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// 重新获取最新的订单状态，防止并发问题
+			var currentOrder models.RechargeOrder
+			if err := tx.Where("id = ?", order.ID).First(&currentOrder).Error; err != nil {
+				return fmt.Errorf("获取订单失败: %w", err)
+			}
 
-		if err := tx.Save(&currentOrder).Error; err != nil {
-			return fmt.Errorf("更新订单状态失败: %w", err)
-		}
+			// 检查订单状态，防止重复处理
+			if currentOrder.Status != models.RechargeStatusPending &&
+				!(allowExpired && currentOrder.Status == models.RechargeStatusExpired) {
+				return fmt.Errorf("订单已处理，当前状态: %s", currentOrder.Status)
+			}
 
-		// 在同一事务中增加用户余额
-		remark := fmt.Sprintf("充值到账，订单号: %s", order.OrderNo)
-		if err := s.addBalanceInTransaction(ctx, tx, order.UserID, order.Amount, remark); err != nil {
-			return fmt.Errorf("增加用户余额失败: %w", err)
-		}
+			// 检查交易哈希是否已被使用
+			var existingOrder models.RechargeOrder
+			err := tx.Where("tx_hash = ? AND id != ?", txHash, order.ID).First(&existingOrder).Error
+			if err == nil {
+				return fmt.Errorf("交易哈希已被使用")
+			}
+			if err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("检查交易哈希失败: %w", err)
+			}
+
+			// 已转入孤儿充值的转账只能由管理员分配
+			var orphans int64
+			if err := tx.Model(&models.OrphanDeposit{}).Where("tx_hash = ?", txHash).Count(&orphans).Error; err != nil {
+				return fmt.Errorf("检查孤儿充值失败: %w", err)
+			}
+			if orphans > 0 {
+				return fmt.Errorf("交易已转入孤儿充值，需人工处理")
+			}
 
-		// 更新原始订单对象，用于后续通知
-		*order = currentOrder
-		return nil
+			// 更新订单状态
+			now := time.Now()
+			currentOrder.Status = models.RechargeStatusConfirmed
+			currentOrder.TxHash = txHash
+			currentOrder.ConfirmedAt = &now
+			currentOrder.CreditedAmount = creditAmount
+			currentOrder.PaymentType = paymentType
+			currentOrder.PaidAmount = txDetail.Amount
+			currentOrder.Confirmations = txDetail.Confirmations
+
+			if err := tx.Save(&currentOrder).Error; err != nil {
+				return fmt.Errorf("更新订单状态失败: %w", err)
+			}
+
+			// 在同一事务中增加用户余额
+			paid := order.ExactAmount
+			if order.MatchMode == models.RechargeMatchAddress || paymentType != models.RechargePaymentExact {
+				paid = txDetail.Amount
+			}
+			remark := fmt.Sprintf("充值到账，订单号: %s", order.OrderNo)
+			if order.Asset != models.AssetUSDTTRC20 || order.MatchMode == models.RechargeMatchAddress || paymentType != models.RechargePaymentExact {
+				remark = fmt.Sprintf("充值到账，订单号: %s，支付 %s %s，汇率 %s", order.OrderNo, paid, order.Asset, order.Rate)
+			}
+			if label, ok := rechargePaymentLabels[paymentType]; ok {
+				remark = fmt.Sprintf("%s（%s）", remark, label)
+			}
+			if err := s.addBalanceInTransaction(ctx, tx, order.UserID, creditAmount, order.OrderNo, txHash, remark); err != nil {
+				return fmt.Errorf("增加用户余额失败: %w", err)
+			}
+
+			// 更新原始订单对象，用于后续通知
+			*order = currentOrder
+			return nil
+		})
 	})
 
 	if err != nil {
@@ -263,21 +419,84 @@ func (s *rechargeService) ConfirmRecharge(ctx context.Context, order *models.Rec
 	}
 
 	// 发送 Telegram 通知（在事务外执行，失败不影响充值确认）
-	if err := s.notificationService.SendRechargeSuccessNotification(ctx, order.UserID, order.Amount, order.OrderNo); err != nil {
-		// 通知发送失败不影响充值确认
-		fmt.Printf("发送充值成功通知失败: %v\n", err)
+	if s.notificationService != nil {
+		if err := s.notificationService.SendRechargeSuccessNotification(ctx, order.UserID, order.CreditedAmount, order.OrderNo); err != nil {
+			// 通知发送失败不影响充值确认
+			fmt.Printf("发送充值成功通知失败: %v\n", err)
+		}
+	}
+
+	// 推送到账事件，Mini App 收到后刷新订单和余额
+	if s.events != nil {
+		s.events.Publish(order.UserID, EventRechargeConfirmed, map[string]interface{}{
+			"order_no":        order.OrderNo,
+			"amount":          order.Amount,
+			"credited_amount": order.CreditedAmount,
+			"asset":           order.Asset,
+			"status":          order.Status,
+			"tx_hash":         order.TxHash,
+			"payment_type":    order.PaymentType,
+			"confirmed_at":    order.ConfirmedAt,
+		})
 	}
 
 	return nil
 }
 
+// classifyPayment 判断到账类型：先比较实收数量与应付数量，金额足额时订单过期后到账的为逾期
+// 少付优先于逾期判断，逾期少付同样按少付策略处理；精确金额订单的金额已由 verifyTransaction 校验，只可能是足额或逾期
+func classifyPayment(order *models.RechargeOrder, txDetail *TransactionInfo) (string, error) {
+	onTime := models.RechargePaymentExact
+	if !txDetail.Timestamp.IsZero() && txDetail.Timestamp.After(order.ExpiresAt) {
+		onTime = models.RechargePaymentLate
+	}
+	if order.MatchMode != models.RechargeMatchAddress {
+		return onTime, nil
+	}
+
+	paid, err := parseDecimal(txDetail.Amount)
+	if err != nil {
+		return "", fmt.Errorf("实收金额格式错误: %w", err)
+	}
+	expected, err := parseDecimal(order.ExactAmount)
+	if err != nil {
+		return "", fmt.Errorf("应付金额格式错误: %w", err)
+	}
+	switch paid.Cmp(expected) {
+	case 1:
+		return models.RechargePaymentOver, nil
+	case -1:
+		return models.RechargePaymentUnder, nil
+	default:
+		return onTime, nil
+	}
+}
+
+// holdUnderpayment 少付暂不入账：将转账记为关联该订单的孤儿充值，订单保持原状态
+func (s *rechargeService) holdUnderpayment(ctx context.Context, asset *models.Asset, order *models.RechargeOrder, txHash string, txDetail *TransactionInfo) error {
+	_, err := s.orphanRepo.CreateIfNotExists(ctx, &models.OrphanDeposit{
+		Chain:       asset.Chain,
+		Address:     order.WalletAddress,
+		Asset:       order.Asset,
+		TxHash:      txHash,
+		FromAddress: txDetail.FromAddress,
+		Amount:      txDetail.Amount,
+		Reason:      models.OrphanReasonUnderpaid,
+		RechargeNo:  order.OrderNo,
+	})
+	if err != nil {
+		return fmt.Errorf("记录少付充值失败: %w", err)
+	}
+	return ErrRechargeUnderpaidHeld
+}
+
 // ExpireOldOrders 将过期订单标记为已过期
 func (s *rechargeService) ExpireOldOrders(ctx context.Context) error {
 	return s.rechargeRepo.ExpireOldOrders(ctx)
 }
 
-// GenerateExactAmount 生成唯一的精确金额
-func (s *rechargeService) GenerateExactAmount(ctx context.Context, baseAmount string) (string, error) {
+// GenerateExactAmount 为指定资产生成唯一的精确金额
+func (s *rechargeService) GenerateExactAmount(ctx context.Context, asset string, baseAmount string) (string, error) {
 	// 解析基础金额
 	baseFloat, err := strconv.ParseFloat(baseAmount, 64)
 	if err != nil {
@@ -296,7 +515,7 @@ func (s *rechargeService) GenerateExactAmount(ctx context.Context, baseAmount st
 		exactAmount := fmt.Sprintf("%.4f", baseFloat+float64(randomNum.Int64())/10000)
 
 		// 检查是否已存在
-		exists, err := s.rechargeRepo.IsExactAmountExists(ctx, exactAmount)
+		exists, err := s.rechargeRepo.IsExactAmountExists(ctx, asset, exactAmount)
 		if err != nil {
 			return "", fmt.Errorf("检查精确金额唯一性失败: %w", err)
 		}
@@ -309,88 +528,120 @@ func (s *rechargeService) GenerateExactAmount(ctx context.Context, baseAmount st
 	return "", fmt.Errorf("生成唯一精确金额失败，请稍后重试")
 }
 
-// verifyTransaction 验证交易是否真实存在且金额正确
-func (s *rechargeService) verifyTransaction(ctx context.Context, txHash, expectedAmount, expectedToAddress string) error {
-	// 通过交易哈希获取交易详情
-	txDetail, err := s.blockchainService.GetTransactionByHash(ctx, txHash)
+// orderChain 获取订单支付资产及其所在链的收款配置
+// 资产停用后已创建的订单仍按登记信息核对交易，因此不要求资产可用
+func (s *rechargeService) orderChain(ctx context.Context, order *models.RechargeOrder) (*models.Asset, *DepositChain, error) {
+	assetInfo, err := s.assetService.GetAsset(ctx, order.Asset)
 	if err != nil {
-		return fmt.Errorf("获取交易详情失败: %w", err)
+		return nil, nil, err
 	}
-
-	// 验证交易是否确认
-	if txDetail.Confirmations < 5 {
-		return fmt.Errorf("交易确认数不足，当前: %d，需要: 5", txDetail.Confirmations)
+	chain, ok := s.chains[assetInfo.Chain]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: 未配置 %s 链收款", ErrAssetNotSupported, assetInfo.Chain)
 	}
+	return assetInfo, chain, nil
+}
 
-	// 验证接收地址
-	if txDetail.ToAddress != expectedToAddress {
-		return fmt.Errorf("接收地址不匹配，期望: %s，实际: %s", expectedToAddress, txDetail.ToAddress)
+// transactionMatchesAsset 检查交易转账的资产是否为订单的支付资产
+// 交易带合约地址时按合约比对，否则按币种符号比对；两者都没有的视为链原生币转账
+func transactionMatchesAsset(tx *TransactionInfo, asset *models.Asset) bool {
+	if tx.TokenContract != "" {
+		return !asset.IsNative() && strings.EqualFold(tx.TokenContract, asset.ContractAddress)
 	}
-
-	// 验证金额
-	if !s.blockchainService.MatchTransactionAmount(txDetail.Amount, expectedAmount) {
-		return fmt.Errorf("交易金额不匹配，期望: %s，实际: %s", expectedAmount, txDetail.Amount)
+	if tx.TokenSymbol != "" {
+		return strings.EqualFold(tx.TokenSymbol, asset.Symbol)
 	}
-
-	return nil
+	return asset.IsNative()
 }
 
-// addBalanceInTransaction 在数据库事务中增加用户余额
-func (s *rechargeService) addBalanceInTransaction(ctx context.Context, tx *gorm.DB, userID int64, amount, remark string) error {
-	// 获取或创建钱包（在事务中）
-	var wallet models.Wallet
-	err := tx.Where("user_id = ?", userID).First(&wallet).Error
+// verifyTransaction 验证交易是否真实存在、执行成功且资产、收款地址正确、确认数满足策略；精确金额订单还要求金额一致
+func (s *rechargeService) verifyTransaction(ctx context.Context, chain *DepositChain, asset *models.Asset, order *models.RechargeOrder, txHash string) (*TransactionInfo, error) {
+	// 通过交易哈希获取交易详情
+	txDetail, err := chain.Service.GetTransactionByHash(ctx, txHash)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// 创建新钱包
-			wallet = models.Wallet{
-				UserID:        userID,
-				Balance:       "0",
-				FrozenBalance: "0",
-				TotalIncome:   "0",
-				TotalExpense:  "0",
-			}
-			if err := tx.Create(&wallet).Error; err != nil {
-				return fmt.Errorf("创建钱包失败: %w", err)
-			}
-		} else {
-			return fmt.Errorf("获取钱包失败: %w", err)
-		}
+		return nil, fmt.Errorf("获取交易详情失败: %w", err)
+	}
+	if err := checkTransactionMatches(chain, asset, order, txDetail); err != nil {
+		return nil, err
 	}
 
-	// 解析金额
-	balance, _ := parseDecimal(wallet.Balance)
-	addAmount, err := parseDecimal(amount)
+	// 验证确认数：按实收数量折算的金额查确认数策略，折算失败时按最严格的一档要求
+	value, err := pricingAmount(txDetail.Amount, order.Rate)
 	if err != nil {
-		return fmt.Errorf("金额格式错误: %w", err)
+		value = ""
+	}
+	if required := chain.Confirmations.Required(value); txDetail.Confirmations < required {
+		return nil, fmt.Errorf("%w，当前: %d，需要: %d", ErrInsufficientConfirmations, txDetail.Confirmations, required)
 	}
 
-	// 计算新余额
-	newBalance := new(big.Float).Add(balance, addAmount)
-	wallet.Balance = newBalance.Text('f', 8)
+	return txDetail, nil
+}
 
-	// 更新总收入
-	totalIncome, _ := parseDecimal(wallet.TotalIncome)
-	newTotalIncome := new(big.Float).Add(totalIncome, addAmount)
-	wallet.TotalIncome = newTotalIncome.Text('f', 8)
+// checkTransactionMatches 检查交易执行成功且与订单的资产、收款地址（精确金额订单还有金额）一致
+// 入账前验证和入账后复核共用，执行失败的交易返回 ErrTransactionFailed
+func checkTransactionMatches(chain *DepositChain, asset *models.Asset, order *models.RechargeOrder, txDetail *TransactionInfo) error {
+	// 验证执行结果：只有成功的交易才能入账，失败或结果未知的一律拒绝
+	if txDetail.Status != string(TransactionStatusConfirmed) {
+		return fmt.Errorf("%w，状态: %s", ErrTransactionFailed, txDetail.Status)
+	}
 
-	// 在事务中保存钱包
-	if err := tx.Save(&wallet).Error; err != nil {
-		return fmt.Errorf("更新钱包余额失败: %w", err)
+	// 验证转账资产
+	if !transactionMatchesAsset(txDetail, asset) {
+		return fmt.Errorf("交易资产不匹配，期望: %s", asset.Code)
 	}
 
-	// TODO: 在事务中记录交易日志（包含备注）
-	// 这里可以添加交易记录的逻辑
+	// 验证接收地址
+	if txDetail.ToAddress != order.WalletAddress {
+		return fmt.Errorf("接收地址不匹配，期望: %s，实际: %s", order.WalletAddress, txDetail.ToAddress)
+	}
+
+	// 验证金额
+	if order.MatchMode != models.RechargeMatchAddress && !chain.Service.MatchTransactionAmount(txDetail.Amount, order.ExactAmount) {
+		return fmt.Errorf("交易金额不匹配，期望: %s，实际: %s", order.ExactAmount, txDetail.Amount)
+	}
 
 	return nil
 }
 
-// queryTransactionsWithRetry 带重试机制的区块链交易查询
-func (s *rechargeService) queryTransactionsWithRetry(ctx context.Context, address, minAmount string, maxRetries int) ([]*TransactionInfo, error) {
-	transactions, err := s.blockchainService.GetAddressIncomingTransactions(ctx, address, minAmount)
-	if err == nil {
-		return transactions, nil
+// addBalanceInTransaction 在数据库事务中增加用户余额并写入充值记录
+// 记账：借 充值清算，贷 用户可用余额，钱包缓存余额在同一事务中以版本号 CAS 刷新
+// 版本冲突时返回错误，由 ConfirmRecharge 重试整个事务
+func (s *rechargeService) addBalanceInTransaction(ctx context.Context, tx *gorm.DB, userID int64, amount, orderNo, txHash, remark string) error {
+	if _, err := parseDecimal(amount); err != nil {
+		return fmt.Errorf("金额格式错误: %w", err)
 	}
 
-	return nil, err
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeRecharge,
+		models.LedgerAccountDepositClearing,
+		models.LedgerAccountUserAvailable,
+		amount,
+		orderNo,
+		remark,
+	)
+	posting.Idempotent = true
+
+	result, err := s.ledgerService.PostInTx(ctx, tx, posting)
+	if err != nil {
+		return fmt.Errorf("更新钱包余额失败: %w", err)
+	}
+
+	history := &models.WalletHistory{
+		UserID:        userID,
+		Type:          models.WalletHistoryTypeRecharge,
+		Amount:        amount,
+		BalanceBefore: result.WalletBefore.Balance,
+		BalanceAfter:  result.WalletAfter.Balance,
+		Status:        models.WalletHistoryStatusCompleted,
+		Description:   remark,
+		RelatedType:   "recharge_order",
+		RelatedID:     orderNo,
+		TxHash:        txHash,
+	}
+	if err := tx.Create(history).Error; err != nil {
+		return fmt.Errorf("创建充值记录失败: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// fakeChainService 测试用区块链服务，返回预置的入账交易
+type fakeChainService struct {
+	chain        string
+	transactions []*TransactionInfo
+	scans        int
+}
+
+func (f *fakeChainService) Chain() string { return f.chain }
+
+func (f *fakeChainService) ValidateTransaction(txHash string) (*TransactionInfo, error) {
+	return f.GetTransactionByHash(context.Background(), txHash)
+}
+
+func (f *fakeChainService) GetTransactionStatus(txHash string) (TransactionStatus, error) {
+	return TransactionStatusConfirmed, nil
+}
+
+func (f *fakeChainService) MonitorAddress(address string) error { return nil }
+
+func (f *fakeChainService) GetAddressTransactions(address string, limit int) ([]*TransactionInfo, error) {
+	return f.transactions, nil
+}
+
+func (f *fakeChainService) IsTransactionConfirmed(txHash string, requiredConfirmations int) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeChainService) GetAddressIncomingTransactions(ctx context.Context, address string, minAmount string) ([]*TransactionInfo, error) {
+	return f.transactions, nil
+}
+
+func (f *fakeChainService) GetTransactionByHash(ctx context.Context, txHash string) (*TransactionInfo, error) {
+	for _, tx := range f.transactions {
+		if tx.TxHash == txHash {
+			// 预置交易未指定状态时视为执行成功
+			if tx.Status == "" {
+				detail := *tx
+				detail.Status = string(TransactionStatusConfirmed)
+				return &detail, nil
+			}
+			return tx, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, txHash)
+}
+
+// ScanIncomingTransfers 返回预置交易中该资产的转账，游标只记录扫描次数
+func (f *fakeChainService) ScanIncomingTransfers(ctx context.Context, address string, asset *models.Asset, cursor ScanCursor) (*ScanResult, error) {
+	f.scans++
+	result := &ScanResult{Next: ScanCursor{Timestamp: cursor.Timestamp + 1}}
+	for _, tx := range f.transactions {
+		if transactionMatchesAsset(tx, asset) {
+			result.Transfers = append(result.Transfers, tx)
+		}
+	}
+	return result, nil
+}
+
+// MatchTransactionAmount 按数值比较（sqlite 读回的精确金额会去掉末尾的 0）
+func (f *fakeChainService) MatchTransactionAmount(txAmount string, targetAmount string) bool {
+	txValue, err := parseDecimal(txAmount)
+	if err != nil {
+		return false
+	}
+	targetValue, err := parseDecimal(targetAmount)
+	return err == nil && txValue.Cmp(targetValue) == 0
+}
+
+func (f *fakeChainService) ValidateAddress(ctx context.Context, address string) (bool, error) {
+	return true, nil
+}
+
+// TestRechargeWithConvertedAsset TRX 充值按汇率折算，只有同资产的转账才能确认订单
+func TestRechargeWithConvertedAsset(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	assetService := NewAssetService(repository.NewAssetRepository(db))
+	tron := &fakeChainService{chain: models.ChainTron}
+	rechargeService := NewRechargeService(
+		repository.NewRechargeOrderRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewDepositCursorRepository(db),
+		repository.NewOrphanDepositRepository(db),
+		assetService,
+		nil,
+		walletRepo,
+		map[string]*DepositChain{
+			models.ChainTron: {Service: tron, DepositAddress: "TDepositAddress", Confirmations: NewConfirmationPolicy(19, nil)},
+		},
+		nil,
+		nil,
+		NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo),
+		db,
+		1, 1000,
+		"",
+		0,
+	)
+
+	// TRX 默认没有汇率，不能下单
+	if _, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", models.AssetTRX); !errors.Is(err, ErrAssetRateUnavailable) {
+		t.Fatalf("未设置汇率应返回 ErrAssetRateUnavailable, 实际: %v", err)
+	}
+	// BSC 未配置收款，不能下单
+	if _, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", models.AssetUSDTBEP20); !errors.Is(err, ErrAssetNotSupported) {
+		t.Fatalf("未配置收款链应返回 ErrAssetNotSupported, 实际: %v", err)
+	}
+
+	if err := assetService.UpdateRate(ctx, "trx", "0.125"); err != nil {
+		t.Fatalf("设置汇率失败: %v", err)
+	}
+	assets, err := rechargeService.ListRechargeAssets(ctx)
+	if err != nil {
+		t.Fatalf("获取充值资产失败: %v", err)
+	}
+	if len(assets) != 2 {
+		t.Errorf("可充值资产数量 = %d, 期望 2 (USDT-TRC20, TRX)", len(assets))
+	}
+
+	order, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", "trx")
+	if err != nil {
+		t.Fatalf("创建充值订单失败: %v", err)
+	}
+	if order.Asset != models.AssetTRX || order.WalletAddress != "TDepositAddress" {
+		t.Errorf("订单资产 = %s, 收款地址 = %s", order.Asset, order.WalletAddress)
+	}
+	// 10 USD / 0.125 = 80 TRX，再加 4 位随机小数
+	if !strings.HasPrefix(order.ExactAmount, "80.") {
+		t.Errorf("精确金额 = %s, 期望 80.xxxx", order.ExactAmount)
+	}
+
+	// 金额相同但转的是 USDT，不能确认 TRX 订单
+	tron.transactions = []*TransactionInfo{
+		{TxHash: "tx-usdt", ToAddress: "TDepositAddress", Amount: order.ExactAmount, TokenSymbol: "USDT", Confirmations: 20},
+	}
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	if current, _ := rechargeService.GetRechargeOrder(ctx, order.OrderNo); current.Status != models.RechargeStatusPending {
+		t.Fatalf("USDT 转账不应确认 TRX 订单, 状态: %s", current.Status)
+	}
+
+	tron.transactions = append(tron.transactions,
+		&TransactionInfo{TxHash: "tx-trx", ToAddress: "TDepositAddress", Amount: order.ExactAmount, TokenSymbol: "TRX", Confirmations: 20},
+	)
+	if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+		t.Fatalf("处理充值订单失败: %v", err)
+	}
+	current, err := rechargeService.GetRechargeOrder(ctx, order.OrderNo)
+	if err != nil {
+		t.Fatalf("获取充值订单失败: %v", err)
+	}
+	if current.Status != models.RechargeStatusConfirmed || current.TxHash != "tx-trx" {
+		t.Fatalf("订单状态 = %s, 交易哈希 = %s", current.Status, current.TxHash)
+	}
+
+	// 钱包按计价币种入账
+	wallet, err := walletRepo.GetByUserID(ctx, 1)
+	if err != nil {
+		t.Fatalf("获取钱包失败: %v", err)
+	}
+	if wallet.Asset != models.PricingCurrency || normalizeAmount(wallet.Balance) != "10.00000000" {
+		t.Errorf("钱包资产 = %s, 余额 = %s, 期望 USD 10", wallet.Asset, wallet.Balance)
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+// WalletReconciliation 单个钱包的对账结果
+type WalletReconciliation struct {
+	UserID int64 `json:"user_id"`
+
+	// 根据业务记录回放得到的期望余额
+	ExpectedBalance string `json:"expected_balance"`
+	ExpectedFrozen  string `json:"expected_frozen"`
+
+	// 钱包缓存余额
+	WalletBalance string `json:"wallet_balance"`
+	WalletFrozen  string `json:"wallet_frozen"`
+
+	// 账本科目余额（尚未建立科目时等于钱包余额）
+	LedgerBalance string `json:"ledger_balance"`
+	LedgerFrozen  string `json:"ledger_frozen"`
+
+	// 差额 = 期望 - 实际（以账本为准）
+	BalanceDiff string `json:"balance_diff"`
+	FrozenDiff  string `json:"frozen_diff"`
+
+	// 钱包缓存与账本是否一致
+	CacheMismatch bool `json:"cache_mismatch"`
+
+	HistoryRows    int `json:"history_rows"`
+	RechargeOrders int `json:"recharge_orders"`
+	Orders         int `json:"orders"`
+	Withdrawals    int `json:"withdrawals"`
+}
+
+// HasDrift 是否存在差异
+func (r *WalletReconciliation) HasDrift() bool {
+	return r.BalanceDiff != zeroAmount || r.FrozenDiff != zeroAmount || r.CacheMismatch
+}
+
+// ReconciliationReport 对账报告
+type ReconciliationReport struct {
+	CheckedAt     time.Time               `json:"checked_at"`
+	WalletsCount  int                     `json:"wallets_count"`
+	Discrepancies []*WalletReconciliation `json:"discrepancies"`
+}
+
+// ReconciliationService 钱包对账服务接口
+// 通过回放钱包历史、已确认充值订单、已扣款订单和提现申请计算期望余额，并与钱包余额比对
+type ReconciliationService interface {
+	// ReconcileUser 对单个用户钱包对账
+	ReconcileUser(ctx context.Context, userID int64) (*WalletReconciliation, error)
+
+	// ReconcileAll 对所有钱包对账，仅返回存在差异的钱包
+	ReconcileAll(ctx context.Context) (*ReconciliationReport, error)
+
+	// FixDiscrepancy 写入调整分录使钱包余额与期望余额一致，并记录审计信息
+	FixDiscrepancy(ctx context.Context, result *WalletReconciliation, operator, reason string) (*models.LedgerEntry, error)
+}
+
+// zeroAmount 零金额的标准格式
+const zeroAmount = "0.00000000"
+
+// reconciliationService 钱包对账服务实现
+type reconciliationService struct {
+	walletRepo        repository.WalletRepository
+	walletHistoryRepo repository.WalletHistoryRepository
+	rechargeOrderRepo repository.RechargeOrderRepository
+	orderRepo         repository.OrderRepository
+	withdrawalRepo    repository.WithdrawalRepository
+	ledgerRepo        repository.LedgerRepository
+	ledgerService     LedgerService
+}
+
+// NewReconciliationService 创建钱包对账服务实例
+func NewReconciliationService(
+	walletRepo repository.WalletRepository,
+	walletHistoryRepo repository.WalletHistoryRepository,
+	rechargeOrderRepo repository.RechargeOrderRepository,
+	orderRepo repository.OrderRepository,
+	withdrawalRepo repository.WithdrawalRepository,
+	ledgerRepo repository.LedgerRepository,
+	ledgerService LedgerService,
+) ReconciliationService {
+	return &reconciliationService{
+		walletRepo:        walletRepo,
+		walletHistoryRepo: walletHistoryRepo,
+		rechargeOrderRepo: rechargeOrderRepo,
+		orderRepo:         orderRepo,
+		withdrawalRepo:    withdrawalRepo,
+		ledgerRepo:        ledgerRepo,
+		ledgerService:     ledgerService,
+	}
+}
+
+// ReconcileUser 对单个用户钱包对账
+func (s *reconciliationService) ReconcileUser(ctx context.Context, userID int64) (*WalletReconciliation, error) {
+	wallet, err := s.walletRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取钱包失败: %w", err)
+	}
+
+	expectedBalance := new(big.Float)
+	expectedFrozen := new(big.Float)
+	result := &WalletReconciliation{UserID: userID}
+
+	// 1. 已确认的充值订单：全部计入可用余额
+	rechargeOrders, err := s.rechargeOrderRepo.GetByUserIDAndStatus(ctx, userID, models.RechargeStatusConfirmed)
+	if err != nil {
+		return nil, fmt.Errorf("获取充值订单失败: %w", err)
+	}
+	for _, order := range rechargeOrders {
+		amount, err := parseDecimal(order.CreditedAmount)
+		if err != nil {
+			return nil, fmt.Errorf("充值订单 %s 金额格式错误: %w", order.OrderNo, err)
+		}
+		expectedBalance.Add(expectedBalance, amount)
+	}
+	result.RechargeOrders = len(rechargeOrders)
+
+	// 2. 已扣款的订单：处理中的订单金额冻结，已支付/已完成的订单金额已扣除
+	orders, err := s.orderRepo.GetByUserIDAndStatuses(ctx, userID, []models.OrderStatus{
+		models.OrderStatusProcessing,
+		models.OrderStatusPaid,
+		models.OrderStatusCompleted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取订单失败: %w", err)
+	}
+	for _, order := range orders {
+		amount, err := parseDecimal(order.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("订单 %s 金额格式错误: %w", order.OrderNo, err)
+		}
+		expectedBalance.Sub(expectedBalance, amount)
+		if order.Status == models.OrderStatusProcessing {
+			expectedFrozen.Add(expectedFrozen, amount)
+		}
+	}
+	result.Orders = len(orders)
+
+	// 3. 提现申请：待审核的金额冻结，已通过的金额已扣除，已拒绝的已解冻退还
+	withdrawals, err := s.withdrawalRepo.GetByUserIDAndStatuses(ctx, userID, []models.WithdrawalStatus{
+		models.WithdrawalStatusPending,
+		models.WithdrawalStatusApproved,
+	}, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("获取提现申请失败: %w", err)
+	}
+	for _, withdrawal := range withdrawals {
+		amount, err := parseDecimal(withdrawal.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("提现申请 %s 金额格式错误: %w", withdrawal.WithdrawalNo, err)
+		}
+		expectedBalance.Sub(expectedBalance, amount)
+		if withdrawal.Status == models.WithdrawalStatusPending {
+			expectedFrozen.Add(expectedFrozen, amount)
+		}
+	}
+	result.Withdrawals = len(withdrawals)
+
+	// 4. 钱包历史：只回放没有其他业务记录支撑的流水
+	histories, err := s.walletHistoryRepo.GetByUserID(ctx, userID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("获取钱包历史失败: %w", err)
+	}
+	for _, history := range histories {
+		if history.Status != models.WalletHistoryStatusCompleted {
+			continue
+		}
+		result.HistoryRows++
+
+		amount, err := parseDecimal(history.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("钱包历史 %d 金额格式错误: %w", history.ID, err)
+		}
+
+		switch history.Type {
+		case models.WalletHistoryTypeRecharge:
+			// 关联充值订单的记录已在第 1 步计入，这里只计入人工充值等无订单的记录
+			if history.RelatedType != "recharge_order" {
+				expectedBalance.Add(expectedBalance, amount)
+			}
+		case models.WalletHistoryTypePayment, models.WalletHistoryTypeRefund:
+			// 订单和提现的扣款、退款已由第 2、3 步的状态体现
+		case models.WalletHistoryTypeTransferIn, models.WalletHistoryTypeTransferOut:
+			// 转账只有钱包流水这一份业务记录，转出金额以负数记录
+			expectedBalance.Add(expectedBalance, amount)
+		case models.WalletHistoryTypeReferral:
+			// 邀请奖励同样只有钱包流水这一份业务记录
+			expectedBalance.Add(expectedBalance, amount)
+		case models.WalletHistoryTypeChargeback:
+			// 充值冲回后订单不再是已确认状态，第 1 步已不计入；余额不足未扣回的部分体现为差异
+			// 支付渠道退款没有订单状态可依，与对应的充值流水一样在这里计入（金额为负数）
+			if history.RelatedType != "recharge_order" {
+				expectedBalance.Add(expectedBalance, amount)
+			}
+		case models.WalletHistoryTypeAdjustment:
+			// 对账调整是把钱包纠正到期望值，不改变期望值本身
+		}
+	}
+
+	// 5. 账本科目余额，尚未建立科目时以钱包余额为准（首次记账会作为期初余额导入）
+	result.WalletBalance = normalizeAmount(wallet.Balance)
+	result.WalletFrozen = normalizeAmount(wallet.FrozenBalance)
+	result.LedgerBalance = result.WalletBalance
+	result.LedgerFrozen = result.WalletFrozen
+
+	accounts, err := s.ledgerRepo.GetUserAccounts(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取账本科目失败: %w", err)
+	}
+	for _, account := range accounts {
+		switch account.AccountType {
+		case models.LedgerAccountUserAvailable:
+			result.LedgerBalance = normalizeAmount(account.Balance)
+		case models.LedgerAccountUserFrozen:
+			result.LedgerFrozen = normalizeAmount(account.Balance)
+		}
+	}
+
+	result.ExpectedBalance = expectedBalance.Text('f', 8)
+	result.ExpectedFrozen = expectedFrozen.Text('f', 8)
+	result.BalanceDiff = subtractAmount(result.ExpectedBalance, result.LedgerBalance)
+	result.FrozenDiff = subtractAmount(result.ExpectedFrozen, result.LedgerFrozen)
+	result.CacheMismatch = result.WalletBalance != result.LedgerBalance || result.WalletFrozen != result.LedgerFrozen
+
+	return result, nil
+}
+
+// ReconcileAll 对所有钱包对账，仅返回存在差异的钱包
+func (s *reconciliationService) ReconcileAll(ctx context.Context) (*ReconciliationReport, error) {
+	userIDs, err := s.walletRepo.GetAllUserIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取钱包列表失败: %w", err)
+	}
+
+	report := &ReconciliationReport{
+		CheckedAt:    time.Now(),
+		WalletsCount: len(userIDs),
+	}
+
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		result, err := s.ReconcileUser(ctx, userID)
+		if err != nil {
+			return report, fmt.Errorf("用户 %d 对账失败: %w", userID, err)
+		}
+		if result.HasDrift() {
+			report.Discrepancies = append(report.Discrepancies, result)
+		}
+	}
+
+	return report, nil
+}
+
+// FixDiscrepancy 写入调整分录使钱包余额与期望余额一致，并记录审计信息
+func (s *reconciliationService) FixDiscrepancy(ctx context.Context, result *WalletReconciliation, operator, reason string) (*models.LedgerEntry, error) {
+	if result == nil || !result.HasDrift() {
+		return nil, errors.New("no discrepancy to fix")
+	}
+
+	var lines []LedgerPostingLine
+	net := new(big.Float)
+
+	addLine := func(account models.LedgerAccountType, diff string) {
+		amount, _ := parseDecimal(diff)
+		switch amount.Sign() {
+		case 1:
+			lines = append(lines, LedgerPostingLine{Account: account, Side: models.LedgerSideCredit, Amount: amount.Text('f', 8)})
+		case -1:
+			lines = append(lines, LedgerPostingLine{Account: account, Side: models.LedgerSideDebit, Amount: new(big.Float).Neg(amount).Text('f', 8)})
+		}
+		net.Add(net, amount)
+	}
+	addLine(models.LedgerAccountUserAvailable, result.BalanceDiff)
+	addLine(models.LedgerAccountUserFrozen, result.FrozenDiff)
+
+	// 用户资金净增减由充值清算科目对冲
+	switch net.Sign() {
+	case 1:
+		lines = append(lines, LedgerPostingLine{Account: models.LedgerAccountDepositClearing, Side: models.LedgerSideDebit, Amount: net.Text('f', 8)})
+	case -1:
+		lines = append(lines, LedgerPostingLine{Account: models.LedgerAccountDepositClearing, Side: models.LedgerSideCredit, Amount: new(big.Float).Neg(net).Text('f', 8)})
+	}
+
+	if len(lines) < 2 {
+		// 账本与期望一致，只是钱包缓存偏离：写一笔零影响分录无意义，直接按账本刷新缓存
+		return nil, s.refreshWalletCache(ctx, result.UserID)
+	}
+
+	relatedID := fmt.Sprintf("reconcile-%d-%d", result.UserID, time.Now().Unix())
+	description := fmt.Sprintf("对账调整: %s", reason)
+
+	// 调整分录和审计历史在同一事务中写入，不会出现账本已调整却没有审计记录的情况
+	var entry *models.LedgerEntry
+	err := s.ledgerService.Transaction(ctx, func(tx *gorm.DB) error {
+		ledgerResult, err := s.ledgerService.PostInTx(ctx, tx, &LedgerPosting{
+			UserID:      result.UserID,
+			EntryType:   models.LedgerEntryTypeAdjustment,
+			RelatedID:   relatedID,
+			Description: description,
+			Lines:       lines,
+		})
+		if err != nil {
+			return fmt.Errorf("写入调整分录失败: %w", err)
+		}
+
+		// 审计信息：操作人、原因以及调整前的对账快照
+		metadata, _ := json.Marshal(map[string]interface{}{
+			"operator":       operator,
+			"reason":         reason,
+			"ledger_entry":   ledgerResult.Entry.ID,
+			"reconciliation": result,
+		})
+
+		history := &models.WalletHistory{
+			UserID:        result.UserID,
+			Type:          models.WalletHistoryTypeAdjustment,
+			Amount:        result.BalanceDiff,
+			BalanceBefore: ledgerResult.WalletBefore.Balance,
+			BalanceAfter:  ledgerResult.WalletAfter.Balance,
+			Status:        models.WalletHistoryStatusCompleted,
+			Description:   description,
+			RelatedType:   "reconciliation",
+			RelatedID:     relatedID,
+			Metadata:      string(metadata),
+		}
+		if err := tx.Create(history).Error; err != nil {
+			return fmt.Errorf("写入调整历史失败: %w", err)
+		}
+
+		entry = ledgerResult.Entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// refreshWalletCache 按账本科目余额刷新钱包缓存
+// 锁定钱包后在同一事务中重新读取科目余额，并以版本号 CAS 更新，不会覆盖并发记账的结果
+func (s *reconciliationService) refreshWalletCache(ctx context.Context, userID int64) error {
+	return s.ledgerService.Transaction(ctx, func(tx *gorm.DB) error {
+		walletRepo := s.walletRepo.WithTx(tx)
+		wallet, err := walletRepo.GetOrCreateForUpdate(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("获取钱包失败: %w", err)
+		}
+
+		accounts, err := s.ledgerRepo.WithTx(tx).GetUserAccounts(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("获取账本科目失败: %w", err)
+		}
+		for _, account := range accounts {
+			switch account.AccountType {
+			case models.LedgerAccountUserAvailable:
+				wallet.Balance = normalizeAmount(account.Balance)
+			case models.LedgerAccountUserFrozen:
+				wallet.FrozenBalance = normalizeAmount(account.Balance)
+			}
+		}
+		return walletRepo.Update(ctx, wallet)
+	})
+}
+
+// normalizeAmount 统一金额格式为 8 位小数
+func normalizeAmount(s string) string {
+	amount, err := parseDecimal(s)
+	if err != nil {
+		return s
+	}
+	return amount.Text('f', 8)
+}
+
+// subtractAmount 计算 a - b
+func subtractAmount(a, b string) string {
+	x, _ := parseDecimal(a)
+	y, _ := parseDecimal(b)
+	diff := new(big.Float).Sub(x, y).Text('f', 8)
+	if diff == "-"+zeroAmount {
+		return zeroAmount
+	}
+	return diff
+}
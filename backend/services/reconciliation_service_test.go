@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestFixDiscrepancy 调整分录与审计历史一起写入；只有缓存偏离时按账本刷新钱包缓存
+func TestFixDiscrepancy(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	walletService := NewWalletService(walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil)
+	reconciliation := NewReconciliationService(walletRepo, repository.NewWalletHistoryRepository(db), repository.NewRechargeOrderRepository(db),
+		repository.NewOrderRepository(db), repository.NewWithdrawalRepository(db), repository.NewLedgerRepository(db), ledgerService)
+
+	reconcile := func() *WalletReconciliation {
+		t.Helper()
+		result, err := reconciliation.ReconcileUser(ctx, 1)
+		if err != nil {
+			t.Fatalf("对账失败: %v", err)
+		}
+		return result
+	}
+
+	// 没有业务记录的入账：期望余额为 0，账本为 20
+	if err := walletService.AddBalance(ctx, 1, "20", "", "无记录入账"); err != nil {
+		t.Fatalf("入账失败: %v", err)
+	}
+	result := reconcile()
+	if result.BalanceDiff != "-20.00000000" {
+		t.Fatalf("余额差额 = %s, 期望 -20", result.BalanceDiff)
+	}
+	entry, err := reconciliation.FixDiscrepancy(ctx, result, "tester", "测试")
+	if err != nil || entry == nil {
+		t.Fatalf("写入调整失败: %v", err)
+	}
+	var adjustments int64
+	if err := db.Model(&models.WalletHistory{}).Where("type = ? AND related_id = ?", models.WalletHistoryTypeAdjustment, entry.RelatedID).Count(&adjustments).Error; err != nil || adjustments != 1 {
+		t.Fatalf("调整历史 = %d (%v), 期望 1 条", adjustments, err)
+	}
+	if result := reconcile(); result.HasDrift() {
+		t.Fatalf("调整后仍有差异: %+v", result)
+	}
+
+	// 钱包缓存偏离账本：按账本刷新缓存，不写分录
+	if err := walletRepo.UpdateBalance(ctx, 1, "5", "0"); err != nil {
+		t.Fatalf("修改钱包缓存失败: %v", err)
+	}
+	result = reconcile()
+	if !result.CacheMismatch || result.BalanceDiff != zeroAmount {
+		t.Fatalf("对账结果 = %+v, 期望只有缓存偏离", result)
+	}
+	if entry, err := reconciliation.FixDiscrepancy(ctx, result, "tester", "刷新缓存"); err != nil || entry != nil {
+		t.Fatalf("刷新缓存 = %v (%v), 期望不写分录", entry, err)
+	}
+	if result := reconcile(); result.HasDrift() {
+		t.Fatalf("刷新缓存后仍有差异: %+v", result)
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSelfReferral 不能邀请自己
+	ErrSelfReferral = errors.New("cannot refer yourself")
+	// ErrReferralLoop 邀请关系形成环（如 A 邀请 B 后 B 再邀请 A）
+	ErrReferralLoop = errors.New("referral loop detected")
+	// ErrAlreadyReferred 用户已绑定邀请人
+	ErrAlreadyReferred = errors.New("user already has a referrer")
+	// ErrReferrerNotFound 邀请人不存在
+	ErrReferrerNotFound = errors.New("referrer not found")
+	// ErrReferralNotEligible 用户已下过单，不再是新用户
+	ErrReferralNotEligible = errors.New("user is not eligible for referral")
+)
+
+// maxReferralChainDepth 检查邀请环时向上追溯的最大层数
+const maxReferralChainDepth = 64
+
+// ReferralInfo 用户的邀请信息
+type ReferralInfo struct {
+	Link         string `json:"link"`          // 专属邀请链接
+	InvitedCount int64  `json:"invited_count"` // 邀请人数
+	RewardedNum  int64  `json:"rewarded_num"`  // 已完成首单（已发放奖励）的人数
+	TotalEarned  string `json:"total_earned"`  // 累计获得的邀请奖励
+	InviterBonus string `json:"inviter_bonus"` // 每邀请一人可获得的奖励
+	InviteeBonus string `json:"invitee_bonus"` // 被邀请人首单完成后获得的奖励
+}
+
+// ReferralService 邀请服务接口
+// 邀请关系通过 /start ref_<邀请人ID> 绑定，被邀请人首个 eSIM 订单完成后双方各获得一次奖励
+type ReferralService interface {
+	// BindReferrer 绑定邀请关系，拒绝自己邀请自己、邀请环、重复绑定和已下单用户
+	BindReferrer(ctx context.Context, userID, referrerID int64) error
+
+	// RewardFirstOrder 被邀请人订单完成时发放邀请奖励，每个被邀请人只发放一次，重复调用不会重复发放
+	RewardFirstOrder(ctx context.Context, userID int64, orderNo string) error
+
+	// GetReferralInfo 获取用户的邀请链接、邀请人数和累计奖励
+	GetReferralInfo(ctx context.Context, userID int64) (*ReferralInfo, error)
+}
+
+// referralService 邀请服务实现
+type referralService struct {
+	userRepo            repository.UserRepository
+	orderRepo           repository.OrderRepository
+	walletRepo          repository.WalletRepository
+	walletHistoryRepo   repository.WalletHistoryRepository
+	ledgerService       LedgerService
+	notificationService NotificationService
+	config              *config.ReferralConfig
+	botUsername         string
+}
+
+// NewReferralService 创建邀请服务实例
+// notificationService 可以为 nil，此时发放奖励后不发送通知
+func NewReferralService(
+	userRepo repository.UserRepository,
+	orderRepo repository.OrderRepository,
+	walletRepo repository.WalletRepository,
+	walletHistoryRepo repository.WalletHistoryRepository,
+	ledgerService LedgerService,
+	notificationService NotificationService,
+	cfg *config.ReferralConfig,
+	botUsername string,
+) ReferralService {
+	return &referralService{
+		userRepo:            userRepo,
+		orderRepo:           orderRepo,
+		walletRepo:          walletRepo,
+		walletHistoryRepo:   walletHistoryRepo,
+		ledgerService:       ledgerService,
+		notificationService: notificationService,
+		config:              cfg,
+		botUsername:         botUsername,
+	}
+}
+
+// BindReferrer 绑定邀请关系
+func (s *referralService) BindReferrer(ctx context.Context, userID, referrerID int64) error {
+	if userID == referrerID {
+		return ErrSelfReferral
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("获取用户失败: %w", err)
+	}
+	if user.ReferredBy != 0 {
+		return ErrAlreadyReferred
+	}
+
+	referrer, err := s.userRepo.GetByTelegramID(ctx, referrerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReferrerNotFound
+		}
+		return fmt.Errorf("获取邀请人失败: %w", err)
+	}
+	if !referrer.IsActive {
+		return ErrReferrerNotFound
+	}
+
+	// 只有尚未下单的新用户可以绑定邀请人，避免老用户互相绑定刷奖励
+	orderCount, err := s.orderRepo.CountByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("统计用户订单失败: %w", err)
+	}
+	if orderCount > 0 {
+		return ErrReferralNotEligible
+	}
+
+	// 沿邀请人的上级链追溯，链上出现当前用户说明会形成环
+	ancestor := referrer
+	for depth := 0; ancestor.ReferredBy != 0; depth++ {
+		if ancestor.ReferredBy == userID || depth >= maxReferralChainDepth {
+			return ErrReferralLoop
+		}
+		ancestor, err = s.userRepo.GetByTelegramID(ctx, ancestor.ReferredBy)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				break
+			}
+			return fmt.Errorf("查询邀请链失败: %w", err)
+		}
+	}
+
+	bound, err := s.userRepo.SetReferrer(ctx, userID, referrerID)
+	if err != nil {
+		return fmt.Errorf("绑定邀请人失败: %w", err)
+	}
+	if !bound {
+		return ErrAlreadyReferred
+	}
+	return nil
+}
+
+// RewardFirstOrder 被邀请人订单完成时发放邀请奖励
+// 记账：借 营销费用，贷 用户可用余额（邀请人和被邀请人各一笔）
+func (s *referralService) RewardFirstOrder(ctx context.Context, userID int64, orderNo string) error {
+	if s.config == nil || !s.config.Enabled {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("获取用户失败: %w", err)
+	}
+	if user.ReferredBy == 0 || user.RewardedAt != nil {
+		return nil
+	}
+	referrerID := user.ReferredBy
+
+	// 关联ID按被邀请人生成，每个被邀请人只对应一组奖励
+	relatedID := fmt.Sprintf("REF%d", userID)
+	rewards := []struct {
+		userID      int64
+		amount      float64
+		suffix      string
+		description string
+	}{
+		{referrerID, s.config.InviterReward, "inviter", fmt.Sprintf("邀请奖励 - 好友 %d 完成首单 %s", userID, orderNo)},
+		{userID, s.config.InviteeReward, "invitee", fmt.Sprintf("新用户首单奖励 - 订单号: %s", orderNo)},
+	}
+
+	rewarded := false
+	err = s.ledgerService.Transaction(ctx, func(tx *gorm.DB) error {
+		// 条件更新抢占发放资格，并发完成多个订单时只有一个事务能继续
+		marked, err := s.userRepo.WithTx(tx).MarkReferralRewarded(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("标记邀请奖励失败: %w", err)
+		}
+		if !marked {
+			return nil
+		}
+
+		// 按用户ID升序锁定双方钱包
+		walletRepo := s.walletRepo.WithTx(tx)
+		lockOrder := []int64{referrerID, userID}
+		if referrerID > userID {
+			lockOrder = []int64{userID, referrerID}
+		}
+		for _, id := range lockOrder {
+			if _, err := walletRepo.GetOrCreateForUpdate(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		for _, reward := range rewards {
+			if reward.amount <= 0 {
+				continue
+			}
+			amountText := fmt.Sprintf("%.2f", reward.amount)
+
+			posting := NewLedgerTransfer(
+				reward.userID,
+				models.LedgerEntryTypeReferral,
+				models.LedgerAccountMarketingExpense,
+				models.LedgerAccountUserAvailable,
+				amountText,
+				relatedID+"-"+reward.suffix,
+				reward.description,
+			)
+			posting.Idempotent = true
+			result, err := s.ledgerService.PostInTx(ctx, tx, posting)
+			if err != nil {
+				return err
+			}
+
+			history := &models.WalletHistory{
+				UserID:        reward.userID,
+				Type:          models.WalletHistoryTypeReferral,
+				Amount:        amountText,
+				BalanceBefore: result.WalletBefore.Balance,
+				BalanceAfter:  result.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   reward.description,
+				RelatedType:   "referral",
+				RelatedID:     relatedID,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return fmt.Errorf("创建邀请奖励记录失败: %w", err)
+			}
+		}
+
+		rewarded = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 通知在事务外发送，失败不影响奖励结果
+	if rewarded && s.notificationService != nil {
+		for _, reward := range rewards {
+			if reward.amount <= 0 {
+				continue
+			}
+			message := fmt.Sprintf("🎁 <b>邀请奖励到账</b>\n\n%s\n💰 <b>金额:</b> %.2f USDT", reward.description, reward.amount)
+			if err := s.notificationService.SendMessage(ctx, reward.userID, message); err != nil {
+				fmt.Printf("Warning: failed to notify referral reward to user %d: %v\n", reward.userID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetReferralInfo 获取用户的邀请信息
+func (s *referralService) GetReferralInfo(ctx context.Context, userID int64) (*ReferralInfo, error) {
+	invited, rewarded, err := s.userRepo.CountReferrals(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("统计邀请人数失败: %w", err)
+	}
+
+	totalEarned, err := s.walletHistoryRepo.SumAmountByUserIDAndType(ctx, userID, models.WalletHistoryTypeReferral)
+	if err != nil {
+		return nil, fmt.Errorf("统计邀请奖励失败: %w", err)
+	}
+
+	info := &ReferralInfo{
+		Link:         ReferralLink(s.botUsername, userID),
+		InvitedCount: invited,
+		RewardedNum:  rewarded,
+		TotalEarned:  normalizeAmount(totalEarned),
+		InviterBonus: "0.00",
+		InviteeBonus: "0.00",
+	}
+	if s.config != nil && s.config.Enabled {
+		info.InviterBonus = fmt.Sprintf("%.2f", s.config.InviterReward)
+		info.InviteeBonus = fmt.Sprintf("%.2f", s.config.InviteeReward)
+	}
+	return info, nil
+}
+
+// ReferralLink 生成用户的专属邀请链接
+func ReferralLink(botUsername string, userID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=ref_%d", botUsername, userID)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestReferralBindAndReward 邀请绑定的防刷校验，以及首单奖励并发触发时只发放一次
+func TestReferralBindAndReward(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	referralService := NewReferralService(
+		userRepo,
+		repository.NewOrderRepository(db),
+		walletRepo,
+		repository.NewWalletHistoryRepository(db),
+		ledgerService,
+		nil,
+		&config.ReferralConfig{Enabled: true, InviterReward: 2, InviteeReward: 1},
+		"esim_bot",
+	)
+
+	for _, id := range []int64{1, 2, 3} {
+		if err := userRepo.Create(ctx, &models.User{TelegramID: id, IsActive: true}); err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+
+	if err := referralService.BindReferrer(ctx, 1, 1); !errors.Is(err, ErrSelfReferral) {
+		t.Errorf("自己邀请自己应返回 ErrSelfReferral, 实际: %v", err)
+	}
+	if err := referralService.BindReferrer(ctx, 2, 99); !errors.Is(err, ErrReferrerNotFound) {
+		t.Errorf("邀请人不存在应返回 ErrReferrerNotFound, 实际: %v", err)
+	}
+	// 1 邀请 2，2 邀请 3
+	if err := referralService.BindReferrer(ctx, 2, 1); err != nil {
+		t.Fatalf("绑定邀请关系失败: %v", err)
+	}
+	if err := referralService.BindReferrer(ctx, 3, 2); err != nil {
+		t.Fatalf("绑定邀请关系失败: %v", err)
+	}
+	if err := referralService.BindReferrer(ctx, 2, 3); !errors.Is(err, ErrAlreadyReferred) {
+		t.Errorf("重复绑定应返回 ErrAlreadyReferred, 实际: %v", err)
+	}
+	// 3 -> 2 -> 1，1 再绑定 3 会形成环
+	if err := referralService.BindReferrer(ctx, 1, 3); !errors.Is(err, ErrReferralLoop) {
+		t.Errorf("邀请环应返回 ErrReferralLoop, 实际: %v", err)
+	}
+
+	// 多个订单同时完成，奖励只发放一次
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := referralService.RewardFirstOrder(ctx, 2, fmt.Sprintf("ORD%d", i)); err != nil {
+				t.Errorf("发放邀请奖励失败: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for userID, want := range map[int64]string{1: "2.00000000", 2: "1.00000000"} {
+		wallet, err := walletRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if got := normalizeAmount(wallet.Balance); got != want {
+			t.Errorf("用户 %d 余额 = %s, 期望 %s", userID, got, want)
+		}
+	}
+
+	info, err := referralService.GetReferralInfo(ctx, 1)
+	if err != nil {
+		t.Fatalf("获取邀请信息失败: %v", err)
+	}
+	if info.InvitedCount != 1 || info.RewardedNum != 1 {
+		t.Errorf("邀请人数 = %d, 已奖励人数 = %d, 期望 1 和 1", info.InvitedCount, info.RewardedNum)
+	}
+	if info.TotalEarned != "2.00000000" {
+		t.Errorf("累计奖励 = %s, 期望 2.00000000", info.TotalEarned)
+	}
+	if info.Link != "https://t.me/esim_bot?start=ref_1" {
+		t.Errorf("邀请链接 = %s", info.Link)
+	}
+}
@@ -0,0 +1,473 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrGatewayPaymentNotFound 支付记录不存在
+	ErrGatewayPaymentNotFound = errors.New("gateway payment not found")
+	// ErrGatewayPaymentMismatch 回调的用户、币种或数量与发票不一致
+	ErrGatewayPaymentMismatch = errors.New("gateway payment mismatch")
+	// ErrGatewayPaymentExpired 发票已过期
+	ErrGatewayPaymentExpired = errors.New("gateway payment expired")
+	// ErrGatewayPaymentNotPending 发票已支付或已退款
+	ErrGatewayPaymentNotPending = errors.New("gateway payment not pending")
+	// ErrGatewayPaymentNotPaid 支付记录不是已支付状态，无法退款
+	ErrGatewayPaymentNotPaid = errors.New("gateway payment not paid")
+)
+
+// starsAlreadyRefunded Telegram 对已退款的支付返回的错误描述
+const starsAlreadyRefunded = "CHARGE_ALREADY_REFUNDED"
+
+// starsGateway Telegram Stars 支付渠道实现
+// 发票币种为 XTR，provider_token 为空；PaymentNo 作为发票载荷，支付成功后以 telegram_payment_charge_id 幂等入账
+type starsGateway struct {
+	paymentRepo         repository.GatewayPaymentRepository
+	ledgerService       LedgerService
+	notificationService NotificationService
+	events              EventPublisher
+	bot                 *tgbotapi.BotAPI
+	config              *config.StarsConfig
+	db                  *gorm.DB
+}
+
+// NewStarsGateway 创建 Telegram Stars 支付渠道实例
+// notificationService 可以为 nil，此时入账和退款后不发送通知；events 可以为 nil，此时入账后不推送实时事件
+func NewStarsGateway(
+	paymentRepo repository.GatewayPaymentRepository,
+	ledgerService LedgerService,
+	notificationService NotificationService,
+	events EventPublisher,
+	bot *tgbotapi.BotAPI,
+	cfg *config.StarsConfig,
+	db *gorm.DB,
+) PaymentGateway {
+	return &starsGateway{
+		paymentRepo:         paymentRepo,
+		ledgerService:       ledgerService,
+		notificationService: notificationService,
+		events:              events,
+		bot:                 bot,
+		config:              cfg,
+		db:                  db,
+	}
+}
+
+// Name 支付渠道标识
+func (g *starsGateway) Name() string {
+	return models.PaymentGatewayTelegramStars
+}
+
+// CreateInvoiceLink 创建发票链接
+func (g *starsGateway) CreateInvoiceLink(ctx context.Context, userID int64, amount string) (*GatewayInvoice, error) {
+	payment, err := g.createPayment(ctx, userID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.bot.MakeRequest("createInvoiceLink", g.invoiceParams(payment))
+	if err != nil {
+		return nil, fmt.Errorf("创建 Stars 发票链接失败: %w", err)
+	}
+	var link string
+	if err := json.Unmarshal(resp.Result, &link); err != nil {
+		return nil, fmt.Errorf("解析 Stars 发票链接失败: %w", err)
+	}
+
+	return &GatewayInvoice{Payment: payment, InvoiceLink: link}, nil
+}
+
+// SendInvoice 发送发票到聊天
+func (g *starsGateway) SendInvoice(ctx context.Context, chatID int64, userID int64, amount string) (*models.GatewayPayment, error) {
+	payment, err := g.createPayment(ctx, userID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	params := g.invoiceParams(payment)
+	params.AddFirstValid("chat_id", chatID)
+	if _, err := g.bot.MakeRequest("sendInvoice", params); err != nil {
+		return nil, fmt.Errorf("发送 Stars 发票失败: %w", err)
+	}
+	return payment, nil
+}
+
+// ValidateCheckout 预结账校验
+func (g *starsGateway) ValidateCheckout(ctx context.Context, checkout *GatewayCheckout) error {
+	payment, err := g.GetPayment(ctx, checkout.Payload)
+	if err != nil {
+		return err
+	}
+	if err := checkStarsCheckout(payment, checkout); err != nil {
+		return err
+	}
+	if payment.Status != models.GatewayPaymentStatusPending {
+		return ErrGatewayPaymentNotPending
+	}
+	if payment.IsExpired() {
+		return ErrGatewayPaymentExpired
+	}
+	return nil
+}
+
+// CompletePayment 支付成功后入账
+// 支付信息、账本分录和钱包流水在同一事务中写入；账本以支付单号幂等，支付记录以渠道支付ID唯一
+func (g *starsGateway) CompletePayment(ctx context.Context, checkout *GatewayCheckout) (*models.GatewayPayment, error) {
+	if checkout.ChargeID == "" {
+		return nil, errors.New("渠道支付ID不能为空")
+	}
+	// 同一笔支付重复回调时直接返回首次入账的记录
+	if existing, err := g.paymentRepo.GetByChargeID(ctx, checkout.ChargeID); err == nil {
+		return existing, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取支付记录失败: %w", err)
+	}
+
+	invoice, err := g.GetPayment(ctx, checkout.Payload)
+	if err != nil {
+		return nil, err
+	}
+	// 已经扣款成功，预结账之后发票过期不影响入账
+	if err := checkStarsCheckout(invoice, checkout); err != nil {
+		return nil, err
+	}
+
+	var payment *models.GatewayPayment
+	var duplicate bool
+	err = RetryOnConflict(ctx, func() error {
+		duplicate = false
+		return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			paymentRepo := g.paymentRepo.WithTx(tx)
+			now := time.Now()
+
+			chargeID := checkout.ChargeID
+			current := *invoice
+			updated, err := paymentRepo.MarkPaid(ctx, current.ID, chargeID, now)
+			if err != nil {
+				return fmt.Errorf("更新支付记录失败: %w", err)
+			}
+			if !updated {
+				// 同一发票被再次支付（例如重复打开发票链接），Stars 已扣除，按发票金额另建一条已支付记录入账，
+				// 并标记原支付单号，由运营核查后决定是否退款
+				duplicate = true
+				current = models.GatewayPayment{
+					Gateway:     invoice.Gateway,
+					UserID:      invoice.UserID,
+					Currency:    invoice.Currency,
+					TotalAmount: invoice.TotalAmount,
+					Amount:      invoice.Amount,
+					Rate:        invoice.Rate,
+					Status:      models.GatewayPaymentStatusPaid,
+					ChargeID:    &chargeID,
+					ExpiresAt:   invoice.ExpiresAt,
+					PaidAt:      &now,
+					Remark:      fmt.Sprintf("重复支付发票 %s，待核查退款", invoice.PaymentNo),
+					DuplicateOf: invoice.PaymentNo,
+				}
+				if err := paymentRepo.Create(ctx, &current); err != nil {
+					return fmt.Errorf("创建支付记录失败: %w", err)
+				}
+			}
+			current.Status = models.GatewayPaymentStatusPaid
+			current.ChargeID = &chargeID
+			current.PaidAt = &now
+
+			remark := fmt.Sprintf("Telegram Stars 充值，支付单号: %s，支付 %d Stars，汇率 %s，渠道支付ID: %s",
+				current.PaymentNo, current.TotalAmount, current.Rate, chargeID)
+			posting := NewLedgerTransfer(
+				current.UserID,
+				models.LedgerEntryTypeRecharge,
+				models.LedgerAccountDepositClearing,
+				models.LedgerAccountUserAvailable,
+				current.Amount,
+				current.PaymentNo,
+				remark,
+			)
+			posting.Idempotent = true
+
+			result, err := g.ledgerService.PostInTx(ctx, tx, posting)
+			if err != nil {
+				return fmt.Errorf("更新钱包余额失败: %w", err)
+			}
+
+			history := &models.WalletHistory{
+				UserID:        current.UserID,
+				Type:          models.WalletHistoryTypeRecharge,
+				Amount:        current.Amount,
+				BalanceBefore: result.WalletBefore.Balance,
+				BalanceAfter:  result.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   remark,
+				RelatedType:   "gateway_payment",
+				RelatedID:     current.PaymentNo,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return fmt.Errorf("创建充值记录失败: %w", err)
+			}
+
+			payment = &current
+			return nil
+		})
+	})
+	if err != nil {
+		// 并发回调由另一方先入账时，渠道支付ID的唯一索引使本次失败，返回已入账的记录
+		if existing, getErr := g.paymentRepo.GetByChargeID(ctx, checkout.ChargeID); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	if duplicate {
+		g.alertDuplicatePayment(ctx, payment)
+	}
+
+	if g.notificationService != nil {
+		if err := g.notificationService.SendRechargeSuccessNotification(ctx, payment.UserID, payment.Amount, payment.PaymentNo); err != nil {
+			// 通知发送失败不影响入账
+			fmt.Printf("发送充值成功通知失败: %v\n", err)
+		}
+	}
+
+	// 推送到账事件，Mini App 收到后刷新余额
+	if g.events != nil {
+		g.events.Publish(payment.UserID, EventRechargeConfirmed, map[string]interface{}{
+			"payment_no": payment.PaymentNo,
+			"amount":     payment.Amount,
+			"gateway":    payment.Gateway,
+			"status":     payment.Status,
+			"paid_at":    payment.PaidAt,
+		})
+	}
+	return payment, nil
+}
+
+// alertDuplicatePayment 记录并告警发票被重复支付，运营核查后可通过 refund-stars 退款
+func (g *starsGateway) alertDuplicatePayment(ctx context.Context, payment *models.GatewayPayment) {
+	fmt.Printf("[WARNING] Stars invoice %s paid again as %s (user %d, %d Stars), flagged for refund review\n",
+		payment.DuplicateOf, payment.PaymentNo, payment.UserID, payment.TotalAmount)
+	if g.notificationService == nil {
+		return
+	}
+
+	message := fmt.Sprintf("⚠️ Stars 发票重复支付，请核查是否退款\n\n👤 用户: %d\n📋 原支付单号: %s\n📋 重复支付单号: %s\n⭐ 支付: %d Stars\n💰 已入账: %s USD\n\n退款: gm -cmd refund-stars -no %s -reason \"重复支付\"",
+		payment.UserID, payment.DuplicateOf, payment.PaymentNo, payment.TotalAmount, payment.Amount, payment.PaymentNo)
+	if err := g.notificationService.SendAdminAlert(ctx, message); err != nil {
+		fmt.Printf("[ERROR] Failed to send duplicate payment alert: %v\n", err)
+	}
+}
+
+// Refund 退款
+// 先在事务中标记退款并扣回入账金额，最后调用 Telegram 退款接口，接口失败时整个事务回滚
+func (g *starsGateway) Refund(ctx context.Context, paymentNo, operator, reason string) (*models.GatewayPayment, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("退款原因不能为空")
+	}
+
+	payment, err := g.GetPayment(ctx, paymentNo)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.GatewayPaymentStatusPaid || payment.ChargeID == nil {
+		return nil, fmt.Errorf("%w: 当前状态 %s", ErrGatewayPaymentNotPaid, payment.Status)
+	}
+
+	remark := fmt.Sprintf("Telegram Stars 退款，支付单号: %s，退回 %d Stars，扣回 %s，操作人: %s，原因: %s",
+		payment.PaymentNo, payment.TotalAmount, payment.Amount, operator, reason)
+
+	now := time.Now()
+	err = RetryOnConflict(ctx, func() error {
+		return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			updated, err := g.paymentRepo.WithTx(tx).MarkRefunded(ctx, payment.ID, operator, reason, now)
+			if err != nil {
+				return fmt.Errorf("更新支付记录失败: %w", err)
+			}
+			if !updated {
+				return ErrGatewayPaymentNotPaid
+			}
+
+			posting := NewLedgerTransfer(
+				payment.UserID,
+				models.LedgerEntryTypeRechargeRevert,
+				models.LedgerAccountUserAvailable,
+				models.LedgerAccountDepositClearing,
+				payment.Amount,
+				payment.PaymentNo,
+				remark,
+			)
+			posting.Idempotent = true
+
+			result, err := g.ledgerService.PostInTx(ctx, tx, posting)
+			if err != nil {
+				if errors.Is(err, ErrInsufficientBalance) {
+					return fmt.Errorf("用户余额不足，无法扣回入账金额: %w", err)
+				}
+				return fmt.Errorf("更新钱包余额失败: %w", err)
+			}
+
+			history := &models.WalletHistory{
+				UserID:        payment.UserID,
+				Type:          models.WalletHistoryTypeChargeback,
+				Amount:        "-" + normalizeAmount(payment.Amount),
+				BalanceBefore: result.WalletBefore.Balance,
+				BalanceAfter:  result.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   remark,
+				RelatedType:   "gateway_payment",
+				RelatedID:     payment.PaymentNo,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return fmt.Errorf("创建退款记录失败: %w", err)
+			}
+
+			return g.refundStarPayment(payment)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payment.Status = models.GatewayPaymentStatusRefunded
+	payment.Operator = operator
+	payment.Remark = reason
+	payment.RefundedAt = &now
+
+	if g.notificationService != nil {
+		message := fmt.Sprintf("↩️ 您的 Stars 充值已退款\n\n📋 支付单号: %s\n⭐ 退回: %d Stars\n💰 扣回余额: %s USD",
+			payment.PaymentNo, payment.TotalAmount, payment.Amount)
+		if err := g.notificationService.SendMessage(ctx, payment.UserID, message); err != nil {
+			fmt.Printf("发送退款通知失败: %v\n", err)
+		}
+	}
+	return payment, nil
+}
+
+// GetPayment 获取支付记录
+func (g *starsGateway) GetPayment(ctx context.Context, paymentNo string) (*models.GatewayPayment, error) {
+	payment, err := g.paymentRepo.GetByPaymentNo(ctx, paymentNo)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGatewayPaymentNotFound
+		}
+		return nil, fmt.Errorf("获取支付记录失败: %w", err)
+	}
+	if payment.Gateway != models.PaymentGatewayTelegramStars {
+		return nil, ErrGatewayPaymentNotFound
+	}
+	return payment, nil
+}
+
+// createPayment 校验金额并创建待支付记录
+func (g *starsGateway) createPayment(ctx context.Context, userID int64, amount string) (*models.GatewayPayment, error) {
+	amountFloat, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return nil, fmt.Errorf("充值金额格式错误")
+	}
+	if amountFloat < g.config.MinAmount {
+		return nil, fmt.Errorf("充值金额不能低于 %.2f USD", g.config.MinAmount)
+	}
+	if amountFloat > g.config.MaxAmount {
+		return nil, fmt.Errorf("充值金额不能超过 %.2f USD", g.config.MaxAmount)
+	}
+
+	rate := strconv.FormatFloat(g.config.USDPerStar, 'f', -1, 64)
+	stars, credit, err := starsForAmount(amount, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &models.GatewayPayment{
+		Gateway:     models.PaymentGatewayTelegramStars,
+		UserID:      userID,
+		Currency:    models.CurrencyXTR,
+		TotalAmount: stars,
+		Amount:      credit,
+		Rate:        rate,
+		ExpiresAt:   time.Now().Add(time.Duration(g.config.InvoiceExpireMinutes) * time.Minute),
+	}
+	if err := g.paymentRepo.Create(ctx, payment); err != nil {
+		return nil, fmt.Errorf("创建支付记录失败: %w", err)
+	}
+	return payment, nil
+}
+
+// invoiceParams Stars 发票参数，sendInvoice 与 createInvoiceLink 共用
+func (g *starsGateway) invoiceParams(payment *models.GatewayPayment) tgbotapi.Params {
+	params := make(tgbotapi.Params)
+	params["title"] = "钱包充值"
+	params["description"] = fmt.Sprintf("使用 %d Stars 充值 %s USD 到钱包余额", payment.TotalAmount, payment.Amount)
+	params["payload"] = payment.PaymentNo
+	params["provider_token"] = ""
+	params["currency"] = models.CurrencyXTR
+	_ = params.AddInterface("prices", []tgbotapi.LabeledPrice{
+		{Label: "钱包充值", Amount: int(payment.TotalAmount)},
+	})
+	return params
+}
+
+// refundStarPayment 调用 Telegram 退款接口，已退款的支付视为成功（事务重试时可能重复调用）
+func (g *starsGateway) refundStarPayment(payment *models.GatewayPayment) error {
+	params := make(tgbotapi.Params)
+	params.AddFirstValid("user_id", payment.UserID)
+	params["telegram_payment_charge_id"] = *payment.ChargeID
+	if _, err := g.bot.MakeRequest("refundStarPayment", params); err != nil {
+		if strings.Contains(err.Error(), starsAlreadyRefunded) {
+			return nil
+		}
+		return fmt.Errorf("Telegram Stars 退款失败: %w", err)
+	}
+	return nil
+}
+
+// checkStarsCheckout 校验回调的用户、币种和数量与发票一致
+func checkStarsCheckout(payment *models.GatewayPayment, checkout *GatewayCheckout) error {
+	if payment.UserID != checkout.UserID {
+		return fmt.Errorf("%w: 用户 %d 与发票用户不一致", ErrGatewayPaymentMismatch, checkout.UserID)
+	}
+	if checkout.Currency != models.CurrencyXTR || checkout.TotalAmount != payment.TotalAmount {
+		return fmt.Errorf("%w: 支付 %d %s，发票 %d %s",
+			ErrGatewayPaymentMismatch, checkout.TotalAmount, checkout.Currency, payment.TotalAmount, payment.Currency)
+	}
+	return nil
+}
+
+// starsForAmount 按汇率将计价币种金额折算为 Stars 数量（向上取整），并按 Stars 数量折算到账金额（向下取整到分）
+// 使用有理数计算，避免 0.013 这类汇率的二进制误差导致少算一分
+func starsForAmount(amount, rate string) (int64, string, error) {
+	amountValue, ok := new(big.Rat).SetString(amount)
+	if !ok || amountValue.Sign() <= 0 {
+		return 0, "", fmt.Errorf("充值金额格式错误")
+	}
+	rateValue, ok := new(big.Rat).SetString(rate)
+	if !ok || rateValue.Sign() <= 0 {
+		return 0, "", ErrAssetRateUnavailable
+	}
+
+	quotient := new(big.Rat).Quo(amountValue, rateValue)
+	stars, remainder := new(big.Int).QuoRem(quotient.Num(), quotient.Denom(), new(big.Int))
+	if remainder.Sign() > 0 {
+		stars.Add(stars, big.NewInt(1))
+	}
+	if !stars.IsInt64() {
+		return 0, "", fmt.Errorf("充值金额过大")
+	}
+
+	credit := new(big.Rat).Mul(new(big.Rat).SetInt(stars), rateValue)
+	cents := new(big.Int).Quo(new(big.Int).Mul(credit.Num(), big.NewInt(100)), credit.Denom())
+	return stars.Int64(), new(big.Rat).SetFrac(cents, big.NewInt(100)).FloatString(2), nil
+}
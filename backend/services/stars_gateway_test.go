@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeBotAPI 模拟 Telegram Bot API，记录每个方法收到的参数
+type fakeBotAPI struct {
+	mu         sync.Mutex
+	calls      map[string][]url.Values
+	failRefund bool
+}
+
+func newFakeBotAPI(t *testing.T) (*fakeBotAPI, *tgbotapi.BotAPI) {
+	t.Helper()
+	fake := &fakeBotAPI{calls: make(map[string][]url.Values)}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("创建 Bot API 失败: %v", err)
+	}
+	return fake, api
+}
+
+func (f *fakeBotAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	f.mu.Lock()
+	f.calls[method] = append(f.calls[method], r.PostForm)
+	failRefund := f.failRefund
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getMe":
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"test_bot"}}`)
+	case "createInvoiceLink":
+		fmt.Fprintf(w, `{"ok":true,"result":"https://t.me/$%s"}`, r.PostForm.Get("payload"))
+	case "sendInvoice":
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`)
+	case "refundStarPayment":
+		if failRefund {
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: CHARGE_NOT_FOUND"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	default:
+		fmt.Fprint(w, `{"ok":false,"error_code":404,"description":"Not Found"}`)
+	}
+}
+
+func (f *fakeBotAPI) last(method string) url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls[method]
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1]
+}
+
+// fakeStarsNotifier 记录到账通知和发给用户的消息
+type fakeStarsNotifier struct {
+	fakeAlertNotifier
+	messages []string
+}
+
+func (f *fakeStarsNotifier) SendMessage(ctx context.Context, userID int64, message string) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func TestStarsForAmount(t *testing.T) {
+	tests := []struct {
+		amount, rate string
+		stars        int64
+		credit       string
+	}{
+		{"10", "0.013", 770, "10.01"},
+		{"1", "0.013", 77, "1.00"},
+		{"1.3", "0.013", 100, "1.30"},
+		{"0.5", "0.5", 1, "0.50"},
+	}
+	for _, tt := range tests {
+		stars, credit, err := starsForAmount(tt.amount, tt.rate)
+		if err != nil {
+			t.Fatalf("starsForAmount(%s, %s) 失败: %v", tt.amount, tt.rate, err)
+		}
+		if stars != tt.stars || credit != tt.credit {
+			t.Errorf("starsForAmount(%s, %s) = %d, %s, 期望 %d, %s", tt.amount, tt.rate, stars, credit, tt.stars, tt.credit)
+		}
+	}
+}
+
+// TestStarsGatewayLifecycle 发票 -> 预结账 -> 支付入账（按渠道支付ID幂等）-> 退款扣回，最后对账平衡
+func TestStarsGatewayLifecycle(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	fake, api := newFakeBotAPI(t)
+
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	notifier := &fakeStarsNotifier{}
+	cfg := config.DefaultStarsConfig()
+	cfg.Enabled = true
+	gateway := NewStarsGateway(repository.NewGatewayPaymentRepository(db), ledgerService, notifier, nil, api, &cfg, db)
+
+	balance := func() string {
+		t.Helper()
+		wallet, err := walletRepo.GetByUserID(ctx, 1)
+		if err != nil {
+			return "0"
+		}
+		return normalizeAmount(wallet.Balance)
+	}
+
+	if _, err := gateway.CreateInvoiceLink(ctx, 1, "0.5"); err == nil {
+		t.Errorf("低于最小金额应拒绝创建发票")
+	}
+
+	invoice, err := gateway.CreateInvoiceLink(ctx, 1, "10")
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	payment := invoice.Payment
+	if payment.TotalAmount != 770 || payment.Amount != "10.01" || payment.Currency != models.CurrencyXTR {
+		t.Fatalf("发票 = %d %s / %s USD, 期望 770 XTR / 10.01 USD", payment.TotalAmount, payment.Currency, payment.Amount)
+	}
+	if invoice.InvoiceLink != "https://t.me/$"+payment.PaymentNo {
+		t.Errorf("发票链接 = %s", invoice.InvoiceLink)
+	}
+	params := fake.last("createInvoiceLink")
+	if params.Get("currency") != "XTR" || params.Get("provider_token") != "" || !strings.Contains(params.Get("prices"), `"amount":770`) {
+		t.Errorf("createInvoiceLink 参数 = %v", params)
+	}
+
+	checkout := &GatewayCheckout{UserID: 1, Payload: payment.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: 770}
+	for _, bad := range []*GatewayCheckout{
+		{UserID: 2, Payload: payment.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: 770},
+		{UserID: 1, Payload: payment.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: 769},
+	} {
+		if err := gateway.ValidateCheckout(ctx, bad); !errors.Is(err, ErrGatewayPaymentMismatch) {
+			t.Errorf("ValidateCheckout(%+v) = %v, 期望 %v", bad, err, ErrGatewayPaymentMismatch)
+		}
+	}
+	if err := gateway.ValidateCheckout(ctx, checkout); err != nil {
+		t.Fatalf("预结账校验失败: %v", err)
+	}
+
+	// 同一笔支付重复回调只入账一次
+	checkout.ChargeID = "charge-1"
+	for i := 0; i < 2; i++ {
+		paid, err := gateway.CompletePayment(ctx, checkout)
+		if err != nil {
+			t.Fatalf("支付入账失败: %v", err)
+		}
+		if paid.PaymentNo != payment.PaymentNo || paid.Status != models.GatewayPaymentStatusPaid {
+			t.Errorf("入账记录 = %s/%s", paid.PaymentNo, paid.Status)
+		}
+	}
+	if got := balance(); got != normalizeAmount("10.01") {
+		t.Fatalf("余额 = %s, 期望 10.01", got)
+	}
+	if len(notifier.recharges) != 1 {
+		t.Errorf("到账通知 = %v, 期望 1 条", notifier.recharges)
+	}
+	if err := gateway.ValidateCheckout(ctx, &GatewayCheckout{UserID: 1, Payload: payment.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: 770}); !errors.Is(err, ErrGatewayPaymentNotPending) {
+		t.Errorf("已支付发票预结账 = %v, 期望 %v", err, ErrGatewayPaymentNotPending)
+	}
+
+	// 同一发票被再次支付时另建记录入账，并标记原支付单号、告警运营核查退款
+	second, err := gateway.CompletePayment(ctx, &GatewayCheckout{UserID: 1, Payload: payment.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: 770, ChargeID: "charge-2"})
+	if err != nil {
+		t.Fatalf("重复支付入账失败: %v", err)
+	}
+	if second.PaymentNo == payment.PaymentNo {
+		t.Errorf("重复支付应使用新的支付单号")
+	}
+	if second.DuplicateOf != payment.PaymentNo {
+		t.Errorf("重复支付标记 = %q, 期望 %s", second.DuplicateOf, payment.PaymentNo)
+	}
+	if stored, err := gateway.GetPayment(ctx, second.PaymentNo); err != nil || stored.DuplicateOf != payment.PaymentNo {
+		t.Errorf("保存的重复支付标记 = %+v (%v)", stored, err)
+	}
+	if len(notifier.alerts) != 1 || !strings.Contains(notifier.alerts[0], second.PaymentNo) {
+		t.Errorf("重复支付告警 = %v, 期望 1 条包含 %s", notifier.alerts, second.PaymentNo)
+	}
+	if got := balance(); got != normalizeAmount("20.02") {
+		t.Fatalf("余额 = %s, 期望 20.02", got)
+	}
+
+	// Telegram 退款失败时整体回滚
+	fake.failRefund = true
+	if _, err := gateway.Refund(ctx, second.PaymentNo, "tester", "重复支付"); err == nil {
+		t.Fatalf("Telegram 退款失败时应返回错误")
+	}
+	if got := balance(); got != normalizeAmount("20.02") {
+		t.Fatalf("退款失败后余额 = %s, 期望 20.02", got)
+	}
+	fake.failRefund = false
+
+	refunded, err := gateway.Refund(ctx, second.PaymentNo, "tester", "重复支付")
+	if err != nil {
+		t.Fatalf("退款失败: %v", err)
+	}
+	if refunded.Status != models.GatewayPaymentStatusRefunded {
+		t.Errorf("退款后状态 = %s", refunded.Status)
+	}
+	if params := fake.last("refundStarPayment"); params.Get("telegram_payment_charge_id") != "charge-2" || params.Get("user_id") != "1" {
+		t.Errorf("refundStarPayment 参数 = %v", params)
+	}
+	if got := balance(); got != normalizeAmount("10.01") {
+		t.Fatalf("退款后余额 = %s, 期望 10.01", got)
+	}
+	if _, err := gateway.Refund(ctx, second.PaymentNo, "tester", "重复支付"); !errors.Is(err, ErrGatewayPaymentNotPaid) {
+		t.Errorf("重复退款 = %v, 期望 %v", err, ErrGatewayPaymentNotPaid)
+	}
+	if len(notifier.messages) != 1 {
+		t.Errorf("退款通知 = %v, 期望 1 条", notifier.messages)
+	}
+
+	// 过期发票拒绝预结账，直接发送的发票带上聊天 ID
+	sent, err := gateway.SendInvoice(ctx, 1, 1, "5")
+	if err != nil {
+		t.Fatalf("发送发票失败: %v", err)
+	}
+	if params := fake.last("sendInvoice"); params.Get("chat_id") != "1" || params.Get("payload") != sent.PaymentNo {
+		t.Errorf("sendInvoice 参数 = %v", params)
+	}
+	if err := db.Model(&models.GatewayPayment{}).Where("id = ?", sent.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("更新发票过期时间失败: %v", err)
+	}
+	if err := gateway.ValidateCheckout(ctx, &GatewayCheckout{UserID: 1, Payload: sent.PaymentNo, Currency: models.CurrencyXTR, TotalAmount: sent.TotalAmount}); !errors.Is(err, ErrGatewayPaymentExpired) {
+		t.Errorf("过期发票预结账 = %v, 期望 %v", err, ErrGatewayPaymentExpired)
+	}
+
+	reconciliation := NewReconciliationService(walletRepo, repository.NewWalletHistoryRepository(db), repository.NewRechargeOrderRepository(db),
+		repository.NewOrderRepository(db), repository.NewWithdrawalRepository(db), repository.NewLedgerRepository(db), ledgerService)
+	result, err := reconciliation.ReconcileUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("对账失败: %v", err)
+	}
+	if result.HasDrift() {
+		t.Errorf("对账结果不平: %+v", result)
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/tron"
+	"tg-robot-sim/pkg/tron/trontest"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// discardLogger 测试用日志，丢弃所有输出
+type discardLogger struct{}
+
+func (discardLogger) Info(format string, args ...interface{})  {}
+func (discardLogger) Error(format string, args ...interface{}) {}
+func (discardLogger) Warn(format string, args ...interface{})  {}
+func (discardLogger) Debug(format string, args ...interface{}) {}
+
+// TestTronRechargePipeline 使用模拟 TronGrid 走完整个充值流程：
+// 创建订单 -> 链上转账 -> 扫描匹配（或手动确认）-> 钱包入账 -> 到账通知
+func TestTronRechargePipeline(t *testing.T) {
+	depositAddress, _ := tron.HexToBase58(strings.Repeat("11", 20))
+	sender, _ := tron.HexToBase58(strings.Repeat("22", 20))
+	const usdtContract = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+
+	tests := []struct {
+		name          string
+		depth         int                                       // 固化深度
+		confirmations int                                       // 入账所需确认数
+		blocks        int                                       // 转账后出的空块数
+		setup         func(chain *trontest.Server, txID string) // 第一次处理前
+		manual        bool                                      // 第一次处理使用 ConfirmRecharge 而不是扫描器
+		first         models.RechargeStatus
+		then          func(chain *trontest.Server, txID string) // 第二次处理前
+		want          models.RechargeStatus
+		wantBalance   string
+		wantAlerts    int
+	}{
+		{
+			name:          "扫描到账即入账",
+			confirmations: 1, blocks: 1,
+			first: models.RechargeStatusConfirmed, want: models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+		{
+			name:          "确认数不足时等待出块",
+			confirmations: 19, blocks: 1,
+			first: models.RechargeStatusPending,
+			then:  func(chain *trontest.Server, txID string) { chain.AdvanceBlocks(18) },
+			want:  models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+		{
+			name:  "未固化的转账不可见",
+			depth: 19, confirmations: 1,
+			first: models.RechargeStatusPending,
+			then:  func(chain *trontest.Server, txID string) { chain.AdvanceBlocks(19) },
+			want:  models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+		{
+			name:          "执行失败的转账不入账",
+			confirmations: 1, blocks: 1,
+			setup: func(chain *trontest.Server, txID string) { chain.Revert(txID) },
+			first: models.RechargeStatusPending,
+			then:  func(chain *trontest.Server, txID string) { chain.AdvanceBlocks(19) },
+			want:  models.RechargeStatusPending, wantBalance: "0",
+		},
+		{
+			name:          "限流后下次扫描重试",
+			confirmations: 1, blocks: 1,
+			setup: func(chain *trontest.Server, txID string) {
+				chain.FailNext("/v1/accounts/", http.StatusTooManyRequests, 2)
+			},
+			first: models.RechargeStatusPending,
+			want:  models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+		{
+			name:          "核验交易时节点错误下次重试",
+			confirmations: 1, blocks: 1,
+			setup: func(chain *trontest.Server, txID string) {
+				chain.FailNext("/walletsolidity/", http.StatusInternalServerError, 1)
+			},
+			first: models.RechargeStatusPending,
+			want:  models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+		{
+			name:          "入账后交易回滚被冲回",
+			confirmations: 1, blocks: 1,
+			first: models.RechargeStatusConfirmed,
+			then:  func(chain *trontest.Server, txID string) { chain.Revert(txID) },
+			want:  models.RechargeStatusReversed, wantBalance: "0", wantAlerts: 1,
+		},
+		{
+			name:          "手动确认充值",
+			confirmations: 1, blocks: 1,
+			manual: true,
+			first:  models.RechargeStatusConfirmed, want: models.RechargeStatusConfirmed, wantBalance: "10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openRaceTestDB(t, "sqlite")
+			ctx := context.Background()
+
+			chain := trontest.New(t)
+			chain.RegisterToken(usdtContract, "USDT", 6)
+			chain.SetConfirmationDepth(tt.depth)
+
+			assetService := NewAssetService(repository.NewAssetRepository(db))
+			assets, err := assetService.ListAssets(ctx, false)
+			if err != nil {
+				t.Fatalf("获取资产失败: %v", err)
+			}
+			walletRepo := repository.NewWalletRepository(db)
+			notifier := &fakeAlertNotifier{}
+			rechargeService := NewRechargeService(
+				repository.NewRechargeOrderRepository(db),
+				repository.NewTransactionRepository(db),
+				repository.NewDepositCursorRepository(db),
+				repository.NewOrphanDepositRepository(db),
+				assetService,
+				nil,
+				walletRepo,
+				map[string]*DepositChain{
+					models.ChainTron: {
+						Service:        NewBlockchainService(chain.Client(), &config.BlockchainConfig{}, assets, discardLogger{}),
+						DepositAddress: depositAddress,
+						Confirmations:  NewConfirmationPolicy(tt.confirmations, nil),
+					},
+				},
+				notifier,
+				nil,
+				NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo),
+				db,
+				1, 1000,
+				"",
+				0,
+			)
+
+			order, err := rechargeService.CreateRechargeOrder(ctx, 1, "10", models.AssetUSDTTRC20)
+			if err != nil {
+				t.Fatalf("创建充值订单失败: %v", err)
+			}
+			txID := chain.MintTRC20(usdtContract, sender, depositAddress, order.ExactAmount)
+			chain.AdvanceBlocks(tt.blocks)
+			if tt.setup != nil {
+				tt.setup(chain, txID)
+			}
+
+			status := func() models.RechargeStatus {
+				t.Helper()
+				current, err := rechargeService.GetRechargeOrder(ctx, order.OrderNo)
+				if err != nil {
+					t.Fatalf("获取充值订单失败: %v", err)
+				}
+				return current.Status
+			}
+
+			if tt.manual {
+				if err := rechargeService.ConfirmRecharge(ctx, order, txID); err != nil {
+					t.Fatalf("确认充值失败: %v", err)
+				}
+			} else if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+				t.Fatalf("处理充值订单失败: %v", err)
+			}
+			if got := status(); got != tt.first {
+				t.Fatalf("第一次处理后订单状态 = %s, 期望 %s", got, tt.first)
+			}
+
+			if tt.then != nil {
+				tt.then(chain, txID)
+			}
+			if err := rechargeService.ProcessPendingRecharges(ctx); err != nil {
+				t.Fatalf("处理充值订单失败: %v", err)
+			}
+			if got := status(); got != tt.want {
+				t.Fatalf("订单状态 = %s, 期望 %s", got, tt.want)
+			}
+
+			// 未入账的订单手动确认同样失败
+			if tt.want == models.RechargeStatusPending {
+				if err := rechargeService.ConfirmRecharge(ctx, order, txID); err == nil {
+					t.Errorf("未入账的转账不应能手动确认")
+				}
+			}
+
+			balance := "0"
+			if wallet, err := walletRepo.GetByUserID(ctx, 1); err == nil {
+				balance = wallet.Balance
+			}
+			if normalizeAmount(balance) != normalizeAmount(tt.wantBalance) {
+				t.Errorf("余额 = %s, 期望 %s", balance, tt.wantBalance)
+			}
+
+			credited := tt.first == models.RechargeStatusConfirmed || tt.want != models.RechargeStatusPending
+			if credited && (len(notifier.recharges) != 1 || notifier.recharges[0] != order.OrderNo) {
+				t.Errorf("到账通知 = %v, 期望订单 %s 一条", notifier.recharges, order.OrderNo)
+			}
+			if !credited && len(notifier.recharges) != 0 {
+				t.Errorf("未入账却发送了到账通知: %v", notifier.recharges)
+			}
+			if len(notifier.alerts) != tt.wantAlerts {
+				t.Errorf("告警 = %v, 期望 %d 条", notifier.alerts, tt.wantAlerts)
+			}
+		})
+	}
+}
@@ -2,15 +2,35 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"math/rand/v2"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"tg-robot-sim/storage/models"
 	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTransferToSelf 不能给自己转账
+	ErrTransferToSelf = errors.New("cannot transfer to yourself")
+	// ErrTransferRecipientNotFound 收款方不存在
+	ErrTransferRecipientNotFound = errors.New("transfer recipient not found")
+	// ErrInvalidTransferAmount 转账金额无效（必须为正数且最多两位小数）
+	ErrInvalidTransferAmount = errors.New("invalid transfer amount")
+	// ErrTransferMemoTooLong 转账备注过长
+	ErrTransferMemoTooLong = errors.New("transfer memo too long")
 )
 
+// maxTransferMemoLength 转账备注最大字符数
+const maxTransferMemoLength = 100
+
 // WalletBalance 钱包余额信息
 type WalletBalance struct {
 	Balance       string `json:"balance"`
@@ -19,6 +39,20 @@ type WalletBalance struct {
 	TotalExpense  string `json:"total_expense"`
 }
 
+// TransferResult 转账结果
+type TransferResult struct {
+	TransferNo  string    `json:"transfer_no"`
+	FromUserID  int64     `json:"from_user_id"`
+	ToUserID    int64     `json:"to_user_id"`
+	FromName    string    `json:"from_name"`
+	ToName      string    `json:"to_name"`
+	Amount      string    `json:"amount"`
+	Memo        string    `json:"memo"`
+	FromBalance string    `json:"from_balance"` // 付款方转账后可用余额
+	ToBalance   string    `json:"-"`            // 收款方转账后可用余额（仅用于通知收款方）
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // PaymentResult 支付结果
 type PaymentResult struct {
 	Success bool   `json:"success"`
@@ -40,17 +74,28 @@ type WalletService interface {
 	AddBalanceWithRemark(ctx context.Context, userID int64, amount string, remark string) error
 
 	// eSIM 订单处理相关方法
+	// 以下资金操作在 relatedID 非空时按 (操作类型, relatedID) 幂等：重复调用返回首次结果，不会重复动账
+
 	// FreezeBalance 冻结余额（不记录 wallet_history，仅内部状态变更）
 	FreezeBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error
 
+	// FreezeBalanceInTx 在调用方事务内冻结余额，用于与订单创建一起提交
+	FreezeBalanceInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error
+
 	// UnfreezeBalance 解冻余额（退还到可用余额）
-	// 会创建 wallet_history 记录：type=refund, status=completed
+	// 会在同一事务中创建 wallet_history 记录：type=refund, status=completed
 	UnfreezeBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error
 
+	// UnfreezeBalanceInTx 在调用方事务内解冻余额，用于与订单状态流转一起提交
+	UnfreezeBalanceInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error
+
 	// ConfirmFrozenPayment 确认冻结金额的支付（从冻结余额扣除）
-	// 会创建 wallet_history 记录：type=payment, status=completed
+	// 会在同一事务中创建 wallet_history 记录：type=payment, status=completed
 	ConfirmFrozenPayment(ctx context.Context, userID int64, amount string, relatedID string, description string) error
 
+	// ConfirmFrozenPaymentInTx 在调用方事务内确认冻结金额的支付，用于与订单状态流转一起提交
+	ConfirmFrozenPaymentInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error
+
 	// AddBalance 增加余额（充值等）
 	AddBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error
 
@@ -59,6 +104,10 @@ type WalletService interface {
 
 	// GetFrozenBalance 获取冻结余额
 	GetFrozenBalance(ctx context.Context, userID int64) (string, error)
+
+	// Transfer 用户间转账（userID 均为 Telegram ID）
+	// 双方余额和 wallet_history（type=transfer_out / transfer_in）在同一事务中写入，成功后通知双方
+	Transfer(ctx context.Context, fromUserID, toUserID int64, amount string, memo string) (*TransferResult, error)
 }
 
 // walletService 钱包服务实现
@@ -67,6 +116,9 @@ type walletService struct {
 	rechargeOrderRepo    repository.RechargeOrderRepository
 	blockchainService    BlockchainService
 	walletHistoryService WalletHistoryService
+	ledgerService        LedgerService
+	userRepo             repository.UserRepository
+	notificationService  NotificationService
 }
 
 // NewWalletService 创建钱包服务实例
@@ -75,12 +127,18 @@ func NewWalletService(
 	rechargeOrderRepo repository.RechargeOrderRepository,
 	blockchainService BlockchainService,
 	walletHistoryService WalletHistoryService,
+	ledgerService LedgerService,
+	userRepo repository.UserRepository,
+	notificationService NotificationService,
 ) WalletService {
 	return &walletService{
 		walletRepo:           walletRepo,
 		rechargeOrderRepo:    rechargeOrderRepo,
 		blockchainService:    blockchainService,
 		walletHistoryService: walletHistoryService,
+		ledgerService:        ledgerService,
+		userRepo:             userRepo,
+		notificationService:  notificationService,
 	}
 }
 
@@ -127,41 +185,26 @@ func (s *walletService) CreateRechargeOrder(ctx context.Context, userID int64, a
 }
 
 // ProcessPayment 处理支付
+// 记账：借 用户可用余额，贷 平台收入
 func (s *walletService) ProcessPayment(ctx context.Context, userID int64, productID int, amount string) (*PaymentResult, error) {
-	// 获取或创建钱包
-	wallet, err := s.walletRepo.GetOrCreate(ctx, userID)
-	if err != nil {
-		return &PaymentResult{
-			Success: false,
-			Message: "获取钱包失败",
-		}, err
-	}
-
-	// 检查余额是否充足
-	balance, _ := parseDecimal(wallet.Balance)
-	payAmount, _ := parseDecimal(amount)
-
-	if balance.Cmp(payAmount) < 0 {
-		return &PaymentResult{
-			Success: false,
-			Message: "余额不足",
-		}, errors.New("insufficient balance")
-	}
-
-	// 扣除余额
-	newBalance := new(big.Float).Sub(balance, payAmount)
-	wallet.Balance = newBalance.Text('f', 8)
-
-	// 更新总支出
-	totalExpense, _ := parseDecimal(wallet.TotalExpense)
-	newTotalExpense := new(big.Float).Add(totalExpense, payAmount)
-	wallet.TotalExpense = newTotalExpense.Text('f', 8)
-
-	// 保存钱包
-	if err := s.walletRepo.Update(ctx, wallet); err != nil {
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypePayment,
+		models.LedgerAccountUserAvailable,
+		models.LedgerAccountPlatformRevenue,
+		amount,
+		fmt.Sprintf("product-%d", productID),
+		"余额支付",
+	)
+
+	if _, err := s.ledgerService.Post(ctx, posting); err != nil {
+		message := "支付失败"
+		if errors.Is(err, ErrInsufficientBalance) {
+			message = "余额不足"
+		}
 		return &PaymentResult{
 			Success: false,
-			Message: "支付失败",
+			Message: message,
 		}, err
 	}
 
@@ -184,26 +227,20 @@ func (s *walletService) ProcessRecharge(ctx context.Context, txHash string, amou
 		return errors.New("order already processed")
 	}
 
-	// 获取或创建钱包
-	wallet, err := s.walletRepo.GetOrCreate(ctx, order.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to get or create wallet: %w", err)
-	}
+	// 记账：借 充值清算，贷 用户可用余额
+	posting := NewLedgerTransfer(
+		order.UserID,
+		models.LedgerEntryTypeRecharge,
+		models.LedgerAccountDepositClearing,
+		models.LedgerAccountUserAvailable,
+		amount,
+		order.OrderNo,
+		fmt.Sprintf("充值到账，交易哈希: %s", txHash),
+	)
+	posting.Idempotent = true
 
-	// 增加余额
-	balance, _ := parseDecimal(wallet.Balance)
-	rechargeAmount, _ := parseDecimal(amount)
-	newBalance := new(big.Float).Add(balance, rechargeAmount)
-	wallet.Balance = newBalance.Text('f', 8)
-
-	// 更新总收入
-	totalIncome, _ := parseDecimal(wallet.TotalIncome)
-	newTotalIncome := new(big.Float).Add(totalIncome, rechargeAmount)
-	wallet.TotalIncome = newTotalIncome.Text('f', 8)
-
-	// 保存钱包
-	if err := s.walletRepo.Update(ctx, wallet); err != nil {
-		return fmt.Errorf("failed to update wallet: %w", err)
+	if _, err := s.ledgerService.Post(ctx, posting); err != nil {
+		return fmt.Errorf("failed to post recharge entry: %w", err)
 	}
 
 	// 更新充值订单状态
@@ -217,27 +254,62 @@ func (s *walletService) ProcessRecharge(ctx context.Context, txHash string, amou
 
 // FreezeBalance 冻结余额（不记录 wallet_history，仅内部状态变更）
 func (s *walletService) FreezeBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error {
-	// 验证金额格式
-	freezeAmount, err := parseDecimal(amount)
+	posting, err := newFreezePosting(userID, amount, relatedID, description)
 	if err != nil {
-		return fmt.Errorf("invalid amount format: %w", err)
+		return err
 	}
+	_, err = s.ledgerService.Post(ctx, posting)
+	return err
+}
 
-	if freezeAmount.Cmp(big.NewFloat(0)) <= 0 {
-		return errors.New("amount must be positive")
+// FreezeBalanceInTx 在调用方事务内冻结余额
+// 版本冲突时返回 repository.ErrVersionConflict，由调用方用 RetryOnConflict 重试整个事务
+func (s *walletService) FreezeBalanceInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error {
+	posting, err := newFreezePosting(userID, amount, relatedID, description)
+	if err != nil {
+		return err
 	}
+	_, err = s.ledgerService.PostInTx(ctx, tx, posting)
+	return err
+}
 
-	// 使用原子操作：减少可用余额，增加冻结余额
-	negativeAmount := new(big.Float).Neg(freezeAmount)
-	balanceDelta := negativeAmount.Text('f', 8) // 减少可用余额
-	frozenDelta := amount                       // 增加冻结余额
+// newFreezePosting 构造冻结余额分录
+func newFreezePosting(userID int64, amount string, relatedID string, description string) (*LedgerPosting, error) {
+	// 验证金额格式
+	freezeAmount, err := parseDecimal(amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount format: %w", err)
+	}
 
-	return s.walletRepo.UpdateBalanceAtomic(ctx, userID, balanceDelta, frozenDelta)
+	if freezeAmount.Cmp(big.NewFloat(0)) <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	// 记账：借 用户可用余额，贷 用户冻结余额
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeFreeze,
+		models.LedgerAccountUserAvailable,
+		models.LedgerAccountUserFrozen,
+		amount,
+		relatedID,
+		description,
+	)
+	posting.Idempotent = relatedID != ""
+	return posting, nil
 }
 
 // UnfreezeBalance 解冻余额（退还到可用余额）
-// 会创建 wallet_history 记录：type=refund, status=completed
+// 会在同一事务中创建 wallet_history 记录：type=refund, status=completed
 func (s *walletService) UnfreezeBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error {
+	return s.inLedgerTx(ctx, models.LedgerEntryTypeUnfreeze, relatedID, func(tx *gorm.DB) error {
+		return s.UnfreezeBalanceInTx(ctx, tx, userID, amount, relatedID, description)
+	})
+}
+
+// UnfreezeBalanceInTx 在调用方事务内解冻余额，wallet_history 与记账在同一事务中写入
+// 版本冲突时返回 repository.ErrVersionConflict，由调用方用 RetryOnConflict 重试整个事务
+func (s *walletService) UnfreezeBalanceInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error {
 	// 验证金额格式
 	unfreezeAmount, err := parseDecimal(amount)
 	if err != nil {
@@ -248,85 +320,77 @@ func (s *walletService) UnfreezeBalance(ctx context.Context, userID int64, amoun
 		return errors.New("amount must be positive")
 	}
 
-	// 使用原子操作：增加可用余额，减少冻结余额
-	negativeAmount := new(big.Float).Neg(unfreezeAmount)
-	balanceDelta := amount                     // 增加可用余额
-	frozenDelta := negativeAmount.Text('f', 8) // 减少冻结余额
+	// 记账：借 用户冻结余额，贷 用户可用余额
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeUnfreeze,
+		models.LedgerAccountUserFrozen,
+		models.LedgerAccountUserAvailable,
+		amount,
+		relatedID,
+		description,
+	)
+	posting.Idempotent = relatedID != ""
 
-	// 获取操作前的余额信息
-	walletBefore, err := s.walletRepo.GetByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get wallet before unfreeze: %w", err)
-	}
-
-	err = s.walletRepo.UpdateBalanceAtomic(ctx, userID, balanceDelta, frozenDelta)
+	result, err := s.ledgerService.PostInTx(ctx, tx, posting)
 	if err != nil {
 		return err
 	}
-
-	// 获取操作后的余额信息
-	walletAfter, err := s.walletRepo.GetByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get wallet after unfreeze: %w", err)
+	if result.Replayed {
+		// 重复调用：资金和历史记录都已在首次调用时处理
+		return nil
 	}
 
 	// 记录 wallet_history（type=refund）
-	if s.walletHistoryService != nil {
-		err = s.walletHistoryService.CreateRefundRecord(
-			ctx,
-			userID,
-			amount,
-			walletBefore.Balance,
-			walletAfter.Balance,
-			relatedID,
-			description,
-		)
-		if err != nil {
-			// 记录历史失败不应该影响主要操作，只记录日志
-			fmt.Printf("Warning: failed to create refund history record: %v\n", err)
-		}
+	history := &models.WalletHistory{
+		UserID:        userID,
+		Type:          models.WalletHistoryTypeRefund,
+		Amount:        amount, // 退款为正数
+		BalanceBefore: result.WalletBefore.Balance,
+		BalanceAfter:  result.WalletAfter.Balance,
+		Status:        models.WalletHistoryStatusCompleted,
+		Description:   description,
+		RelatedType:   "order",
+		RelatedID:     relatedID,
+	}
+	if err := tx.Create(history).Error; err != nil {
+		return fmt.Errorf("创建退款记录失败: %w", err)
 	}
-
 	return nil
 }
 
 // DeductBalance 扣除余额
+// 记账：借 用户可用余额，贷 平台收入
 func (s *walletService) DeductBalance(ctx context.Context, userID int64, amount string) error {
-	wallet, err := s.walletRepo.GetOrCreate(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	balance, _ := parseDecimal(wallet.Balance)
-	deductAmount, _ := parseDecimal(amount)
-
-	if balance.Cmp(deductAmount) < 0 {
-		return errors.New("insufficient balance")
-	}
-
-	newBalance := new(big.Float).Sub(balance, deductAmount)
-	wallet.Balance = newBalance.Text('f', 8)
-
-	return s.walletRepo.Update(ctx, wallet)
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypePayment,
+		models.LedgerAccountUserAvailable,
+		models.LedgerAccountPlatformRevenue,
+		amount,
+		"",
+		"扣除余额",
+	)
+	_, err := s.ledgerService.Post(ctx, posting)
+	return err
 }
 
 // AddBalance 增加余额（新签名，支持 relatedID 和 description）
+// 记账：借 充值清算，贷 用户可用余额
 func (s *walletService) AddBalance(ctx context.Context, userID int64, amount string, relatedID string, description string) error {
-	wallet, err := s.walletRepo.GetOrCreate(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	balance, _ := parseDecimal(wallet.Balance)
-	addAmount, _ := parseDecimal(amount)
-	newBalance := new(big.Float).Add(balance, addAmount)
-
-	wallet.Balance = newBalance.Text('f', 8)
-
-	// TODO: 记录钱包历史（使用 relatedID 和 description）
-	// 这里可以调用 WalletHistoryService 来记录历史
-
-	return s.walletRepo.Update(ctx, wallet)
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeRecharge,
+		models.LedgerAccountDepositClearing,
+		models.LedgerAccountUserAvailable,
+		amount,
+		relatedID,
+		description,
+	)
+	posting.Idempotent = relatedID != ""
+
+	_, err := s.ledgerService.Post(ctx, posting)
+	return err
 }
 
 // getRechargeAddress 获取充值地址
@@ -355,70 +419,40 @@ func (s *walletService) GetOrCreateWallet(ctx context.Context, userID int64) (*m
 	return wallet, nil
 }
 
-// AddBalanceWithRemark 增加余额（带备注）- 带重试机制处理数据库锁定
+// AddBalanceWithRemark 增加余额（带备注）
+// 并发冲突和数据库锁定的重试由 LedgerService.Post 统一处理
 func (s *walletService) AddBalanceWithRemark(ctx context.Context, userID int64, amount string, remark string) error {
-	maxRetries := 3
-	var err error
-
-	for i := 0; i < maxRetries; i++ {
-		err = s.addBalanceWithRemarkOnce(ctx, userID, amount, remark)
-		if err == nil {
-			return nil // 成功，退出重试循环
-		}
-
-		// 如果是数据库锁定错误，进行重试
-		if i < maxRetries-1 && (err.Error() == "database is locked" || err.Error() == "database locked") {
-			waitTime := time.Duration(100*(i+1)) * time.Millisecond // 100ms, 200ms, 300ms
-			fmt.Printf("钱包操作数据库锁定，%v 后重试 (第 %d/%d 次): %v\n", waitTime, i+1, maxRetries, err)
-			time.Sleep(waitTime)
-			continue
-		}
-
-		// 其他错误或最后一次重试失败，直接返回
-		break
-	}
-
-	return err
-}
-
-// addBalanceWithRemarkOnce 单次增加余额操作
-func (s *walletService) addBalanceWithRemarkOnce(ctx context.Context, userID int64, amount string, remark string) error {
-	// 获取或创建钱包
-	wallet, err := s.GetOrCreateWallet(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	// 解析金额
-	balance, _ := parseDecimal(wallet.Balance)
-	addAmount, err := parseDecimal(amount)
-	if err != nil {
+	if _, err := parseDecimal(amount); err != nil {
 		return fmt.Errorf("金额格式错误: %w", err)
 	}
 
-	// 计算新余额
-	newBalance := new(big.Float).Add(balance, addAmount)
-	wallet.Balance = newBalance.Text('f', 8)
-
-	// 更新总收入
-	totalIncome, _ := parseDecimal(wallet.TotalIncome)
-	newTotalIncome := new(big.Float).Add(totalIncome, addAmount)
-	wallet.TotalIncome = newTotalIncome.Text('f', 8)
-
-	// 保存钱包
-	if err := s.walletRepo.Update(ctx, wallet); err != nil {
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypeRecharge,
+		models.LedgerAccountDepositClearing,
+		models.LedgerAccountUserAvailable,
+		amount,
+		"",
+		remark,
+	)
+	if _, err := s.ledgerService.Post(ctx, posting); err != nil {
 		return fmt.Errorf("更新钱包余额失败: %w", err)
 	}
 
-	// TODO: 记录交易日志（包含备注）
-	// 这里可以添加交易记录的逻辑
-
 	return nil
 }
 
 // ConfirmFrozenPayment 确认冻结金额的支付（从冻结余额扣除）
-// 会创建 wallet_history 记录：type=payment, status=completed
+// 会在同一事务中创建 wallet_history 记录：type=payment, status=completed
 func (s *walletService) ConfirmFrozenPayment(ctx context.Context, userID int64, amount string, relatedID string, description string) error {
+	return s.inLedgerTx(ctx, models.LedgerEntryTypePayment, relatedID, func(tx *gorm.DB) error {
+		return s.ConfirmFrozenPaymentInTx(ctx, tx, userID, amount, relatedID, description)
+	})
+}
+
+// ConfirmFrozenPaymentInTx 在调用方事务内确认冻结金额的支付，wallet_history 与记账在同一事务中写入
+// 版本冲突时返回 repository.ErrVersionConflict，由调用方用 RetryOnConflict 重试整个事务
+func (s *walletService) ConfirmFrozenPaymentInTx(ctx context.Context, tx *gorm.DB, userID int64, amount string, relatedID string, description string) error {
 	// 验证金额格式
 	payAmount, err := parseDecimal(amount)
 	if err != nil {
@@ -429,54 +463,67 @@ func (s *walletService) ConfirmFrozenPayment(ctx context.Context, userID int64,
 		return errors.New("amount must be positive")
 	}
 
-	// 使用原子操作：减少冻结余额
-	negativeAmount := new(big.Float).Neg(payAmount)
-	balanceDelta := "0"                        // 可用余额不变
-	frozenDelta := negativeAmount.Text('f', 8) // 减少冻结余额
+	// 记账：借 用户冻结余额，贷 平台收入
+	posting := NewLedgerTransfer(
+		userID,
+		models.LedgerEntryTypePayment,
+		models.LedgerAccountUserFrozen,
+		models.LedgerAccountPlatformRevenue,
+		amount,
+		relatedID,
+		description,
+	)
+	posting.Idempotent = relatedID != ""
 
-	err = s.walletRepo.UpdateBalanceAtomic(ctx, userID, balanceDelta, frozenDelta)
+	result, err := s.ledgerService.PostInTx(ctx, tx, posting)
 	if err != nil {
 		return err
 	}
-
-	// 更新总支出（需要单独处理，因为 UpdateBalanceAtomic 不处理统计字段）
-	wallet, err := s.walletRepo.GetByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get wallet for expense update: %w", err)
+	if result.Replayed {
+		// 重复调用：资金和历史记录都已在首次调用时处理
+		return nil
 	}
 
-	totalExpense, _ := parseDecimal(wallet.TotalExpense)
-	newTotalExpense := new(big.Float).Add(totalExpense, payAmount)
-	wallet.TotalExpense = newTotalExpense.Text('f', 8)
-
-	// 获取操作前的余额信息（用于历史记录）
-	balanceBefore := wallet.Balance // 可用余额在这个操作中没有变化
-
-	err = s.walletRepo.Update(ctx, wallet)
-	if err != nil {
-		return fmt.Errorf("failed to update total expense: %w", err)
-	}
-
-	// 记录 wallet_history（type=payment）
-	if s.walletHistoryService != nil {
-		err = s.walletHistoryService.CreatePaymentRecord(
-			ctx,
-			userID,
-			amount,
-			balanceBefore,
-			wallet.Balance, // 可用余额没有变化，但记录当前值
-			relatedID,
-			description,
-		)
-		if err != nil {
-			// 记录历史失败不应该影响主要操作，只记录日志
-			fmt.Printf("Warning: failed to create payment history record: %v\n", err)
-		}
+	// 记录 wallet_history（type=payment），可用余额在这个操作中没有变化，但记录当前值
+	history := &models.WalletHistory{
+		UserID:        userID,
+		Type:          models.WalletHistoryTypePayment,
+		Amount:        fmt.Sprintf("-%s", amount), // 支出为负数
+		BalanceBefore: result.WalletBefore.Balance,
+		BalanceAfter:  result.WalletAfter.Balance,
+		Status:        models.WalletHistoryStatusCompleted,
+		Description:   description,
+		RelatedType:   "order",
+		RelatedID:     relatedID,
+	}
+	if err := tx.Create(history).Error; err != nil {
+		return fmt.Errorf("创建支付记录失败: %w", err)
 	}
-
 	return nil
 }
 
+// inLedgerTx 在新的记账事务中执行以 (entryType, relatedID) 为幂等键的操作
+// 唯一索引冲突时只有幂等记录已存在才说明并发的重复调用已先提交；
+// 其他唯一索引冲突（例如首次创建平台科目的竞争）按并发冲突重试，不能当作已处理
+func (s *walletService) inLedgerTx(ctx context.Context, entryType models.LedgerEntryType, relatedID string, fn func(tx *gorm.DB) error) error {
+	return RetryOnConflict(ctx, func() error {
+		err := s.ledgerService.Transaction(ctx, fn)
+		if err == nil || !repository.IsDuplicateKeyError(err) {
+			return err
+		}
+		if relatedID != "" {
+			applied, checkErr := s.ledgerService.HasOperation(ctx, entryType, relatedID)
+			if checkErr != nil {
+				return fmt.Errorf("查询钱包操作失败: %w", checkErr)
+			}
+			if applied {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %v", repository.ErrVersionConflict, err)
+	})
+}
+
 // HasSufficientBalance 检查是否有足够的可用余额
 func (s *walletService) HasSufficientBalance(ctx context.Context, userID int64, amount string) (bool, error) {
 	wallet, err := s.walletRepo.GetOrCreate(ctx, userID)
@@ -500,6 +547,215 @@ func (s *walletService) GetFrozenBalance(ctx context.Context, userID int64) (str
 	return wallet.FrozenBalance, nil
 }
 
+// Transfer 用户间转账
+// 记账：借 付款方可用余额，贷 转账过渡科目；借 转账过渡科目，贷 收款方可用余额
+func (s *walletService) Transfer(ctx context.Context, fromUserID, toUserID int64, amount string, memo string) (*TransferResult, error) {
+	if fromUserID == toUserID {
+		return nil, ErrTransferToSelf
+	}
+
+	amountText, err := parseTransferAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	memo = strings.TrimSpace(memo)
+	if utf8.RuneCountInString(memo) > maxTransferMemoLength {
+		return nil, fmt.Errorf("%w: 最多 %d 个字符", ErrTransferMemoTooLong, maxTransferMemoLength)
+	}
+
+	toName, err := s.resolveTransferRecipient(ctx, toUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TransferResult{
+		TransferNo: fmt.Sprintf("TRF%d%06d", time.Now().UnixMilli(), rand.IntN(1000000)),
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		FromName:   s.userDisplayName(ctx, fromUserID),
+		ToName:     toName,
+		Amount:     amountText,
+		Memo:       memo,
+		CreatedAt:  time.Now(),
+	}
+
+	outDescription := fmt.Sprintf("转账给 %s", result.ToName)
+	inDescription := fmt.Sprintf("收到 %s 的转账", result.FromName)
+	if memo != "" {
+		outDescription += "：" + memo
+		inDescription += "：" + memo
+	}
+
+	err = s.ledgerService.Transaction(ctx, func(tx *gorm.DB) error {
+		// 按用户ID升序锁定双方钱包，避免相向转账互相等待
+		walletRepo := s.walletRepo.WithTx(tx)
+		lockOrder := []int64{fromUserID, toUserID}
+		if fromUserID > toUserID {
+			lockOrder = []int64{toUserID, fromUserID}
+		}
+		for _, userID := range lockOrder {
+			if _, err := walletRepo.GetOrCreateForUpdate(ctx, userID); err != nil {
+				return err
+			}
+		}
+
+		out := NewLedgerTransfer(
+			fromUserID,
+			models.LedgerEntryTypeTransferOut,
+			models.LedgerAccountUserAvailable,
+			models.LedgerAccountTransferClearing,
+			amountText,
+			result.TransferNo,
+			outDescription,
+		)
+		out.Idempotent = true
+		outResult, err := s.ledgerService.PostInTx(ctx, tx, out)
+		if err != nil {
+			return err
+		}
+
+		in := NewLedgerTransfer(
+			toUserID,
+			models.LedgerEntryTypeTransferIn,
+			models.LedgerAccountTransferClearing,
+			models.LedgerAccountUserAvailable,
+			amountText,
+			result.TransferNo,
+			inDescription,
+		)
+		in.Idempotent = true
+		inResult, err := s.ledgerService.PostInTx(ctx, tx, in)
+		if err != nil {
+			return err
+		}
+
+		histories := []*models.WalletHistory{
+			{
+				UserID:        fromUserID,
+				Type:          models.WalletHistoryTypeTransferOut,
+				Amount:        "-" + amountText, // 支出为负数
+				BalanceBefore: outResult.WalletBefore.Balance,
+				BalanceAfter:  outResult.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   outDescription,
+				RelatedType:   "transfer",
+				RelatedID:     result.TransferNo,
+				Metadata:      transferMetadata(result, toUserID, result.ToName),
+			},
+			{
+				UserID:        toUserID,
+				Type:          models.WalletHistoryTypeTransferIn,
+				Amount:        amountText,
+				BalanceBefore: inResult.WalletBefore.Balance,
+				BalanceAfter:  inResult.WalletAfter.Balance,
+				Status:        models.WalletHistoryStatusCompleted,
+				Description:   inDescription,
+				RelatedType:   "transfer",
+				RelatedID:     result.TransferNo,
+				Metadata:      transferMetadata(result, fromUserID, result.FromName),
+			},
+		}
+		if err := tx.Create(&histories).Error; err != nil {
+			return fmt.Errorf("创建转账记录失败: %w", err)
+		}
+
+		result.FromBalance = outResult.WalletAfter.Balance
+		result.ToBalance = inResult.WalletAfter.Balance
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 通知在事务外发送，失败不影响转账结果
+	if s.notificationService != nil {
+		if err := s.notificationService.SendTransferNotification(ctx, fromUserID, result, false); err != nil {
+			fmt.Printf("Warning: failed to notify transfer sender: %v\n", err)
+		}
+		if err := s.notificationService.SendTransferNotification(ctx, toUserID, result, true); err != nil {
+			fmt.Printf("Warning: failed to notify transfer recipient: %v\n", err)
+		}
+	}
+
+	return result, nil
+}
+
+// resolveTransferRecipient 校验收款方存在（已注册用户或已有钱包），返回展示名称
+func (s *walletService) resolveTransferRecipient(ctx context.Context, userID int64) (string, error) {
+	if userID <= 0 {
+		return "", ErrTransferRecipientNotFound
+	}
+
+	if s.userRepo != nil {
+		user, err := s.userRepo.GetByTelegramID(ctx, userID)
+		if err == nil {
+			if !user.IsActive {
+				return "", ErrTransferRecipientNotFound
+			}
+			return formatUserDisplayName(user), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("查询收款方失败: %w", err)
+		}
+	}
+
+	// 只通过 Mini App 使用过钱包的用户不一定在 users 表中
+	if _, err := s.walletRepo.GetByUserID(ctx, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrTransferRecipientNotFound
+		}
+		return "", fmt.Errorf("查询收款方钱包失败: %w", err)
+	}
+	return fmt.Sprintf("用户 %d", userID), nil
+}
+
+// userDisplayName 获取用户展示名称，查询失败时使用用户ID
+func (s *walletService) userDisplayName(ctx context.Context, userID int64) string {
+	if s.userRepo != nil {
+		if user, err := s.userRepo.GetByTelegramID(ctx, userID); err == nil {
+			return formatUserDisplayName(user)
+		}
+	}
+	return fmt.Sprintf("用户 %d", userID)
+}
+
+// formatUserDisplayName 优先使用 @username，其次使用姓名
+func formatUserDisplayName(user *models.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("用户 %d", user.TelegramID)
+}
+
+// parseTransferAmount 校验转账金额：正数且最多两位小数（与 wallet_history 金额精度一致）
+func parseTransferAmount(amount string) (string, error) {
+	amount = strings.TrimSpace(amount)
+	value, err := parseDecimal(amount)
+	if err != nil || value.IsInf() || value.Sign() <= 0 || strings.ContainsAny(amount, "eE") {
+		return "", ErrInvalidTransferAmount
+	}
+	if _, fraction, ok := strings.Cut(amount, "."); ok && len(strings.TrimRight(fraction, "0")) > 2 {
+		return "", ErrInvalidTransferAmount
+	}
+	return value.Text('f', 2), nil
+}
+
+// transferMetadata 生成转账记录的元数据（JSON）
+func transferMetadata(result *TransferResult, counterpartyID int64, counterpartyName string) string {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"transfer_no":       result.TransferNo,
+		"counterparty_id":   counterpartyID,
+		"counterparty_name": counterpartyName,
+		"memo":              result.Memo,
+	})
+	return string(metadata)
+}
+
 // parseDecimal 解析 decimal 字符串为 big.Float
 func parseDecimal(s string) (*big.Float, error) {
 	f, _, err := big.ParseFloat(s, 10, 256, big.ToNearestEven)
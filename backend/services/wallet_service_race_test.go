@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"tg-robot-sim/storage/data"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openRaceTestDB 打开并发测试数据库
+// SQLite 始终运行；MySQL 需设置环境变量 WALLET_RACE_MYSQL_DSN，否则跳过
+func openRaceTestDB(t *testing.T, dialect string) *gorm.DB {
+	t.Helper()
+
+	var dialector gorm.Dialector
+	switch dialect {
+	case "sqlite":
+		dialector = sqlite.Open(t.TempDir() + "/wallet_race.db?_busy_timeout=5000")
+	case "mysql":
+		dsn := os.Getenv("WALLET_RACE_MYSQL_DSN")
+		if dsn == "" {
+			t.Skip("WALLET_RACE_MYSQL_DSN 未设置，跳过 MySQL 并发测试")
+		}
+		dialector = mysql.Open(dsn)
+	default:
+		t.Fatalf("unsupported dialect: %s", dialect)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := data.AutoMigrate(db); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	return db
+}
+
+// TestWalletConcurrentMutations 多个协程同时操作同一钱包，最终余额、版本号和账本必须一致
+func TestWalletConcurrentMutations(t *testing.T) {
+	for _, dialect := range []string{"sqlite", "mysql"} {
+		t.Run(dialect, func(t *testing.T) {
+			db := openRaceTestDB(t, dialect)
+			ctx := context.Background()
+
+			// MySQL 可能是共享库，用唯一用户ID和关联ID前缀隔离
+			userID := time.Now().UnixNano() % 1_000_000_000
+			prefix := fmt.Sprintf("race-%d", userID)
+
+			walletRepo := repository.NewWalletRepository(db)
+			ledgerRepo := repository.NewLedgerRepository(db)
+			ledgerService := NewLedgerService(db, ledgerRepo, walletRepo)
+			walletService := NewWalletService(walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil)
+			recharge := &rechargeService{ledgerService: ledgerService, db: db}
+
+			if err := walletService.AddBalance(ctx, userID, "100", prefix+"-seed", "初始余额"); err != nil {
+				t.Fatalf("初始化余额失败: %v", err)
+			}
+
+			const workers = 12
+			const iterations = 8
+
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*iterations*6)
+
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < iterations; i++ {
+						orderNo := fmt.Sprintf("%s-%d-%d", prefix, w, i)
+
+						// 每轮净效果：可用 +1（充值）+1（加余额）-2（冻结）+1（解冻）= +1，冻结归零，支出 +1
+						steps := []func() error{
+							func() error {
+								return RetryOnConflict(ctx, func() error {
+									return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+										return recharge.addBalanceInTransaction(ctx, tx, userID, "1", "R"+orderNo, "", "并发充值")
+									})
+								})
+							},
+							func() error { return walletService.AddBalance(ctx, userID, "1", "A"+orderNo, "并发加余额") },
+							func() error { return walletService.FreezeBalance(ctx, userID, "2", orderNo, "并发冻结") },
+							func() error { return walletService.ConfirmFrozenPayment(ctx, userID, "1", orderNo, "并发扣款") },
+							// 重复确认必须幂等
+							func() error { return walletService.ConfirmFrozenPayment(ctx, userID, "1", orderNo, "并发扣款") },
+							func() error { return walletService.UnfreezeBalance(ctx, userID, "1", orderNo, "并发解冻") },
+						}
+						for _, step := range steps {
+							if err := step(); err != nil {
+								errs <- fmt.Errorf("worker %d iteration %d: %w", w, i, err)
+								return
+							}
+						}
+					}
+				}(w)
+			}
+
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+			if t.Failed() {
+				return
+			}
+
+			wallet, err := walletRepo.GetByUserID(ctx, userID)
+			if err != nil {
+				t.Fatalf("获取钱包失败: %v", err)
+			}
+
+			rounds := workers * iterations
+			expectBalance := fmt.Sprintf("%d.00000000", 100+rounds)
+			if got := normalizeAmount(wallet.Balance); got != expectBalance {
+				t.Errorf("可用余额 = %s, 期望 %s", got, expectBalance)
+			}
+			if got := normalizeAmount(wallet.FrozenBalance); got != zeroAmount {
+				t.Errorf("冻结余额 = %s, 期望 0", got)
+			}
+			if got, want := normalizeAmount(wallet.TotalExpense), fmt.Sprintf("%d.00000000", rounds); got != want {
+				t.Errorf("总支出 = %s, 期望 %s", got, want)
+			}
+
+			// 每次成功动账（种子 + 每轮 5 次，重复确认不动账）版本号加一
+			if want := int64(1 + rounds*5); wallet.Version != want {
+				t.Errorf("版本号 = %d, 期望 %d", wallet.Version, want)
+			}
+
+			// 账本科目余额必须与钱包缓存一致
+			accounts, err := ledgerRepo.GetUserAccounts(ctx, userID)
+			if err != nil {
+				t.Fatalf("获取科目失败: %v", err)
+			}
+			for _, account := range accounts {
+				switch account.AccountType {
+				case models.LedgerAccountUserAvailable:
+					if normalizeAmount(account.Balance) != normalizeAmount(wallet.Balance) {
+						t.Errorf("可用科目余额 %s 与钱包 %s 不一致", account.Balance, wallet.Balance)
+					}
+				case models.LedgerAccountUserFrozen:
+					if normalizeAmount(account.Balance) != normalizeAmount(wallet.FrozenBalance) {
+						t.Errorf("冻结科目余额 %s 与钱包 %s 不一致", account.Balance, wallet.FrozenBalance)
+					}
+				}
+			}
+
+			// 扣款和解冻的 wallet_history 与记账同一事务写入，每个订单各一条（重复确认不重复写入）
+			for _, historyType := range []models.WalletHistoryType{models.WalletHistoryTypePayment, models.WalletHistoryTypeRefund} {
+				var count int64
+				if err := db.Model(&models.WalletHistory{}).Where("user_id = ? AND type = ?", userID, historyType).Count(&count).Error; err != nil {
+					t.Fatalf("统计钱包历史失败: %v", err)
+				}
+				if count != int64(rounds) {
+					t.Errorf("%s 历史记录 = %d 条, 期望 %d 条", historyType, count, rounds)
+				}
+			}
+		})
+	}
+}
+
+// TestWalletUpdateVersionConflict 使用过期版本号更新钱包必须返回 ErrVersionConflict
+func TestWalletUpdateVersionConflict(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	walletRepo := repository.NewWalletRepository(db)
+
+	wallet, err := walletRepo.GetOrCreate(ctx, 42)
+	if err != nil {
+		t.Fatalf("创建钱包失败: %v", err)
+	}
+	stale := *wallet
+
+	wallet.Balance = "1"
+	if err := walletRepo.Update(ctx, wallet); err != nil {
+		t.Fatalf("首次更新失败: %v", err)
+	}
+
+	stale.Balance = "2"
+	if err := walletRepo.Update(ctx, &stale); err != repository.ErrVersionConflict {
+		t.Fatalf("过期版本更新应返回 ErrVersionConflict, 实际: %v", err)
+	}
+}
+
+// TestWalletInLedgerTxDuplicateKey 唯一索引冲突只有在幂等记录已存在时才视为已处理
+func TestWalletInLedgerTxDuplicateKey(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	service := NewWalletService(walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil).(*walletService)
+
+	applied := &models.WalletOperation{OperationType: models.LedgerEntryTypePayment, RelatedID: "ORD-1", UserID: 1, Amount: "1"}
+	if err := db.Create(applied).Error; err != nil {
+		t.Fatalf("创建幂等记录失败: %v", err)
+	}
+	duplicate := func(tx *gorm.DB) error {
+		return tx.Create(&models.WalletOperation{OperationType: models.LedgerEntryTypePayment, RelatedID: "ORD-1", UserID: 1, Amount: "1"}).Error
+	}
+
+	if err := service.inLedgerTx(ctx, models.LedgerEntryTypePayment, "ORD-1", duplicate); err != nil {
+		t.Errorf("操作已记账时应返回成功, 实际: %v", err)
+	}
+	if err := service.inLedgerTx(ctx, models.LedgerEntryTypePayment, "ORD-2", duplicate); !repository.IsDuplicateKeyError(err) {
+		t.Errorf("操作未记账时应返回唯一索引冲突, 实际: %v", err)
+	}
+}
+
+// TestWalletConcurrentTransfers 两个用户同时相向转账，不能死锁，资金总额守恒且双方流水成对
+func TestWalletConcurrentTransfers(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	ledgerService := NewLedgerService(db, ledgerRepo, walletRepo)
+	walletService := NewWalletService(walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil)
+
+	const alice, bob = int64(1001), int64(1002)
+	for _, userID := range []int64{alice, bob} {
+		if err := walletService.AddBalance(ctx, userID, "50", fmt.Sprintf("seed-%d", userID), "初始余额"); err != nil {
+			t.Fatalf("初始化余额失败: %v", err)
+		}
+	}
+
+	const rounds = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, rounds*2)
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := walletService.Transfer(ctx, alice, bob, "1.5", "午饭"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := walletService.Transfer(ctx, bob, alice, "1", ""); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	expect := map[int64]string{
+		alice: fmt.Sprintf("%.8f", 50-rounds*0.5),
+		bob:   fmt.Sprintf("%.8f", 50+rounds*0.5),
+	}
+	for userID, want := range expect {
+		wallet, err := walletRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if got := normalizeAmount(wallet.Balance); got != want {
+			t.Errorf("用户 %d 余额 = %s, 期望 %s", userID, got, want)
+		}
+	}
+
+	var histories int64
+	db.Model(&models.WalletHistory{}).Where("related_type = ?", "transfer").Count(&histories)
+	if histories != rounds*4 {
+		t.Errorf("转账流水 = %d 条, 期望 %d 条", histories, rounds*4)
+	}
+
+	clearing, err := ledgerRepo.GetAccount(ctx, 0, models.LedgerAccountTransferClearing)
+	if err != nil {
+		t.Fatalf("获取转账过渡科目失败: %v", err)
+	}
+	if got := normalizeAmount(clearing.Balance); got != zeroAmount {
+		t.Errorf("转账过渡科目余额 = %s, 期望 0", got)
+	}
+
+	if _, err := walletService.Transfer(ctx, alice, alice, "1", ""); err != ErrTransferToSelf {
+		t.Errorf("给自己转账应返回 ErrTransferToSelf, 实际: %v", err)
+	}
+	if _, err := walletService.Transfer(ctx, alice, bob, "0.001", ""); err != ErrInvalidTransferAmount {
+		t.Errorf("超过两位小数应返回 ErrInvalidTransferAmount, 实际: %v", err)
+	}
+	if _, err := walletService.Transfer(ctx, alice, bob, "1000", ""); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("余额不足应返回 ErrInsufficientBalance, 实际: %v", err)
+	}
+}
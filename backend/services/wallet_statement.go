@@ -0,0 +1,354 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"tg-robot-sim/pkg/pdf"
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// maxStatementDays 单份对账单最多覆盖的天数
+const maxStatementDays = 366
+
+// 对账单文件格式
+const (
+	StatementFormatCSV = "csv"
+	StatementFormatPDF = "pdf"
+)
+
+// ErrInvalidStatementPeriod 对账单期间无效
+var ErrInvalidStatementPeriod = fmt.Errorf("对账单期间无效，结束日期不能早于开始日期且跨度不超过 %d 天", maxStatementDays)
+
+// WalletStatement 钱包对账单
+type WalletStatement struct {
+	UserID          int64                   `json:"user_id"`
+	From            time.Time               `json:"from"` // 开始日期（含）
+	To              time.Time               `json:"to"`   // 结束日期（含）
+	Currency        string                  `json:"currency"`
+	OpeningBalance  string                  `json:"opening_balance"`
+	ClosingBalance  string                  `json:"closing_balance"`
+	TotalIncome     string                  `json:"total_income"`     // 期间收入合计
+	TotalExpense    string                  `json:"total_expense"`    // 期间支出合计（正数）
+	LifetimeIncome  string                  `json:"lifetime_income"`  // 累计收入
+	LifetimeExpense string                  `json:"lifetime_expense"` // 累计支出
+	Entries         []*WalletStatementEntry `json:"entries"`
+	GeneratedAt     time.Time               `json:"generated_at"`
+}
+
+// WalletStatementEntry 对账单中的一笔资金变动
+type WalletStatementEntry struct {
+	Time         time.Time                `json:"time"`
+	Type         models.WalletHistoryType `json:"type"`
+	Description  string                   `json:"description"`
+	Amount       string                   `json:"amount"` // 正数为收入，负数为支出
+	BalanceAfter string                   `json:"balance_after"`
+	RelatedID    string                   `json:"related_id"` // 关联订单号
+	TxHash       string                   `json:"tx_hash"`
+}
+
+// GetWalletStatement 生成指定日期范围内的钱包对账单，只包含已完成的资金变动
+func (s *walletHistoryService) GetWalletStatement(ctx context.Context, userID int64, from, to time.Time) (*WalletStatement, error) {
+	if to.Before(from) || to.Sub(from) >= maxStatementDays*24*time.Hour {
+		return nil, ErrInvalidStatementPeriod
+	}
+
+	histories, _, err := s.GetWalletHistory(ctx, userID, WalletHistoryFilters{
+		UserID:    userID,
+		StartDate: from.Format("2006-01-02"),
+		EndDate:   to.Format("2006-01-02"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.GetWalletHistoryStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var completed []*models.WalletHistory
+	for _, history := range histories {
+		if history.IsCompleted() {
+			completed = append(completed, history)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		if completed[i].CreatedAt.Equal(completed[j].CreatedAt) {
+			return completed[i].ID < completed[j].ID
+		}
+		return completed[i].CreatedAt.Before(completed[j].CreatedAt)
+	})
+
+	// 期初余额取期间第一笔变动前的余额，期间没有变动时取之前最后一笔变动后的余额
+	opening := "0"
+	if len(completed) > 0 {
+		opening = completed[0].BalanceBefore
+	} else {
+		previous, err := s.walletHistoryRepo.GetLatestCompletedBefore(ctx, userID, from)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("获取期初余额失败: %w", err)
+		}
+		if previous != nil {
+			opening = previous.BalanceAfter
+		}
+	}
+	closing := opening
+	if len(completed) > 0 {
+		closing = completed[len(completed)-1].BalanceAfter
+	}
+
+	income := new(big.Float)
+	expense := new(big.Float)
+	entries := make([]*WalletStatementEntry, 0, len(completed))
+	for _, history := range completed {
+		amount, err := parseDecimal(history.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("记录 %d 金额格式错误: %w", history.ID, err)
+		}
+		if amount.Sign() > 0 {
+			income.Add(income, amount)
+		} else {
+			expense.Sub(expense, amount)
+		}
+
+		entries = append(entries, &WalletStatementEntry{
+			Time:         history.CreatedAt,
+			Type:         history.Type,
+			Description:  history.Description,
+			Amount:       statementAmount(history.Amount),
+			BalanceAfter: statementAmount(history.BalanceAfter),
+			RelatedID:    history.RelatedID,
+			TxHash:       history.TxHash,
+		})
+	}
+
+	return &WalletStatement{
+		UserID:          userID,
+		From:            from,
+		To:              to,
+		Currency:        models.PricingCurrency,
+		OpeningBalance:  statementAmount(opening),
+		ClosingBalance:  statementAmount(closing),
+		TotalIncome:     income.Text('f', 2),
+		TotalExpense:    expense.Text('f', 2),
+		LifetimeIncome:  statementAmount(stats.TotalIncome),
+		LifetimeExpense: statementAmount(stats.TotalExpense),
+		Entries:         entries,
+		GeneratedAt:     time.Now(),
+	}, nil
+}
+
+// ParseStatementPeriod 解析 YYYY-MM-DD 格式的对账单期间
+// from 为空时默认为当月第一天，to 为空时默认为今天
+func ParseStatementPeriod(from, to string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := today
+
+	var err error
+	if from != "" {
+		if start, err = time.Parse("2006-01-02", from); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: 开始日期格式应为 YYYY-MM-DD", ErrInvalidStatementPeriod)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse("2006-01-02", to); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: 结束日期格式应为 YYYY-MM-DD", ErrInvalidStatementPeriod)
+		}
+	}
+	if end.Before(start) || end.Sub(start) >= maxStatementDays*24*time.Hour {
+		return time.Time{}, time.Time{}, ErrInvalidStatementPeriod
+	}
+	return start, end, nil
+}
+
+// RenderWalletStatement 按格式渲染对账单，返回文件内容和 MIME 类型
+func RenderWalletStatement(statement *WalletStatement, format string) ([]byte, string, error) {
+	switch format {
+	case StatementFormatCSV:
+		content, err := RenderWalletStatementCSV(statement)
+		return content, "text/csv; charset=utf-8", err
+	case StatementFormatPDF:
+		return RenderWalletStatementPDF(statement), "application/pdf", nil
+	default:
+		return nil, "", fmt.Errorf("不支持的对账单格式: %s", format)
+	}
+}
+
+// StatementFileName 对账单文件名，format 为 csv 或 pdf
+func StatementFileName(statement *WalletStatement, format string) string {
+	return fmt.Sprintf("statement_%d_%s_%s.%s",
+		statement.UserID, statement.From.Format("20060102"), statement.To.Format("20060102"), format)
+}
+
+// RenderWalletStatementCSV 将对账单渲染为 CSV（带 UTF-8 BOM，便于 Excel 识别中文）
+func RenderWalletStatementCSV(statement *WalletStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"钱包对账单"},
+		{"用户ID", strconv.FormatInt(statement.UserID, 10)},
+		{"期间", statementPeriod(statement)},
+		{"币种", statement.Currency},
+		{"期初余额", statement.OpeningBalance},
+		{"收入合计", statement.TotalIncome},
+		{"支出合计", statement.TotalExpense},
+		{"期末余额", statement.ClosingBalance},
+		{},
+		{"时间", "类型", "说明", "金额", "余额", "关联单号", "交易哈希"},
+	}
+	for _, entry := range statement.Entries {
+		rows = append(rows, []string{
+			entry.Time.Format("2006-01-02 15:04:05"),
+			statementTypeLabel(entry.Type),
+			entry.Description,
+			entry.Amount,
+			entry.BalanceAfter,
+			entry.RelatedID,
+			entry.TxHash,
+		})
+	}
+	rows = append(rows,
+		[]string{},
+		[]string{"生成时间", statement.GeneratedAt.Format("2006-01-02 15:04:05")},
+	)
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("生成 CSV 失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderWalletStatementPDF 将对账单渲染为 PDF
+func RenderWalletStatementPDF(statement *WalletStatement) []byte {
+	const (
+		margin     = 40.0
+		rowSize    = 8.0
+		rowHeight  = 14.0
+		hashHeight = 11.0
+		bottom     = pdf.PageHeight - 50
+	)
+	columns := []struct {
+		title string
+		x     float64
+		width float64
+	}{
+		{"时间", margin, 80},
+		{"类型", 122, 40},
+		{"说明", 164, 170},
+		{"金额", 336, 58},
+		{"余额", 396, 58},
+		{"关联单号", 456, 100},
+	}
+
+	doc := pdf.New()
+	doc.AddPage()
+
+	doc.Text(margin, 50, 16, "钱包对账单 Wallet Statement")
+	summary := []string{
+		fmt.Sprintf("用户ID: %d", statement.UserID),
+		fmt.Sprintf("期间: %s", statementPeriod(statement)),
+		fmt.Sprintf("币种: %s", statement.Currency),
+		fmt.Sprintf("期初余额: %s    收入合计: %s    支出合计: %s    期末余额: %s",
+			statement.OpeningBalance, statement.TotalIncome, statement.TotalExpense, statement.ClosingBalance),
+		fmt.Sprintf("累计收入: %s    累计支出: %s", statement.LifetimeIncome, statement.LifetimeExpense),
+	}
+	y := 75.0
+	for _, line := range summary {
+		doc.Text(margin, y, 10, line)
+		y += 15
+	}
+
+	drawHeader := func(y float64) float64 {
+		for _, column := range columns {
+			doc.Text(column.x, y, rowSize+1, column.title)
+		}
+		doc.Line(margin, y+4, pdf.PageWidth-margin, y+4, 0.5)
+		return y + rowHeight + 2
+	}
+
+	y = drawHeader(y + 10)
+	if len(statement.Entries) == 0 {
+		doc.Text(margin, y, rowSize, "本期间没有资金变动")
+		y += rowHeight
+	}
+	for _, entry := range statement.Entries {
+		height := rowHeight
+		if entry.TxHash != "" {
+			height += hashHeight
+		}
+		if y+height > bottom {
+			doc.AddPage()
+			y = drawHeader(50)
+		}
+
+		values := []string{
+			entry.Time.Format("2006-01-02 15:04"),
+			statementTypeLabel(entry.Type),
+			entry.Description,
+			entry.Amount,
+			entry.BalanceAfter,
+			entry.RelatedID,
+		}
+		for i, column := range columns {
+			doc.Text(column.x, y, rowSize, pdf.Truncate(values[i], rowSize, column.width))
+		}
+		if entry.TxHash != "" {
+			doc.Text(columns[2].x, y+hashHeight, rowSize-1, "TX: "+entry.TxHash)
+		}
+		y += height
+	}
+
+	doc.Line(margin, y-6, pdf.PageWidth-margin, y-6, 0.5)
+	doc.Text(margin, y+8, rowSize, fmt.Sprintf("生成时间: %s", statement.GeneratedAt.Format("2006-01-02 15:04:05")))
+
+	return doc.Bytes()
+}
+
+// statementPeriod 对账单期间描述
+func statementPeriod(statement *WalletStatement) string {
+	return fmt.Sprintf("%s 至 %s", statement.From.Format("2006-01-02"), statement.To.Format("2006-01-02"))
+}
+
+// statementAmount 金额格式化为两位小数，无法解析时原样返回
+func statementAmount(amount string) string {
+	value, err := parseDecimal(amount)
+	if err != nil {
+		return amount
+	}
+	return value.Text('f', 2)
+}
+
+// statementTypeLabel 资金变动类型的中文名称
+func statementTypeLabel(historyType models.WalletHistoryType) string {
+	switch historyType {
+	case models.WalletHistoryTypeRecharge:
+		return "充值"
+	case models.WalletHistoryTypePayment:
+		return "支付"
+	case models.WalletHistoryTypeRefund:
+		return "退款"
+	case models.WalletHistoryTypeAdjustment:
+		return "调整"
+	case models.WalletHistoryTypeTransferIn:
+		return "转入"
+	case models.WalletHistoryTypeTransferOut:
+		return "转出"
+	case models.WalletHistoryTypeReferral:
+		return "邀请奖励"
+	default:
+		return string(historyType)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestWalletStatement 对账单的期初、期末余额和收支合计，以及 CSV / PDF 渲染
+func TestWalletStatement(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	historyService := NewWalletHistoryService(repository.NewWalletHistoryRepository(db))
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 10, 0, 0, 0, time.UTC) }
+	records := []struct {
+		at      time.Time
+		history models.WalletHistory
+	}{
+		{day(1), models.WalletHistory{Type: models.WalletHistoryTypeRecharge, Amount: "50", BalanceBefore: "0", BalanceAfter: "50", RelatedID: "RCH1", TxHash: "hash-1"}},
+		{day(10), models.WalletHistory{Type: models.WalletHistoryTypePayment, Amount: "-12.5", BalanceBefore: "50", BalanceAfter: "37.5", RelatedID: "ORD1"}},
+		{day(11), models.WalletHistory{Type: models.WalletHistoryTypeRefund, Amount: "2.5", BalanceBefore: "37.5", BalanceAfter: "40", RelatedID: "ORD1"}},
+		{day(12), models.WalletHistory{Type: models.WalletHistoryTypePayment, Amount: "-5", BalanceBefore: "40", BalanceAfter: "40", RelatedID: "ORD2", Status: models.WalletHistoryStatusFailed}},
+		{day(25), models.WalletHistory{Type: models.WalletHistoryTypePayment, Amount: "-10", BalanceBefore: "40", BalanceAfter: "30", RelatedID: "ORD3"}},
+	}
+	for _, record := range records {
+		history := record.history
+		history.UserID = 7
+		history.Description = "测试记录"
+		if history.Status == "" {
+			history.Status = models.WalletHistoryStatusCompleted
+		}
+		if err := db.Create(&history).Error; err != nil {
+			t.Fatalf("创建历史记录失败: %v", err)
+		}
+		if err := db.Model(&history).UpdateColumn("created_at", record.at).Error; err != nil {
+			t.Fatalf("设置记录时间失败: %v", err)
+		}
+	}
+
+	from, to, err := ParseStatementPeriod("2026-03-05", "2026-03-20", time.Now())
+	if err != nil {
+		t.Fatalf("解析对账单期间失败: %v", err)
+	}
+	statement, err := historyService.GetWalletStatement(ctx, 7, from, to)
+	if err != nil {
+		t.Fatalf("生成对账单失败: %v", err)
+	}
+
+	if len(statement.Entries) != 2 {
+		t.Fatalf("资金变动数量 = %d, 期望 2（失败记录和期间外记录不计入）", len(statement.Entries))
+	}
+	checks := map[string][2]string{
+		"期初余额": {statement.OpeningBalance, "50.00"},
+		"期末余额": {statement.ClosingBalance, "40.00"},
+		"收入合计": {statement.TotalIncome, "2.50"},
+		"支出合计": {statement.TotalExpense, "12.50"},
+	}
+	for name, check := range checks {
+		if check[0] != check[1] {
+			t.Errorf("%s = %s, 期望 %s", name, check[0], check[1])
+		}
+	}
+
+	// 期间内没有变动时，期初和期末余额取之前最后一笔变动后的余额
+	from, to, _ = ParseStatementPeriod("2026-03-21", "2026-03-22", time.Now())
+	empty, err := historyService.GetWalletStatement(ctx, 7, from, to)
+	if err != nil {
+		t.Fatalf("生成对账单失败: %v", err)
+	}
+	if empty.OpeningBalance != "40.00" || empty.ClosingBalance != "40.00" {
+		t.Errorf("空期间余额 = %s / %s, 期望 40.00", empty.OpeningBalance, empty.ClosingBalance)
+	}
+
+	csvContent, err := RenderWalletStatementCSV(statement)
+	if err != nil {
+		t.Fatalf("生成 CSV 失败: %v", err)
+	}
+	if !strings.Contains(string(csvContent), "ORD1") || !strings.Contains(string(csvContent), "期末余额,40.00") {
+		t.Errorf("CSV 内容缺少订单号或期末余额:\n%s", csvContent)
+	}
+
+	pdfContent := RenderWalletStatementPDF(statement)
+	if !bytes.HasPrefix(pdfContent, []byte("%PDF-")) || !bytes.HasSuffix(pdfContent, []byte("%%EOF\n")) {
+		t.Errorf("PDF 文件头或文件尾不正确")
+	}
+
+	if _, _, err := ParseStatementPeriod("2026-03-20", "2026-03-05", time.Now()); err == nil {
+		t.Errorf("结束日期早于开始日期应返回错误")
+	}
+}
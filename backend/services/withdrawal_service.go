@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/pkg/tron"
+	"tg-robot-sim/storage/models"
+	"tg-robot-sim/storage/repository"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidWithdrawalAmount 提现金额无效
+	ErrInvalidWithdrawalAmount = errors.New("invalid withdrawal amount")
+	// ErrInvalidWithdrawalAddress 提现地址无效
+	ErrInvalidWithdrawalAddress = errors.New("invalid TRON address")
+	// ErrWithdrawalDailyLimitExceeded 超出每日提现限额
+	ErrWithdrawalDailyLimitExceeded = errors.New("daily withdrawal limit exceeded")
+	// ErrWithdrawalNotFound 提现申请不存在
+	ErrWithdrawalNotFound = errors.New("withdrawal request not found")
+	// ErrWithdrawalNotPending 提现申请已审核
+	ErrWithdrawalNotPending = errors.New("withdrawal request is not pending")
+	// ErrInvalidPayoutTxHash 打款交易哈希格式错误
+	ErrInvalidPayoutTxHash = errors.New("invalid payout tx hash")
+)
+
+var (
+	// tronTxHashPattern TRON 交易哈希格式：64 位十六进制
+	tronTxHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// withdrawalAmountDecimals 提现金额的小数位数，与钱包流水金额的精度一致
+const withdrawalAmountDecimals = 2
+
+// WithdrawalDailyUsage 用户当日提现额度使用情况
+type WithdrawalDailyUsage struct {
+	Used      string `json:"used"`
+	Limit     string `json:"limit"`
+	Remaining string `json:"remaining"`
+}
+
+// WithdrawalService 提现服务接口
+// 提现申请创建时冻结金额，管理员审核通过后从冻结余额扣除，拒绝时解冻退还
+// 冻结、扣款、解冻均以提现单号作为幂等键，审核操作可安全重试
+type WithdrawalService interface {
+	// CreateWithdrawal 创建提现申请并冻结金额
+	CreateWithdrawal(ctx context.Context, userID int64, amount string, toAddress string) (*models.WithdrawalRequest, error)
+
+	// GetWithdrawal 获取用户的提现申请详情
+	GetWithdrawal(ctx context.Context, userID int64, withdrawalNo string) (*models.WithdrawalRequest, error)
+
+	// GetUserWithdrawals 获取用户的提现申请列表
+	GetUserWithdrawals(ctx context.Context, userID int64, limit, offset int) ([]*models.WithdrawalRequest, int64, error)
+
+	// GetDailyUsage 获取用户当日提现额度使用情况
+	GetDailyUsage(ctx context.Context, userID int64) (*WithdrawalDailyUsage, error)
+
+	// ListWithdrawals 按状态列出提现申请（管理员），status 为空时返回全部
+	ListWithdrawals(ctx context.Context, status models.WithdrawalStatus, limit, offset int) ([]*models.WithdrawalRequest, error)
+
+	// ApproveWithdrawal 审核通过：记录打款交易哈希并从冻结余额扣除
+	ApproveWithdrawal(ctx context.Context, withdrawalNo string, txHash string, operator string) (*models.WithdrawalRequest, error)
+
+	// RejectWithdrawal 拒绝提现：解冻金额退还到可用余额
+	RejectWithdrawal(ctx context.Context, withdrawalNo string, reason string, operator string) (*models.WithdrawalRequest, error)
+}
+
+// withdrawalService 提现服务实现
+type withdrawalService struct {
+	withdrawalRepo      repository.WithdrawalRepository
+	walletService       WalletService
+	ledgerService       LedgerService
+	notificationService NotificationService
+	config              *config.WithdrawalConfig
+}
+
+// NewWithdrawalService 创建提现服务实例
+// notificationService 可以为 nil，此时审核结果不通知用户；提现地址离线校验，不访问节点
+func NewWithdrawalService(
+	withdrawalRepo repository.WithdrawalRepository,
+	walletService WalletService,
+	ledgerService LedgerService,
+	notificationService NotificationService,
+	cfg *config.WithdrawalConfig,
+) WithdrawalService {
+	return &withdrawalService{
+		withdrawalRepo:      withdrawalRepo,
+		walletService:       walletService,
+		ledgerService:       ledgerService,
+		notificationService: notificationService,
+		config:              cfg,
+	}
+}
+
+// CreateWithdrawal 创建提现申请并冻结金额
+func (s *withdrawalService) CreateWithdrawal(ctx context.Context, userID int64, amount string, toAddress string) (*models.WithdrawalRequest, error) {
+	amountValue, err := s.parseWithdrawalAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	amountText := amountValue.FloatString(withdrawalAmountDecimals)
+
+	toAddress = strings.TrimSpace(toAddress)
+	if err := validateWithdrawalAddress(toAddress); err != nil {
+		return nil, err
+	}
+
+	// 检查每日限额
+	used, err := s.dailyUsed(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if new(big.Rat).Add(used, amountValue).Cmp(s.dailyLimit()) > 0 {
+		return nil, ErrWithdrawalDailyLimitExceeded
+	}
+
+	withdrawal := &models.WithdrawalRequest{
+		WithdrawalNo: models.GenerateWithdrawalNo(),
+		UserID:       userID,
+		Amount:       amountText,
+		ToAddress:    toAddress,
+		Status:       models.WithdrawalStatusPending,
+	}
+
+	// 申请和冻结在同一事务中提交，不会出现金额已冻结却没有可审核申请的情况
+	description := fmt.Sprintf("提现冻结 - 单号: %s", withdrawal.WithdrawalNo)
+	err = s.ledgerService.Transaction(ctx, func(tx *gorm.DB) error {
+		withdrawal.ID = 0 // 冲突重试时重新插入
+		if err := s.withdrawalRepo.WithTx(tx).Create(ctx, withdrawal); err != nil {
+			return fmt.Errorf("创建提现申请失败: %w", err)
+		}
+		// 冻结金额（余额不足时返回 ErrInsufficientBalance）
+		return s.walletService.FreezeBalanceInTx(ctx, tx, userID, amountText, withdrawal.WithdrawalNo, description)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 并发提交的申请可能同时通过了上面的限额检查，保存后再核对一次，超限的申请直接拒绝
+	used, err = s.dailyUsed(ctx, userID)
+	if err == nil && used.Cmp(s.dailyLimit()) > 0 {
+		if _, rejectErr := s.reject(ctx, withdrawal, "超出每日提现限额", "system", false); rejectErr != nil {
+			return nil, fmt.Errorf("%w (撤销申请失败: %v)", ErrWithdrawalDailyLimitExceeded, rejectErr)
+		}
+		return nil, ErrWithdrawalDailyLimitExceeded
+	}
+
+	return withdrawal, nil
+}
+
+// GetWithdrawal 获取用户的提现申请详情
+func (s *withdrawalService) GetWithdrawal(ctx context.Context, userID int64, withdrawalNo string) (*models.WithdrawalRequest, error) {
+	withdrawal, err := s.getByWithdrawalNo(ctx, withdrawalNo)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证用户权限
+	if withdrawal.UserID != userID {
+		return nil, ErrWithdrawalNotFound
+	}
+	return withdrawal, nil
+}
+
+// GetUserWithdrawals 获取用户的提现申请列表
+func (s *withdrawalService) GetUserWithdrawals(ctx context.Context, userID int64, limit, offset int) ([]*models.WithdrawalRequest, int64, error) {
+	withdrawals, err := s.withdrawalRepo.GetByUserID(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取提现记录失败: %w", err)
+	}
+
+	total, err := s.withdrawalRepo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取提现记录总数失败: %w", err)
+	}
+
+	return withdrawals, total, nil
+}
+
+// GetDailyUsage 获取用户当日提现额度使用情况
+func (s *withdrawalService) GetDailyUsage(ctx context.Context, userID int64) (*WithdrawalDailyUsage, error) {
+	used, err := s.dailyUsed(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := s.dailyLimit()
+	remaining := new(big.Rat).Sub(limit, used)
+	if remaining.Sign() < 0 {
+		remaining.SetInt64(0)
+	}
+
+	return &WithdrawalDailyUsage{
+		Used:      used.FloatString(2),
+		Limit:     limit.FloatString(2),
+		Remaining: remaining.FloatString(2),
+	}, nil
+}
+
+// ListWithdrawals 按状态列出提现申请
+func (s *withdrawalService) ListWithdrawals(ctx context.Context, status models.WithdrawalStatus, limit, offset int) ([]*models.WithdrawalRequest, error) {
+	withdrawals, err := s.withdrawalRepo.GetByStatus(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("获取提现申请失败: %w", err)
+	}
+	return withdrawals, nil
+}
+
+// ApproveWithdrawal 审核通过：记录打款交易哈希并从冻结余额扣除
+// 对已通过且交易哈希相同的申请重复调用时，会重新执行幂等扣款，用于修复扣款中断的情况
+func (s *withdrawalService) ApproveWithdrawal(ctx context.Context, withdrawalNo string, txHash string, operator string) (*models.WithdrawalRequest, error) {
+	txHash = strings.TrimPrefix(strings.TrimSpace(txHash), "0x")
+	if !tronTxHashPattern.MatchString(txHash) {
+		return nil, ErrInvalidPayoutTxHash
+	}
+
+	withdrawal, err := s.getByWithdrawalNo(ctx, withdrawalNo)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := withdrawal.Status == models.WithdrawalStatusApproved && strings.EqualFold(withdrawal.TxHash, txHash)
+	if !withdrawal.IsPending() && !retry {
+		return nil, fmt.Errorf("%w: 当前状态 %s", ErrWithdrawalNotPending, withdrawal.Status)
+	}
+
+	if !retry {
+		now := time.Now()
+		withdrawal.Status = models.WithdrawalStatusApproved
+		withdrawal.TxHash = txHash
+		withdrawal.Reviewer = operator
+		withdrawal.ReviewedAt = &now
+
+		// 先抢占状态，保证并发的通过/拒绝只有一个生效
+		updated, err := s.withdrawalRepo.UpdateStatusFrom(ctx, withdrawal, models.WithdrawalStatusPending)
+		if err != nil {
+			return nil, fmt.Errorf("更新提现申请失败: %w", err)
+		}
+		if !updated {
+			return nil, ErrWithdrawalNotPending
+		}
+	}
+
+	description := fmt.Sprintf("USDT 提现 - 单号: %s", withdrawal.WithdrawalNo)
+	if err := s.walletService.ConfirmFrozenPayment(ctx, withdrawal.UserID, withdrawal.Amount, withdrawal.WithdrawalNo, description); err != nil {
+		return nil, fmt.Errorf("扣除冻结金额失败，可使用相同交易哈希重试: %w", err)
+	}
+
+	if !retry {
+		s.notify(ctx, withdrawal.UserID, fmt.Sprintf(
+			"✅ <b>提现已到账</b>\n\n"+
+				"💰 <b>金额:</b> %s USDT\n"+
+				"📍 <b>地址:</b> <code>%s</code>\n"+
+				"🔗 <b>交易哈希:</b> <code>%s</code>\n"+
+				"📋 <b>单号:</b> <code>%s</code>",
+			withdrawal.Amount, withdrawal.ToAddress, withdrawal.TxHash, withdrawal.WithdrawalNo,
+		))
+	}
+
+	return withdrawal, nil
+}
+
+// RejectWithdrawal 拒绝提现：解冻金额退还到可用余额
+// 对已拒绝的申请重复调用时，会重新执行幂等解冻
+func (s *withdrawalService) RejectWithdrawal(ctx context.Context, withdrawalNo string, reason string, operator string) (*models.WithdrawalRequest, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("拒绝原因不能为空")
+	}
+
+	withdrawal, err := s.getByWithdrawalNo(ctx, withdrawalNo)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reject(ctx, withdrawal, reason, operator, true)
+}
+
+// reject 将申请标记为拒绝并解冻金额
+func (s *withdrawalService) reject(ctx context.Context, withdrawal *models.WithdrawalRequest, reason string, operator string, notify bool) (*models.WithdrawalRequest, error) {
+	retry := withdrawal.Status == models.WithdrawalStatusRejected
+	if !withdrawal.IsPending() && !retry {
+		return nil, fmt.Errorf("%w: 当前状态 %s", ErrWithdrawalNotPending, withdrawal.Status)
+	}
+
+	if !retry {
+		now := time.Now()
+		withdrawal.Status = models.WithdrawalStatusRejected
+		withdrawal.Reviewer = operator
+		withdrawal.RejectReason = reason
+		withdrawal.ReviewedAt = &now
+
+		updated, err := s.withdrawalRepo.UpdateStatusFrom(ctx, withdrawal, models.WithdrawalStatusPending)
+		if err != nil {
+			return nil, fmt.Errorf("更新提现申请失败: %w", err)
+		}
+		if !updated {
+			return nil, ErrWithdrawalNotPending
+		}
+	}
+
+	description := fmt.Sprintf("提现被拒绝，退还冻结金额 - 单号: %s", withdrawal.WithdrawalNo)
+	if err := s.walletService.UnfreezeBalance(ctx, withdrawal.UserID, withdrawal.Amount, withdrawal.WithdrawalNo, description); err != nil {
+		return nil, fmt.Errorf("解冻金额失败，可重新执行拒绝操作重试: %w", err)
+	}
+
+	if notify && !retry {
+		s.notify(ctx, withdrawal.UserID, fmt.Sprintf(
+			"❌ <b>提现申请未通过</b>\n\n"+
+				"💰 <b>金额:</b> %s USDT\n"+
+				"📝 <b>原因:</b> %s\n"+
+				"📋 <b>单号:</b> <code>%s</code>\n\n"+
+				"冻结金额已退还到您的钱包余额。",
+			withdrawal.Amount, withdrawal.RejectReason, withdrawal.WithdrawalNo,
+		))
+	}
+
+	return withdrawal, nil
+}
+
+// getByWithdrawalNo 根据单号获取提现申请
+func (s *withdrawalService) getByWithdrawalNo(ctx context.Context, withdrawalNo string) (*models.WithdrawalRequest, error) {
+	withdrawal, err := s.withdrawalRepo.GetByWithdrawalNo(ctx, strings.TrimSpace(withdrawalNo))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWithdrawalNotFound
+		}
+		return nil, fmt.Errorf("获取提现申请失败: %w", err)
+	}
+	return withdrawal, nil
+}
+
+// parseWithdrawalAmount 校验提现金额：在单笔限额内且不超过两位小数
+func (s *withdrawalService) parseWithdrawalAmount(amount string) (*big.Rat, error) {
+	amount = strings.TrimSpace(amount)
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || value.Sign() <= 0 || strings.ContainsAny(amount, "eE/") {
+		return nil, ErrInvalidWithdrawalAmount
+	}
+	if _, fraction, ok := strings.Cut(amount, "."); ok && len(strings.TrimRight(fraction, "0")) > withdrawalAmountDecimals {
+		return nil, fmt.Errorf("%w: 最多 %d 位小数", ErrInvalidWithdrawalAmount, withdrawalAmountDecimals)
+	}
+
+	if value.Cmp(withdrawalConfigAmount(s.config.MinAmount)) < 0 {
+		return nil, fmt.Errorf("%w: 提现金额不能低于 %.2f USDT", ErrInvalidWithdrawalAmount, s.config.MinAmount)
+	}
+	if value.Cmp(withdrawalConfigAmount(s.config.MaxAmount)) > 0 {
+		return nil, fmt.Errorf("%w: 提现金额不能超过 %.2f USDT", ErrInvalidWithdrawalAmount, s.config.MaxAmount)
+	}
+	return value, nil
+}
+
+// validateWithdrawalAddress 离线校验 TRON 提现地址（base58check 校验和、0x41 前缀）
+func validateWithdrawalAddress(address string) error {
+	if !tron.IsValidAddress(address) {
+		return ErrInvalidWithdrawalAddress
+	}
+	return nil
+}
+
+// dailyUsed 统计用户当日（自然日）待审核和已打款的提现金额
+func (s *withdrawalService) dailyUsed(ctx context.Context, userID int64) (*big.Rat, error) {
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	withdrawals, err := s.withdrawalRepo.GetByUserIDAndStatuses(ctx, userID, []models.WithdrawalStatus{
+		models.WithdrawalStatusPending,
+		models.WithdrawalStatusApproved,
+	}, startOfDay)
+	if err != nil {
+		return nil, fmt.Errorf("获取当日提现金额失败: %w", err)
+	}
+
+	used := new(big.Rat)
+	for _, withdrawal := range withdrawals {
+		amount, ok := new(big.Rat).SetString(withdrawal.Amount)
+		if !ok {
+			return nil, fmt.Errorf("提现申请 %s 金额格式错误: %s", withdrawal.WithdrawalNo, withdrawal.Amount)
+		}
+		used.Add(used, amount)
+	}
+	return used, nil
+}
+
+// dailyLimit 每日提现限额
+func (s *withdrawalService) dailyLimit() *big.Rat {
+	return withdrawalConfigAmount(s.config.DailyLimit)
+}
+
+// withdrawalConfigAmount 将配置中的金额按十进制字符串转换，避免二进制浮点误差影响限额比较
+func withdrawalConfigAmount(amount float64) *big.Rat {
+	value, _ := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	return value
+}
+
+// notify 通知用户，失败只记录日志
+func (s *withdrawalService) notify(ctx context.Context, userID int64, message string) {
+	if s.notificationService == nil {
+		return
+	}
+	if err := s.notificationService.SendMessage(ctx, userID, message); err != nil {
+		fmt.Printf("Warning: failed to send withdrawal notification: %v\n", err)
+	}
+}
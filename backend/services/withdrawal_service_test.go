@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tg-robot-sim/config"
+	"tg-robot-sim/storage/repository"
+)
+
+// TestCreateWithdrawalFreezesAtomically 提现申请与冻结在同一事务中提交，金额精确到分并按十进制比较限额
+func TestCreateWithdrawalFreezesAtomically(t *testing.T) {
+	db := openRaceTestDB(t, "sqlite")
+	ctx := context.Background()
+	const address = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+
+	walletRepo := repository.NewWalletRepository(db)
+	withdrawalRepo := repository.NewWithdrawalRepository(db)
+	ledgerService := NewLedgerService(db, repository.NewLedgerRepository(db), walletRepo)
+	walletService := NewWalletService(walletRepo, repository.NewRechargeOrderRepository(db), nil, nil, ledgerService, nil, nil)
+	cfg := config.WithdrawalConfig{MinAmount: 0.1, MaxAmount: 50, DailyLimit: 0.3}
+	withdrawalService := NewWithdrawalService(withdrawalRepo, walletService, ledgerService, nil, &cfg)
+
+	if err := walletService.AddBalance(ctx, 1, "20", "seed", "初始余额"); err != nil {
+		t.Fatalf("初始化余额失败: %v", err)
+	}
+	assertWallet := func(balance, frozen string) {
+		t.Helper()
+		wallet, err := walletRepo.GetByUserID(ctx, 1)
+		if err != nil {
+			t.Fatalf("获取钱包失败: %v", err)
+		}
+		if normalizeAmount(wallet.Balance) != balance || normalizeAmount(wallet.FrozenBalance) != frozen {
+			t.Fatalf("钱包 = %s/%s, 期望 %s/%s", wallet.Balance, wallet.FrozenBalance, balance, frozen)
+		}
+	}
+
+	if _, err := withdrawalService.CreateWithdrawal(ctx, 1, "0.105", address); !errors.Is(err, ErrInvalidWithdrawalAmount) {
+		t.Errorf("三位小数返回 %v, 期望 ErrInvalidWithdrawalAmount", err)
+	}
+
+	// 0.1 + 0.2 正好等于每日限额 0.3，不应因浮点误差被拒绝
+	for _, amount := range []string{"0.1", "0.2"} {
+		if _, err := withdrawalService.CreateWithdrawal(ctx, 1, amount, address); err != nil {
+			t.Fatalf("提现 %s 失败: %v", amount, err)
+		}
+	}
+	assertWallet("19.70000000", "0.30000000")
+	if _, err := withdrawalService.CreateWithdrawal(ctx, 1, "0.1", address); !errors.Is(err, ErrWithdrawalDailyLimitExceeded) {
+		t.Errorf("超出每日限额返回 %v, 期望 ErrWithdrawalDailyLimitExceeded", err)
+	}
+
+	// 冻结失败时申请一起回滚
+	cfg.DailyLimit = 100
+	if _, err := withdrawalService.CreateWithdrawal(ctx, 1, "25", address); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("余额不足返回 %v, 期望 ErrInsufficientBalance", err)
+	}
+	if total, err := withdrawalRepo.CountByUserID(ctx, 1); err != nil || total != 2 {
+		t.Errorf("提现申请 = %d (%v), 期望 2", total, err)
+	}
+	assertWallet("19.70000000", "0.30000000")
+}
@@ -31,6 +31,20 @@ type Database struct {
 	rechargeOrderRepo repository.RechargeOrderRepository
 	walletHistoryRepo repository.WalletHistoryRepository
 	esimCardRepo      repository.EsimCardRepository
+	ledgerRepo        repository.LedgerRepository
+	withdrawalRepo    repository.WithdrawalRepository
+	couponRepo        repository.CouponRepository
+	assetRepo         repository.AssetRepository
+	transactionRepo   repository.TransactionRepository
+	depositCursorRepo repository.DepositCursorRepository
+	depositAddrRepo   repository.DepositAddressRepository
+	orphanDepositRepo repository.OrphanDepositRepository
+	gatewayPayRepo    repository.GatewayPaymentRepository
+	orderEventRepo    repository.OrderEventRepository
+	orderOutboxRepo   repository.OrderOutboxRepository
+	orderSyncErrRepo  repository.OrderSyncErrorRepository
+	webhookNonceRepo  repository.ProviderWebhookNonceRepository
+	userEventRepo     repository.UserEventRepository
 }
 
 // NewDatabase 创建数据库管理器
@@ -102,6 +116,20 @@ func NewDatabase(cfg *config.DatabaseConfig) (*Database, error) {
 	database.rechargeOrderRepo = repository.NewRechargeOrderRepository(db)
 	database.walletHistoryRepo = repository.NewWalletHistoryRepository(db)
 	database.esimCardRepo = repository.NewEsimCardRepository(db)
+	database.ledgerRepo = repository.NewLedgerRepository(db)
+	database.withdrawalRepo = repository.NewWithdrawalRepository(db)
+	database.couponRepo = repository.NewCouponRepository(db)
+	database.assetRepo = repository.NewAssetRepository(db)
+	database.transactionRepo = repository.NewTransactionRepository(db)
+	database.depositCursorRepo = repository.NewDepositCursorRepository(db)
+	database.depositAddrRepo = repository.NewDepositAddressRepository(db)
+	database.orphanDepositRepo = repository.NewOrphanDepositRepository(db)
+	database.gatewayPayRepo = repository.NewGatewayPaymentRepository(db)
+	database.orderEventRepo = repository.NewOrderEventRepository(db)
+	database.orderOutboxRepo = repository.NewOrderOutboxRepository(db)
+	database.orderSyncErrRepo = repository.NewOrderSyncErrorRepository(db)
+	database.webhookNonceRepo = repository.NewProviderWebhookNonceRepository(db)
+	database.userEventRepo = repository.NewUserEventRepository(db)
 
 	return database, nil
 }
@@ -113,16 +141,46 @@ func (d *Database) GetDB() *gorm.DB {
 
 // AutoMigrate 自动迁移数据库表结构
 func (d *Database) AutoMigrate() error {
-	return d.db.AutoMigrate(
+	if err := dropLegacyWalletIndex(d.db); err != nil {
+		return err
+	}
+
+	err := d.db.AutoMigrate(
 		&models.User{},
 		&models.UserSession{},
 		&models.Product{},
 		&models.ProductDetail{},
 		&models.Wallet{},
 		&models.Order{},
+		&models.OrderEvent{},
+		&models.OrderOutboxTask{},
+		&models.OrderSyncError{},
+		&models.ProviderWebhookNonce{},
+		&models.UserEventRecord{},
 		&models.RechargeOrder{},
 		&models.WalletHistory{},
+		&models.LedgerAccount{},
+		&models.LedgerEntry{},
+		&models.LedgerLine{},
+		&models.WalletOperation{},
+		&models.WithdrawalRequest{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.Asset{},
+		&models.Transaction{},
+		&models.DepositCursor{},
+		&models.DepositAddress{},
+		&models.OrphanDeposit{},
+		&models.GatewayPayment{},
 	)
+	if err != nil {
+		return err
+	}
+	if err := backfillRechargeCreditedAmount(d.db); err != nil {
+		return err
+	}
+
+	return SeedAssets(d.db)
 }
 
 // Close 关闭数据库连接
@@ -184,6 +242,76 @@ func (d *Database) GetEsimCardRepository() repository.EsimCardRepository {
 	return d.esimCardRepo
 }
 
+// GetLedgerRepository 获取复式记账仓库
+func (d *Database) GetLedgerRepository() repository.LedgerRepository {
+	return d.ledgerRepo
+}
+
+// GetWithdrawalRepository 获取提现申请仓库
+func (d *Database) GetWithdrawalRepository() repository.WithdrawalRepository {
+	return d.withdrawalRepo
+}
+
+// GetCouponRepository 获取优惠券仓库
+func (d *Database) GetCouponRepository() repository.CouponRepository {
+	return d.couponRepo
+}
+
+// GetAssetRepository 获取资产登记仓库
+func (d *Database) GetAssetRepository() repository.AssetRepository {
+	return d.assetRepo
+}
+
+// GetTransactionRepository 获取区块链交易仓库
+func (d *Database) GetTransactionRepository() repository.TransactionRepository {
+	return d.transactionRepo
+}
+
+// GetDepositCursorRepository 获取充值扫描游标仓库
+func (d *Database) GetDepositCursorRepository() repository.DepositCursorRepository {
+	return d.depositCursorRepo
+}
+
+// GetDepositAddressRepository 获取用户充值地址仓库
+func (d *Database) GetDepositAddressRepository() repository.DepositAddressRepository {
+	return d.depositAddrRepo
+}
+
+// GetOrphanDepositRepository 获取孤儿充值仓库
+func (d *Database) GetOrphanDepositRepository() repository.OrphanDepositRepository {
+	return d.orphanDepositRepo
+}
+
+// GetGatewayPaymentRepository 获取渠道支付仓库
+func (d *Database) GetGatewayPaymentRepository() repository.GatewayPaymentRepository {
+	return d.gatewayPayRepo
+}
+
+// GetOrderEventRepository 获取订单事件仓库
+func (d *Database) GetOrderEventRepository() repository.OrderEventRepository {
+	return d.orderEventRepo
+}
+
+// GetOrderOutboxRepository 获取订单发件箱仓库
+func (d *Database) GetOrderOutboxRepository() repository.OrderOutboxRepository {
+	return d.orderOutboxRepo
+}
+
+// GetOrderSyncErrorRepository 获取订单同步失败记录仓库
+func (d *Database) GetOrderSyncErrorRepository() repository.OrderSyncErrorRepository {
+	return d.orderSyncErrRepo
+}
+
+// GetProviderWebhookNonceRepository 获取第三方 Webhook nonce 仓库
+func (d *Database) GetProviderWebhookNonceRepository() repository.ProviderWebhookNonceRepository {
+	return d.webhookNonceRepo
+}
+
+// GetUserEventRepository 获取用户实时事件仓库
+func (d *Database) GetUserEventRepository() repository.UserEventRepository {
+	return d.userEventRepo
+}
+
 // Transaction 执行数据库事务
 func (d *Database) Transaction(ctx context.Context, fn func(*gorm.DB) error) error {
 	return d.db.WithContext(ctx).Transaction(fn)
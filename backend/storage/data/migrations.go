@@ -10,6 +10,10 @@ import (
 
 // AutoMigrate 自动迁移数据库表结构
 func AutoMigrate(db *gorm.DB) error {
+	if err := dropLegacyWalletIndex(db); err != nil {
+		return err
+	}
+
 	// 迁移所有模型
 	err := db.AutoMigrate(
 		&models.User{},
@@ -18,16 +22,72 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.UserSession{},
 		&models.Wallet{},
 		&models.Order{},
+		&models.OrderEvent{},
+		&models.OrderOutboxTask{},
+		&models.OrderSyncError{},
+		&models.ProviderWebhookNonce{},
+		&models.UserEventRecord{},
 		// &models.OrderDetail{},
 		&models.RechargeOrder{},
 		&models.WalletHistory{},
 		&models.EsimCard{}, // eSIM 卡模型
+		&models.LedgerAccount{},
+		&models.LedgerEntry{},
+		&models.LedgerLine{},
+		&models.WalletOperation{},
+		&models.WithdrawalRequest{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.Asset{},
+		&models.Transaction{},
+		&models.DepositCursor{},
+		&models.DepositAddress{},
+		&models.OrphanDeposit{},
+		&models.GatewayPayment{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	if err := backfillRechargeCreditedAmount(db); err != nil {
+		return err
+	}
+
+	return SeedAssets(db)
+}
 
+// dropLegacyWalletIndex 删除旧版钱包表 user_id 上的唯一索引
+// 钱包改为按 (用户, 资产) 唯一后，旧索引会阻止同一用户创建其他资产的钱包
+func dropLegacyWalletIndex(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Wallet{}) || !migrator.HasIndex(&models.Wallet{}, "idx_wallets_user_id") {
+		return nil
+	}
+	if err := migrator.DropIndex(&models.Wallet{}, "idx_wallets_user_id"); err != nil {
+		return fmt.Errorf("failed to drop legacy wallet index: %w", err)
+	}
+	return nil
+}
+
+// backfillRechargeCreditedAmount 为新增入账金额字段前已入账的充值订单补齐入账金额
+// 旧版本确认到账时把入账金额写回了 amount，这些订单的 amount 即入账金额
+func backfillRechargeCreditedAmount(db *gorm.DB) error {
+	err := db.Model(&models.RechargeOrder{}).
+		Where("credited_amount IS NULL AND status IN ?", []models.RechargeStatus{models.RechargeStatusConfirmed, models.RechargeStatusReversed}).
+		Update("credited_amount", gorm.Expr("amount")).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill recharge credited amount: %w", err)
+	}
+	return nil
+}
+
+// SeedAssets 写入内置资产，已存在的资产保持不变（汇率和状态以数据库为准）
+func SeedAssets(db *gorm.DB) error {
+	for _, asset := range models.DefaultAssets() {
+		if err := db.Where("code = ?", asset.Code).FirstOrCreate(asset).Error; err != nil {
+			return fmt.Errorf("failed to seed asset %s: %w", asset.Code, err)
+		}
+	}
 	return nil
 }
 
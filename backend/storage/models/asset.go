@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PricingCurrency 计价币种：产品价格、钱包余额和账本均以美元计价
+const PricingCurrency = "USD"
+
+// 链标识
+const (
+	ChainTron     = "tron"     // TRON
+	ChainBSC      = "bsc"      // BNB Smart Chain
+	ChainEthereum = "ethereum" // Ethereum
+)
+
+// 内置资产代码
+const (
+	AssetUSDTTRC20 = "USDT-TRC20" // TRON 链上的 USDT
+	AssetTRX       = "TRX"        // TRON 原生币
+	AssetUSDTBEP20 = "USDT-BEP20" // BSC 链上的 USDT
+)
+
+// AssetStatus 资产状态
+type AssetStatus string
+
+const (
+	AssetStatusActive   AssetStatus = "active"   // 可用于充值
+	AssetStatusInactive AssetStatus = "inactive" // 已停用
+)
+
+// Asset 资产登记表：可充值的币种及其所在链、合约和精度
+type Asset struct {
+	ID              uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code            string      `gorm:"uniqueIndex;size:20;not null" json:"code"`       // 资产代码（如 USDT-TRC20）
+	Symbol          string      `gorm:"size:20;not null" json:"symbol"`                 // 币种符号（如 USDT）
+	Chain           string      `gorm:"size:20;not null;index" json:"chain"`            // 所在链
+	ContractAddress string      `gorm:"size:100" json:"contract_address"`               // 代币合约地址（原生币为空）
+	Decimals        int         `gorm:"not null" json:"decimals"`                       // 链上精度
+	UsdRate         string      `gorm:"type:decimal(20,8);default:0" json:"usd_rate"`   // 1 单位资产折合的计价币种金额（0 表示未设置汇率）
+	Status          AssetStatus `gorm:"size:20;default:'active';index" json:"status"`   // 状态
+	RateUpdatedAt   *time.Time  `gorm:"type:datetime" json:"rate_updated_at,omitempty"` // 汇率更新时间
+	CreatedAt       time.Time   `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Asset) TableName() string {
+	return "assets"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (a *Asset) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	a.Code = NormalizeAssetCode(a.Code)
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (a *Asset) BeforeUpdate(tx *gorm.DB) error {
+	a.UpdatedAt = time.Now()
+	return nil
+}
+
+// IsNative 是否为链的原生币（没有合约地址）
+func (a *Asset) IsNative() bool {
+	return a.ContractAddress == ""
+}
+
+// IsActive 是否可用于充值
+func (a *Asset) IsActive() bool {
+	return a.Status == AssetStatusActive
+}
+
+// NormalizeAssetCode 规范化资产代码：去除空白并转为大写
+func NormalizeAssetCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// DefaultAssets 内置资产
+// USDT 按 1:1 折算；TRX 汇率需由管理员设置后才能用于充值
+func DefaultAssets() []*Asset {
+	return []*Asset{
+		{
+			Code:            AssetUSDTTRC20,
+			Symbol:          "USDT",
+			Chain:           ChainTron,
+			ContractAddress: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+			Decimals:        6,
+			UsdRate:         "1",
+			Status:          AssetStatusActive,
+		},
+		{
+			Code:     AssetTRX,
+			Symbol:   "TRX",
+			Chain:    ChainTron,
+			Decimals: 6,
+			UsdRate:  "0",
+			Status:   AssetStatusActive,
+		},
+		{
+			Code:            AssetUSDTBEP20,
+			Symbol:          "USDT",
+			Chain:           ChainBSC,
+			ContractAddress: "0x55d398326f99059fF775485246999027B3197955",
+			Decimals:        18,
+			UsdRate:         "1",
+			Status:          AssetStatusActive,
+		},
+	}
+}
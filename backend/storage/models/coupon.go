@@ -0,0 +1,147 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CouponDiscountType 优惠券折扣类型
+type CouponDiscountType string
+
+const (
+	CouponDiscountPercentage CouponDiscountType = "percentage" // 按比例折扣，DiscountValue 为百分比（如 15 表示减 15%）
+	CouponDiscountFixed      CouponDiscountType = "fixed"      // 固定金额立减，DiscountValue 为 USDT 金额
+)
+
+// CouponStatus 优惠券状态
+type CouponStatus string
+
+const (
+	CouponStatusActive   CouponStatus = "active"   // 可用
+	CouponStatusInactive CouponStatus = "inactive" // 已停用
+)
+
+// CouponRedemptionStatus 优惠券核销状态
+type CouponRedemptionStatus string
+
+const (
+	CouponRedemptionApplied  CouponRedemptionStatus = "applied"  // 已使用（占用使用次数）
+	CouponRedemptionReleased CouponRedemptionStatus = "released" // 已释放（订单失败，使用次数已退回）
+)
+
+// Coupon 优惠券 / 优惠码
+type Coupon struct {
+	ID            uint               `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code          string             `gorm:"uniqueIndex;size:32;not null" json:"code"`          // 优惠码（大写存储，匹配时不区分大小写）
+	Name          string             `gorm:"size:100" json:"name"`                              // 名称
+	DiscountType  CouponDiscountType `gorm:"size:20;not null" json:"discount_type"`             // 折扣类型
+	DiscountValue string             `gorm:"type:decimal(10,2);not null" json:"discount_value"` // 折扣值
+	MaxDiscount   string             `gorm:"type:decimal(10,2);default:0" json:"max_discount"`  // 最高优惠金额（仅按比例折扣，0 表示不限）
+	MinSpend      string             `gorm:"type:decimal(10,2);default:0" json:"min_spend"`     // 最低消费金额（0 表示不限）
+	ProductTypes  string             `gorm:"size:100" json:"product_types"`                     // 适用产品类型，逗号分隔（local,regional,global），为空表示不限
+	Countries     string             `gorm:"type:text" json:"countries"`                        // 适用国家代码，逗号分隔，为空表示不限
+	UsageLimit    int                `gorm:"default:0" json:"usage_limit"`                      // 总使用次数上限（0 表示不限）
+	PerUserLimit  int                `gorm:"default:0" json:"per_user_limit"`                   // 每个用户使用次数上限（0 表示不限）
+	UsedCount     int                `gorm:"default:0" json:"used_count"`                       // 已使用次数
+	StartsAt      *time.Time         `gorm:"type:datetime" json:"starts_at,omitempty"`          // 生效时间（为空表示立即生效）
+	ExpiresAt     *time.Time         `gorm:"type:datetime" json:"expires_at,omitempty"`         // 过期时间（为空表示永不过期）
+	Status        CouponStatus       `gorm:"size:20;default:'active';index" json:"status"`      // 状态
+	CreatedAt     time.Time          `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt     time.Time          `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Coupon) TableName() string {
+	return "coupons"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (c *Coupon) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.Code = NormalizeCouponCode(c.Code)
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (c *Coupon) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+// IsActive 检查优惠券在指定时间是否处于有效期内且未停用
+func (c *Coupon) IsActive(now time.Time) bool {
+	if c.Status != CouponStatusActive {
+		return false
+	}
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return false
+	}
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// ProductTypeList 适用产品类型列表，为空表示不限
+func (c *Coupon) ProductTypeList() []string {
+	return splitCouponList(c.ProductTypes, strings.ToLower)
+}
+
+// CountryList 适用国家代码列表，为空表示不限
+func (c *Coupon) CountryList() []string {
+	return splitCouponList(c.Countries, strings.ToUpper)
+}
+
+// CouponRedemption 优惠券核销记录，每个订单最多一条
+type CouponRedemption struct {
+	ID             uint                   `gorm:"primaryKey;autoIncrement" json:"id"`
+	CouponID       uint                   `gorm:"index:idx_coupon_redemption_user;not null" json:"coupon_id"`
+	Code           string                 `gorm:"size:32;not null" json:"code"`
+	UserID         int64                  `gorm:"index:idx_coupon_redemption_user;not null" json:"user_id"`
+	OrderID        uint                   `gorm:"index;not null" json:"order_id"`
+	OrderNo        string                 `gorm:"uniqueIndex;size:32;not null" json:"order_no"`
+	DiscountAmount string                 `gorm:"type:decimal(10,2);not null" json:"discount_amount"`
+	Status         CouponRedemptionStatus `gorm:"size:20;default:'applied';index" json:"status"`
+	ReleasedAt     *time.Time             `gorm:"type:datetime" json:"released_at,omitempty"`
+	CreatedAt      time.Time              `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt      time.Time              `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CouponRedemption) TableName() string {
+	return "coupon_redemptions"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (r *CouponRedemption) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (r *CouponRedemption) BeforeUpdate(tx *gorm.DB) error {
+	r.UpdatedAt = time.Now()
+	return nil
+}
+
+// NormalizeCouponCode 规范化优惠码：去除空白并转为大写
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// splitCouponList 拆分逗号分隔的限制列表
+func splitCouponList(value string, normalize func(string) string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, normalize(item))
+		}
+	}
+	return items
+}
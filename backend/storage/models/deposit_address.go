@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DepositAddress 用户专属充值地址：由扩展公钥按 m/44'/195'/0'/0/index 派生，index 取记录 ID
+type DepositAddress struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64     `gorm:"uniqueIndex:idx_deposit_address_user;not null" json:"user_id"`       // 用户 Telegram ID
+	Chain     string    `gorm:"uniqueIndex:idx_deposit_address_user;size:20;not null" json:"chain"` // 所在链
+	Address   string    `gorm:"size:100;index" json:"address"`                                      // 派生的收款地址
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DepositAddress) TableName() string {
+	return "deposit_addresses"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (d *DepositAddress) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (d *DepositAddress) BeforeUpdate(tx *gorm.DB) error {
+	d.UpdatedAt = time.Now()
+	return nil
+}
+
+// DerivationIndex 派生索引（m/44'/195'/0'/0/index）
+func (d *DepositAddress) DerivationIndex() uint32 {
+	return uint32(d.ID)
+}
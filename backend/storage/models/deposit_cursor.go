@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DepositCursor 充值扫描游标：记录收款地址上每种资产已扫描到的位置，重启后从该位置继续扫描
+type DepositCursor struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Chain         string    `gorm:"uniqueIndex:idx_deposit_cursor;size:20;not null" json:"chain"`    // 所在链
+	Address       string    `gorm:"uniqueIndex:idx_deposit_cursor;size:100;not null" json:"address"` // 收款地址
+	Asset         string    `gorm:"uniqueIndex:idx_deposit_cursor;size:20;not null" json:"asset"`    // 资产代码
+	LastBlock     int64     `gorm:"default:0" json:"last_block"`                                     // 已扫描到的区块高度（EVM）
+	LastTimestamp int64     `gorm:"default:0" json:"last_timestamp"`                                 // 已扫描到的区块时间，毫秒（TRON）
+	Fingerprint   string    `gorm:"size:255" json:"fingerprint"`                                     // 未翻完时的翻页标记（TRON）
+	CreatedAt     time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DepositCursor) TableName() string {
+	return "deposit_cursors"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (c *DepositCursor) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (c *DepositCursor) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
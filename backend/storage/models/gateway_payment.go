@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 支付渠道
+const (
+	PaymentGatewayTelegramStars = "telegram_stars" // Telegram Stars（币种 XTR）
+)
+
+// CurrencyXTR Telegram Stars 的币种代码
+const CurrencyXTR = "XTR"
+
+// GatewayPaymentStatus 渠道支付状态
+type GatewayPaymentStatus string
+
+const (
+	GatewayPaymentStatusPending  GatewayPaymentStatus = "pending"  // 已创建发票，待支付
+	GatewayPaymentStatusPaid     GatewayPaymentStatus = "paid"     // 已支付并入账
+	GatewayPaymentStatusRefunded GatewayPaymentStatus = "refunded" // 已退款并扣回入账金额
+)
+
+// GatewayPayment 通过支付渠道（非链上转账）的充值
+// 创建发票时写入待支付记录，PaymentNo 作为发票载荷；支付成功后记录渠道支付ID并入账。
+// ChargeID 未支付时为 NULL，唯一索引保证同一笔渠道支付只入账一次
+type GatewayPayment struct {
+	ID          uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
+	PaymentNo   string               `gorm:"uniqueIndex;size:32;not null" json:"payment_no"`  // 支付单号（发票载荷）
+	Gateway     string               `gorm:"size:30;not null;index" json:"gateway"`           // 支付渠道
+	UserID      int64                `gorm:"index;not null" json:"user_id"`                   // 用户 Telegram ID
+	Currency    string               `gorm:"size:10;not null" json:"currency"`                // 渠道币种，如 XTR
+	TotalAmount int64                `gorm:"not null" json:"total_amount"`                    // 渠道币种的最小单位数量（Stars 数量）
+	Amount      string               `gorm:"type:decimal(20,8);not null" json:"amount"`       // 到账金额（计价币种）
+	Rate        string               `gorm:"type:decimal(20,8);not null" json:"rate"`         // 1 单位渠道币种折合的计价币种金额
+	Status      GatewayPaymentStatus `gorm:"size:20;default:'pending';index" json:"status"`   // 支付状态
+	ChargeID    *string              `gorm:"uniqueIndex;size:128" json:"charge_id,omitempty"` // 渠道支付ID（Stars 为 telegram_payment_charge_id）
+	Operator    string               `gorm:"size:100" json:"operator,omitempty"`              // 退款操作人
+	Remark      string               `gorm:"type:text" json:"remark,omitempty"`               // 备注（退款原因等）
+	DuplicateOf string               `gorm:"size:32;index" json:"duplicate_of,omitempty"`     // 重复支付的原支付单号，非空时需人工核查是否退款
+	ExpiresAt   time.Time            `gorm:"index" json:"expires_at"`                         // 发票过期时间，过期后拒绝支付
+	PaidAt      *time.Time           `json:"paid_at,omitempty"`                               // 支付时间
+	RefundedAt  *time.Time           `json:"refunded_at,omitempty"`                           // 退款时间
+	CreatedAt   time.Time            `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt   time.Time            `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (GatewayPayment) TableName() string {
+	return "gateway_payments"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (p *GatewayPayment) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	if p.PaymentNo == "" {
+		p.PaymentNo = generateGatewayPaymentNo()
+	}
+	if p.Status == "" {
+		p.Status = GatewayPaymentStatusPending
+	}
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (p *GatewayPayment) BeforeUpdate(tx *gorm.DB) error {
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// IsExpired 发票是否已过期
+func (p *GatewayPayment) IsExpired() bool {
+	return !p.ExpiresAt.IsZero() && time.Now().After(p.ExpiresAt)
+}
+
+// generateGatewayPaymentNo 生成支付单号
+// 格式: PAY + 时间戳（纳秒）
+func generateGatewayPaymentNo() string {
+	return fmt.Sprintf("PAY%d", time.Now().UnixNano())
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrLedgerImmutable 账本分录不可修改
+var ErrLedgerImmutable = errors.New("ledger entries are immutable")
+
+// LedgerAccountType 账本科目类型
+type LedgerAccountType string
+
+const (
+	LedgerAccountUserAvailable    LedgerAccountType = "user_available"    // 用户可用余额（负债，贷方余额）
+	LedgerAccountUserFrozen       LedgerAccountType = "user_frozen"       // 用户冻结余额（负债，贷方余额）
+	LedgerAccountPlatformRevenue  LedgerAccountType = "platform_revenue"  // 平台收入（贷方余额）
+	LedgerAccountDepositClearing  LedgerAccountType = "deposit_clearing"  // 充值清算（资产，借方余额）
+	LedgerAccountTransferClearing LedgerAccountType = "transfer_clearing" // 用户间转账过渡科目（每笔转账转出转入后归零）
+	LedgerAccountMarketingExpense LedgerAccountType = "marketing_expense" // 营销费用（邀请奖励等平台补贴，借方余额）
+)
+
+// IsUserAccount 是否为用户维度的科目
+func (t LedgerAccountType) IsUserAccount() bool {
+	return t == LedgerAccountUserAvailable || t == LedgerAccountUserFrozen
+}
+
+// NormalSide 科目的正常余额方向
+func (t LedgerAccountType) NormalSide() LedgerSide {
+	if t == LedgerAccountDepositClearing || t == LedgerAccountMarketingExpense {
+		return LedgerSideDebit
+	}
+	return LedgerSideCredit
+}
+
+// LedgerSide 借贷方向
+type LedgerSide string
+
+const (
+	LedgerSideDebit  LedgerSide = "debit"  // 借
+	LedgerSideCredit LedgerSide = "credit" // 贷
+)
+
+// LedgerEntryType 分录业务类型
+type LedgerEntryType string
+
+const (
+	LedgerEntryTypeRecharge       LedgerEntryType = "recharge"        // 充值入账
+	LedgerEntryTypeFreeze         LedgerEntryType = "freeze"          // 冻结
+	LedgerEntryTypeUnfreeze       LedgerEntryType = "unfreeze"        // 解冻退还
+	LedgerEntryTypePayment        LedgerEntryType = "payment"         // 支付（平台确认收入）
+	LedgerEntryTypeOpeningBalance LedgerEntryType = "opening_balance" // 期初余额（迁移历史钱包）
+	LedgerEntryTypeAdjustment     LedgerEntryType = "adjustment"      // 人工调整
+	LedgerEntryTypeTransferOut    LedgerEntryType = "transfer_out"    // 用户间转账转出
+	LedgerEntryTypeTransferIn     LedgerEntryType = "transfer_in"     // 用户间转账转入
+	LedgerEntryTypeReferral       LedgerEntryType = "referral"        // 邀请奖励
+	LedgerEntryTypeRechargeRevert LedgerEntryType = "recharge_revert" // 充值冲回（入账后链上交易失败或被回滚）
+)
+
+// LedgerAccount 账本科目
+// 用户科目 UserID 为用户 Telegram ID，平台科目 UserID 为 0
+type LedgerAccount struct {
+	ID          uint              `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int64             `gorm:"uniqueIndex:idx_ledger_account_owner;not null;default:0" json:"user_id"`
+	AccountType LedgerAccountType `gorm:"uniqueIndex:idx_ledger_account_owner;size:30;not null" json:"account_type"`
+	Balance     string            `gorm:"type:decimal(20,8);default:'0'" json:"balance"` // 按正常余额方向计算的余额（由分录累计）
+	Version     int64             `gorm:"not null;default:0" json:"version"`             // 乐观锁版本号
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (a *LedgerAccount) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (a *LedgerAccount) BeforeUpdate(tx *gorm.DB) error {
+	a.UpdatedAt = time.Now()
+	return nil
+}
+
+// LedgerEntry 记账分录（不可修改，借贷必须相等）
+type LedgerEntry struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int64           `gorm:"index;not null" json:"user_id"`
+	EntryType   LedgerEntryType `gorm:"size:30;not null;index" json:"entry_type"`
+	RelatedID   string          `gorm:"size:100;index" json:"related_id"`
+	Description string          `gorm:"size:500" json:"description"`
+	Lines       []LedgerLine    `gorm:"foreignKey:EntryID" json:"lines,omitempty"`
+	CreatedAt   time.Time       `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (e *LedgerEntry) BeforeCreate(tx *gorm.DB) error {
+	e.CreatedAt = time.Now()
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：分录不可修改
+func (e *LedgerEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+// BeforeDelete GORM 钩子：分录不可删除
+func (e *LedgerEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+// LedgerLine 分录明细行
+type LedgerLine struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	EntryID   uint       `gorm:"index;not null" json:"entry_id"`
+	AccountID uint       `gorm:"index;not null" json:"account_id"`
+	Side      LedgerSide `gorm:"size:10;not null" json:"side"`
+	Amount    string     `gorm:"type:decimal(20,8);not null" json:"amount"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (LedgerLine) TableName() string {
+	return "ledger_lines"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (l *LedgerLine) BeforeCreate(tx *gorm.DB) error {
+	l.CreatedAt = time.Now()
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：明细不可修改
+func (l *LedgerLine) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+// BeforeDelete GORM 钩子：明细不可删除
+func (l *LedgerLine) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
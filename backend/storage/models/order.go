@@ -20,6 +20,43 @@ const (
 	OrderStatusFailed     OrderStatus = "failed"     // 失败（冻结金额已退还）
 )
 
+// orderTransitions 订单状态机：当前状态 -> 允许流转到的状态
+// 空状态表示新建订单；未列出的状态（已取消、已退款、失败）为终态
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	"":                    {OrderStatusPending, OrderStatusProcessing},
+	OrderStatusPending:    {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:       {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusProcessing: {OrderStatusCompleted, OrderStatusFailed},
+	OrderStatusCompleted:  {OrderStatusRefunded},
+}
+
+// CanTransitionTo 是否允许从当前状态流转到目标状态
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal 是否为终态
+func (s OrderStatus) IsTerminal() bool {
+	return s != "" && len(orderTransitions[s]) == 0
+}
+
+// OrderTransitionError 非法的订单状态流转
+type OrderTransitionError struct {
+	OrderNo string
+	From    OrderStatus
+	To      OrderStatus
+}
+
+// Error 实现 error 接口
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("订单 %s 不允许从 %q 流转到 %q", e.OrderNo, e.From, e.To)
+}
+
 // Order 订单模型
 type Order struct {
 	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -44,6 +81,12 @@ type Order struct {
 	SyncAttempts    int        `gorm:"default:0" json:"sync_attempts"`          // 同步尝试次数
 	LastSyncAt      *time.Time `gorm:"index;type:datetime" json:"last_sync_at"` // 最后同步时间
 	NextSyncAt      *time.Time `gorm:"index;type:datetime" json:"next_sync_at"` // 下次同步时间
+	ClaimedBy       string     `gorm:"size:100" json:"-"`                       // 正在同步该订单的实例
+	ClaimedUntil    *time.Time `gorm:"index;type:datetime" json:"-"`            // 同步租约到期时间，到期后其他实例可重新领取
+
+	// 优惠券相关字段（Amount 为优惠后的实付金额）
+	CouponCode     string `gorm:"size:32" json:"coupon_code,omitempty"`                // 使用的优惠码
+	DiscountAmount string `gorm:"type:decimal(10,2);default:0" json:"discount_amount"` // 优惠金额
 }
 
 // TableName 指定表名
@@ -81,6 +124,14 @@ func (o *Order) IsCompleted() bool {
 	return o.Status == OrderStatusCompleted
 }
 
+// CheckTransition 校验订单能否流转到目标状态，不允许时返回 *OrderTransitionError
+func (o *Order) CheckTransition(to OrderStatus) error {
+	if !o.Status.CanTransitionTo(to) {
+		return &OrderTransitionError{OrderNo: o.OrderNo, From: o.Status, To: to}
+	}
+	return nil
+}
+
 // IsCancelled 检查订单是否已取消
 func (o *Order) IsCancelled() bool {
 	return o.Status == OrderStatusCancelled
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderEventActor 订单状态变更的发起方
+type OrderEventActor string
+
+const (
+	OrderActorSystem  OrderEventActor = "system"  // 系统（下单失败回滚等内部流程）
+	OrderActorSync    OrderEventActor = "sync"    // 第三方订单同步
+	OrderActorWebhook OrderEventActor = "webhook" // 第三方 Webhook 推送
+	OrderActorAdmin   OrderEventActor = "admin"   // 管理员
+	OrderActorUser    OrderEventActor = "user"    // 用户
+)
+
+// OrderEvent 订单状态变更记录，每次状态流转写入一条，只追加不修改
+type OrderEvent struct {
+	ID         uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID    uint            `gorm:"index;not null" json:"order_id"`    // 订单ID
+	OrderNo    string          `gorm:"size:32;index" json:"order_no"`     // 订单号（冗余）
+	FromStatus OrderStatus     `gorm:"size:20" json:"from_status"`        // 变更前状态，新建订单为空
+	ToStatus   OrderStatus     `gorm:"size:20;not null" json:"to_status"` // 变更后状态
+	Actor      OrderEventActor `gorm:"size:20;not null" json:"actor"`     // 发起方
+	Operator   string          `gorm:"size:100" json:"operator"`          // 操作人（管理员用户名、用户ID等）
+	Reason     string          `gorm:"type:text" json:"reason"`           // 变更原因
+	Payload    string          `gorm:"type:text" json:"payload"`          // 第三方返回的原始数据（JSON）
+	CreatedAt  time.Time       `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (OrderEvent) TableName() string {
+	return "order_events"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (e *OrderEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 订单发件箱任务类型
+const (
+	OutboxTaskCreateProviderOrder = "create_provider_order" // 调用第三方接口创建 eSIM 订单
+)
+
+// 订单发件箱任务状态
+const (
+	OutboxStatusPending      = "pending"       // 等待执行（含失败后等待重试）
+	OutboxStatusRunning      = "running"       // 已被后台任务领取，租约过期后可被重新领取
+	OutboxStatusDone         = "done"          // 执行成功
+	OutboxStatusCompensated  = "compensated"   // 重试耗尽，订单已标记失败并退款
+	OutboxStatusManualReview = "manual_review" // 重试耗尽但无法确认第三方是否已下单，等待人工核查
+)
+
+// OrderOutboxTask 订单事务性发件箱任务
+// 与订单、冻结资金在同一事务内写入，由后台任务执行外部调用，保证进程崩溃后既不会遗漏也不会重复下单
+type OrderOutboxTask struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID     uint       `gorm:"index;not null" json:"order_id"`                                          // 订单ID
+	TaskType    string     `gorm:"size:50;not null;uniqueIndex:idx_order_outbox_type_ref" json:"task_type"` // 任务类型
+	Reference   string     `gorm:"size:64;not null;uniqueIndex:idx_order_outbox_type_ref" json:"reference"` // 幂等引用，调用外部接口时携带
+	Payload     string     `gorm:"type:text" json:"payload"`                                                // 任务参数（JSON）
+	Status      string     `gorm:"size:20;default:'pending';index" json:"status"`                           // 任务状态
+	Attempts    int        `gorm:"default:0" json:"attempts"`                                               // 已执行次数
+	NextRunAt   time.Time  `gorm:"type:datetime;index" json:"next_run_at"`                                  // 下次执行时间
+	LockedBy    string     `gorm:"size:100" json:"locked_by,omitempty"`                                     // 领取任务的实例
+	LockedUntil *time.Time `gorm:"type:datetime;index" json:"locked_until,omitempty"`                       // 租约到期时间
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`                                   // 最近一次失败原因
+	Uncertain   bool       `gorm:"default:false" json:"uncertain"`                                          // 存在结果未知的调用（超时、连接错误或执行中崩溃），不能确认第三方未下单
+	Result      string     `gorm:"type:text" json:"result,omitempty"`                                       // 执行结果（JSON）
+	CompletedAt *time.Time `gorm:"type:datetime" json:"completed_at,omitempty"`                             // 完成或补偿时间
+	CreatedAt   time.Time  `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (OrderOutboxTask) TableName() string {
+	return "order_outbox_tasks"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (t *OrderOutboxTask) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	if t.Status == "" {
+		t.Status = OutboxStatusPending
+	}
+	if t.NextRunAt.IsZero() {
+		t.NextRunAt = now
+	}
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (t *OrderOutboxTask) BeforeUpdate(tx *gorm.DB) error {
+	t.UpdatedAt = time.Now()
+	return nil
+}
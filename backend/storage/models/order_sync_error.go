@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderSyncError 订单同步失败记录，每次同步失败写入一条，用于排查第三方订单长时间未完成的原因
+type OrderSyncError struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID   uint      `gorm:"index;not null" json:"order_id"` // 订单ID
+	Attempt   int       `gorm:"not null" json:"attempt"`        // 第几次同步
+	Message   string    `gorm:"type:text" json:"message"`       // 失败原因
+	CreatedAt time.Time `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (OrderSyncError) TableName() string {
+	return "order_sync_errors"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (e *OrderSyncError) BeforeCreate(tx *gorm.DB) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return nil
+}
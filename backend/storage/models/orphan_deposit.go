@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 孤儿充值原因
+const (
+	OrphanReasonUnmatched = "unmatched" // 没有可匹配的充值订单
+	OrphanReasonUnderpaid = "underpaid" // 少付且少付策略为暂不入账
+)
+
+// 孤儿充值状态
+const (
+	OrphanStatusPending  = "pending"  // 待管理员处理
+	OrphanStatusAssigned = "assigned" // 已分配给用户并入账
+)
+
+// OrphanDeposit 未能自动入账的链上充值，由管理员核实后分配给用户
+// 分配时记录操作人、备注和入账金额，入账本身通过账本分录和钱包流水留痕
+type OrphanDeposit struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Chain          string     `gorm:"size:20;not null" json:"chain"`                 // 所在链
+	Address        string     `gorm:"size:100;index;not null" json:"address"`        // 收款地址
+	Asset          string     `gorm:"size:20;not null" json:"asset"`                 // 资产代码
+	TxHash         string     `gorm:"uniqueIndex;size:100;not null" json:"tx_hash"`  // 交易哈希
+	FromAddress    string     `gorm:"size:100" json:"from_address"`                  // 付款地址
+	Amount         string     `gorm:"size:50;not null" json:"amount"`                // 实收资产数量
+	Reason         string     `gorm:"size:20;not null" json:"reason"`                // 原因
+	RechargeNo     string     `gorm:"size:32;index" json:"recharge_no,omitempty"`    // 关联的充值订单号（少付时）
+	Status         string     `gorm:"size:20;default:'pending';index" json:"status"` // 处理状态
+	AssignedUserID int64      `gorm:"index" json:"assigned_user_id,omitempty"`       // 分配的用户 Telegram ID
+	CreditedAmount string     `gorm:"type:decimal(20,8)" json:"credited_amount"`     // 入账金额（计价币种）
+	Operator       string     `gorm:"size:100" json:"operator,omitempty"`            // 分配操作人
+	Note           string     `gorm:"type:text" json:"note,omitempty"`               // 分配备注
+	AssignedAt     *time.Time `json:"assigned_at,omitempty"`                         // 分配时间
+	CreatedAt      time.Time  `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (OrphanDeposit) TableName() string {
+	return "orphan_deposits"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (o *OrphanDeposit) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	o.CreatedAt = now
+	o.UpdatedAt = now
+	if o.Status == "" {
+		o.Status = OrphanStatusPending
+	}
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (o *OrphanDeposit) BeforeUpdate(tx *gorm.DB) error {
+	o.UpdatedAt = time.Now()
+	return nil
+}
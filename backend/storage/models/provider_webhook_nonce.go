@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProviderWebhookNonce 已处理的第三方 Webhook 请求 nonce，用于拒绝重放请求
+// 超过时间戳容忍窗口的记录可以清理，窗口外的请求会因时间戳校验失败被拒绝
+type ProviderWebhookNonce struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Nonce     string    `gorm:"size:64;uniqueIndex;not null" json:"nonce"` // 请求 nonce
+	EventID   string    `gorm:"size:64" json:"event_id"`                   // 事件ID
+	EventType string    `gorm:"size:32" json:"event_type"`                 // 事件类型
+	CreatedAt time.Time `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ProviderWebhookNonce) TableName() string {
+	return "provider_webhook_nonces"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (n *ProviderWebhookNonce) BeforeCreate(tx *gorm.DB) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -15,25 +15,49 @@ const (
 	RechargeStatusConfirmed RechargeStatus = "confirmed" // 已确认
 	RechargeStatusExpired   RechargeStatus = "expired"   // 已过期
 	RechargeStatusFailed    RechargeStatus = "failed"    // 失败
+	RechargeStatusReversed  RechargeStatus = "reversed"  // 入账后复核发现交易失败或被回滚，已冲回入账
+)
+
+// 充值订单匹配方式
+const (
+	RechargeMatchExactAmount = "exact_amount" // 共用收款地址，按精确金额匹配
+	RechargeMatchAddress     = "address"      // 用户专属收款地址，收到的任意金额按实收入账
+)
+
+// 充值到账类型：按实收数量与订单应付数量比较，订单过期后到账的为逾期
+const (
+	RechargePaymentExact = "exact" // 足额支付
+	RechargePaymentOver  = "over"  // 超额支付，按实收入账
+	RechargePaymentUnder = "under" // 少付，按少付策略入账或转人工
+	RechargePaymentLate  = "late"  // 订单过期后到账，按实收入账
 )
 
 // RechargeOrder 充值订单模型
 type RechargeOrder struct {
-	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	OrderNo       string         `gorm:"uniqueIndex;size:32;not null" json:"order_no"`          // 订单号
-	UserID        int64          `gorm:"index;not null" json:"user_id"`                         // 用户 Telegram ID
-	Amount        string         `gorm:"type:decimal(10,2);not null" json:"amount"`             // 用户输入的充值金额
-	ExactAmount   string         `gorm:"type:decimal(10,4);index;not null" json:"exact_amount"` // 精确金额（用于匹配交易）
-	WalletAddress string         `gorm:"size:100;not null" json:"wallet_address"`               // 系统收款地址
-	Status        RechargeStatus `gorm:"size:20;default:'pending';index" json:"status"`         // 订单状态
-	TxHash        string         `gorm:"size:100;index" json:"tx_hash"`                         // 交易哈希
-	Confirmations int            `gorm:"default:0" json:"confirmations"`                        // 确认数
-	Remark        string         `gorm:"type:text" json:"remark"`                               // 备注
-	ExpiresAt     time.Time      `gorm:"index" json:"expires_at"`                               // 过期时间
-	ConfirmedAt   *time.Time     `json:"confirmed_at,omitempty"`                                // 确认时间
-	CreatedAt     time.Time      `gorm:"type:datetime" json:"created_at"`
-	UpdatedAt     time.Time      `gorm:"type:datetime" json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderNo        string         `gorm:"uniqueIndex;size:32;not null" json:"order_no"`              // 订单号
+	UserID         int64          `gorm:"index;not null" json:"user_id"`                             // 用户 Telegram ID
+	Amount         string         `gorm:"type:decimal(10,2);not null" json:"amount"`                 // 用户输入的充值金额（计价币种，下单金额）
+	Asset          string         `gorm:"size:20;not null;default:'USDT-TRC20';index" json:"asset"`  // 支付资产代码
+	Rate           string         `gorm:"type:decimal(20,8);not null;default:1" json:"rate"`         // 下单时记录的汇率（1 单位支付资产折合的计价币种金额）
+	ExactAmount    string         `gorm:"type:decimal(20,4);index;not null" json:"exact_amount"`     // 需支付的精确资产数量（用于匹配交易）
+	WalletAddress  string         `gorm:"size:100;not null" json:"wallet_address"`                   // 系统收款地址
+	MatchMode      string         `gorm:"size:20;not null;default:'exact_amount'" json:"match_mode"` // 匹配方式
+	Status         RechargeStatus `gorm:"size:20;default:'pending';index" json:"status"`             // 订单状态
+	TxHash         string         `gorm:"size:100;index" json:"tx_hash"`                             // 交易哈希
+	PaymentType    string         `gorm:"size:20" json:"payment_type,omitempty"`                     // 到账类型
+	PaidAmount     string         `gorm:"size:50" json:"paid_amount,omitempty"`                      // 实收资产数量
+	CreditedAmount string         `gorm:"type:decimal(20,8)" json:"credited_amount,omitempty"`       // 实际入账金额（计价币种）
+	Confirmations  int            `gorm:"default:0" json:"confirmations"`                            // 入账时的确认数
+	Remark         string         `gorm:"type:text" json:"remark"`                                   // 备注
+	ExpiresAt      time.Time      `gorm:"index" json:"expires_at"`                                   // 过期时间
+	ConfirmedAt    *time.Time     `json:"confirmed_at,omitempty"`                                    // 确认时间
+	VerifiedAt     *time.Time     `gorm:"index" json:"verified_at,omitempty"`                        // 入账后复核通过时间
+	ReversedAt     *time.Time     `json:"reversed_at,omitempty"`                                     // 冲回时间
+	ReverifyMiss   int            `gorm:"default:0" json:"-"`                                        // 入账后复核连续查不到交易的次数
+	CreatedAt      time.Time      `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"type:datetime" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 // TableName 指定表名
@@ -16,9 +16,13 @@ const (
 )
 
 // Transaction 区块链交易模型
+// 充值扫描器把收款地址收到的每笔转账写入一次，ProcessedAt 为空表示尚未与充值订单匹配
 type Transaction struct {
 	ID            uint              `gorm:"primaryKey" json:"id"`
-	TxHash        string            `gorm:"uniqueIndex;not null" json:"tx_hash"`
+	TxHash        string            `gorm:"uniqueIndex;size:100;not null" json:"tx_hash"`
+	Chain         string            `gorm:"size:20;index" json:"chain"`     // 所在链
+	Asset         string            `gorm:"size:20;index" json:"asset"`     // 资产代码（如 USDT-TRC20）
+	TokenContract string            `gorm:"size:100" json:"token_contract"` // 代币合约地址（原生币为空）
 	FromAddress   string            `gorm:"index" json:"from_address"`
 	ToAddress     string            `gorm:"index" json:"to_address"`
 	Amount        string            `gorm:"not null" json:"amount"` // 使用字符串存储精确金额
@@ -30,6 +34,8 @@ type Transaction struct {
 	GasUsed       int64             `json:"gas_used"`
 	GasPrice      string            `json:"gas_price"`
 	Timestamp     time.Time         `gorm:"type:datetime" json:"timestamp"`
+	RechargeNo    string            `gorm:"size:50;index" json:"recharge_no"`                  // 匹配到的充值订单号
+	ProcessedAt   *time.Time        `gorm:"type:datetime;index" json:"processed_at,omitempty"` // 完成订单匹配的时间
 	CreatedAt     time.Time         `gorm:"type:datetime" json:"created_at"`
 	UpdatedAt     time.Time         `gorm:"type:datetime" json:"updated_at"`
 	DeletedAt     gorm.DeletedAt    `gorm:"index" json:"deleted_at,omitempty"`
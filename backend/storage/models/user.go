@@ -1,11 +1,17 @@
 package models
 
 import (
+	"errors"
 	"time"
 
+	"tg-robot-sim/pkg/tron"
+
 	"gorm.io/gorm"
 )
 
+// ErrInvalidWalletAddress 用户钱包地址不是有效的 TRON 地址
+var ErrInvalidWalletAddress = errors.New("invalid TRON wallet address")
+
 // User 用户模型
 type User struct {
 	ID            int64          `gorm:"primaryKey" json:"id"`
@@ -14,9 +20,12 @@ type User struct {
 	FirstName     string         `json:"first_name"`
 	LastName      string         `json:"last_name"`
 	Language      string         `gorm:"default:'zh'" json:"language"`
-	WalletAddress string         `gorm:"size:100;index" json:"wallet_address"` // 钱包地址
+	WalletAddress string         `gorm:"size:100;index" json:"wallet_address"` // 钱包地址（TRON，保存前离线校验）
 	IsVIP         bool           `gorm:"default:false" json:"is_vip"`          // VIP 状态
 	IsActive      bool           `gorm:"default:true" json:"is_active"`
+	ReferredBy    int64          `gorm:"index;default:0" json:"referred_by"`         // 邀请人 Telegram ID（0 表示无邀请人）
+	ReferredAt    *time.Time     `gorm:"type:datetime" json:"referred_at,omitempty"` // 绑定邀请关系的时间
+	RewardedAt    *time.Time     `gorm:"type:datetime" json:"rewarded_at,omitempty"` // 邀请奖励发放时间（首单完成后发放，只发一次）
 	CreatedAt     time.Time      `gorm:"type:datetime" json:"created_at"`
 	UpdatedAt     time.Time      `gorm:"type:datetime" json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -32,11 +41,19 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	now := time.Now()
 	u.CreatedAt = now
 	u.UpdatedAt = now
-	return nil
+	return u.validateWalletAddress()
 }
 
 // BeforeUpdate GORM 钩子：更新前
 func (u *User) BeforeUpdate(tx *gorm.DB) error {
 	u.UpdatedAt = time.Now()
+	return u.validateWalletAddress()
+}
+
+// validateWalletAddress 钱包地址不为空时必须是有效的 TRON 地址
+func (u *User) validateWalletAddress() error {
+	if u.WalletAddress != "" && !tron.IsValidAddress(u.WalletAddress) {
+		return ErrInvalidWalletAddress
+	}
 	return nil
 }
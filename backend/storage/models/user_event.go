@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserEventRecord 跨进程共享的用户实时事件
+// Bot、Mini App 各副本发布事件时写入该表，Mini App 进程按 ID 顺序轮询后投递到进程内事件中心推送给订阅者
+type UserEventRecord struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64     `gorm:"index;not null" json:"user_id"` // 用户 Telegram ID
+	Type      string    `gorm:"size:50;not null" json:"type"`  // 事件类型
+	Data      string    `gorm:"type:text" json:"data"`         // 事件数据（JSON）
+	CreatedAt time.Time `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserEventRecord) TableName() string {
+	return "user_events"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (e *UserEventRecord) BeforeCreate(tx *gorm.DB) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return nil
+}
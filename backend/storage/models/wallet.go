@@ -6,14 +6,17 @@ import (
 	"gorm.io/gorm"
 )
 
-// Wallet 钱包模型
+// Wallet 钱包模型，按 (用户, 资产) 唯一
+// 充值资产到账时按汇率折算为计价币种，余额、冻结和账本均记在计价币种钱包上
 type Wallet struct {
 	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID        int64     `gorm:"uniqueIndex;not null" json:"user_id"`
-	Balance       string    `gorm:"type:decimal(20,8);default:'0'" json:"balance"`        // 可用余额
-	FrozenBalance string    `gorm:"type:decimal(20,8);default:'0'" json:"frozen_balance"` // 冻结余额
-	TotalIncome   string    `gorm:"type:decimal(20,8);default:'0'" json:"total_income"`   // 总收入
-	TotalExpense  string    `gorm:"type:decimal(20,8);default:'0'" json:"total_expense"`  // 总支出
+	UserID        int64     `gorm:"uniqueIndex:idx_wallet_user_asset;not null" json:"user_id"`
+	Asset         string    `gorm:"uniqueIndex:idx_wallet_user_asset;size:20;not null;default:'USD'" json:"asset"` // 资产代码，默认为计价币种
+	Balance       string    `gorm:"type:decimal(20,8);default:'0'" json:"balance"`                                 // 可用余额
+	FrozenBalance string    `gorm:"type:decimal(20,8);default:'0'" json:"frozen_balance"`                          // 冻结余额
+	TotalIncome   string    `gorm:"type:decimal(20,8);default:'0'" json:"total_income"`                            // 总收入
+	TotalExpense  string    `gorm:"type:decimal(20,8);default:'0'" json:"total_expense"`                           // 总支出
+	Version       int64     `gorm:"not null;default:0" json:"version"`                                             // 乐观锁版本号，每次更新加一
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -28,6 +31,9 @@ func (w *Wallet) BeforeCreate(tx *gorm.DB) error {
 	now := time.Now()
 	w.CreatedAt = now
 	w.UpdatedAt = now
+	if w.Asset == "" {
+		w.Asset = PricingCurrency
+	}
 	return nil
 }
 
@@ -10,9 +10,14 @@ import (
 type WalletHistoryType string
 
 const (
-	WalletHistoryTypeRecharge WalletHistoryType = "recharge" // 充值
-	WalletHistoryTypePayment  WalletHistoryType = "payment"  // 支付（包含冻结金额的最终扣费）
-	WalletHistoryTypeRefund   WalletHistoryType = "refund"   // 退款（包含冻结金额的退还）
+	WalletHistoryTypeRecharge    WalletHistoryType = "recharge"     // 充值
+	WalletHistoryTypePayment     WalletHistoryType = "payment"      // 支付（包含冻结金额的最终扣费）
+	WalletHistoryTypeRefund      WalletHistoryType = "refund"       // 退款（包含冻结金额的退还）
+	WalletHistoryTypeAdjustment  WalletHistoryType = "adjustment"   // 对账调整（由 reconcile-wallets -fix 写入）
+	WalletHistoryTypeTransferIn  WalletHistoryType = "transfer_in"  // 用户间转账转入
+	WalletHistoryTypeTransferOut WalletHistoryType = "transfer_out" // 用户间转账转出
+	WalletHistoryTypeReferral    WalletHistoryType = "referral"     // 邀请奖励
+	WalletHistoryTypeChargeback  WalletHistoryType = "chargeback"   // 充值冲回（金额为负数）
 )
 
 // WalletHistoryStatus 钱包历史记录状态
@@ -65,12 +70,12 @@ func (w *WalletHistory) BeforeUpdate(tx *gorm.DB) error {
 
 // IsIncome 检查是否为收入记录
 func (w *WalletHistory) IsIncome() bool {
-	return w.Type == WalletHistoryTypeRecharge || w.Type == WalletHistoryTypeRefund
+	return w.Type == WalletHistoryTypeRecharge || w.Type == WalletHistoryTypeRefund || w.Type == WalletHistoryTypeTransferIn || w.Type == WalletHistoryTypeReferral
 }
 
 // IsExpense 检查是否为支出记录
 func (w *WalletHistory) IsExpense() bool {
-	return w.Type == WalletHistoryTypePayment
+	return w.Type == WalletHistoryTypePayment || w.Type == WalletHistoryTypeTransferOut
 }
 
 // IsCompleted 检查记录是否已完成
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WalletOperation 钱包操作幂等记录
+// 同一 (操作类型, 关联ID) 只能成功执行一次，重复调用直接返回首次执行结果
+type WalletOperation struct {
+	ID            uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	OperationType LedgerEntryType `gorm:"uniqueIndex:idx_wallet_operation_key;size:30;not null" json:"operation_type"`
+	RelatedID     string          `gorm:"uniqueIndex:idx_wallet_operation_key;size:100;not null" json:"related_id"`
+	UserID        int64           `gorm:"index;not null" json:"user_id"`
+	Amount        string          `gorm:"type:decimal(20,8);not null" json:"amount"` // 分录借方合计
+	EntryID       uint            `gorm:"index" json:"entry_id"`                     // 对应的账本分录
+	BalanceBefore string          `gorm:"type:decimal(20,8)" json:"balance_before"`
+	BalanceAfter  string          `gorm:"type:decimal(20,8)" json:"balance_after"`
+	FrozenBefore  string          `gorm:"type:decimal(20,8)" json:"frozen_before"`
+	FrozenAfter   string          `gorm:"type:decimal(20,8)" json:"frozen_after"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// TableName 指定表名
+func (WalletOperation) TableName() string {
+	return "wallet_operations"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (o *WalletOperation) BeforeCreate(tx *gorm.DB) error {
+	o.CreatedAt = time.Now()
+	return nil
+}
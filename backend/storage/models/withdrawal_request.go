@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WithdrawalStatus 提现申请状态
+type WithdrawalStatus string
+
+const (
+	WithdrawalStatusPending  WithdrawalStatus = "pending"  // 待审核（金额已冻结）
+	WithdrawalStatusApproved WithdrawalStatus = "approved" // 已打款（冻结金额已扣除）
+	WithdrawalStatusRejected WithdrawalStatus = "rejected" // 已拒绝（冻结金额已退还）
+)
+
+// WithdrawalRequest USDT 提现申请
+type WithdrawalRequest struct {
+	ID           uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	WithdrawalNo string           `gorm:"uniqueIndex;size:32;not null" json:"withdrawal_no"` // 提现单号（同时作为冻结/扣款/解冻的幂等键）
+	UserID       int64            `gorm:"index;not null" json:"user_id"`                     // 用户 Telegram ID
+	Amount       string           `gorm:"type:decimal(20,8);not null" json:"amount"`         // 提现金额
+	ToAddress    string           `gorm:"size:100;not null" json:"to_address"`               // 收款 TRON 地址
+	Status       WithdrawalStatus `gorm:"size:20;default:'pending';index" json:"status"`     // 申请状态
+	TxHash       string           `gorm:"size:100;index" json:"tx_hash"`                     // 打款交易哈希（审核通过时填写）
+	Reviewer     string           `gorm:"size:100" json:"reviewer"`                          // 审核人
+	RejectReason string           `gorm:"size:500" json:"reject_reason"`                     // 拒绝原因
+	ReviewedAt   *time.Time       `json:"reviewed_at,omitempty"`                             // 审核时间
+	CreatedAt    time.Time        `gorm:"type:datetime;index" json:"created_at"`
+	UpdatedAt    time.Time        `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WithdrawalRequest) TableName() string {
+	return "withdrawal_requests"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (w *WithdrawalRequest) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	w.CreatedAt = now
+	w.UpdatedAt = now
+
+	if w.WithdrawalNo == "" {
+		w.WithdrawalNo = GenerateWithdrawalNo()
+	}
+	return nil
+}
+
+// BeforeUpdate GORM 钩子：更新前
+func (w *WithdrawalRequest) BeforeUpdate(tx *gorm.DB) error {
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+// IsPending 检查申请是否待审核
+func (w *WithdrawalRequest) IsPending() bool {
+	return w.Status == WithdrawalStatusPending
+}
+
+// GenerateWithdrawalNo 生成提现单号
+// 需要在冻结余额前确定单号，因此在创建记录之前调用
+func GenerateWithdrawalNo() string {
+	// 格式: WDR + 时间戳 + 随机数
+	return fmt.Sprintf("WDR%d%04d", time.Now().Unix(), time.Now().Nanosecond()%10000)
+}
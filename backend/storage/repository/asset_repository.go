@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// AssetRepository 资产登记仓储接口
+type AssetRepository interface {
+	Create(ctx context.Context, asset *models.Asset) error
+	// GetByCode 根据资产代码获取资产（不区分大小写）
+	GetByCode(ctx context.Context, code string) (*models.Asset, error)
+	// List 列出资产，activeOnly 为 true 时只返回可用资产
+	List(ctx context.Context, activeOnly bool) ([]*models.Asset, error)
+	// ListByChain 列出指定链上的可用资产
+	ListByChain(ctx context.Context, chain string) ([]*models.Asset, error)
+	// UpdateRate 更新资产汇率
+	UpdateRate(ctx context.Context, code string, rate string) error
+	UpdateStatus(ctx context.Context, code string, status models.AssetStatus) error
+}
+
+// assetRepository 资产登记仓储实现
+type assetRepository struct {
+	db *gorm.DB
+}
+
+// NewAssetRepository 创建资产登记仓储实例
+func NewAssetRepository(db *gorm.DB) AssetRepository {
+	return &assetRepository{db: db}
+}
+
+// Create 创建资产
+func (r *assetRepository) Create(ctx context.Context, asset *models.Asset) error {
+	return r.db.WithContext(ctx).Create(asset).Error
+}
+
+// GetByCode 根据资产代码获取资产
+func (r *assetRepository) GetByCode(ctx context.Context, code string) (*models.Asset, error) {
+	var asset models.Asset
+	err := r.db.WithContext(ctx).
+		Where("code = ?", models.NormalizeAssetCode(code)).
+		First(&asset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// List 列出资产
+func (r *assetRepository) List(ctx context.Context, activeOnly bool) ([]*models.Asset, error) {
+	var assets []*models.Asset
+	query := r.db.WithContext(ctx).Order("id ASC")
+	if activeOnly {
+		query = query.Where("status = ?", models.AssetStatusActive)
+	}
+	err := query.Find(&assets).Error
+	return assets, err
+}
+
+// ListByChain 列出指定链上的可用资产
+func (r *assetRepository) ListByChain(ctx context.Context, chain string) ([]*models.Asset, error) {
+	var assets []*models.Asset
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND status = ?", chain, models.AssetStatusActive).
+		Order("id ASC").
+		Find(&assets).Error
+	return assets, err
+}
+
+// UpdateRate 更新资产汇率
+func (r *assetRepository) UpdateRate(ctx context.Context, code string, rate string) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Asset{}).
+		Where("code = ?", models.NormalizeAssetCode(code)).
+		Updates(map[string]interface{}{
+			"usd_rate":        rate,
+			"rate_updated_at": now,
+			"updated_at":      now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateStatus 更新资产状态
+func (r *assetRepository) UpdateStatus(ctx context.Context, code string, status models.AssetStatus) error {
+	result := r.db.WithContext(ctx).Model(&models.Asset{}).
+		Where("code = ?", models.NormalizeAssetCode(code)).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// CouponRepository 优惠券仓储接口
+type CouponRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) CouponRepository
+
+	Create(ctx context.Context, coupon *models.Coupon) error
+	GetByID(ctx context.Context, id uint) (*models.Coupon, error)
+	// GetByCode 根据优惠码获取优惠券（不区分大小写）
+	GetByCode(ctx context.Context, code string) (*models.Coupon, error)
+	// List 按状态列出优惠券，status 为空时返回全部
+	List(ctx context.Context, status models.CouponStatus, limit, offset int) ([]*models.Coupon, error)
+	UpdateStatus(ctx context.Context, id uint, status models.CouponStatus) error
+	// IncrementUsage 在未达到总使用次数上限时占用一次使用次数，返回是否占用成功
+	IncrementUsage(ctx context.Context, id uint) (bool, error)
+	// DecrementUsage 退回一次使用次数
+	DecrementUsage(ctx context.Context, id uint) error
+
+	CreateRedemption(ctx context.Context, redemption *models.CouponRedemption) error
+	GetRedemptionByOrderNo(ctx context.Context, orderNo string) (*models.CouponRedemption, error)
+	// CountUserRedemptions 统计用户对该优惠券的有效核销次数
+	CountUserRedemptions(ctx context.Context, couponID uint, userID int64) (int64, error)
+	// ReleaseRedemption 仅当核销记录为已使用时标记为已释放，返回是否更新成功
+	ReleaseRedemption(ctx context.Context, id uint) (bool, error)
+}
+
+// couponRepository 优惠券仓储实现
+type couponRepository struct {
+	db *gorm.DB
+}
+
+// NewCouponRepository 创建优惠券仓储实例
+func NewCouponRepository(db *gorm.DB) CouponRepository {
+	return &couponRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *couponRepository) WithTx(tx *gorm.DB) CouponRepository {
+	return &couponRepository{db: tx}
+}
+
+// Create 创建优惠券
+func (r *couponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	return r.db.WithContext(ctx).Create(coupon).Error
+}
+
+// GetByID 根据ID获取优惠券
+func (r *couponRepository) GetByID(ctx context.Context, id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.WithContext(ctx).First(&coupon, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetByCode 根据优惠码获取优惠券
+func (r *couponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.WithContext(ctx).
+		Where("code = ?", models.NormalizeCouponCode(code)).
+		First(&coupon).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// List 按状态列出优惠券
+func (r *couponRepository) List(ctx context.Context, status models.CouponStatus, limit, offset int) ([]*models.Coupon, error) {
+	var coupons []*models.Coupon
+	query := r.db.WithContext(ctx).Order("id DESC")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&coupons).Error
+	return coupons, err
+}
+
+// UpdateStatus 更新优惠券状态
+func (r *couponRepository) UpdateStatus(ctx context.Context, id uint, status models.CouponStatus) error {
+	return r.db.WithContext(ctx).Model(&models.Coupon{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// IncrementUsage 在未达到总使用次数上限时占用一次使用次数
+// 以上限作为更新条件，并发核销时不会超发
+func (r *couponRepository) IncrementUsage(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit = 0 OR used_count < usage_limit)", id).
+		Updates(map[string]interface{}{
+			"used_count": gorm.Expr("used_count + 1"),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DecrementUsage 退回一次使用次数
+func (r *couponRepository) DecrementUsage(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.Coupon{}).
+		Where("id = ? AND used_count > 0", id).
+		Updates(map[string]interface{}{
+			"used_count": gorm.Expr("used_count - 1"),
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// CreateRedemption 创建核销记录
+func (r *couponRepository) CreateRedemption(ctx context.Context, redemption *models.CouponRedemption) error {
+	return r.db.WithContext(ctx).Create(redemption).Error
+}
+
+// GetRedemptionByOrderNo 根据订单号获取核销记录
+func (r *couponRepository) GetRedemptionByOrderNo(ctx context.Context, orderNo string) (*models.CouponRedemption, error) {
+	var redemption models.CouponRedemption
+	err := r.db.WithContext(ctx).Where("order_no = ?", orderNo).First(&redemption).Error
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// CountUserRedemptions 统计用户对该优惠券的有效核销次数
+func (r *couponRepository) CountUserRedemptions(ctx context.Context, couponID uint, userID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.CouponRedemption{}).
+		Where("coupon_id = ? AND user_id = ? AND status = ?", couponID, userID, models.CouponRedemptionApplied).
+		Count(&count).Error
+	return count, err
+}
+
+// ReleaseRedemption 仅当核销记录为已使用时标记为已释放
+func (r *couponRepository) ReleaseRedemption(ctx context.Context, id uint) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.CouponRedemption{}).
+		Where("id = ? AND status = ?", id, models.CouponRedemptionApplied).
+		Updates(map[string]interface{}{
+			"status":      models.CouponRedemptionReleased,
+			"released_at": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
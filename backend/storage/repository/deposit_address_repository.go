@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// DepositAddressRepository 用户充值地址仓储接口
+type DepositAddressRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) DepositAddressRepository
+	Create(ctx context.Context, address *models.DepositAddress) error
+	Update(ctx context.Context, address *models.DepositAddress) error
+	// GetByUserID 获取用户在指定链上的充值地址，不存在时返回 gorm.ErrRecordNotFound
+	GetByUserID(ctx context.Context, chain string, userID int64) (*models.DepositAddress, error)
+	// GetByAddress 根据地址查找所属用户，不存在时返回 gorm.ErrRecordNotFound
+	GetByAddress(ctx context.Context, chain, address string) (*models.DepositAddress, error)
+	// ListByChain 获取指定链上已派生地址的全部充值地址
+	ListByChain(ctx context.Context, chain string) ([]*models.DepositAddress, error)
+}
+
+// depositAddressRepository 用户充值地址仓储实现
+type depositAddressRepository struct {
+	db *gorm.DB
+}
+
+// NewDepositAddressRepository 创建用户充值地址仓储实例
+func NewDepositAddressRepository(db *gorm.DB) DepositAddressRepository {
+	return &depositAddressRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *depositAddressRepository) WithTx(tx *gorm.DB) DepositAddressRepository {
+	return &depositAddressRepository{db: tx}
+}
+
+// Create 创建充值地址记录
+func (r *depositAddressRepository) Create(ctx context.Context, address *models.DepositAddress) error {
+	return r.db.WithContext(ctx).Create(address).Error
+}
+
+// Update 更新充值地址记录
+func (r *depositAddressRepository) Update(ctx context.Context, address *models.DepositAddress) error {
+	return r.db.WithContext(ctx).Save(address).Error
+}
+
+// GetByUserID 获取用户在指定链上的充值地址
+func (r *depositAddressRepository) GetByUserID(ctx context.Context, chain string, userID int64) (*models.DepositAddress, error) {
+	var address models.DepositAddress
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND user_id = ?", chain, userID).
+		First(&address).Error
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// GetByAddress 根据地址查找所属用户
+func (r *depositAddressRepository) GetByAddress(ctx context.Context, chain, address string) (*models.DepositAddress, error) {
+	var record models.DepositAddress
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND address = ?", chain, address).
+		First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListByChain 获取指定链上已派生地址的全部充值地址
+func (r *depositAddressRepository) ListByChain(ctx context.Context, chain string) ([]*models.DepositAddress, error) {
+	var records []*models.DepositAddress
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND address != ''", chain).
+		Order("id ASC").
+		Find(&records).Error
+	return records, err
+}
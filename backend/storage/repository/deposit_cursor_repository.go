@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// DepositCursorRepository 充值扫描游标仓储接口
+type DepositCursorRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) DepositCursorRepository
+	// Get 获取收款地址上指定资产的扫描游标，不存在时返回 gorm.ErrRecordNotFound
+	Get(ctx context.Context, chain, address, asset string) (*models.DepositCursor, error)
+	// Save 创建或更新扫描游标
+	Save(ctx context.Context, cursor *models.DepositCursor) error
+}
+
+// depositCursorRepository 充值扫描游标仓储实现
+type depositCursorRepository struct {
+	db *gorm.DB
+}
+
+// NewDepositCursorRepository 创建充值扫描游标仓储实例
+func NewDepositCursorRepository(db *gorm.DB) DepositCursorRepository {
+	return &depositCursorRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *depositCursorRepository) WithTx(tx *gorm.DB) DepositCursorRepository {
+	return &depositCursorRepository{db: tx}
+}
+
+// Get 获取扫描游标
+func (r *depositCursorRepository) Get(ctx context.Context, chain, address, asset string) (*models.DepositCursor, error) {
+	var cursor models.DepositCursor
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND address = ? AND asset = ?", chain, address, asset).
+		First(&cursor).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Save 创建或更新扫描游标
+func (r *depositCursorRepository) Save(ctx context.Context, cursor *models.DepositCursor) error {
+	return r.db.WithContext(ctx).Save(cursor).Error
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrVersionConflict 乐观锁版本冲突（记录已被其他请求修改）
+var ErrVersionConflict = errors.New("version conflict")
+
+// IsRetryableConflict 判断是否为可重试的并发冲突：版本冲突、SQLite 锁定、MySQL 死锁或锁等待超时
+func IsRetryableConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "Deadlock found") || // MySQL 1213
+		strings.Contains(msg, "Lock wait timeout") // MySQL 1205
+}
+
+// IsDuplicateKeyError 判断是否为唯一索引冲突错误（兼容 MySQL 与 SQLite）
+func IsDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "Duplicate entry") || // MySQL 1062
+		strings.Contains(msg, "UNIQUE constraint failed") // SQLite
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// GatewayPaymentRepository 渠道支付仓储接口
+type GatewayPaymentRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) GatewayPaymentRepository
+	// Create 创建支付记录
+	Create(ctx context.Context, payment *models.GatewayPayment) error
+	// GetByPaymentNo 按支付单号获取，不存在时返回 gorm.ErrRecordNotFound
+	GetByPaymentNo(ctx context.Context, paymentNo string) (*models.GatewayPayment, error)
+	// GetByChargeID 按渠道支付ID获取，不存在时返回 gorm.ErrRecordNotFound
+	GetByChargeID(ctx context.Context, chargeID string) (*models.GatewayPayment, error)
+	// GetByUserID 获取用户的支付记录，按创建时间倒序
+	GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.GatewayPayment, error)
+	// MarkPaid 仅当记录仍待支付时写入渠道支付ID和支付时间，返回是否更新成功
+	MarkPaid(ctx context.Context, id uint, chargeID string, paidAt time.Time) (bool, error)
+	// MarkRefunded 仅当记录已支付时标记为已退款，返回是否更新成功
+	MarkRefunded(ctx context.Context, id uint, operator, remark string, refundedAt time.Time) (bool, error)
+}
+
+// gatewayPaymentRepository 渠道支付仓储实现
+type gatewayPaymentRepository struct {
+	db *gorm.DB
+}
+
+// NewGatewayPaymentRepository 创建渠道支付仓储实例
+func NewGatewayPaymentRepository(db *gorm.DB) GatewayPaymentRepository {
+	return &gatewayPaymentRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *gatewayPaymentRepository) WithTx(tx *gorm.DB) GatewayPaymentRepository {
+	return &gatewayPaymentRepository{db: tx}
+}
+
+// Create 创建支付记录
+func (r *gatewayPaymentRepository) Create(ctx context.Context, payment *models.GatewayPayment) error {
+	return r.db.WithContext(ctx).Create(payment).Error
+}
+
+// GetByPaymentNo 按支付单号获取
+func (r *gatewayPaymentRepository) GetByPaymentNo(ctx context.Context, paymentNo string) (*models.GatewayPayment, error) {
+	var payment models.GatewayPayment
+	err := r.db.WithContext(ctx).Where("payment_no = ?", paymentNo).First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetByChargeID 按渠道支付ID获取
+func (r *gatewayPaymentRepository) GetByChargeID(ctx context.Context, chargeID string) (*models.GatewayPayment, error) {
+	var payment models.GatewayPayment
+	err := r.db.WithContext(ctx).Where("charge_id = ?", chargeID).First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetByUserID 获取用户的支付记录
+func (r *gatewayPaymentRepository) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.GatewayPayment, error) {
+	var payments []*models.GatewayPayment
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	err := query.Find(&payments).Error
+	return payments, err
+}
+
+// MarkPaid 写入支付信息
+// 以待支付状态作为条件更新，同一张发票只会被标记一次
+func (r *gatewayPaymentRepository) MarkPaid(ctx context.Context, id uint, chargeID string, paidAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.GatewayPayment{}).
+		Where("id = ? AND status = ?", id, models.GatewayPaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":    models.GatewayPaymentStatusPaid,
+			"charge_id": chargeID,
+			"paid_at":   paidAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// MarkRefunded 标记退款
+// 以已支付状态作为条件更新，同一笔支付只会退款一次
+func (r *gatewayPaymentRepository) MarkRefunded(ctx context.Context, id uint, operator, remark string, refundedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.GatewayPayment{}).
+		Where("id = ? AND status = ?", id, models.GatewayPaymentStatusPaid).
+		Updates(map[string]interface{}{
+			"status":      models.GatewayPaymentStatusRefunded,
+			"operator":    operator,
+			"remark":      remark,
+			"refunded_at": refundedAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
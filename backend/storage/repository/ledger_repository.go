@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerRepository 复式记账仓储接口
+type LedgerRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) LedgerRepository
+
+	GetAccount(ctx context.Context, userID int64, accountType models.LedgerAccountType) (*models.LedgerAccount, error)
+	// GetOrCreateAccountForUpdate 获取（不存在则创建）科目并加行锁
+	GetOrCreateAccountForUpdate(ctx context.Context, userID int64, accountType models.LedgerAccountType) (*models.LedgerAccount, bool, error)
+	// UpdateAccountBalance 按版本号比较并更新科目余额，版本不一致时返回 ErrVersionConflict
+	UpdateAccountBalance(ctx context.Context, account *models.LedgerAccount) error
+	GetUserAccounts(ctx context.Context, userID int64) ([]*models.LedgerAccount, error)
+
+	CreateEntry(ctx context.Context, entry *models.LedgerEntry) error
+	GetEntriesByRelatedID(ctx context.Context, relatedID string) ([]*models.LedgerEntry, error)
+	GetEntriesByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.LedgerEntry, error)
+	GetEntryByID(ctx context.Context, id uint) (*models.LedgerEntry, error)
+
+	// 幂等操作记录
+	GetOperation(ctx context.Context, operationType models.LedgerEntryType, relatedID string) (*models.WalletOperation, error)
+	CreateOperation(ctx context.Context, operation *models.WalletOperation) error
+}
+
+// ledgerRepository 复式记账仓储实现
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+// NewLedgerRepository 创建复式记账仓储实例
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *ledgerRepository) WithTx(tx *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: tx}
+}
+
+// GetAccount 获取科目
+func (r *ledgerRepository) GetAccount(ctx context.Context, userID int64, accountType models.LedgerAccountType) (*models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND account_type = ?", userID, accountType).
+		First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetOrCreateAccountForUpdate 获取（不存在则创建）科目并加行锁，返回值 created 表示是否新建
+func (r *ledgerRepository) GetOrCreateAccountForUpdate(ctx context.Context, userID int64, accountType models.LedgerAccountType) (*models.LedgerAccount, bool, error) {
+	var account models.LedgerAccount
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND account_type = ?", userID, accountType).
+		First(&account).Error
+	if err == nil {
+		return &account, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, fmt.Errorf("failed to lock ledger account: %w", err)
+	}
+
+	account = models.LedgerAccount{
+		UserID:      userID,
+		AccountType: accountType,
+		Balance:     "0",
+	}
+	if err := r.db.WithContext(ctx).Create(&account).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to create ledger account: %w", err)
+	}
+	return &account, true, nil
+}
+
+// UpdateAccountBalance 按版本号比较并更新科目余额，版本不一致时返回 ErrVersionConflict
+func (r *ledgerRepository) UpdateAccountBalance(ctx context.Context, account *models.LedgerAccount) error {
+	result := r.db.WithContext(ctx).Model(&models.LedgerAccount{}).
+		Where("id = ? AND version = ?", account.ID, account.Version).
+		Updates(map[string]interface{}{
+			"balance": account.Balance,
+			"version": gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	account.Version++
+	return nil
+}
+
+// GetUserAccounts 获取用户的全部科目
+func (r *ledgerRepository) GetUserAccounts(ctx context.Context, userID int64) ([]*models.LedgerAccount, error) {
+	var accounts []*models.LedgerAccount
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&accounts).Error
+	return accounts, err
+}
+
+// CreateEntry 创建分录（连同明细行）
+func (r *ledgerRepository) CreateEntry(ctx context.Context, entry *models.LedgerEntry) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// GetEntriesByRelatedID 根据关联ID获取分录
+func (r *ledgerRepository) GetEntriesByRelatedID(ctx context.Context, relatedID string) ([]*models.LedgerEntry, error) {
+	var entries []*models.LedgerEntry
+	err := r.db.WithContext(ctx).
+		Preload("Lines").
+		Where("related_id = ?", relatedID).
+		Order("id ASC").
+		Find(&entries).Error
+	return entries, err
+}
+
+// GetEntriesByUserID 获取用户的分录
+func (r *ledgerRepository) GetEntriesByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.LedgerEntry, error) {
+	var entries []*models.LedgerEntry
+	query := r.db.WithContext(ctx).
+		Preload("Lines").
+		Where("user_id = ?", userID).
+		Order("id DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&entries).Error
+	return entries, err
+}
+
+// GetEntryByID 根据ID获取分录
+func (r *ledgerRepository) GetEntryByID(ctx context.Context, id uint) (*models.LedgerEntry, error) {
+	var entry models.LedgerEntry
+	err := r.db.WithContext(ctx).Preload("Lines").First(&entry, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetOperation 获取幂等操作记录
+func (r *ledgerRepository) GetOperation(ctx context.Context, operationType models.LedgerEntryType, relatedID string) (*models.WalletOperation, error) {
+	var operation models.WalletOperation
+	err := r.db.WithContext(ctx).
+		Where("operation_type = ? AND related_id = ?", operationType, relatedID).
+		First(&operation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// CreateOperation 创建幂等操作记录，(operation_type, related_id) 冲突时返回唯一索引错误
+func (r *ledgerRepository) CreateOperation(ctx context.Context, operation *models.WalletOperation) error {
+	return r.db.WithContext(ctx).Create(operation).Error
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// OrderEventRepository 订单事件仓储接口
+type OrderEventRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) OrderEventRepository
+	// Create 写入订单事件
+	Create(ctx context.Context, event *models.OrderEvent) error
+	// GetByOrderID 获取订单的全部事件，按发生顺序排列
+	GetByOrderID(ctx context.Context, orderID uint) ([]*models.OrderEvent, error)
+}
+
+// orderEventRepository 订单事件仓储实现
+type orderEventRepository struct {
+	db *gorm.DB
+}
+
+// NewOrderEventRepository 创建订单事件仓储实例
+func NewOrderEventRepository(db *gorm.DB) OrderEventRepository {
+	return &orderEventRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *orderEventRepository) WithTx(tx *gorm.DB) OrderEventRepository {
+	return &orderEventRepository{db: tx}
+}
+
+// Create 写入订单事件
+func (r *orderEventRepository) Create(ctx context.Context, event *models.OrderEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// GetByOrderID 获取订单的全部事件
+func (r *orderEventRepository) GetByOrderID(ctx context.Context, orderID uint) ([]*models.OrderEvent, error) {
+	var events []*models.OrderEvent
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Find(&events).Error
+	return events, err
+}
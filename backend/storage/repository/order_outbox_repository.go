@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// OrderOutboxRepository 订单发件箱仓储接口
+type OrderOutboxRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) OrderOutboxRepository
+	// Create 写入任务，通常与订单在同一事务中调用
+	Create(ctx context.Context, task *models.OrderOutboxTask) error
+	// GetByOrderID 获取订单的全部任务
+	GetByOrderID(ctx context.Context, orderID uint) ([]*models.OrderOutboxTask, error)
+	// ClaimDue 领取到期的待执行任务和租约已过期的执行中任务，执行次数加一，返回领取成功的任务
+	// 租约过期的执行中任务说明上一次调用结果未知，领取时标记为 Uncertain
+	ClaimDue(ctx context.Context, taskType, owner string, lease time.Duration, limit int) ([]*models.OrderOutboxTask, error)
+	// MarkDone 仅当任务仍由 owner 持有时标记为成功，返回是否更新成功
+	MarkDone(ctx context.Context, id uint, owner, result string) (bool, error)
+	// MarkRetry 仅当任务仍由 owner 持有时释放租约并安排重试，uncertain 为 true 时同时标记调用结果未知，返回是否更新成功
+	MarkRetry(ctx context.Context, id uint, owner, lastError string, nextRunAt time.Time, uncertain bool) (bool, error)
+	// MarkCompensated 仅当任务仍由 owner 持有时标记为已补偿，返回是否更新成功
+	MarkCompensated(ctx context.Context, id uint, owner, lastError string) (bool, error)
+	// MarkManualReview 仅当任务仍由 owner 持有时标记为等待人工核查，返回是否更新成功
+	MarkManualReview(ctx context.Context, id uint, owner, lastError string) (bool, error)
+}
+
+// orderOutboxRepository 订单发件箱仓储实现
+type orderOutboxRepository struct {
+	db *gorm.DB
+}
+
+// NewOrderOutboxRepository 创建订单发件箱仓储实例
+func NewOrderOutboxRepository(db *gorm.DB) OrderOutboxRepository {
+	return &orderOutboxRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *orderOutboxRepository) WithTx(tx *gorm.DB) OrderOutboxRepository {
+	return &orderOutboxRepository{db: tx}
+}
+
+// Create 写入任务
+func (r *orderOutboxRepository) Create(ctx context.Context, task *models.OrderOutboxTask) error {
+	return r.db.WithContext(ctx).Create(task).Error
+}
+
+// GetByOrderID 获取订单的全部任务
+func (r *orderOutboxRepository) GetByOrderID(ctx context.Context, orderID uint) ([]*models.OrderOutboxTask, error) {
+	var tasks []*models.OrderOutboxTask
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimDue 领取到期任务
+// 先查出候选任务，再逐个以相同条件做条件更新，多个实例并发领取时每个任务只会被一个实例领到
+func (r *orderOutboxRepository) ClaimDue(ctx context.Context, taskType, owner string, lease time.Duration, limit int) ([]*models.OrderOutboxTask, error) {
+	now := time.Now()
+	due := func(db *gorm.DB) *gorm.DB {
+		return db.Where("task_type = ?", taskType).
+			Where("(status = ? AND next_run_at <= ?) OR (status = ? AND locked_until < ?)",
+				models.OutboxStatusPending, now, models.OutboxStatusRunning, now)
+	}
+
+	var candidates []*models.OrderOutboxTask
+	query := due(r.db.WithContext(ctx)).Order("next_run_at ASC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	lockedUntil := now.Add(lease)
+	claimed := make([]*models.OrderOutboxTask, 0, len(candidates))
+	for _, task := range candidates {
+		updates := map[string]interface{}{
+			"status":       models.OutboxStatusRunning,
+			"locked_by":    owner,
+			"locked_until": lockedUntil,
+			"attempts":     gorm.Expr("attempts + 1"),
+		}
+		recovered := task.Status == models.OutboxStatusRunning
+		if recovered {
+			updates["uncertain"] = true
+		}
+		result := due(r.db.WithContext(ctx).Model(&models.OrderOutboxTask{})).
+			Where("id = ? AND status = ?", task.ID, task.Status).
+			Updates(updates)
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue // 已被其他实例领取
+		}
+		task.Status = models.OutboxStatusRunning
+		task.LockedBy = owner
+		task.LockedUntil = &lockedUntil
+		task.Attempts++
+		task.Uncertain = task.Uncertain || recovered
+		claimed = append(claimed, task)
+	}
+	return claimed, nil
+}
+
+// MarkDone 标记任务成功
+func (r *orderOutboxRepository) MarkDone(ctx context.Context, id uint, owner, result string) (bool, error) {
+	return r.finish(ctx, id, owner, map[string]interface{}{
+		"status":       models.OutboxStatusDone,
+		"result":       result,
+		"last_error":   "",
+		"locked_until": nil,
+		"completed_at": time.Now(),
+	})
+}
+
+// MarkRetry 安排任务重试
+func (r *orderOutboxRepository) MarkRetry(ctx context.Context, id uint, owner, lastError string, nextRunAt time.Time, uncertain bool) (bool, error) {
+	updates := map[string]interface{}{
+		"status":       models.OutboxStatusPending,
+		"last_error":   lastError,
+		"next_run_at":  nextRunAt,
+		"locked_until": nil,
+	}
+	if uncertain {
+		updates["uncertain"] = true
+	}
+	return r.finish(ctx, id, owner, updates)
+}
+
+// MarkCompensated 标记任务已补偿
+func (r *orderOutboxRepository) MarkCompensated(ctx context.Context, id uint, owner, lastError string) (bool, error) {
+	return r.finish(ctx, id, owner, map[string]interface{}{
+		"status":       models.OutboxStatusCompensated,
+		"last_error":   lastError,
+		"locked_until": nil,
+		"completed_at": time.Now(),
+	})
+}
+
+// MarkManualReview 标记任务等待人工核查
+func (r *orderOutboxRepository) MarkManualReview(ctx context.Context, id uint, owner, lastError string) (bool, error) {
+	return r.finish(ctx, id, owner, map[string]interface{}{
+		"status":       models.OutboxStatusManualReview,
+		"last_error":   lastError,
+		"locked_until": nil,
+		"completed_at": time.Now(),
+	})
+}
+
+// finish 以任务仍由 owner 持有作为条件更新任务，租约过期后被其他实例重新领取的任务不会被覆盖
+func (r *orderOutboxRepository) finish(ctx context.Context, id uint, owner string, updates map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OrderOutboxTask{}).
+		Where("id = ? AND status = ? AND locked_by = ?", id, models.OutboxStatusRunning, owner).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -11,13 +11,17 @@ import (
 
 // OrderRepository 订单仓储接口
 type OrderRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) OrderRepository
 	Create(ctx context.Context, order *models.Order) error
 	GetByID(ctx context.Context, id uint) (*models.Order, error)
 	GetByIDs(ctx context.Context, id []uint) ([]*models.Order, error)
 	GetByOrderNo(ctx context.Context, orderNo string) (*models.Order, error)
 	GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.Order, error)
+	// Update 更新订单，不写入状态字段（状态只能通过订单状态机流转）和同步租约字段
 	Update(ctx context.Context, order *models.Order) error
-	UpdateStatus(ctx context.Context, id uint, status models.OrderStatus) error
+	// TransitionStatus 仅当订单仍处于 from 状态时更新状态及 updates 中的其他字段，返回是否更新成功
+	TransitionStatus(ctx context.Context, id uint, from, to models.OrderStatus, updates map[string]interface{}) (bool, error)
 	Delete(ctx context.Context, id uint) error
 	CountByUserID(ctx context.Context, userID int64) (int64, error)
 	GetUserOrderByID(ctx context.Context, userID int64, orderID uint) (*models.Order, error)
@@ -26,20 +30,30 @@ type OrderRepository interface {
 	// GetByIDWithDetail 根据ID获取订单（包含详情）
 	GetByIDWithDetail(ctx context.Context, id uint) (*models.Order, error)
 
-	// GetPendingSyncOrders 获取需要同步的待处理订单
-	GetPendingSyncOrders(ctx context.Context, limit int) ([]*models.Order, error)
+	// ClaimPendingSyncOrders 领取到达下次同步时间且未被其他实例领取（或租约已过期）的待处理订单，
+	// 领取后 lease 时长内其他实例不会再领取同一订单
+	ClaimPendingSyncOrders(ctx context.Context, owner string, lease time.Duration, limit int) ([]*models.Order, error)
+
+	// ClaimSyncOrder 领取指定订单的同步租约，订单已被其他实例领取且租约未过期时返回 false
+	ClaimSyncOrder(ctx context.Context, id uint, owner string, lease time.Duration) (bool, error)
+
+	// ReleaseSyncClaim 释放 owner 持有的同步租约
+	ReleaseSyncClaim(ctx context.Context, id uint, owner string) error
 
 	// UpdateSyncInfo 更新订单同步信息
 	UpdateSyncInfo(ctx context.Context, id uint, syncAttempts int, nextSyncAt *time.Time) error
 
+	// SetProviderOrder 仅当订单尚未关联第三方订单时写入第三方订单ID和订单号，返回是否更新成功
+	SetProviderOrder(ctx context.Context, id uint, providerOrderID, providerOrderNo string) (bool, error)
+
 	// GetByProviderOrderID 根据第三方订单ID获取订单
 	GetByProviderOrderID(ctx context.Context, providerOrderID string) (*models.Order, error)
 
-	// BatchUpdateStatus 批量更新订单状态
-	BatchUpdateStatus(ctx context.Context, orderIDs []uint, status models.OrderStatus) error
-
 	// GetByUserIDWithFilters 根据用户ID和筛选条件获取订单列表
 	GetByUserIDWithFilters(ctx context.Context, userID int64, status models.OrderStatus, limit, offset int) ([]*models.Order, int64, error)
+
+	// GetByUserIDAndStatuses 获取用户指定状态的全部订单（对账使用）
+	GetByUserIDAndStatuses(ctx context.Context, userID int64, statuses []models.OrderStatus) ([]*models.Order, error)
 }
 
 // orderRepository 订单仓储实现
@@ -52,6 +66,11 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
+// WithTx 返回绑定到指定事务的仓储
+func (r *orderRepository) WithTx(tx *gorm.DB) OrderRepository {
+	return &orderRepository{db: tx}
+}
+
 // Create 创建订单
 func (r *orderRepository) Create(ctx context.Context, order *models.Order) error {
 	return r.db.WithContext(ctx).Create(order).Error
@@ -98,16 +117,36 @@ func (r *orderRepository) GetByUserID(ctx context.Context, userID int64, limit,
 	return orders, err
 }
 
-// Update 更新订单
+// GetByUserIDAndStatuses 获取用户指定状态的全部订单（对账使用）
+func (r *orderRepository) GetByUserIDAndStatuses(ctx context.Context, userID int64, statuses []models.OrderStatus) ([]*models.Order, error) {
+	var orders []*models.Order
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, statuses).
+		Order("id ASC").
+		Find(&orders).Error
+	return orders, err
+}
+
+// Update 更新订单（不写入状态和同步租约字段）
 func (r *orderRepository) Update(ctx context.Context, order *models.Order) error {
-	return r.db.WithContext(ctx).Save(order).Error
+	return r.db.WithContext(ctx).Omit("status", "claimed_by", "claimed_until").Save(order).Error
 }
 
-// UpdateStatus 更新订单状态
-func (r *orderRepository) UpdateStatus(ctx context.Context, id uint, status models.OrderStatus) error {
-	return r.db.WithContext(ctx).Model(&models.Order{}).
-		Where("id = ?", id).
-		Update("status", status).Error
+// TransitionStatus 流转订单状态
+// 以当前状态作为条件更新，并发流转时只有一个请求会成功
+func (r *orderRepository) TransitionStatus(ctx context.Context, id uint, from, to models.OrderStatus, updates map[string]interface{}) (bool, error) {
+	values := map[string]interface{}{"status": to}
+	for column, value := range updates {
+		values[column] = value
+	}
+
+	result := r.db.WithContext(ctx).Model(&models.Order{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(values)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
 }
 
 // Delete 删除订单
@@ -135,20 +174,72 @@ func (r *orderRepository) GetByIDWithDetail(ctx context.Context, id uint) (*mode
 	return &order, nil
 }
 
-// GetPendingSyncOrders 获取需要同步的待处理订单
-func (r *orderRepository) GetPendingSyncOrders(ctx context.Context, limit int) ([]*models.Order, error) {
-	var orders []*models.Order
-	query := r.db.WithContext(ctx).
-		Where("status = ? AND provider_order_id != ''", models.OrderStatusProcessing).
-		Where("next_sync_at IS NULL OR next_sync_at <= ?", time.Now()).
-		Order("created_at ASC")
+// ClaimPendingSyncOrders 领取需要同步的待处理订单
+// 先查询候选订单，再逐个以相同条件更新 claimed_by/claimed_until，更新行数为 0 说明已被其他实例领取，
+// MySQL 和 SQLite 下行为一致，不依赖 SELECT ... FOR UPDATE SKIP LOCKED
+func (r *orderRepository) ClaimPendingSyncOrders(ctx context.Context, owner string, lease time.Duration, limit int) ([]*models.Order, error) {
+	now := time.Now()
+	due := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND provider_order_id != ''", models.OrderStatusProcessing).
+			Where("next_sync_at IS NULL OR next_sync_at <= ?", now).
+			Where("claimed_until IS NULL OR claimed_until < ?", now)
+	}
 
+	var candidates []*models.Order
+	query := due(r.db.WithContext(ctx)).Order("created_at ASC")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
 
-	err := query.Find(&orders).Error
-	return orders, err
+	claimedUntil := now.Add(lease)
+	claimed := make([]*models.Order, 0, len(candidates))
+	for _, order := range candidates {
+		result := due(r.db.WithContext(ctx).Model(&models.Order{})).
+			Where("id = ?", order.ID).
+			Updates(map[string]interface{}{
+				"claimed_by":    owner,
+				"claimed_until": claimedUntil,
+			})
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue // 已被其他实例领取
+		}
+		order.ClaimedBy = owner
+		order.ClaimedUntil = &claimedUntil
+		claimed = append(claimed, order)
+	}
+	return claimed, nil
+}
+
+// ClaimSyncOrder 领取指定订单的同步租约（Webhook 等按事件处理单个订单时使用）
+func (r *orderRepository) ClaimSyncOrder(ctx context.Context, id uint, owner string, lease time.Duration) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Order{}).
+		Where("id = ?", id).
+		Where("claimed_until IS NULL OR claimed_until < ?", now).
+		Updates(map[string]interface{}{
+			"claimed_by":    owner,
+			"claimed_until": now.Add(lease),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseSyncClaim 释放同步租约，租约已过期并被其他实例领取时不做修改
+func (r *orderRepository) ReleaseSyncClaim(ctx context.Context, id uint, owner string) error {
+	return r.db.WithContext(ctx).Model(&models.Order{}).
+		Where("id = ? AND claimed_by = ?", id, owner).
+		Updates(map[string]interface{}{
+			"claimed_by":    "",
+			"claimed_until": nil,
+		}).Error
 }
 
 // UpdateSyncInfo 更新订单同步信息
@@ -179,29 +270,6 @@ func (r *orderRepository) GetByProviderOrderID(ctx context.Context, providerOrde
 	return &order, nil
 }
 
-// BatchUpdateStatus 批量更新订单状态
-func (r *orderRepository) BatchUpdateStatus(ctx context.Context, orderIDs []uint, status models.OrderStatus) error {
-	if len(orderIDs) == 0 {
-		return nil
-	}
-
-	updates := map[string]interface{}{
-		"status": status,
-	}
-
-	// 根据状态设置相应的时间戳
-	switch status {
-	case models.OrderStatusCompleted:
-		updates["completed_at"] = time.Now()
-	case models.OrderStatusPaid:
-		updates["paid_at"] = time.Now()
-	}
-
-	return r.db.WithContext(ctx).Model(&models.Order{}).
-		Where("id IN ?", orderIDs).
-		Updates(updates).Error
-}
-
 // GetByUserIDWithFilters 根据用户ID和筛选条件获取订单列表
 func (r *orderRepository) GetByUserIDWithFilters(ctx context.Context, userID int64, status models.OrderStatus, limit, offset int) ([]*models.Order, int64, error) {
 	var orders []*models.Order
@@ -253,3 +321,18 @@ func (r *orderRepository) GetByIDs(ctx context.Context, id []uint) ([]*models.Or
 	}
 	return orders, nil
 }
+
+// SetProviderOrder 写入第三方订单信息
+// 以 provider_order_id 为空作为条件，重复执行的发件箱任务不会覆盖已保存的第三方订单
+func (r *orderRepository) SetProviderOrder(ctx context.Context, id uint, providerOrderID, providerOrderNo string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Order{}).
+		Where("id = ? AND provider_order_id = ''", id).
+		Updates(map[string]interface{}{
+			"provider_order_id": providerOrderID,
+			"provider_order_no": providerOrderNo,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// OrderSyncErrorRepository 订单同步失败记录仓储接口
+type OrderSyncErrorRepository interface {
+	// Create 写入同步失败记录
+	Create(ctx context.Context, syncError *models.OrderSyncError) error
+	// GetRecentByOrderID 获取订单最近的同步失败记录，按时间倒序排列
+	GetRecentByOrderID(ctx context.Context, orderID uint, limit int) ([]*models.OrderSyncError, error)
+}
+
+// orderSyncErrorRepository 订单同步失败记录仓储实现
+type orderSyncErrorRepository struct {
+	db *gorm.DB
+}
+
+// NewOrderSyncErrorRepository 创建订单同步失败记录仓储实例
+func NewOrderSyncErrorRepository(db *gorm.DB) OrderSyncErrorRepository {
+	return &orderSyncErrorRepository{db: db}
+}
+
+// Create 写入同步失败记录
+func (r *orderSyncErrorRepository) Create(ctx context.Context, syncError *models.OrderSyncError) error {
+	return r.db.WithContext(ctx).Create(syncError).Error
+}
+
+// GetRecentByOrderID 获取订单最近的同步失败记录
+func (r *orderSyncErrorRepository) GetRecentByOrderID(ctx context.Context, orderID uint, limit int) ([]*models.OrderSyncError, error) {
+	var syncErrors []*models.OrderSyncError
+	query := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&syncErrors).Error
+	return syncErrors, err
+}
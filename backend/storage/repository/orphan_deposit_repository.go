@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrphanDepositRepository 孤儿充值仓储接口
+type OrphanDepositRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) OrphanDepositRepository
+	// CreateIfNotExists 按交易哈希去重创建记录，返回是否新建
+	CreateIfNotExists(ctx context.Context, deposit *models.OrphanDeposit) (bool, error)
+	// GetByID 获取孤儿充值，不存在时返回 gorm.ErrRecordNotFound
+	GetByID(ctx context.Context, id uint) (*models.OrphanDeposit, error)
+	// GetByStatus 按状态获取孤儿充值，status 为空时返回全部
+	GetByStatus(ctx context.Context, status string, limit, offset int) ([]*models.OrphanDeposit, error)
+	// MarkAssigned 仅当记录仍待处理时写入分配信息，返回是否更新成功
+	MarkAssigned(ctx context.Context, deposit *models.OrphanDeposit) (bool, error)
+}
+
+// orphanDepositRepository 孤儿充值仓储实现
+type orphanDepositRepository struct {
+	db *gorm.DB
+}
+
+// NewOrphanDepositRepository 创建孤儿充值仓储实例
+func NewOrphanDepositRepository(db *gorm.DB) OrphanDepositRepository {
+	return &orphanDepositRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *orphanDepositRepository) WithTx(tx *gorm.DB) OrphanDepositRepository {
+	return &orphanDepositRepository{db: tx}
+}
+
+// CreateIfNotExists 按交易哈希去重创建孤儿充值
+func (r *orphanDepositRepository) CreateIfNotExists(ctx context.Context, deposit *models.OrphanDeposit) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "tx_hash"}}, DoNothing: true}).
+		Create(deposit)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetByID 获取孤儿充值
+func (r *orphanDepositRepository) GetByID(ctx context.Context, id uint) (*models.OrphanDeposit, error) {
+	var deposit models.OrphanDeposit
+	err := r.db.WithContext(ctx).First(&deposit, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deposit, nil
+}
+
+// GetByStatus 按状态获取孤儿充值
+func (r *orphanDepositRepository) GetByStatus(ctx context.Context, status string, limit, offset int) ([]*models.OrphanDeposit, error) {
+	var deposits []*models.OrphanDeposit
+	query := r.db.WithContext(ctx).Order("created_at ASC, id ASC")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&deposits).Error
+	return deposits, err
+}
+
+// MarkAssigned 写入分配信息
+// 以待处理状态作为条件更新，保证同一笔孤儿充值只会被分配一次
+func (r *orphanDepositRepository) MarkAssigned(ctx context.Context, deposit *models.OrphanDeposit) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OrphanDeposit{}).
+		Where("id = ? AND status = ?", deposit.ID, models.OrphanStatusPending).
+		Updates(map[string]interface{}{
+			"status":           models.OrphanStatusAssigned,
+			"assigned_user_id": deposit.AssignedUserID,
+			"credited_amount":  deposit.CreditedAmount,
+			"operator":         deposit.Operator,
+			"note":             deposit.Note,
+			"assigned_at":      deposit.AssignedAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// ProviderWebhookNonceRepository 第三方 Webhook nonce 仓储接口
+type ProviderWebhookNonceRepository interface {
+	// Create 记录 nonce，nonce 已存在时返回 false（重放请求）
+	Create(ctx context.Context, nonce *models.ProviderWebhookNonce) (bool, error)
+	// Delete 删除 nonce，处理失败时调用以允许第三方重试
+	Delete(ctx context.Context, nonce string) error
+	// DeleteBefore 清理指定时间之前的 nonce，返回删除条数
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// providerWebhookNonceRepository 第三方 Webhook nonce 仓储实现
+type providerWebhookNonceRepository struct {
+	db *gorm.DB
+}
+
+// NewProviderWebhookNonceRepository 创建第三方 Webhook nonce 仓储实例
+func NewProviderWebhookNonceRepository(db *gorm.DB) ProviderWebhookNonceRepository {
+	return &providerWebhookNonceRepository{db: db}
+}
+
+// Create 记录 nonce
+func (r *providerWebhookNonceRepository) Create(ctx context.Context, nonce *models.ProviderWebhookNonce) (bool, error) {
+	if err := r.db.WithContext(ctx).Create(nonce).Error; err != nil {
+		if IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete 删除 nonce
+func (r *providerWebhookNonceRepository) Delete(ctx context.Context, nonce string) error {
+	return r.db.WithContext(ctx).Where("nonce = ?", nonce).Delete(&models.ProviderWebhookNonce{}).Error
+}
+
+// DeleteBefore 清理指定时间之前的 nonce
+func (r *providerWebhookNonceRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.ProviderWebhookNonce{})
+	return result.RowsAffected, result.Error
+}
@@ -18,11 +18,25 @@ type RechargeOrderRepository interface {
 	GetByTxHash(ctx context.Context, txHash string) (*models.RechargeOrder, error)
 	GetByExactAmount(ctx context.Context, exactAmount string) (*models.RechargeOrder, error)
 	GetPendingOrders(ctx context.Context) ([]*models.RechargeOrder, error)
-	IsExactAmountExists(ctx context.Context, exactAmount string) (bool, error)
+	// GetExpiredSince 获取过期时间在 since 之后、已过期但未确认的订单（匹配逾期到账使用）
+	GetExpiredSince(ctx context.Context, since time.Time) ([]*models.RechargeOrder, error)
+	// GetUnverifiedSince 获取确认时间在 since 之后、尚未通过入账后复核的已确认订单
+	GetUnverifiedSince(ctx context.Context, since time.Time) ([]*models.RechargeOrder, error)
+	// IsExactAmountExists 检查同一资产进行中的订单是否已使用该精确金额
+	IsExactAmountExists(ctx context.Context, asset string, exactAmount string) (bool, error)
 	Update(ctx context.Context, order *models.RechargeOrder) error
 	UpdateStatus(ctx context.Context, id uint, status models.RechargeStatus) error
+	// MarkVerified 将已确认的订单标记为入账后复核通过，订单状态已变更时返回 false
+	MarkVerified(ctx context.Context, id uint, verifiedAt time.Time) (bool, error)
+	// RecordReverifyMiss 已确认订单的复核连续查不到交易次数加一，返回累计次数
+	RecordReverifyMiss(ctx context.Context, id uint) (int, error)
+	// ResetReverifyMiss 复核查到交易时清零连续查不到的次数
+	ResetReverifyMiss(ctx context.Context, id uint) error
 	Delete(ctx context.Context, id uint) error
 	ExpireOldOrders(ctx context.Context) error
+
+	// GetByUserIDAndStatus 获取用户指定状态的全部充值订单（对账使用）
+	GetByUserIDAndStatus(ctx context.Context, userID int64, status models.RechargeStatus) ([]*models.RechargeOrder, error)
 }
 
 // rechargeOrderRepository 充值订单仓储实现
@@ -81,6 +95,16 @@ func (r *rechargeOrderRepository) GetByUserID(ctx context.Context, userID int64,
 	return orders, err
 }
 
+// GetByUserIDAndStatus 获取用户指定状态的全部充值订单（对账使用）
+func (r *rechargeOrderRepository) GetByUserIDAndStatus(ctx context.Context, userID int64, status models.RechargeStatus) ([]*models.RechargeOrder, error) {
+	var orders []*models.RechargeOrder
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status = ?", userID, status).
+		Order("id ASC").
+		Find(&orders).Error
+	return orders, err
+}
+
 // GetByTxHash 根据交易哈希获取充值订单
 func (r *rechargeOrderRepository) GetByTxHash(ctx context.Context, txHash string) (*models.RechargeOrder, error) {
 	var order models.RechargeOrder
@@ -118,6 +142,30 @@ func (r *rechargeOrderRepository) GetPendingOrders(ctx context.Context) ([]*mode
 	return orders, err
 }
 
+// GetExpiredSince 获取最近过期的充值订单
+func (r *rechargeOrderRepository) GetExpiredSince(ctx context.Context, since time.Time) ([]*models.RechargeOrder, error) {
+	var orders []*models.RechargeOrder
+	err := r.db.WithContext(ctx).
+		Where("status = ?", models.RechargeStatusExpired).
+		Where("expires_at > ?", since).
+		Order("expires_at DESC").
+		Find(&orders).Error
+	return orders, err
+}
+
+// GetUnverifiedSince 获取待复核的已确认充值订单
+func (r *rechargeOrderRepository) GetUnverifiedSince(ctx context.Context, since time.Time) ([]*models.RechargeOrder, error) {
+	var orders []*models.RechargeOrder
+	err := r.db.WithContext(ctx).
+		Where("status = ?", models.RechargeStatusConfirmed).
+		Where("verified_at IS NULL").
+		Where("tx_hash <> ''").
+		Where("confirmed_at > ?", since).
+		Order("confirmed_at ASC").
+		Find(&orders).Error
+	return orders, err
+}
+
 // Update 更新充值订单
 func (r *rechargeOrderRepository) Update(ctx context.Context, order *models.RechargeOrder) error {
 	return r.db.WithContext(ctx).Save(order).Error
@@ -130,6 +178,39 @@ func (r *rechargeOrderRepository) UpdateStatus(ctx context.Context, id uint, sta
 		Update("status", status).Error
 }
 
+// MarkVerified 以已确认状态为条件标记复核通过
+func (r *rechargeOrderRepository) MarkVerified(ctx context.Context, id uint, verifiedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RechargeOrder{}).
+		Where("id = ? AND status = ?", id, models.RechargeStatusConfirmed).
+		Update("verified_at", verifiedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RecordReverifyMiss 累计复核连续查不到交易的次数
+func (r *rechargeOrderRepository) RecordReverifyMiss(ctx context.Context, id uint) (int, error) {
+	err := r.db.WithContext(ctx).Model(&models.RechargeOrder{}).
+		Where("id = ? AND status = ?", id, models.RechargeStatusConfirmed).
+		UpdateColumn("reverify_miss", gorm.Expr("reverify_miss + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	var order models.RechargeOrder
+	if err := r.db.WithContext(ctx).Select("reverify_miss").Where("id = ?", id).First(&order).Error; err != nil {
+		return 0, err
+	}
+	return order.ReverifyMiss, nil
+}
+
+// ResetReverifyMiss 清零复核连续查不到交易的次数
+func (r *rechargeOrderRepository) ResetReverifyMiss(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.RechargeOrder{}).
+		Where("id = ? AND reverify_miss > 0", id).
+		UpdateColumn("reverify_miss", 0).Error
+}
+
 // Delete 删除充值订单
 func (r *rechargeOrderRepository) Delete(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&models.RechargeOrder{}, id).Error
@@ -143,11 +224,11 @@ func (r *rechargeOrderRepository) ExpireOldOrders(ctx context.Context) error {
 		Update("status", models.RechargeStatusExpired).Error
 }
 
-// IsExactAmountExists 检查精确金额是否在进行中的订单中存在
-func (r *rechargeOrderRepository) IsExactAmountExists(ctx context.Context, exactAmount string) (bool, error) {
+// IsExactAmountExists 检查同一资产进行中的订单是否已使用该精确金额
+func (r *rechargeOrderRepository) IsExactAmountExists(ctx context.Context, asset string, exactAmount string) (bool, error) {
 	var count int64
 	err := r.db.WithContext(ctx).Model(&models.RechargeOrder{}).
-		Where("exact_amount = ?", exactAmount).
+		Where("asset = ? AND exact_amount = ?", asset, exactAmount).
 		Where("status = ?", models.RechargeStatusPending).
 		Where("expires_at > ?", time.Now()).
 		Count(&count).Error
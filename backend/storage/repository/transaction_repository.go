@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TransactionRepository 交易仓库接口
@@ -18,6 +19,14 @@ type TransactionRepository interface {
 	GetByAddress(ctx context.Context, address string, limit int) ([]*models.Transaction, error)
 	GetPendingTransactions(ctx context.Context) ([]*models.Transaction, error)
 	UpdateStatus(ctx context.Context, txHash string, status models.TransactionStatus, confirmations int) error
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) TransactionRepository
+	// CreateIfNotExists 按交易哈希去重写入，已存在时不修改并返回 false
+	CreateIfNotExists(ctx context.Context, tx *models.Transaction) (bool, error)
+	// GetUnprocessed 获取收款地址上尚未与充值订单匹配的交易（按区块时间升序）
+	GetUnprocessed(ctx context.Context, chain, toAddress string) ([]*models.Transaction, error)
+	// MarkProcessed 标记交易已完成匹配，rechargeNo 为空表示没有匹配到订单
+	MarkProcessed(ctx context.Context, id uint, rechargeNo string) error
 }
 
 // transactionRepository 交易仓库实现
@@ -30,6 +39,11 @@ func NewTransactionRepository(db *gorm.DB) TransactionRepository {
 	return &transactionRepository{db: db}
 }
 
+// WithTx 返回绑定到指定事务的仓储
+func (r *transactionRepository) WithTx(tx *gorm.DB) TransactionRepository {
+	return &transactionRepository{db: tx}
+}
+
 func (r *transactionRepository) Create(ctx context.Context, tx *models.Transaction) error {
 	return r.db.WithContext(ctx).Create(tx).Error
 }
@@ -88,3 +102,37 @@ func (r *transactionRepository) UpdateStatus(ctx context.Context, txHash string,
 			"updated_at":    time.Now(),
 		}).Error
 }
+
+// CreateIfNotExists 按交易哈希去重写入
+func (r *transactionRepository) CreateIfNotExists(ctx context.Context, tx *models.Transaction) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "tx_hash"}}, DoNothing: true}).
+		Create(tx)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetUnprocessed 获取收款地址上尚未与充值订单匹配的交易
+func (r *transactionRepository) GetUnprocessed(ctx context.Context, chain, toAddress string) ([]*models.Transaction, error) {
+	var transactions []*models.Transaction
+	err := r.db.WithContext(ctx).
+		Where("chain = ? AND to_address = ? AND processed_at IS NULL", chain, toAddress).
+		Order("timestamp ASC, id ASC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// MarkProcessed 标记交易已完成匹配
+func (r *transactionRepository) MarkProcessed(ctx context.Context, id uint, rechargeNo string) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).
+		Model(&models.Transaction{}).
+		Where("id = ? AND processed_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"recharge_no":  rechargeNo,
+			"processed_at": now,
+			"updated_at":   now,
+		}).Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// UserEventRepository 用户实时事件仓储接口
+type UserEventRepository interface {
+	// Create 写入事件
+	Create(ctx context.Context, event *models.UserEventRecord) error
+	// ListAfter 按 ID 升序获取 afterID 之后的事件
+	ListAfter(ctx context.Context, afterID uint, limit int) ([]*models.UserEventRecord, error)
+	// LatestID 获取最新事件的 ID，没有事件时返回 0
+	LatestID(ctx context.Context) (uint, error)
+	// DeleteBefore 清理指定时间之前的事件，返回删除条数
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// userEventRepository 用户实时事件仓储实现
+type userEventRepository struct {
+	db *gorm.DB
+}
+
+// NewUserEventRepository 创建用户实时事件仓储实例
+func NewUserEventRepository(db *gorm.DB) UserEventRepository {
+	return &userEventRepository{db: db}
+}
+
+// Create 写入事件
+func (r *userEventRepository) Create(ctx context.Context, event *models.UserEventRecord) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// ListAfter 按 ID 升序获取 afterID 之后的事件
+func (r *userEventRepository) ListAfter(ctx context.Context, afterID uint, limit int) ([]*models.UserEventRecord, error) {
+	var events []*models.UserEventRecord
+	query := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// LatestID 获取最新事件的 ID
+func (r *userEventRepository) LatestID(ctx context.Context) (uint, error) {
+	var id uint
+	err := r.db.WithContext(ctx).Model(&models.UserEventRecord{}).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&id).Error
+	return id, err
+}
+
+// DeleteBefore 清理指定时间之前的事件
+func (r *userEventRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.UserEventRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -10,6 +12,9 @@ import (
 
 // UserRepository 用户仓库接口
 type UserRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) UserRepository
+
 	Create(ctx context.Context, user *models.User) error
 	GetByTelegramID(ctx context.Context, telegramID int64) (*models.User, error)
 	GetByID(ctx context.Context, id int64) (*models.User, error)
@@ -17,6 +22,14 @@ type UserRepository interface {
 	Delete(ctx context.Context, id int64) error
 	List(ctx context.Context, limit, offset int) ([]*models.User, error)
 	GetByTelegramIDs(ctx context.Context, telegramIDs []int64) ([]*models.User, error)
+	// GetByUsername 根据 Telegram 用户名获取用户（忽略大小写和开头的 @）
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// SetReferrer 仅当用户尚未绑定邀请人时设置邀请人，返回是否设置成功
+	SetReferrer(ctx context.Context, telegramID, referrerID int64) (bool, error)
+	// MarkReferralRewarded 仅当邀请奖励尚未发放时标记为已发放，返回是否标记成功
+	MarkReferralRewarded(ctx context.Context, telegramID int64) (bool, error)
+	// CountReferrals 统计用户邀请的人数和其中已发放奖励（首单已完成）的人数
+	CountReferrals(ctx context.Context, referrerID int64) (invited int64, rewarded int64, err error)
 }
 
 // userRepository 用户仓库实现
@@ -29,6 +42,11 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
+// WithTx 返回绑定到指定事务的仓储
+func (r *userRepository) WithTx(tx *gorm.DB) UserRepository {
+	return &userRepository{db: tx}
+}
+
 func (r *userRepository) Create(ctx context.Context, user *models.User) error {
 	return r.db.WithContext(ctx).Create(user).Error
 }
@@ -79,3 +97,67 @@ func (r *userRepository) GetByTelegramIDs(ctx context.Context, telegramIDs []int
 	}
 	return users, nil
 }
+
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var user models.User
+	err := r.db.WithContext(ctx).
+		Where("LOWER(username) = ?", strings.ToLower(username)).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetReferrer 仅当用户尚未绑定邀请人时设置邀请人
+// 以 referred_by = 0 作为更新条件，邀请关系一经绑定不会被覆盖
+func (r *userRepository) SetReferrer(ctx context.Context, telegramID, referrerID int64) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("telegram_id = ? AND referred_by = 0", telegramID).
+		Updates(map[string]interface{}{
+			"referred_by": referrerID,
+			"referred_at": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// MarkReferralRewarded 仅当邀请奖励尚未发放时标记为已发放
+func (r *userRepository) MarkReferralRewarded(ctx context.Context, telegramID int64) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("telegram_id = ? AND referred_by <> 0 AND rewarded_at IS NULL", telegramID).
+		Updates(map[string]interface{}{
+			"rewarded_at": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountReferrals 统计用户邀请的人数和其中已发放奖励的人数
+func (r *userRepository) CountReferrals(ctx context.Context, referrerID int64) (int64, int64, error) {
+	var invited, rewarded int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("referred_by = ?", referrerID).
+		Count(&invited).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("referred_by = ? AND rewarded_at IS NOT NULL", referrerID).
+		Count(&rewarded).Error; err != nil {
+		return 0, 0, err
+	}
+	return invited, rewarded, nil
+}
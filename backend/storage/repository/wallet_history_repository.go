@@ -18,11 +18,15 @@ type WalletHistoryRepository interface {
 	GetByUserIDAndStatus(ctx context.Context, userID int64, status models.WalletHistoryStatus, limit, offset int) ([]*models.WalletHistory, error)
 	GetByUserIDAndDateRange(ctx context.Context, userID int64, startDate, endDate time.Time, limit, offset int) ([]*models.WalletHistory, error)
 	GetByRelated(ctx context.Context, relatedType, relatedID string) (*models.WalletHistory, error)
+	// GetLatestCompletedBefore 获取用户在指定时间之前的最后一条已完成记录，用于确定期初余额
+	GetLatestCompletedBefore(ctx context.Context, userID int64, before time.Time) (*models.WalletHistory, error)
 	Update(ctx context.Context, history *models.WalletHistory) error
 	UpdateStatus(ctx context.Context, id uint, status models.WalletHistoryStatus) error
 	Delete(ctx context.Context, id uint) error
 	CountByUserID(ctx context.Context, userID int64) (int64, error)
 	GetStatsByUserID(ctx context.Context, userID int64) (map[string]interface{}, error)
+	// SumAmountByUserIDAndType 统计用户某类型已完成记录的金额合计
+	SumAmountByUserIDAndType(ctx context.Context, userID int64, historyType models.WalletHistoryType) (string, error)
 }
 
 // walletHistoryRepository 钱包历史仓储实现
@@ -134,6 +138,19 @@ func (r *walletHistoryRepository) GetByRelated(ctx context.Context, relatedType,
 	return &history, nil
 }
 
+// GetLatestCompletedBefore 获取用户在指定时间之前的最后一条已完成记录
+func (r *walletHistoryRepository) GetLatestCompletedBefore(ctx context.Context, userID int64, before time.Time) (*models.WalletHistory, error) {
+	var history models.WalletHistory
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status = ? AND created_at < ?", userID, models.WalletHistoryStatusCompleted, before).
+		Order("created_at DESC, id DESC").
+		First(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
 // Update 更新钱包历史记录
 func (r *walletHistoryRepository) Update(ctx context.Context, history *models.WalletHistory) error {
 	return r.db.WithContext(ctx).Save(history).Error
@@ -176,27 +193,30 @@ func (r *walletHistoryRepository) GetStatsByUserID(ctx context.Context, userID i
 	}
 	stats["total_records"] = count
 
-	// 统计收入总额（充值、退款、解冻）
+	// 统计收入总额（充值、退款、转入、邀请奖励）
 	var totalIncome string
 	err = r.db.WithContext(ctx).Model(&models.WalletHistory{}).
 		Select("COALESCE(SUM(CAST(amount AS DECIMAL(10,2))), 0)").
-		Where("user_id = ? AND type IN (?, ?, ?) AND status = ?",
+		Where("user_id = ? AND type IN (?, ?, ?, ?) AND status = ?",
 			userID,
 			models.WalletHistoryTypeRecharge,
 			models.WalletHistoryTypeRefund,
+			models.WalletHistoryTypeTransferIn,
+			models.WalletHistoryTypeReferral,
 			models.WalletHistoryStatusCompleted).
 		Scan(&totalIncome).Error
 	if err == nil {
 		stats["total_income"] = totalIncome
 	}
 
-	// 统计支出总额（支付、冻结）
+	// 统计支出总额（支付、转出）
 	var totalExpense string
 	err = r.db.WithContext(ctx).Model(&models.WalletHistory{}).
 		Select("COALESCE(ABS(SUM(CAST(amount AS DECIMAL(10,2)))), 0)").
 		Where("user_id = ? AND type IN (?, ?) AND status = ?",
 			userID,
 			models.WalletHistoryTypePayment,
+			models.WalletHistoryTypeTransferOut,
 			models.WalletHistoryStatusCompleted).
 		Scan(&totalExpense).Error
 	if err == nil {
@@ -225,3 +245,13 @@ func (r *walletHistoryRepository) GetStatsByUserID(ctx context.Context, userID i
 
 	return stats, nil
 }
+
+// SumAmountByUserIDAndType 统计用户某类型已完成记录的金额合计
+func (r *walletHistoryRepository) SumAmountByUserIDAndType(ctx context.Context, userID int64, historyType models.WalletHistoryType) (string, error) {
+	var total string
+	err := r.db.WithContext(ctx).Model(&models.WalletHistory{}).
+		Select("COALESCE(SUM(CAST(amount AS DECIMAL(10,2))), 0)").
+		Where("user_id = ? AND type = ? AND status = ?", userID, historyType, models.WalletHistoryStatusCompleted).
+		Scan(&total).Error
+	return total, err
+}
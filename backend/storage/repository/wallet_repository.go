@@ -4,17 +4,25 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"time"
 
 	"tg-robot-sim/storage/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // WalletRepository 钱包仓储接口
+// 钱包按 (用户, 资产) 唯一，未指明资产的方法均操作计价币种钱包
 type WalletRepository interface {
 	Create(ctx context.Context, wallet *models.Wallet) error
 	GetByUserID(ctx context.Context, userID int64) (*models.Wallet, error)
+	// GetByUserIDAndAsset 获取用户指定资产的钱包
+	GetByUserIDAndAsset(ctx context.Context, userID int64, asset string) (*models.Wallet, error)
+	// ListByUserID 获取用户所有资产的钱包
+	ListByUserID(ctx context.Context, userID int64) ([]*models.Wallet, error)
 	GetOrCreate(ctx context.Context, userID int64) (*models.Wallet, error)
+	// Update 按版本号比较并更新钱包（CAS），版本不一致时返回 ErrVersionConflict
 	Update(ctx context.Context, wallet *models.Wallet) error
 	UpdateBalance(ctx context.Context, userID int64, balance, frozenBalance string) error
 	Delete(ctx context.Context, id uint) error
@@ -22,6 +30,14 @@ type WalletRepository interface {
 	// 新增方法用于原子操作
 	// UpdateBalanceAtomic 原子性更新余额（带乐观锁）
 	UpdateBalanceAtomic(ctx context.Context, userID int64, balanceDelta, frozenDelta string) error
+
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) WalletRepository
+	// GetOrCreateForUpdate 获取（不存在则创建）钱包并加行锁，需在事务中调用
+	GetOrCreateForUpdate(ctx context.Context, userID int64) (*models.Wallet, error)
+
+	// GetAllUserIDs 获取所有钱包的用户ID
+	GetAllUserIDs(ctx context.Context) ([]int64, error)
 }
 
 // walletRepository 钱包仓储实现
@@ -34,36 +50,84 @@ func NewWalletRepository(db *gorm.DB) WalletRepository {
 	return &walletRepository{db: db}
 }
 
+// WithTx 返回绑定到指定事务的仓储
+func (r *walletRepository) WithTx(tx *gorm.DB) WalletRepository {
+	return &walletRepository{db: tx}
+}
+
 // Create 创建钱包
 func (r *walletRepository) Create(ctx context.Context, wallet *models.Wallet) error {
 	return r.db.WithContext(ctx).Create(wallet).Error
 }
 
-// GetByUserID 根据用户ID获取钱包
+// GetByUserID 根据用户ID获取计价币种钱包
 func (r *walletRepository) GetByUserID(ctx context.Context, userID int64) (*models.Wallet, error) {
+	return r.GetByUserIDAndAsset(ctx, userID, models.PricingCurrency)
+}
+
+// GetByUserIDAndAsset 获取用户指定资产的钱包
+func (r *walletRepository) GetByUserIDAndAsset(ctx context.Context, userID int64, asset string) (*models.Wallet, error) {
 	var wallet models.Wallet
-	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&wallet).Error
+	err := r.db.WithContext(ctx).Where("user_id = ? AND asset = ?", userID, asset).First(&wallet).Error
 	if err != nil {
 		return nil, err
 	}
 	return &wallet, nil
 }
 
-// Update 更新钱包
+// ListByUserID 获取用户所有资产的钱包
+func (r *walletRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.Wallet, error) {
+	var wallets []*models.Wallet
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&wallets).Error
+	return wallets, err
+}
+
+// Update 按版本号比较并更新钱包（CAS），版本不一致时返回 ErrVersionConflict
 func (r *walletRepository) Update(ctx context.Context, wallet *models.Wallet) error {
-	return r.db.WithContext(ctx).Save(wallet).Error
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Wallet{}).
+		Where("id = ? AND version = ?", wallet.ID, wallet.Version).
+		Updates(map[string]interface{}{
+			"balance":        wallet.Balance,
+			"frozen_balance": wallet.FrozenBalance,
+			"total_income":   wallet.TotalIncome,
+			"total_expense":  wallet.TotalExpense,
+			"version":        gorm.Expr("version + 1"),
+			"updated_at":     now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	wallet.Version++
+	wallet.UpdatedAt = now
+	return nil
 }
 
-// UpdateBalance 更新余额
+// UpdateBalance 更新余额（直接覆盖，同时递增版本号使并发的 CAS 更新失败重试）
 func (r *walletRepository) UpdateBalance(ctx context.Context, userID int64, balance, frozenBalance string) error {
 	return r.db.WithContext(ctx).Model(&models.Wallet{}).
-		Where("user_id = ?", userID).
+		Where("user_id = ? AND asset = ?", userID, models.PricingCurrency).
 		Updates(map[string]interface{}{
 			"balance":        balance,
 			"frozen_balance": frozenBalance,
+			"version":        gorm.Expr("version + 1"),
 		}).Error
 }
 
+// GetAllUserIDs 获取所有钱包的用户ID
+func (r *walletRepository) GetAllUserIDs(ctx context.Context) ([]int64, error) {
+	var userIDs []int64
+	err := r.db.WithContext(ctx).Model(&models.Wallet{}).
+		Where("asset = ?", models.PricingCurrency).
+		Order("user_id ASC").
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
 // Delete 删除钱包
 func (r *walletRepository) Delete(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&models.Wallet{}, id).Error
@@ -83,6 +147,7 @@ func (r *walletRepository) GetOrCreate(ctx context.Context, userID int64) (*mode
 	// 创建新钱包
 	wallet = &models.Wallet{
 		UserID:        userID,
+		Asset:         models.PricingCurrency,
 		Balance:       "0",
 		FrozenBalance: "0",
 		TotalIncome:   "0",
@@ -96,6 +161,46 @@ func (r *walletRepository) GetOrCreate(ctx context.Context, userID int64) (*mode
 	return wallet, nil
 }
 
+// GetOrCreateForUpdate 获取（不存在则创建）钱包并加行锁，需在事务中调用
+func (r *walletRepository) GetOrCreateForUpdate(ctx context.Context, userID int64) (*models.Wallet, error) {
+	// SQLite 不支持行锁（FOR UPDATE 会被忽略），先执行一次空更新拿到写锁，
+	// 避免两个事务都持有读锁后升级写锁时互相等待而直接返回 database is locked
+	if r.db.Dialector.Name() == "sqlite" {
+		if err := r.db.WithContext(ctx).Model(&models.Wallet{}).
+			Where("user_id = ? AND asset = ?", userID, models.PricingCurrency).
+			UpdateColumn("version", gorm.Expr("version")).Error; err != nil {
+			return nil, fmt.Errorf("failed to lock wallet: %w", err)
+		}
+	}
+
+	var wallet models.Wallet
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND asset = ?", userID, models.PricingCurrency).
+		First(&wallet).Error
+	if err == nil {
+		return &wallet, nil
+	}
+
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	wallet = models.Wallet{
+		UserID:        userID,
+		Asset:         models.PricingCurrency,
+		Balance:       "0",
+		FrozenBalance: "0",
+		TotalIncome:   "0",
+		TotalExpense:  "0",
+	}
+	if err := r.db.WithContext(ctx).Create(&wallet).Error; err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+
+	return &wallet, nil
+}
+
 // UpdateBalanceAtomic 原子性更新余额（带乐观锁）
 func (r *walletRepository) UpdateBalanceAtomic(ctx context.Context, userID int64, balanceDelta, frozenDelta string) error {
 	// 使用数据库级别的原子操作来更新余额
@@ -103,7 +208,7 @@ func (r *walletRepository) UpdateBalanceAtomic(ctx context.Context, userID int64
 		// 先锁定记录
 		var wallet models.Wallet
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").
-			Where("user_id = ?", userID).
+			Where("user_id = ? AND asset = ?", userID, models.PricingCurrency).
 			First(&wallet).Error; err != nil {
 			return fmt.Errorf("failed to lock wallet: %w", err)
 		}
@@ -147,7 +252,7 @@ func (r *walletRepository) UpdateBalanceAtomic(ctx context.Context, userID int64
 		wallet.Balance = newBalance.Text('f', 8)
 		wallet.FrozenBalance = newFrozenBalance.Text('f', 8)
 
-		return tx.Save(&wallet).Error
+		return r.WithTx(tx).Update(ctx, &wallet)
 	})
 }
 
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"tg-robot-sim/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// WithdrawalRepository 提现申请仓储接口
+type WithdrawalRepository interface {
+	// WithTx 返回绑定到指定事务的仓储
+	WithTx(tx *gorm.DB) WithdrawalRepository
+	Create(ctx context.Context, withdrawal *models.WithdrawalRequest) error
+	GetByWithdrawalNo(ctx context.Context, withdrawalNo string) (*models.WithdrawalRequest, error)
+	GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.WithdrawalRequest, error)
+	CountByUserID(ctx context.Context, userID int64) (int64, error)
+	// GetByStatus 按状态获取提现申请，status 为空时返回全部
+	GetByStatus(ctx context.Context, status models.WithdrawalStatus, limit, offset int) ([]*models.WithdrawalRequest, error)
+	// GetByUserIDAndStatuses 获取用户指定状态的提现申请，since 非零时只返回该时间之后创建的申请
+	GetByUserIDAndStatuses(ctx context.Context, userID int64, statuses []models.WithdrawalStatus, since time.Time) ([]*models.WithdrawalRequest, error)
+	// UpdateStatusFrom 仅当当前状态为 from 时更新状态及审核信息，返回是否更新成功
+	UpdateStatusFrom(ctx context.Context, withdrawal *models.WithdrawalRequest, from models.WithdrawalStatus) (bool, error)
+}
+
+// withdrawalRepository 提现申请仓储实现
+type withdrawalRepository struct {
+	db *gorm.DB
+}
+
+// NewWithdrawalRepository 创建提现申请仓储实例
+func NewWithdrawalRepository(db *gorm.DB) WithdrawalRepository {
+	return &withdrawalRepository{db: db}
+}
+
+// WithTx 返回绑定到指定事务的仓储
+func (r *withdrawalRepository) WithTx(tx *gorm.DB) WithdrawalRepository {
+	return &withdrawalRepository{db: tx}
+}
+
+// Create 创建提现申请
+func (r *withdrawalRepository) Create(ctx context.Context, withdrawal *models.WithdrawalRequest) error {
+	return r.db.WithContext(ctx).Create(withdrawal).Error
+}
+
+// GetByWithdrawalNo 根据提现单号获取提现申请
+func (r *withdrawalRepository) GetByWithdrawalNo(ctx context.Context, withdrawalNo string) (*models.WithdrawalRequest, error) {
+	var withdrawal models.WithdrawalRequest
+	err := r.db.WithContext(ctx).Where("withdrawal_no = ?", withdrawalNo).First(&withdrawal).Error
+	if err != nil {
+		return nil, err
+	}
+	return &withdrawal, nil
+}
+
+// GetByUserID 获取用户的提现申请
+func (r *withdrawalRepository) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*models.WithdrawalRequest, error) {
+	var withdrawals []*models.WithdrawalRequest
+	query := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&withdrawals).Error
+	return withdrawals, err
+}
+
+// CountByUserID 统计用户的提现申请数量
+func (r *withdrawalRepository) CountByUserID(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.WithdrawalRequest{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetByStatus 按状态获取提现申请，status 为空时返回全部
+func (r *withdrawalRepository) GetByStatus(ctx context.Context, status models.WithdrawalStatus, limit, offset int) ([]*models.WithdrawalRequest, error) {
+	var withdrawals []*models.WithdrawalRequest
+	query := r.db.WithContext(ctx).Order("created_at ASC")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&withdrawals).Error
+	return withdrawals, err
+}
+
+// GetByUserIDAndStatuses 获取用户指定状态的提现申请
+func (r *withdrawalRepository) GetByUserIDAndStatuses(ctx context.Context, userID int64, statuses []models.WithdrawalStatus, since time.Time) ([]*models.WithdrawalRequest, error) {
+	var withdrawals []*models.WithdrawalRequest
+	query := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, statuses)
+
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+
+	err := query.Order("id ASC").Find(&withdrawals).Error
+	return withdrawals, err
+}
+
+// UpdateStatusFrom 仅当当前状态为 from 时更新状态及审核信息
+// 以状态作为条件更新，保证同一申请只会被审核一次
+func (r *withdrawalRepository) UpdateStatusFrom(ctx context.Context, withdrawal *models.WithdrawalRequest, from models.WithdrawalStatus) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.WithdrawalRequest{}).
+		Where("id = ? AND status = ?", withdrawal.ID, from).
+		Updates(map[string]interface{}{
+			"status":        withdrawal.Status,
+			"tx_hash":       withdrawal.TxHash,
+			"reviewer":      withdrawal.Reviewer,
+			"reject_reason": withdrawal.RejectReason,
+			"reviewed_at":   withdrawal.ReviewedAt,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
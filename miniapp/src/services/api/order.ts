@@ -169,6 +169,13 @@ export class OrderApi {
       providerOrderId: backendData.provider_order_id,
       orderItems: backendData.order_items || [],
       esims: backendData.esims || [],
+      events: (backendData.events || []).map((e: any) => ({
+        fromStatus: e.from_status,
+        toStatus: e.to_status,
+        actor: e.actor,
+        reason: e.reason,
+        createdAt: e.created_at
+      })),
       createdAt: backendData.created_at,
       updatedAt: backendData.updated_at,
       completedAt: backendData.completed_at
@@ -8,14 +8,32 @@ export interface USDTRechargeOrder {
   amount: string
   exact_amount: string
   wallet_address: string
+  match_mode?: 'exact_amount' | 'address'
   status: string
   tx_hash: string
+  payment_type?: 'exact' | 'over' | 'under' | 'late'
+  paid_amount?: string
+  payment_uri?: string // 收款 URI（二维码内容）
+  qr_code?: string // 服务端生成的收款二维码（data URI），仅待支付订单返回
   confirmations: number
   expires_at: string
   confirmed_at?: string
   created_at: string
 }
 
+// Telegram Stars 充值发票
+export interface StarsRechargeInvoice {
+  payment_no: string
+  invoice_link: string // 通过 Telegram.WebApp.openInvoice 打开
+  currency: 'XTR'
+  stars: number // 需支付的 Stars 数量
+  amount: string // 到账金额（USD）
+  rate: string // 1 Star 折合的 USD
+  status: string
+  expires_at: string
+  created_at: string
+}
+
 // 充值历史响应接口
 export interface RechargeHistoryResponse {
   orders: Array<{
@@ -88,12 +106,19 @@ export class WalletApi {
     exact_amount: string
     wallet_address: string
     status: string
+    payment_uri?: string
+    qr_code?: string
     expires_at: string
     created_at: string
   }> {
     return apiClient.post('/miniapp/wallet/recharge', data)
   }
 
+  // 创建 Telegram Stars 充值发票
+  async createStarsRecharge(data: { amount: string }): Promise<StarsRechargeInvoice> {
+    return apiClient.post('/miniapp/wallet/recharge/stars', data)
+  }
+
   // 获取充值订单详情
   async getRechargeOrder(orderNo: string): Promise<USDTRechargeOrder> {
     return apiClient.get(`/miniapp/wallet/recharge/${orderNo}`)
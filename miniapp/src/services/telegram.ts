@@ -417,6 +417,17 @@ class TelegramService {
     this.webApp?.openTelegramLink(url)
   }
 
+  // 打开发票（如 Telegram Stars），返回支付结果: paid, cancelled, failed, pending
+  openInvoice(url: string): Promise<string> {
+    return new Promise((resolve) => {
+      if (!this.webApp) {
+        resolve('failed')
+        return
+      }
+      this.webApp.openInvoice(url, (status) => resolve(status))
+    })
+  }
+
   close(): void {
     this.webApp?.close()
   }
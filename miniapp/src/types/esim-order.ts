@@ -54,9 +54,19 @@ export interface EsimDetail {
   status: string
 }
 
-// eSIM 订单详情（完整版本，包含用户ID）
+// 订单状态变更记录
+export interface OrderStatusEvent {
+  fromStatus: EsimOrderStatus | ''
+  toStatus: EsimOrderStatus
+  actor: 'system' | 'sync' | 'webhook' | 'admin' | 'user'
+  reason: string
+  createdAt: string
+}
+
+// eSIM 订单详情（完整版本，包含用户ID和状态时间线）
 export interface EsimOrderDetail extends EsimOrder {
   userId: number
+  events: OrderStatusEvent[]
 }
 
 // 订单查询参数